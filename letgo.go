@@ -24,8 +24,10 @@ import (
 	"github.com/nooga/let-go/pkg/compiler"
 	"github.com/nooga/let-go/pkg/rt"
 	"github.com/nooga/let-go/pkg/vm"
+	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 func motd() {
@@ -52,6 +54,7 @@ func runForm(ctx *compiler.Context, in string) (vm.Value, error) {
 
 func repl(ctx *compiler.Context) {
 	scanner := bufio.NewScanner(os.Stdin)
+	color := rt.UseColor(os.Stdout)
 	prompt := ctx.CurrentNS().Name() + "=> "
 	fmt.Print(prompt)
 	for scanner.Scan() {
@@ -59,9 +62,12 @@ func repl(ctx *compiler.Context) {
 		ctx.SetSource("REPL")
 		val, err := runForm(ctx, in)
 		if err != nil {
-			fmt.Println(err)
+			rt.RecordError(err)
+			rt.FormatError(os.Stdout, err, in, color)
+			fmt.Print(prompt)
 			continue
 		}
+		rt.RecordResult(val)
 		fmt.Println(val.String())
 		fmt.Print(prompt)
 	}
@@ -71,37 +77,119 @@ func repl(ctx *compiler.Context) {
 	}
 }
 
+// evalSource compiles and runs all forms read from r returning the value of the last one
+func evalSource(ctx *compiler.Context, source string, r io.Reader) (vm.Value, error) {
+	ctx.SetSource(source)
+	_, val, err := ctx.CompileMultiple(r)
+	return val, err
+}
+
+// runBytecode loads a program compiled with the compile command and runs it
+func runBytecode(r io.Reader) error {
+	chunk, err := vm.DecodeChunk(r, rt.ResolveVar)
+	if err != nil {
+		return err
+	}
+	_, err = vm.NewFrame(chunk, nil).Run()
+	return err
+}
+
 func runFile(ctx *compiler.Context, filename string) error {
-	ctx.SetSource(filename)
 	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
-	_, _, err = ctx.CompileMultiple(f)
+	if strings.HasSuffix(filename, bytecodeExt) {
+		err = runBytecode(f)
+	} else {
+		_, err = evalSource(ctx, filename, f)
+	}
 	errc := f.Close()
 	if err != nil {
 		return err
 	}
-	if errc != nil {
-		return errc
+	return errc
+}
+
+const bytecodeExt = ".lgc"
+
+// compileFile compiles a source file to bytecode written to out.
+// Like loading it, compiling runs the top level forms because macros defined in the file may be needed to compile the rest.
+func compileFile(ctx *compiler.Context, filename string, out string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx.SetSource(filename)
+	chunk, _, err := ctx.CompileMultiple(f)
+	if err != nil {
+		return err
+	}
+	o, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = vm.EncodeChunk(o, chunk)
+	errc := o.Close()
+	if err != nil {
+		return err
 	}
-	//_, err = vm.NewFrame(chunk, nil).Run()
-	//if err != nil {
-	//	return err
-	//}
-	return nil
+	return errc
+}
+
+// compileCmd implements letgo compile file.lg [-o file.lgc]
+func compileCmd(args []string) int {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := fs.String("o", "", "output file, defaults to the source file with "+bytecodeExt+" extension")
+	var files []string
+	// flags may come after the file name
+	for len(args) > 0 {
+		_ = fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) != 1 {
+		fmt.Println("usage: letgo compile file.lg [-o file" + bytecodeExt + "]")
+		return 2
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(files[0], ".lg") + bytecodeExt
+	}
+	if err := compileFile(initCompiler(), files[0], *out); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
 }
 
 var runREPL bool
 var expr string
+var noCore bool
+var debugPanics bool
 
 func init() {
 	flag.BoolVar(&runREPL, "r", false, "attach REPL after running given files")
 	flag.StringVar(&expr, "e", "", "eval given expression")
+	flag.BoolVar(&noCore, "no-core", false, "start without the standard library, only special forms are available")
+	flag.BoolVar(&debugPanics, "debug", false, "include Go stack traces in errors of natives which panicked")
+}
+
+// splitArgs separates files to run from arguments passed to the program, the two are separated by --
+func splitArgs(all []string) ([]string, []string) {
+	for i := range all {
+		if all[i] == "--" {
+			return all[:i], all[i+1:]
+		}
+	}
+	return all, nil
 }
 
 func initCompiler() *compiler.Context {
-	ns := rt.NS("lang")
+	ns := rt.NS("user")
 	if ns == nil {
 		fmt.Println("namespace not found")
 		return nil
@@ -111,16 +199,26 @@ func initCompiler() *compiler.Context {
 
 func main() {
 	flag.Parse()
-	files := flag.Args()
+	vm.DebugPanics = debugPanics
+	if noCore {
+		_ = rt.InstallOnly()
+	}
+	if flag.Arg(0) == "compile" {
+		os.Exit(compileCmd(flag.Args()[1:]))
+	}
+	files, args := splitArgs(flag.Args())
+	rt.SetCommandLineArgs(args)
 
 	context := initCompiler()
 
 	ranSomething := false
+	failed := false
 	if len(files) >= 1 {
 		for i := range files {
 			err := runFile(context, files[i])
 			if err != nil {
 				fmt.Println(err)
+				failed = true
 				continue
 			}
 		}
@@ -128,10 +226,10 @@ func main() {
 	}
 
 	if expr != "" {
-		context.SetSource("EXPR")
-		val, err := runForm(context, expr)
+		val, err := evalSource(context, "EXPR", strings.NewReader(expr))
 		if err != nil {
 			fmt.Println(err)
+			failed = true
 		} else {
 			fmt.Println(val)
 		}
@@ -142,4 +240,8 @@ func main() {
 		motd()
 		repl(context)
 	}
+
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -19,8 +19,10 @@ package compiler
 
 import (
 	"fmt"
+	"github.com/nooga/let-go/pkg/rt"
 	"github.com/nooga/let-go/pkg/vm"
 	"io"
+	"math"
 	"strings"
 )
 
@@ -38,6 +40,16 @@ type Context struct {
 	isClosure    bool
 	closedOversC int
 	closedOvers  map[vm.Symbol]*closureCell
+	verify       bool
+	loops        []*loopTarget
+	// numeric hints of locals by stack slot and of arguments by index
+	localHints map[int]vm.Symbol
+	argHints   map[int]vm.Symbol
+	// name given by def to the fn being compiled
+	fnName string
+	// name def gives to the next fn form compiled directly as its value
+	pendingFnName string
+	fnLine        int
 }
 
 // FIXME this is unacceptable hax
@@ -62,6 +74,26 @@ func (c *Context) SetSource(source string) *Context {
 	return c
 }
 
+// SetVerify makes the compiler check every chunk it produces with CodeChunk.Verify, this is meant for
+// catching compiler bugs and costs an extra pass over the code
+func (c *Context) SetVerify(verify bool) *Context {
+	c.verify = verify
+	return c
+}
+
+// finishChunk records the stack size the current chunk needs and verifies it if requested
+func (c *Context) finishChunk() error {
+	c.chunk.SetMaxStack(c.spMax)
+	c.chunk.Seal()
+	if !c.verify {
+		return nil
+	}
+	if err := c.chunk.Verify(); err != nil {
+		return NewCompileError("bytecode verification failed").Wrap(err)
+	}
+	return nil
+}
+
 func (c *Context) CurrentNS() *vm.Namespace {
 	return c.ns
 }
@@ -75,11 +107,13 @@ func (c *Context) Compile(s string) (*vm.CodeChunk, error) {
 
 	c.chunk = vm.NewCodeChunk(c.consts)
 	err = c.compileForm(o)
-	c.chunk.SetMaxStack(c.spMax)
 	if err != nil {
 		return nil, err
 	}
 	c.Emit(vm.OPRET)
+	if err = c.finishChunk(); err != nil {
+		return nil, err
+	}
 	c.decSP(1)
 	return c.chunk, nil
 }
@@ -97,6 +131,9 @@ func (c *Context) CompileMultiple(reader io.Reader) (*vm.CodeChunk, vm.Value, er
 			}
 			return nil, result, err
 		}
+		if o.Type() == vm.VoidType {
+			continue
+		}
 		if compiledForms > 0 {
 			chunk.Append(vm.OPPOP)
 		}
@@ -109,7 +146,11 @@ func (c *Context) CompileMultiple(reader io.Reader) (*vm.CodeChunk, vm.Value, er
 		}
 		chunk.AppendChunk(formchunk)
 
+		// the form is run on its own so it gets a RET which isn't part of the combined chunk
 		formchunk.Append(vm.OPRET)
+		if err = c.finishChunk(); err != nil {
+			return nil, result, err
+		}
 		f := vm.NewFrame(formchunk, nil)
 		result, err = f.Run()
 		if err != nil {
@@ -121,6 +162,12 @@ func (c *Context) CompileMultiple(reader io.Reader) (*vm.CodeChunk, vm.Value, er
 	c.chunk = chunk
 
 	c.Emit(vm.OPRET)
+	c.chunk.Seal()
+	if c.verify {
+		if err := c.chunk.Verify(); err != nil {
+			return nil, result, NewCompileError("bytecode verification failed").Wrap(err)
+		}
+	}
 	c.decSP(1)
 	return c.chunk, result, nil
 }
@@ -136,7 +183,7 @@ func (c *Context) EmitWithArg(op uint8, arg int) {
 
 func (c *Context) Constant(v vm.Value) int {
 	for i := range *c.consts {
-		if (*c.consts)[i] == v {
+		if sameConstant((*c.consts)[i], v) {
 			return i
 		}
 	}
@@ -144,6 +191,17 @@ func (c *Context) Constant(v vm.Value) int {
 	return len(*c.consts) - 1
 }
 
+// sameConstant tells whether the pooled constant k can be loaded in place of v.
+// Floats are compared by their bits since -0.0 equals 0.0 but isn't interchangeable with it.
+// Anything else is shared only when identical, so equal collection literals stay distinct objects.
+func sameConstant(k vm.Value, v vm.Value) bool {
+	if kf, ok := k.(vm.Float); ok {
+		vf, ok := v.(vm.Float)
+		return ok && math.Float64bits(float64(kf)) == math.Float64bits(float64(vf))
+	}
+	return vm.Identical(k, v)
+}
+
 func (c *Context) Arg(v vm.Symbol) int {
 	n, ok := c.formalArgs[v]
 	if !ok {
@@ -163,11 +221,13 @@ func (c *Context) EnterFn(args []vm.Value) (*Context, error) {
 		formalArgs:  make(map[vm.Symbol]int),
 		locals:      []map[vm.Symbol]int{},
 		closedOvers: make(map[vm.Symbol]*closureCell),
+		verify:      c.verify,
+		argHints:    make(map[int]vm.Symbol),
 	}
 
 	for i := range args {
 		a := args[i]
-		s, ok := a.(vm.Symbol)
+		s, hint, ok := bindingName(a)
 		if !ok {
 			return nil, NewCompileError("all fn formal arguments must be symbols")
 		}
@@ -185,6 +245,9 @@ func (c *Context) EnterFn(args []vm.Value) (*Context, error) {
 			i = i - 1
 		}
 		fc.formalArgs[s] = i
+		if hint != "" {
+			fc.argHints[i] = hint
+		}
 	}
 	return fc, nil
 }
@@ -192,7 +255,11 @@ func (c *Context) EnterFn(args []vm.Value) (*Context, error) {
 func (c *Context) LeaveFn(ctx *Context) {
 	fnchunk := ctx.chunk
 	fnchunk.SetMaxStack(ctx.spMax)
-	f := vm.MakeFunc(len(ctx.formalArgs), ctx.variadric, fnchunk)
+	fnchunk.Seal()
+	f := vm.MakeFunc(len(ctx.formalArgs), ctx.variadric, fnchunk).SetClosedOversCount(len(ctx.closedOvers)).SetLine(ctx.fnLine)
+	if ctx.fnName != "" {
+		f = f.WithName(ctx.fnName)
+	}
 
 	n := c.Constant(f)
 	c.EmitWithArg(vm.OPLDC, n)
@@ -200,9 +267,16 @@ func (c *Context) LeaveFn(ctx *Context) {
 
 	// if we have a closure on our hands then add closed overs
 	if ctx.isClosure {
+		c.Emit(vm.OPMKC)
+		// closed overs have to be packed in the order of their indices
+		cells := make([]*closureCell, len(ctx.closedOvers))
 		for _, clo := range ctx.closedOvers {
+			cells[clo.closure] = clo
+		}
+		for _, clo := range cells {
 			_ = clo.source().emit()
 			c.Emit(vm.OPPAK)
+			c.decSP(1)
 		}
 	}
 }
@@ -248,8 +322,14 @@ func (c *Context) symbolLookup(s vm.Symbol) cell {
 }
 
 func (c *Context) compileForm(o vm.Value) error {
+	// vars put in forms by the compiler itself evaluate to themselves, see langCall
+	if v, ok := o.(*vm.Var); ok {
+		c.EmitWithArg(vm.OPLDC, c.Constant(v))
+		c.incSP(1)
+		return nil
+	}
 	switch o.Type() {
-	case vm.IntType, vm.StringType, vm.NilType, vm.BooleanType, vm.KeywordType, vm.CharType, vm.VoidType:
+	case vm.IntType, vm.FloatType, vm.StringType, vm.NilType, vm.BooleanType, vm.KeywordType, vm.CharType, vm.VoidType, vm.RegexType:
 		n := c.Constant(o)
 		c.EmitWithArg(vm.OPLDC, n)
 		c.incSP(1)
@@ -259,69 +339,265 @@ func (c *Context) compileForm(o vm.Value) error {
 			return cel.emit()
 		}
 		// if symbol not found so far then we have a free variable on our hands
-		varn := c.Constant(c.ns.LookupOrAdd(o.(vm.Symbol)))
+		v, err := c.lookupVar(o.(vm.Symbol))
+		if err != nil {
+			return err
+		}
+		varn := c.Constant(v)
 		c.EmitWithArg(vm.OPLDC, varn)
 		c.Emit(vm.OPLDV)
 		c.incSP(1)
-	case vm.ArrayVectorType:
-		v := o.(vm.ArrayVector)
-		// FIXME detect const vectors and push them like this
-		if len(v) == 0 {
-			n := c.Constant(v)
-			c.EmitWithArg(vm.OPLDC, n)
-			c.incSP(1)
-			return nil
+	case vm.ArrayVectorType, vm.PersistentVectorType:
+		return c.compileVectorLiteral(o)
+	case vm.MapType:
+		return c.compileCollectionLiteral(o, "hash-map")
+	case vm.SetType:
+		return c.compileCollectionLiteral(o, "hash-set")
+	case vm.ListType:
+		return c.locate(c.compileList(o.(*vm.List)), o)
+	case hintedSymbolType:
+		return c.compileForm(o.(*hintedSymbol).sym)
+	}
+	return nil
+}
+
+// compileVectorLiteral compiles a vector literal, constant ones are loaded as they are
+// and others have their elements evaluated in order and collected with VEC
+func (c *Context) compileVectorLiteral(o vm.Value) error {
+	if isConstantForm(o) {
+		n := c.Constant(o)
+		c.EmitWithArg(vm.OPLDC, n)
+		c.incSP(1)
+		return nil
+	}
+	elems := o.Unbox().([]vm.Value)
+	for i := range elems {
+		if err := c.compileForm(elems[i]); err != nil {
+			return NewCompileError("compiling vector elements").Wrap(err)
 		}
-		vector := c.Constant(c.ns.LookupOrAdd("vector"))
-		c.EmitWithArg(vm.OPLDC, vector)
+	}
+	c.EmitWithArg(vm.OPVEC, len(elems))
+	c.decSP(len(elems) - 1)
+	return nil
+}
+
+// compileCollectionLiteral compiles a map or set literal, constant ones are loaded as they are
+// and others are built by calling the lang constructor with their evaluated elements
+func (c *Context) compileCollectionLiteral(o vm.Value, constructor vm.Symbol) error {
+	if isConstantForm(o) {
+		n := c.Constant(o)
+		c.EmitWithArg(vm.OPLDC, n)
 		c.incSP(1)
-		for i := range v {
-			err := c.compileForm(v[i])
-			if err != nil {
-				return NewCompileError("compiling vector elements").Wrap(err)
-			}
+		return nil
+	}
+	entries, err := vm.AppendElements(nil, o)
+	if err != nil {
+		return err
+	}
+	var elems []vm.Value
+	for _, e := range entries {
+		if kv, ok := e.(vm.MapEntry); ok {
+			elems = append(elems, kv.Key(), kv.Val())
+			continue
 		}
-		c.EmitWithArg(vm.OPINV, len(v))
-		c.decSP(len(v) + 1)
-	case vm.ListType:
-		fn := o.(*vm.List).First()
-		// check if we're looking at a special form
-		if fn.Type() == vm.SymbolType {
-			formCompiler, ok := specialForms[fn.(vm.Symbol)]
-			if ok {
-				return formCompiler(c, o)
-			}
+		elems = append(elems, e)
+	}
+	fn := c.Constant(rt.Stdlib("lang").Lookup(constructor))
+	c.EmitWithArg(vm.OPLDC, fn)
+	c.incSP(1)
+	for i := range elems {
+		if err := c.compileForm(elems[i]); err != nil {
+			return NewCompileError("compiling " + string(constructor) + " literal").Wrap(err)
+		}
+	}
+	c.EmitWithArg(vm.OPINV, len(elems))
+	c.decSP(len(elems))
+	return nil
+}
 
-			fvar, ok := c.ns.Lookup(fn.(vm.Symbol)).(*vm.Var)
-			if ok && fvar.IsMacro() {
-				argvec := o.(*vm.List).Next().(*vm.List).Unbox().([]vm.Value)
-				newform := fvar.Invoke(argvec)
-				return c.compileForm(newform)
+// isConstantForm tells if form evaluates to itself, like literals and collections of them
+func isConstantForm(form vm.Value) bool {
+	switch f := form.(type) {
+	case vm.Int, vm.Float, vm.String, *vm.Nil, vm.Boolean, vm.Keyword, vm.Char:
+		return true
+	case vm.ArrayVector, *vm.PersistentVector, *vm.Map, *vm.Set:
+		elems, err := vm.AppendElements(nil, f)
+		if err != nil {
+			return false
+		}
+		for _, e := range elems {
+			if !isConstantForm(e) {
+				return false
 			}
 		}
+		return true
+	case vm.MapEntry:
+		return isConstantForm(f.Key()) && isConstantForm(f.Val())
+	}
+	return false
+}
 
-		// treat as function invocation if this is not a special form
-		err := c.compileForm(fn)
+// compileList compiles special forms, macro calls and function invocations
+func (c *Context) compileList(o *vm.List) error {
+	fn := o.First()
+	// check if we're looking at a special form
+	if fn.Type() == vm.SymbolType {
+		formCompiler, ok := specialForms[fn.(vm.Symbol)]
+		if ok {
+			return formCompiler(c, o)
+		}
+
+		newform, expanded, err := c.MacroExpand1(o)
 		if err != nil {
-			return NewCompileError("compiling function position").Wrap(err)
+			return err
+		}
+		if expanded {
+			return c.compileForm(newform)
 		}
+	}
 
-		args := o.(*vm.List).Next()
-		argc := args.(vm.Collection).Count().Unbox().(int)
-		for args != vm.EmptyList {
-			err := c.compileForm(args.First())
-			if err != nil {
-				return NewCompileError("compiling arguments").Wrap(err)
-			}
-			args = args.Next()
+	if ok, err := c.compileHintedCall(o); ok {
+		return err
+	}
+
+	if ok, err := c.compileInlineOp(o); ok {
+		return err
+	}
+
+	if c.isApply(fn) && o.Count().(vm.Int) > 2 {
+		return c.compileApply(o)
+	}
+
+	// treat as function invocation if this is not a special form
+	err := c.compileForm(fn)
+	if err != nil {
+		return NewCompileError("compiling function position").Wrap(err)
+	}
+
+	args := o.Rest()
+	argc := args.(vm.Collection).Count().Unbox().(int)
+	for args != vm.EmptyList {
+		err := c.compileForm(args.First())
+		if err != nil {
+			return NewCompileError("compiling arguments").Wrap(err)
 		}
+		args = args.Rest()
+	}
+
+	c.EmitWithArg(vm.OPINV, argc)
+	c.decSP(argc)
+	return nil
+}
 
-		c.EmitWithArg(vm.OPINV, argc)
-		c.decSP(argc)
+// isApply tells whether fn refers to lang/apply and wasn't shadowed by a local
+func (c *Context) isApply(fn vm.Value) bool {
+	s, ok := fn.(vm.Symbol)
+	if !ok || c.symbolLookup(s) != nil {
+		return false
 	}
+	lang := rt.NS("lang")
+	return lang != nil && c.findVar(s) != nil && c.findVar(s) == lang.Lookup("apply")
+}
+
+// compileApply compiles (apply f args... coll) to the APP instruction which spreads coll
+// without going through the apply native
+func (c *Context) compileApply(form *vm.List) error {
+	args := form.Rest()
+	argc := args.(vm.Collection).Count().Unbox().(int)
+	for ; args != vm.EmptyList; args = args.Rest() {
+		err := c.compileForm(args.First())
+		if err != nil {
+			return NewCompileError("compiling apply arguments").Wrap(err)
+		}
+	}
+	c.EmitWithArg(vm.OPAPP, argc-1)
+	c.decSP(argc - 1)
 	return nil
 }
 
+// MacroExpand1 expands form once if it's a call to a macro, the second return value tells whether
+// any expansion took place. Special forms and ordinary calls are returned unchanged.
+func (c *Context) MacroExpand1(form vm.Value) (vm.Value, bool, error) {
+	l, ok := form.(*vm.List)
+	if !ok || l.Count().(vm.Int) == 0 {
+		return form, false, nil
+	}
+	s, ok := l.First().(vm.Symbol)
+	if !ok {
+		return form, false, nil
+	}
+	if _, special := specialForms[s]; special {
+		return form, false, nil
+	}
+	// locals shadow macros
+	if c.symbolLookup(s) != nil {
+		return form, false, nil
+	}
+	fvar := c.findVar(s)
+	if fvar == nil || !fvar.IsMacro() {
+		return form, false, nil
+	}
+	argvec := l.Rest().(*vm.List).Unbox().([]vm.Value)
+	newform, err := fvar.Invoke(argvec)
+	if err != nil {
+		return vm.NIL, false, NewCompileError("expanding macro").Wrap(err)
+	}
+	// like Clojure, carry the source position of the call over to an expansion which is a call too
+	if m, ok := newform.(*vm.List); ok && m.Meta() == vm.NIL && l.Meta() != vm.NIL {
+		newform = m.WithMeta(l.Meta())
+	}
+	return newform, true, nil
+}
+
+// MacroExpand repeatedly expands form until it's no longer a macro call
+func (c *Context) MacroExpand(form vm.Value) (vm.Value, error) {
+	for {
+		newform, expanded, err := c.MacroExpand1(form)
+		if err != nil || !expanded {
+			return newform, err
+		}
+		form = newform
+	}
+}
+
+// findVar resolves a symbol to an existing Var, qualified symbols like math/sqrt are looked up in their namespace.
+// Returns nil if there is no such Var.
+func (c *Context) findVar(s vm.Symbol) *vm.Var {
+	ns := c.ns
+	nsName, name := s.Namespaced()
+	if nsName != "" {
+		ns = rt.NS(nsName)
+		if ns == nil {
+			return nil
+		}
+	}
+	v, ok := ns.Lookup(vm.Symbol(name)).(*vm.Var)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// lookupVar resolves a symbol to an existing Var, unresolved symbols are reported with a suggestion when
+// there is a similarly named var in the namespace.
+func (c *Context) lookupVar(s vm.Symbol) (*vm.Var, error) {
+	if v := c.findVar(s); v != nil {
+		return v, nil
+	}
+	nsName, _ := s.Namespaced()
+	if nsName == "" {
+		msg := fmt.Sprintf("unable to resolve symbol: %s", s)
+		if sug := suggestSymbol(s, c.ns.Symbols()); sug != "" {
+			msg += fmt.Sprintf(", did you mean %s?", sug)
+		}
+		return nil, NewCompileError(msg)
+	}
+	if rt.NS(nsName) == nil {
+		return nil, NewCompileError(fmt.Sprintf("no such namespace: %s", nsName))
+	}
+	return nil, NewCompileError(fmt.Sprintf("no such var: %s", s))
+}
+
 func (c *Context) EmitWithArgPlaceholder(inst uint8) int {
 	placeholder := c.CurrentAddress()
 	c.EmitWithArg(inst, 0)
@@ -385,44 +661,50 @@ func compilerInit() {
 		"quote": quoteCompiler,
 		"var":   varCompiler,
 		"let":   letCompiler,
+		"try":   tryCompiler,
+		"loop":  loopCompiler,
+		"recur": recurCompiler,
+		"refer": referCompiler,
+
+		"breakpoint": breakpointCompiler,
 	}
 }
 
 func letCompiler(c *Context, form vm.Value) error {
-	bindings := form.(*vm.List).Next()
+	bindings := form.(*vm.List).Rest()
 	binds, ok := bindings.First().(vm.ArrayVector)
 	if !ok {
 		return NewCompileError("let bindings should be a vector")
 	}
-	body := bindings.Next()
+	binds, err := destructure(binds)
+	if err != nil {
+		return NewCompileError("compiling let bindings").Wrap(err)
+	}
+	body := bindings.Rest()
 	c.pushLocals()
 	bindn := 0
 	for i := 0; i < len(binds); i += 2 {
 		name := binds[i]
-		if name.Type() != vm.SymbolType {
-			return NewCompileError("let binding name must be a symbol")
-		}
-		if i+1 >= len(binds) {
-			return NewCompileError("let bindings must have even number of forms")
-		}
 		value := binds[i+1]
 		err := c.compileForm(value)
 		if err != nil {
 			return NewCompileError("compiling let binding").Wrap(err)
 		}
-		c.addLocal(name.(vm.Symbol))
+		if err := c.bindLocal(name, value); err != nil {
+			return err
+		}
 		bindn++
 	}
 	if body == vm.EmptyList {
 		c.EmitWithArg(vm.OPLDC, c.Constant(vm.NIL))
 		c.incSP(1)
 	} else {
-		for b := body; b != vm.EmptyList; b = b.Next() {
+		for b := body; b != vm.EmptyList; b = b.Rest() {
 			err := c.compileForm(b.First())
 			if err != nil {
 				return NewCompileError("compiling let body").Wrap(err)
 			}
-			if b.Next() != vm.EmptyList {
+			if b.Rest() != vm.EmptyList {
 				c.Emit(vm.OPPOP)
 				c.decSP(1)
 			}
@@ -435,14 +717,15 @@ func letCompiler(c *Context, form vm.Value) error {
 }
 
 func quoteCompiler(c *Context, form vm.Value) error {
-	n := c.Constant(form.(vm.Seq).Next().First())
+	quoted, _ := stripHints(form.(vm.Seq).Rest().First())
+	n := c.Constant(quoted)
 	c.EmitWithArg(vm.OPLDC, n)
 	c.incSP(1)
 	return nil
 }
 
 func fnCompiler(c *Context, form vm.Value) error {
-	f := form.(*vm.List).Next()
+	f := form.(*vm.List).Rest()
 
 	args := f.First().(vm.ArrayVector).Unbox().([]vm.Value)
 
@@ -450,15 +733,17 @@ func fnCompiler(c *Context, form vm.Value) error {
 	if err != nil {
 		return NewCompileError("compiling fn args").Wrap(err)
 	}
+	fc.fnName, c.pendingFnName = c.pendingFnName, ""
+	fc.fnLine, _ = formPosition(form)
 	defer c.LeaveFn(fc)
 
-	body := f.(*vm.List).Next().Unbox().([]vm.Value)
+	body := fnLoop(args, conditions(f.(*vm.List).Rest().Unbox().([]vm.Value)))
 	l := len(body)
 	if l == 0 {
 		fc.EmitWithArg(vm.OPLDC, fc.Constant(vm.NIL))
 		fc.incSP(1)
 		fc.Emit(vm.OPRET)
-		return nil
+		return fc.finishChunk()
 	}
 	for i := range body {
 		err := fc.compileForm(body[i])
@@ -472,11 +757,54 @@ func fnCompiler(c *Context, form vm.Value) error {
 	}
 	fc.Emit(vm.OPRET)
 
-	return nil
+	return fc.finishChunk()
+}
+
+// conditions rewrites a fn body starting with a {:pre [...] :post [...]} map into plain forms which check
+// preconditions on entry and postconditions with % bound to the result before returning it.
+// Like in Clojure a lone map is the return value, not a condition map.
+func conditions(body []vm.Value) []vm.Value {
+	if len(body) < 2 {
+		return body
+	}
+	m, ok := body[0].(*vm.Map)
+	if !ok {
+		return body
+	}
+	pre, _ := m.ValueAt(vm.Keyword("pre")).(vm.ArrayVector)
+	post, _ := m.ValueAt(vm.Keyword("post")).(vm.ArrayVector)
+	if pre == nil && post == nil {
+		return body
+	}
+	out := make([]vm.Value, 0, len(pre)+1)
+	for i := range pre {
+		out = append(out, assertion(pre[i]))
+	}
+	if post == nil {
+		return append(out, body[1:]...)
+	}
+	ret := vm.Symbol("%")
+	check := []vm.Value{vm.Symbol("let"), vm.ArrayVector{ret, vm.NewList(append([]vm.Value{vm.Symbol("do")}, body[1:]...))}}
+	for i := range post {
+		check = append(check, assertion(post[i]))
+	}
+	return append(out, vm.NewList(append(check, ret)))
+}
+
+// assertion makes a form throwing when cond is falsy, the message includes the condition as written
+func assertion(cond vm.Value) vm.Value {
+	msg := vm.String(fmt.Sprintf("Assert failed: %s", cond))
+	return vm.NewList([]vm.Value{vm.Symbol("if"), cond, vm.NIL, langCall("throw", msg)})
+}
+
+// langCall makes a form calling the function name of lang. The form holds the var itself so the call works
+// even when lang isn't installed or name means something else in the namespace being compiled.
+func langCall(name vm.Symbol, args ...vm.Value) vm.Value {
+	return vm.NewList(append([]vm.Value{rt.Stdlib("lang").Lookup(name)}, args...))
 }
 
 func ifCompiler(c *Context, form vm.Value) error {
-	args := form.(*vm.List).Next().Unbox().([]vm.Value)
+	args := form.(*vm.List).Rest().Unbox().([]vm.Value)
 	l := len(args)
 	if l < 2 || l > 3 {
 		return NewCompileError(fmt.Sprintf("if: wrong number of forms (%d), need 2 or 3", l))
@@ -487,12 +815,16 @@ func ifCompiler(c *Context, form vm.Value) error {
 		return NewCompileError("compiling if condition").Wrap(err)
 	}
 	elseJumpStart := c.EmitWithArgPlaceholder(vm.OPBRF)
+	// BRF pops the condition
+	c.decSP(1)
 	// compile then branch
 	err = c.compileForm(args[1])
 	if err != nil {
 		return NewCompileError("compiling if then branch").Wrap(err)
 	}
 	finJumpStart := c.EmitWithArgPlaceholder(vm.OPJMP)
+	// only one branch runs so the else branch starts from the same stack depth as the then branch
+	c.decSP(1)
 	elseJumpEnd := c.CurrentAddress()
 	c.UpdatePlaceholderArg(elseJumpStart, elseJumpEnd-elseJumpStart)
 	if l == 3 {
@@ -510,7 +842,7 @@ func ifCompiler(c *Context, form vm.Value) error {
 }
 
 func doCompiler(c *Context, form vm.Value) error {
-	args := form.(*vm.List).Next().Unbox().([]vm.Value)
+	args := form.(*vm.List).Rest().Unbox().([]vm.Value)
 	l := len(args)
 	if l == 0 {
 		c.EmitWithArg(vm.OPLDC, c.Constant(vm.NIL))
@@ -530,21 +862,31 @@ func doCompiler(c *Context, form vm.Value) error {
 	return nil
 }
 
+// defCompiler compiles (def sym val), (def sym) interns the var without changing its root
 func defCompiler(c *Context, form vm.Value) error {
-	args := form.(*vm.List).Next().Unbox().([]vm.Value)
+	args := form.(*vm.List).Rest().Unbox().([]vm.Value)
 	l := len(args)
-	if l != 2 {
-		return NewCompileError(fmt.Sprintf("def: wrong number of forms (%d), need 2", l))
+	if l != 1 && l != 2 {
+		return NewCompileError(fmt.Sprintf("def: wrong number of forms (%d), need 1 or 2", l))
 	}
 	sym := args[0]
-	val := args[1]
+	if h, ok := sym.(*hintedSymbol); ok {
+		sym = h.sym
+	}
 	if sym.Type() != vm.SymbolType {
 		return NewCompileError(fmt.Sprintf("def: first argument must be a symbol, got (%v)", sym))
 	}
 	varr := c.Constant(c.ns.LookupOrAdd(sym.(vm.Symbol)))
 	c.EmitWithArg(vm.OPLDC, varr)
 	c.incSP(1)
-	err := c.compileForm(val)
+	if l == 1 {
+		return nil
+	}
+	if fn, ok := args[1].(*vm.List); ok && fn.First() == vm.Symbol("fn") {
+		c.pendingFnName = c.ns.Name() + "/" + string(sym.(vm.Symbol))
+	}
+	err := c.compileForm(args[1])
+	c.pendingFnName = ""
 	if err != nil {
 		return NewCompileError("compiling def value").Wrap(err)
 	}
@@ -553,9 +895,72 @@ func defCompiler(c *Context, form vm.Value) error {
 	return nil
 }
 
+// tryCompiler rewrites (try body... (catch Class e handler...) (finally cleanup...)) into a call to lang/try*
+// passing the body, the handler and the cleanup as functions.
+// The exception class in catch is not checked, a catch clause handles every error.
+func tryCompiler(c *Context, form vm.Value) error {
+	forms := form.(*vm.List).Rest().(*vm.List).Unbox().([]vm.Value)
+	var body []vm.Value
+	var catch, finally vm.Value = vm.NIL, vm.NIL
+	for i := range forms {
+		clause, ok := forms[i].(*vm.List)
+		head := vm.Value(vm.NIL)
+		if ok {
+			head = clause.First()
+		}
+		switch head {
+		case vm.Symbol("catch"):
+			args := clause.Unbox().([]vm.Value)
+			if catch != vm.NIL || finally != vm.NIL {
+				return NewCompileError("try: only one catch clause allowed, before finally")
+			}
+			if len(args) < 3 || args[2].Type() != vm.SymbolType {
+				return NewCompileError("try: catch needs an exception class and a symbol to bind")
+			}
+			catch = vm.NewList(append([]vm.Value{vm.Symbol("fn"), vm.ArrayVector{args[2]}}, args[3:]...))
+		case vm.Symbol("finally"):
+			if finally != vm.NIL {
+				return NewCompileError("try: only one finally clause allowed")
+			}
+			args := clause.Unbox().([]vm.Value)
+			finally = vm.NewList(append([]vm.Value{vm.Symbol("fn"), vm.ArrayVector{}}, args[1:]...))
+		default:
+			if catch != vm.NIL || finally != vm.NIL {
+				return NewCompileError("try: body forms must come before catch and finally")
+			}
+			body = append(body, forms[i])
+		}
+	}
+	thunk := vm.NewList(append([]vm.Value{vm.Symbol("fn"), vm.ArrayVector{}}, body...))
+	return c.compileForm(langCall("try*", thunk, catch, finally))
+}
+
+// referCompiler rewrites (refer 'ns...) into a call to lang/refer* passing the namespace being compiled,
+// so vars of the referred namespaces resolve unqualified in the forms that follow
+func referCompiler(c *Context, form vm.Value) error {
+	args := form.(*vm.List).Rest().(*vm.List).Unbox().([]vm.Value)
+	if len(args) == 0 {
+		return NewCompileError("refer: need at least one namespace")
+	}
+	here := vm.NewList([]vm.Value{vm.Symbol("quote"), vm.Symbol(c.ns.Name())})
+	return c.compileForm(langCall("refer*", append([]vm.Value{here}, args...)...))
+}
+
+// varCompiler compiles (var sym) to the Var itself loaded as a constant, without dereferencing it
 func varCompiler(c *Context, form vm.Value) error {
-	sym := form.(*vm.List).Next().First().(vm.Symbol)
-	varr := c.Constant(c.ns.LookupOrAdd(sym))
+	l := form.(*vm.List)
+	if n := l.Count().(vm.Int); n != 2 {
+		return NewCompileError(fmt.Sprintf("var: wrong number of forms (%d), need 1", n-1))
+	}
+	sym, ok := l.Rest().First().(vm.Symbol)
+	if !ok {
+		return NewCompileError(fmt.Sprintf("var: argument must be a symbol, got (%v)", l.Rest().First()))
+	}
+	v := c.findVar(sym)
+	if v == nil {
+		return NewCompileError(fmt.Sprintf("unable to resolve var: %s in this context", sym))
+	}
+	varr := c.Constant(v)
 	c.EmitWithArg(vm.OPLDC, varr)
 	c.incSP(1)
 	return nil
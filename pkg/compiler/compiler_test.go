@@ -18,11 +18,19 @@
 package compiler
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/nooga/let-go/pkg/rt"
 	"github.com/nooga/let-go/pkg/vm"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"math"
+	"os"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestContext_Compile(t *testing.T) {
@@ -47,6 +55,128 @@ func TestContext_Compile(t *testing.T) {
 		`[1 2 (+ 1 2)]`:                         []vm.Value{vm.Int(1), vm.Int(2), vm.Int(3)},
 		`'foo`:                                  "foo",
 		`(quote foo)`:                           "foo",
+		`(= '(1 2 3) [1 2 3])`:                  true,
+		`(= '[1 [2 3]] '(1 (2 3)))`:             true,
+		`(= [1 2 3] '(1 2))`:                    false,
+		`(= (hash-map 1 2) [1 2])`:              false,
+		`(= (hash-map :a 1 :b 2) (hash-map :b 2 :a 1))`: true,
+		`(= (hash-set 1 2 3) (hash-set 3 2 1))`:         true,
+		`(compare '(1 2) [1 3])`:                        -1,
+		`(compare [1 2 3] [9 9])`:                       1,
+		`(= 1 1)`:                                       true,
+		`(= 1 1.0)`:                                     false,
+		`(== 1 1.0)`:                                    true,
+		`(== 2 1.0)`:                                    false,
+		`(+ 1 2.5)`:                                     3.5,
+		`(/ 10 4)`:                                      2.5,
+		`(/ 10 5)`:                                      2,
+		`[(/ 4 2) (/ 12 2 3) (/ 1 2) (/ 4.0 2) (/ 8)]`: []vm.Value{vm.Int(2), vm.Int(2), vm.Float(0.5), vm.Float(2), vm.Float(0.125)},
+		`(bit-and 0xFF 0x0F)`:                          0x0F,
+		`(bit-and 0xFF 0x3C 0x0F)`:                     0x0C,
+		`(bit-or 1 2 4)`:                               7,
+		`(bit-xor 5 3)`:                                6,
+		`(bit-not 0)`:                                  -1,
+		`(bit-shift-left 1 63)`:                        -1 << 63,
+		`(bit-shift-left 3 62)`:                        -1 << 62,
+		`(bit-shift-right -16 2)`:                      -4,
+		`(bit-shift-right -1 63)`:                      -1,
+		`(unsigned-bit-shift-right -1 60)`:             0xF,
+		`(unsigned-bit-shift-right -16 2)`:             int(^uint(0)>>2) - 3,
+		`(math/sqrt 16)`:                               4.0,
+		`(math/pow 2 10)`:                              1024.0,
+		`(math/floor -1.5)`:                            -2.0,
+		`(math/ceil 1.2)`:                              2.0,
+		`(math/round 2.5)`:                             3,
+		`(math/round -2.5)`:                            -3,
+		`(math/sin 0)`:                                 0.0,
+		`(math/cos 0)`:                                 1.0,
+		`(= (binding [*rng* (make-rng 7)] (list (rand) (rand-int 100) (shuffle '[1 2 3 4])))
+		    (binding [*rng* (make-rng 7)] (list (rand) (rand-int 100) (shuffle '[1 2 3 4]))))`: true,
+		`(let [t (time/now)] (= t (time/parse time/RFC3339Nano (time/format t time/RFC3339Nano))))`:              true,
+		`(time/format (time/parse time/RFC3339 "2021-03-04T05:06:07Z") time/Kitchen)`:                            "5:06AM",
+		`(time/between (time/from-unix-millis 0) (time/plus (time/from-unix-millis 0) 1500))`:                    1500,
+		`(time/unix-millis (time/from-unix-millis 42))`:                                                          42,
+		`(compare (time/from-unix-millis 1) (time/from-unix-millis 0))`:                                          1,
+		`(let [a (list 1 2) b (list 1 2)] (list (= a b) (identical? a b) (identical? a a)))`:                     []vm.Value{vm.TRUE, vm.FALSE, vm.TRUE},
+		`(list (identical? [1 2] [1 2]) (identical? {:a 1} {:a 1}) (identical? #{1} #{1}))`:                      []vm.Value{vm.FALSE, vm.FALSE, vm.FALSE},
+		`(let [f (fn [] [1 2])] (identical? (f) (f)))`:                                                           true,
+		`(let [a (vector 1 2) b (vector 1 2)] (list (= a b) (identical? a b)))`:                                  []vm.Value{vm.TRUE, vm.FALSE},
+		`(= (list* 1 2 [3 4]) '(1 2 3 4))`:                                                                       true,
+		`(= (list* [1 2]) '(1 2))`:                                                                               true,
+		`(= (list* 0 '(1)) '(0 1))`:                                                                              true,
+		`(list* nil)`:                                                                                            nil,
+		`(list* [])`:                                                                                             nil,
+		`(= [1 [2 3]] (vector 1 (vector 2 3)))`:                                                                  true,
+		`(let [[a [b c] & more :as all] '(1 (2 3) 4 5)] (= (list a b c more all) '(1 2 3 (4 5) (1 (2 3) 4 5))))`: true,
+		`(let [[a b] nil] (list a b))`:                                                                           []vm.Value{vm.NIL, vm.NIL},
+		`(let [[x y] [1 2] nth 5] (list x y nth))`:                                                               []vm.Value{vm.Int(1), vm.Int(2), vm.Int(5)},
+		`(when-first [[a b] [[1 2] 3]] (+ a b))`:                                                                 3,
+		`(when-first [x []] 1)`:                                                                                  nil,
+		`(let [f (fn [x] (fn [] x))] (list ((f 1)) ((f 2))))`:                                                    []vm.Value{vm.Int(1), vm.Int(2)},
+		`(let [a 1 b 2 c 3] ((fn [] (list c a b))))`:                                                             []vm.Value{vm.Int(3), vm.Int(1), vm.Int(2)},
+		`(nth '(1 2 3) 1)`:                                                                                       2,
+		`(nth [1] 5 :nope)`:                                                                                      "nope",
+		`(nthnext [1 2 3] 2)`:                                                                                    []vm.Value{vm.Int(3)},
+		`(seq [])`:                                                                                               nil,
+		`(condp = 2 1 :one 2 :two :many)`:                                                                        "two",
+		`(condp = 5 1 :one 2 :two :many)`:                                                                        "many",
+		`(condp (fn [a b] (if (= a b) (* b 10) nil)) 3 1 :>> inc 3 :>> inc)`:                                     31,
+		`(condp (fn [a b] (if (= a b) (* b 10) nil)) 4 1 :>> inc :default)`:                                      "default",
+		`(str 1 "a" nil :k \c)`:                                                                                  "1a:kc",
+		`(nth "héllo" 1)`:                                                                                        'é',
+		`(nth "日本語" 2)`:                                                                                          '語',
+		`(count "héllo")`:                                                                                        5,
+		`(count "")`:                                                                                             0,
+		`(get "héllo" 4)`:                                                                                        'o',
+		`(get "héllo" 5 :nf)`:                                                                                    "nf",
+		`(= (seq "hé") (list \h \é))`:                                                                            true,
+		`(seq "")`:                                                                                               nil,
+		`(get (hash-map :a 1) :a)`:                                                                               1,
+		`(get [1 2] 1)`:                                                                                          2,
+		`(subs "héllo" 1 3)`:                                                                                     "él",
+		`(str (let [a 0.0 b -0.0] [a b]))`:                                                                       "[0.0 -0.0]",
+		`(subs "héllo" 2)`:                                                                                       "llo",
+		`(string/replace "a.b.c" "." "-")`:                                                                       "a-b-c",
+		`(string/replace "a.b.c" "." (fn [m] (str "<" m ">")))`:                                                  "a<.>b<.>c",
+		`(string/replace "john smith" #"(\w+) (\w+)" "$2 $1")`:                                                   "smith john",
+		`(string/replace "hello" #"l(l)" "$1x")`:                                                                 "helxo",
+		`(string/replace "a1" #"\d" "\\$$0$")`:                                                                   "a$1$",
+		`(string/replace "a1b22" #"\d+" (fn [m] (str (count m))))`:                                               "a1b2",
+		`(string/replace "k=v x=y" #"(\w)=(\w)" (fn [g] (str (nth g 2) (nth g 1))))`:                             "vk yx",
+		`(clojure.string/replace "aaa" #"a" "b")`:                                                                "bbb",
+		`(try 1 2)`: 2,
+		`(try (throw "x") (catch Exception e (str "caught " (ex-message e))))`:                                                 "caught x",
+		`(try (/ 1 0) (catch :default e (ex-message e)))`:                                                                      "ExecutionError: divide by zero",
+		`(try (throw :k) (catch Exception e e) (finally 42))`:                                                                  "k",
+		`(do (defn redef-me [] 1) (list (with-redefs [redef-me (fn [] 2)] (redef-me)) (redef-me)))`:                            []vm.Value{vm.Int(2), vm.Int(1)},
+		`(do (defn redef-me [] 1) (try (with-redefs [redef-me (fn [] 2)] (throw "boom")) (catch Exception e nil)) (redef-me))`: 1,
+		`(apply + (range 5))`:                      10,
+		`(apply + 1 2 [3])`:                        6,
+		`(apply list 1 nil)`:                       []vm.Value{vm.Int(1)},
+		`(let [apply (fn [& xs] xs)] (apply 1 2))`: []vm.Value{vm.Int(1), vm.Int(2)},
+		`((var apply) + 1 '(2 3))`:                 6,
+		`(= (range 1 10 3) '(1 4 7))`:              true,
+		`(= (range 5 0 -2) '(5 3 1))`:              true,
+		`(identical? :foo :foo)`:                   true,
+		`(< (rand-int 3) 3)`:                       true,
+		`(rand-nth '(:a))`:                         vm.Keyword("a").Unbox(),
+		`(= (find-ns 'math) (the-ns 'math))`:       true,
+		`(count (hash-map :a 1, :b 2,))`:           2,
+		`(+ 1 #_(throw "boom") 2)`:                 3,
+		`@(atom 5)`:                                5,
+		`(let [a (atom 1)] (swap! a + 2 3) @a)`:    6,
+		`(let [a (atom 1)] (reset! a 2) @a)`:       2,
+		`(= @#'println println)`:                   true,
+		`(loop [i 0 acc nil] (if (< i 3) (recur (inc i) (cons i acc)) acc))`: []vm.Value{vm.Int(2), vm.Int(1), vm.Int(0)},
+		`(loop [[a & r] [1 2 3] s 0] (if a (recur r (+ s a)) s))`:            6,
+		`(loop [i 0] (let [j (inc i)] (if (< j 3) (recur j) j)))`:            3,
+		`(loop [] 1)`: 1,
+		`(let [] 1)`:  1,
+		`((fn [n acc] (if (< n 2) acc (recur (dec n) (* n acc)))) 5 1)`:              120,
+		`((fn [x & more] (if more (recur (+ x (first more)) (next more)) x)) 1 2 3)`: 6,
+		`(find-ns 'no.such.ns)`:                                nil,
+		`(ns-name (find-ns 'lang))`:                            "lang",
+		`(let [n (first (all-ns))] (identical? n (the-ns n)))`: true,
 	}
 	for k, v := range tests {
 		out, err := Eval(k)
@@ -55,6 +185,129 @@ func TestContext_Compile(t *testing.T) {
 	}
 }
 
+func TestContext_CompileErrors(t *testing.T) {
+	tests := []string{
+		`(bit-and 1 1.5)`,
+		`(bit-not "foo")`,
+		`(bit-shift-left 1.0 2)`,
+		`(+ 1 :foo)`,
+		`(/ 1 0)`,
+		`(math/sqrt :foo)`,
+		`(math/nope 1)`,
+		`(nope/sqrt 1)`,
+		`(rand-nth [])`,
+		`(list*)`,
+		`(apply + 1 2)`,
+		`(the-ns 'no.such.ns)`,
+		`(deref 1)`,
+		`(recur 1)`,
+		`(loop [x 1] (recur))`,
+		`(loop [x] x)`,
+		`(swap! (atom 1) 2)`,
+		`(ns-name 1)`,
+		`(apply +)`,
+		`(range 1 2 0)`,
+		`(try (/ 1 0) (finally 1))`,
+		`(try (throw "a") (catch Exception e (throw e)))`,
+		`(try 1 (finally 2) (catch Exception e 3))`,
+		`(try 1 (catch Exception))`,
+		`(string/replace "abc" #"b" (fn [m] 1))`,
+		`(re-pattern "(")`,
+		`(subs "héllo" 0 6)`,
+		`(subs "abc" 2 1)`,
+		`(nth "héllo" 5)`,
+		`(condp = 5 1 :one)`,
+		`(throw "boom")`,
+		`(nth [1] 5)`,
+		`(let [[a 1] [2 3]] a)`,
+		`(list* 1 2)`,
+		`(time/parse time/RFC3339 "nope")`,
+		`(time/plus (time/now) 1.5)`,
+		`(binding [inc 1] 2)`,
+	}
+	for _, src := range tests {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileMathDomain(t *testing.T) {
+	out, err := Eval("(math/sqrt -1)")
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(out.Unbox().(float64)))
+}
+
+func TestContext_CompileShuffle(t *testing.T) {
+	out, err := Eval("(let [v '[1 2 3 4 5]] (list v (shuffle v)))")
+	assert.NoError(t, err)
+	res := out.Unbox().([]vm.Value)
+	v := []vm.Value{vm.Int(1), vm.Int(2), vm.Int(3), vm.Int(4), vm.Int(5)}
+	assert.Equal(t, v, res[0].Unbox())
+	assert.ElementsMatch(t, v, res[1].Unbox())
+}
+
+func TestContext_CompileGetenv(t *testing.T) {
+	assert.NoError(t, os.Setenv("LETGO_TEST_EMPTY", ""))
+	defer os.Unsetenv("LETGO_TEST_EMPTY")
+	out, err := Eval(`(getenv "LETGO_TEST_EMPTY")`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.String(""), out)
+
+	out, err = Eval(`(getenv "LETGO_TEST_SURELY_UNSET")`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.NIL, out)
+}
+
+func TestContext_CompileSh(t *testing.T) {
+	out, err := Eval(`(shell/sh "echo" "hello" "world")`)
+	assert.NoError(t, err)
+	res := out.(*vm.Map)
+	assert.Equal(t, vm.String("hello world\n"), res.ValueAt(vm.Keyword("out")))
+	assert.Equal(t, vm.String(""), res.ValueAt(vm.Keyword("err")))
+	assert.Equal(t, vm.Int(0), res.ValueAt(vm.Keyword("exit")))
+
+	out, err = Eval(`(shell/sh "cat" :in "piped")`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.String("piped"), out.(*vm.Map).ValueAt(vm.Keyword("out")))
+
+	_, err = Eval(`(shell/sh "let-go-no-such-command")`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileDoseq(t *testing.T) {
+	out := &bytes.Buffer{}
+	outVar := rt.NS("lang").Lookup("*out*").(*vm.Var)
+	assert.NoError(t, outVar.PushBinding(vm.NewBoxed(io.Writer(out))))
+	defer outVar.PopBinding()
+
+	_, err := Eval(`(doseq [[k v] (sorted-map :b 2 :a 1) x [1 2]] (println k v x))`)
+	assert.NoError(t, err)
+	assert.Equal(t, ":a 1 1\n:a 1 2\n:b 2 1\n:b 2 2\n", out.String())
+}
+
+func TestContext_CompileDeftest(t *testing.T) {
+	out := &bytes.Buffer{}
+	outVar := rt.NS("lang").Lookup("*out*").(*vm.Var)
+	assert.NoError(t, outVar.PushBinding(vm.NewBoxed(io.Writer(out))))
+	defer outVar.PopBinding()
+
+	res, err := Eval(`(do
+		(deftest arith
+			(is (= 2 (+ 1 1)))
+			(is (= 3 (+ 1 1)) "one and one")
+			(is (/ 1 0)))
+		(deftest boom (throw "oops"))
+		(run-tests 'lang))`)
+	assert.NoError(t, err)
+	summary := res.(*vm.Map)
+	assert.Equal(t, vm.Int(2), summary.ValueAt(vm.Keyword("test")))
+	assert.Equal(t, vm.Int(1), summary.ValueAt(vm.Keyword("pass")))
+	assert.Equal(t, vm.Int(1), summary.ValueAt(vm.Keyword("fail")))
+	assert.Equal(t, vm.Int(2), summary.ValueAt(vm.Keyword("error")))
+	assert.Contains(t, out.String(), "FAIL in (arith)\none and one\nexpected: (= 3 (+ 1 1))\n  actual: (not (= 3 2))")
+	assert.Contains(t, out.String(), "uncaught: Thrown: oops")
+}
+
 func TestContext_CompileFn(t *testing.T) {
 	out, err := Eval("(fn [x] (+ x 1))")
 	assert.NoError(t, err)
@@ -86,6 +339,24 @@ func TestContext_CompileFnPoly(t *testing.T) {
 	assert.Equal(t, y, strIdentity(y))
 }
 
+// like in Clojure rest args are nil rather than an empty list when there are none
+func TestContext_CompileRestArgs(t *testing.T) {
+	cases := map[string]string{
+		"((fn [& xs] xs))":                  "nil",
+		"((fn [& xs] (nil? xs)))":           "true",
+		"((fn [& xs] xs) 1 2)":              "(1 2)",
+		"((fn [a & xs] [a xs]) 1)":          "[1 nil]",
+		"((fn [a & xs] [a xs]) 1 2)":        "[1 (2)]",
+		"(apply (fn [& xs] xs) [])":         "nil",
+		"(apply (fn [& xs] (count xs)) [])": "0",
+	}
+	for src, expected := range cases {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+}
+
 func TestContext_CompileMultiple(t *testing.T) {
 	src := `(def parens 20)
 			(def fun 1) 
@@ -104,8 +375,1447 @@ func TestContext_CompileMultiple(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestContext_CompileGoSeqs(t *testing.T) {
+	ch := make(chan vm.Value)
+	go func() {
+		for i := 1; i <= 4; i++ {
+			ch <- vm.Int(i)
+		}
+		close(ch)
+	}()
+	ns := rt.NS("lang")
+	ns.Def("from-chan", vm.SeqFromChan(ch))
+	ns.Def("from-slice", vm.SeqFromSlice([]vm.Value{vm.Int(1), vm.Int(2)}))
+
+	out, err := Eval("(reduce + (map inc from-chan))")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(14), out)
+
+	out, err = Eval("(list (count from-chan) (first (next from-chan)) (filter (fn [x] (= x 1)) from-slice))")
+	assert.NoError(t, err)
+	assert.Equal(t, "(4 2 (1))", out.String())
+}
+
+func TestContext_CompileUnresolvedSymbol(t *testing.T) {
+	_, err := Eval("(prinln 1)")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to resolve symbol: prinln, did you mean println?")
+
+	_, err = Eval("(let [x 1] (+ x surely-not-defined))")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to resolve symbol: surely-not-defined")
+	assert.NotContains(t, err.Error(), "did you mean")
+
+	assert.Equal(t, 3, editDistance([]rune("kitten"), []rune("sitting")))
+}
+
+func TestContext_CompileMacroexpand(t *testing.T) {
+	out, err := Eval("(macroexpand-1 '(when a b c))")
+	assert.NoError(t, err)
+	assert.Equal(t, "(if a (do b c) nil)", out.String())
+
+	out, err = Eval(`(defmacro unless-not [c & body] (cons 'when (cons c body)))
+					 (list (macroexpand-1 '(unless-not a b)) (macroexpand '(unless-not a b)))`)
+	assert.NoError(t, err)
+	assert.Equal(t, "((when a b) (if a (do b) nil))", out.String())
+
+	out, err = Eval("(list (macroexpand '(+ 1 2)) (macroexpand :foo) (macroexpand '(let [when 1] (when 2))))")
+	assert.NoError(t, err)
+	assert.Equal(t, "((+ 1 2) :foo (let [when 1] (when 2)))", out.String())
+}
+
+func TestContext_CompileErrorPosition(t *testing.T) {
+	src := `(defmacro twice [x] (list 'do x x))
+(do
+  (twice
+    (prinln 1)))`
+	_, _, err := NewCompiler(rt.NS("lang")).SetSource("pos.lg").CompileMultiple(strings.NewReader(src))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CompileError at (pos.lg:3:3)")
+	assert.Contains(t, err.Error(), "CompileError at (pos.lg:4:5): compiling function position")
+
+	out, err := Eval("(meta '(1 2))")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(1), out.(*vm.Map).ValueAt(vm.Keyword("line")))
+}
+
+func TestContext_CompileDefonce(t *testing.T) {
+	out, err := Eval(`(defonce counter (atom 0))
+					 (swap! counter inc)
+					 (defonce counter (atom 0))
+					 @counter`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(1), out)
+
+	out, err = Eval("(def not-yet) (list (bound? #'not-yet) (bound? #'counter))")
+	assert.NoError(t, err)
+	assert.Equal(t, "(false true)", out.String())
+
+	// def without a value doesn't unbind an existing var
+	out, err = Eval("(def counter) (bound? #'counter)")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.TRUE, out)
+}
+
+func TestContext_CompileComment(t *testing.T) {
+	out, err := Eval(`(comment
+					   (undefined-fn 1 2)
+					   (throw "never evaluated")
+					   [:a :b])`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.NIL, out)
+
+	out, err = Eval("(comment)")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.NIL, out)
+
+	_, err = Eval("(comment (foo (bar)")
+	assert.Error(t, err)
+}
+
+func TestContext_CompilePrePost(t *testing.T) {
+	// cfn puts a condition map built from conds in front of the fn body
+	_, err := Eval(`(defmacro cfn [args conds & body] (cons 'fn (cons args (cons (apply hash-map conds) body))))
+				    (def checked-sq (cfn [x] [:pre [(gt x 0)] :post [(gt % 10)]] (* x x)))`)
+	assert.NoError(t, err)
+
+	out, err := Eval("(checked-sq 4)")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(16), out)
+
+	_, err = Eval("(checked-sq -1)")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Assert failed: (gt x 0)")
+
+	_, err = Eval("(checked-sq 2)")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Assert failed: (gt % 10)")
+
+	// a lone map is the return value and not a condition map
+	lone := []vm.Value{vm.NewMap([]vm.Value{vm.Keyword("pre"), vm.ArrayVector{vm.FALSE}})}
+	assert.Equal(t, lone, conditions(lone))
+}
+
+func TestContext_CompileVerified(t *testing.T) {
+	src := `(def verified-f (fn [a & more] (if (gt a 1) (list a more) (let [b (+ a 1) c [a b]] c))))
+			(verified-f 1 2 3)
+			(let [x 1] (fn [y] (fn [] (+ x y))))
+			(if true 1)
+			(try (throw "x") (catch Exception e (ex-message e)) (finally 3))
+			(apply + 1 2 [3 4])
+			(loop [i 0 [x & xs] [1 2]] (let [j (inc i)] (if x (recur j xs) j)))
+			(cond false 1 :else [1 2 (when true 3)])
+			(let [[a & r :as all] [1 2 3]] (list a r all))`
+	_, out, err := NewCompiler(rt.NS("lang")).SetVerify(true).CompileMultiple(strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, "(1 (2 3) [1 2 3])", out.String())
+}
+
+func TestContext_CompileNestedIf(t *testing.T) {
+	cases := map[string]string{
+		`[1 (if false 2) 3]`:                                                               "[1 nil 3]",
+		`[1 (if true (if false 2) 3) 4]`:                                                   "[1 nil 4]",
+		`[1 (if (if true false true) 2 (if true 3)) 4]`:                                    "[1 3 4]",
+		`[(if (if false false) 1 (if nil 2)) (if true (if true (if true 5)))]`:             "[nil 5]",
+		`(let [f (fn [x] (if (gt x 0) (if (gt x 10) :big) :small))] [(f 20) (f 5) (f 0)])`: "[:big nil :small]",
+		// locals bound after an if take the slots following its value
+		`(let [x (if true 1 2) y 3] (list x y))`:                                         "(1 3)",
+		`(let [a (if false 1 (if true 2 3)) b (let [c (if a 4 5)] c)] [a b (if nil 6)])`: "[2 4 nil]",
+	}
+	for src, out := range cases {
+		_, v, err := NewCompiler(rt.NS("lang")).SetVerify(true).CompileMultiple(strings.NewReader(src))
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+}
+
+func TestContext_CompileRunWithContext(t *testing.T) {
+	for _, src := range []string{
+		"(loop [] (recur))",
+		"(do (defn spin [n] (loop [] (recur))) (spin 1))",
+		"(reduce (fn [a b] (loop [] (recur))) 0 [1 2])",
+		"(first (map (fn [x] (loop [] (recur))) [1]))",
+		"@(future (loop [] (recur)))",
+	} {
+		chunk, err := NewCompiler(rt.NS("lang")).Compile(src)
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = vm.NewFrame(chunk, nil).RunWithContext(ctx)
+		cancel()
+		assert.Error(t, err, src)
+		assert.Contains(t, err.Error(), "execution cancelled", src)
+	}
+
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(loop [i 0] (if (< i 10) (recur (inc i)) i))")
+	assert.NoError(t, err)
+	out, err := vm.NewFrame(chunk, nil).RunWithContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(10), out)
+}
+
+func TestContext_CompileRunWithBudget(t *testing.T) {
+	for _, src := range []string{
+		"(do (defn spin [] (loop [] (recur))) (spin))",
+		// functions called back from natives and run by futures pay from the same budget
+		"(reduce (fn [a b] (loop [] (recur))) 0 [1 2])",
+		"(first (map (fn [x] (loop [] (recur))) [1]))",
+		"@(future (loop [] (recur)))",
+	} {
+		chunk, err := NewCompiler(rt.NS("lang")).Compile(src)
+		assert.NoError(t, err)
+		budget := vm.NewInstructionBudget(1000)
+		_, err = vm.NewFrame(chunk, nil).RunWithBudget(context.Background(), budget)
+		assert.Error(t, err, src)
+		assert.Contains(t, err.Error(), "instruction budget exceeded", src)
+		assert.Equal(t, 0, budget.Remaining(), src)
+	}
+
+	// a budget is shared by all runs it's passed to
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(loop [i 0] (if (< i 10) (recur (inc i)) i))")
+	assert.NoError(t, err)
+	budget := vm.NewInstructionBudget(200)
+	out, err := vm.NewFrame(chunk, nil).RunWithBudget(context.Background(), budget)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(10), out)
+	assert.Greater(t, budget.Remaining(), 0)
+	_, err = vm.NewFrame(chunk, nil).RunWithBudget(context.Background(), budget)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileAllocationLimit(t *testing.T) {
+	vm.SetAllocationLimit(1000)
+	defer vm.SetAllocationLimit(0)
+
+	_, err := Eval("(range 100000000)")
+	assert.EqualError(t, err, "ExecutionError: allocation limit exceeded")
+
+	vm.SetAllocationLimit(1000)
+	_, err = Eval("(loop [l nil] (recur (cons 1 l)))")
+	assert.EqualError(t, err, "ExecutionError: allocation limit exceeded")
+
+	vm.SetAllocationLimit(1000)
+	out, err := Eval("(count (range 100))")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(100), out)
+	assert.GreaterOrEqual(t, vm.Allocated(), 100)
+
+	// natives driving the build-up stop as soon as the limit is crossed, not once the outer call returns
+	vm.SetAllocationLimit(0)
+	_, err = Eval("(def alloc-limit-src (range 100000))")
+	assert.NoError(t, err)
+	vm.SetAllocationLimit(1000)
+	_, err = Eval("(count (reduce conj [] alloc-limit-src))")
+	assert.EqualError(t, err, "ExecutionError: allocation limit exceeded")
+	assert.Less(t, vm.Allocated(), 1100)
+}
+
+func TestContext_CompileFnNames(t *testing.T) {
+	out, err := Eval("(defn named-fn [a b] a) named-fn")
+	assert.NoError(t, err)
+	assert.Equal(t, "#<fn lang/named-fn>", out.String())
+	assert.Equal(t, "lang/named-fn", out.(*vm.Func).Name())
+
+	_, err = Eval("(named-fn 1)")
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (1) passed to lang/named-fn, expected 2")
+
+	_, err = Eval("(defn named-variadic [a & more] a) (named-variadic)")
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (0) passed to lang/named-variadic, expected at least 1")
+
+	out, err = Eval("\n\n(fn [] 1)")
+	assert.NoError(t, err)
+	assert.Equal(t, "#<fn at line 3>", out.String())
+
+	out, err = Eval("(let [f (fn [] 1)] (def not-named-fn (list f)) not-named-fn)")
+	assert.NoError(t, err)
+	assert.Equal(t, "(#<fn at line 1>)", out.String())
+}
+
+func TestContext_CompileSatisfies(t *testing.T) {
+	out, err := Eval("(defprotocol Sized (size-of [x])) (satisfies? Sized 42)")
+	assert.NoError(t, err)
+	assert.Equal(t, false, out.Unbox())
+
+	_, err = Eval("(size-of 42)")
+	assert.EqualError(t, err, "ExecutionError: no implementation of method size-of of protocol Sized found for type Int")
+
+	out, err = Eval("(extend-type Int Sized (size-of [x] (* 2 x))) (list (satisfies? Sized 42) (size-of 21))")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.TRUE, vm.Int(42)}, out.Unbox())
+
+	out, err = Eval("(satisfies? Sized \"foo\")")
+	assert.NoError(t, err)
+	assert.Equal(t, false, out.Unbox())
+}
+
+func TestContext_CompileKeep(t *testing.T) {
+	out, err := Eval("(keep identity [1 nil 2 nil 3])")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(1), vm.Int(2), vm.Int(3)}, out.Unbox())
+
+	out, err = Eval("(keep-indexed (fn [i x] (if (= i 1) nil [i x])) [:a :b :c])")
+	assert.NoError(t, err)
+	assert.Equal(t, "([0 :a] [2 :c])", out.String())
+
+	// nothing is computed until elements are needed
+	out, err = Eval("(let [calls (atom 0) s (keep (fn [x] (swap! calls inc) x) [1 2 3])] (list @calls (first s) @calls))")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(0), vm.Int(1), vm.Int(1)}, out.Unbox())
+
+	_, err = Eval("(first (keep (fn [x] (x)) [1]))")
+	assert.EqualError(t, err, "TypeError: Int is not a function ")
+}
+
+func TestContext_CompileMapIndexed(t *testing.T) {
+	out, err := Eval("(map-indexed (fn [i x] [i x]) [:a :b])")
+	assert.NoError(t, err)
+	assert.Equal(t, "([0 :a] [1 :b])", out.String())
+
+	out, err = Eval("(remove (fn [x] (= x 2)) (list 1 2 3 nil))")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(1), vm.Int(3), vm.NIL}, out.Unbox())
+}
+
+func TestContext_CompileBoundedCount(t *testing.T) {
+	var naturals func(n vm.Int) vm.Seq
+	naturals = func(n vm.Int) vm.Seq {
+		return vm.NewLazySeq(func() (vm.Seq, error) {
+			return vm.NewCons(n, naturals(n+1)), nil
+		})
+	}
+	rt.NS("lang").Def("naturals", naturals(0))
+
+	out, err := Eval("(list (bounded-count 5 naturals) (bounded-count 5 (keep identity [1 2])) (bounded-count 1 [1 2 3]))")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(5), vm.Int(2), vm.Int(3)}, out.Unbox())
+
+	out, err = Eval(`(list (count [1 2 3]) (count "żółw") (count nil) (count (keep identity [1 nil 2])))`)
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(3), vm.Int(4), vm.Int(0), vm.Int(2)}, out.Unbox())
+}
+
+func TestContext_CompileRealized(t *testing.T) {
+	out, err := Eval("(let [s (keep identity [1 2])] (list (realized? s) (first s) (realized? s)))")
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.FALSE, vm.Int(1), vm.TRUE}, out.Unbox())
+
+	_, err = Eval("(realized? 1)")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileDelay(t *testing.T) {
+	out, err := Eval(`(def runs (atom 0))
+		(def d (delay (swap! runs inc) :done))
+		(list (realized? d) (force d) (force d) @d (realized? d) @runs)`)
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.FALSE, vm.Keyword("done"), vm.Keyword("done"), vm.Keyword("done"), vm.TRUE, vm.Int(1)}, out.Unbox())
+
+	// failures are cached and reported again without rerunning the body
+	_, err = Eval("(def failing (delay (swap! runs inc) (1))) (force failing)")
+	assert.EqualError(t, err, "TypeError: Int is not a function ")
+	_, err = Eval("@failing")
+	assert.EqualError(t, err, "TypeError: Int is not a function ")
+	out, err = Eval("@runs")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(2), out)
+
+	out, err = Eval("(force 5)")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(5), out)
+}
+
+func TestContext_CompileSortedMap(t *testing.T) {
+	out, err := Eval("(def sm (sorted-map 5 :e 1 :a 3 :c 2 :b 4 :d)) (subseq sm > 2)")
+	assert.NoError(t, err)
+	assert.Equal(t, "([3 :c] [4 :d] [5 :e])", out.String())
+
+	out, err = Eval("(list (rsubseq sm > 1 < 4) (subseq sm > 5) (get sm 3) (seq sm))")
+	assert.NoError(t, err)
+	assert.Equal(t, "(([3 :c] [2 :b]) nil :c ([1 :a] [2 :b] [3 :c] [4 :d] [5 :e]))", out.String())
+
+	out, err = Eval("(sorted-map-by (fn [a b] (> a b)) 1 :a 3 :c 2 :b)")
+	assert.NoError(t, err)
+	assert.Equal(t, "{3 :c, 2 :b, 1 :a}", out.String())
+}
+
+func TestContext_CompileArrayMap(t *testing.T) {
+	out, err := Eval("(def am (array-map :z 1 :y 2 :x 3)) (list am (seq am) (get am :y) (dissoc am :y) (assoc am :a 0 :z 9))")
+	assert.NoError(t, err)
+	assert.Equal(t, "({:z 1, :y 2, :x 3} ([:z 1] [:y 2] [:x 3]) 2 {:z 1, :x 3} {:z 9, :y 2, :x 3, :a 0})", out.String())
+
+	out, err = Eval("(assoc (array-map 1 1 2 2 3 3 4 4 5 5 6 6 7 7 8 8) 9 9)")
+	assert.NoError(t, err)
+	assert.IsType(t, &vm.Map{}, out)
+	assert.Equal(t, vm.Int(9), out.(vm.Collection).Count())
+
+	out, err = Eval("(assoc [1 2] 0 :a 2 :c)")
+	assert.NoError(t, err)
+	assert.Equal(t, "[:a 2 :c]", out.String())
+}
+
+func TestContext_CompileUserNS(t *testing.T) {
+	_, out, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader("(defn twice-in-user [x] (* 2 x)) (twice-in-user (inc 20))"))
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(42), out)
+	assert.Equal(t, "#'user/twice-in-user", rt.NS("user").Lookup("twice-in-user").String())
+	assert.Equal(t, vm.NIL, rt.NS("lang").Lookup("twice-in-user"))
+}
+
+func TestContext_CompileHostNS(t *testing.T) {
+	host, err := vm.NewNamespaceBuilder("host").
+		Def("version", vm.String("1.0")).
+		DefNative("add", func(vs []vm.Value) (vm.Value, error) {
+			return vs[0].(vm.Int) + vs[1].(vm.Int), nil
+		}).
+		DefFunc("greet", func(name string) string { return "hello " + name }).
+		Build()
+	assert.NoError(t, err)
+	rt.RegisterNS(host)
+
+	app := rt.RegisterNS(vm.NewNamespace("host-app").Refer(rt.NS("lang")))
+	_, out, err := NewCompiler(app).CompileMultiple(strings.NewReader(`(require 'host)
+		(refer 'host)
+		(list (add 40 2) (host/greet "there") version)`))
+	assert.NoError(t, err)
+	assert.Equal(t, `(42 "hello there" "1.0")`, out.String())
+
+	_, err = NewCompiler(app).Compile("(refer)")
+	assert.Error(t, err)
+	_, _, err = NewCompiler(app).CompileMultiple(strings.NewReader("(require 'no-such-host)"))
+	assert.Error(t, err)
+
+	_, err = vm.NewNamespaceBuilder("broken").DefFunc("f", 42).Build()
+	assert.Error(t, err)
+}
+
+func TestContext_CompileTap(t *testing.T) {
+	out, err := Eval(`(do (def tapped (atom (list)))
+		(defn collect-tap [x] (swap! tapped (fn [xs] (cons x xs))))
+		(add-tap collect-tap)
+		(list (tap> 1) (tap> :two) (tap> "three")))`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(true true true)", out.String())
+
+	// taps run on their own goroutine, poll the atom without compiling anything meanwhile
+	tapped := rt.NS("lang").Lookup("tapped").(*vm.Var).Deref().(*vm.Atom)
+	deadline := time.Now().Add(time.Second)
+	for {
+		out = tapped.Deref()
+		if out.(vm.Collection).Count() == vm.Int(3) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, `("three" :two 1)`, out.String())
+
+	_, err = Eval("(remove-tap collect-tap)")
+	assert.NoError(t, err)
+	_, err = Eval("(add-tap 42)")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileCallableCollections(t *testing.T) {
+	tests := map[string]string{
+		"(:a (hash-map :a 1))":                       "1",
+		"(:b (hash-map :a 1))":                       "nil",
+		"(:b (array-map :a 1) 7)":                    "7",
+		"(:a (hash-set :a :b))":                      ":a",
+		"(:a 42 :nope)":                              ":nope",
+		"((hash-map :a 1) :a)":                       "1",
+		"((array-map :a 1) :z 0)":                    "0",
+		"((sorted-map 1 2) 1)":                       "2",
+		"((sorted-map 1 2) 3 :none)":                 ":none",
+		"([10 20] 1)":                                "20",
+		"((hash-set 1 2) 2)":                         "2",
+		"((hash-set 1 2) 3)":                         "nil",
+		"((hash-set 1 2) 3 :none)":                   ":none",
+		"(map :a (list (hash-map :a 1) (hash-map)))": "(1 nil)",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+
+	for _, src := range []string{"([10 20] 2)", "([10 20] :a)", "([10 20])", "(:a (hash-map) 1 2)", "((hash-map) 1 2 3)"} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileApplyArity(t *testing.T) {
+	_, err := Eval("(apply math/sqrt [1 2])")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong number of arguments (2) passed to sqrt, expected 1")
+	_, err = Eval("(let [apply-it apply] (apply-it :a [1 2 3]))")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong number of arguments (3) passed to :a, expected 1 or 2")
+	out, err := Eval("(apply (fn [a & more] more) 1 [2 3])")
+	assert.NoError(t, err)
+	assert.Equal(t, "(2 3)", out.String())
+}
+
+func TestContext_CompileMeta(t *testing.T) {
+	tests := map[string]string{
+		"(meta (conj (with-meta [] (hash-map :x 1)) 2))":                            "{:x 1}",
+		"(conj (with-meta [1] (hash-map :x 1)) 2)":                                  "[1 2]",
+		"(meta (assoc (with-meta [1] (hash-map :x 1)) 0 2))":                        "{:x 1}",
+		"(meta (assoc (with-meta (hash-map) (hash-map :x 1)) :a 1))":                "{:x 1}",
+		"(meta (dissoc (with-meta (sorted-map 1 2) (hash-map :x 1)) 1))":            "{:x 1}",
+		"(meta (conj (with-meta (hash-set) (hash-map :x 1)) 1))":                    "{:x 1}",
+		"(meta (apply assoc (with-meta (array-map) (hash-map :x 1)) (range 20)))":   "{:x 1}",
+		"(meta (vary-meta (with-meta [] (hash-map :x 1)) assoc :y 2))":              "{:x 1, :y 2}",
+		"(meta (vary-meta [] (fn [m] m)))":                                          "nil",
+		"(= [1 2] (with-meta [1 2] (hash-map :x 1)))":                               "true",
+		"(meta (with-meta (with-meta (hash-map) (hash-map :x 1)) (hash-map :y 2)))": "{:y 2}",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+
+	_, err := Eval("(with-meta 1 (hash-map))")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileWalk(t *testing.T) {
+	tests := map[string]string{
+		"(walk/postwalk (fn [x] (if (= x 1) 2 x)) (list 1 [1 (hash-map :a 1)] (hash-set 1)))": "(2 [2 {:a 2}] #{2})",
+		"(walk/walk inc (fn [xs] (apply + xs)) [1 2 3])":                                      "9",
+		"(clojure.walk/stringify-keys (array-map :a (array-map :b 1)))":                       `{"a" {"b" 1}}`,
+		`(walk/keywordize-keys (array-map "a" [(array-map "b" 1)]))`:                          "{:a [{:b 1}]}",
+		"(meta (walk/prewalk identity (with-meta [1] (hash-map :m 1))))":                      "{:m 1}",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+}
+
+func TestContext_CompileSetOps(t *testing.T) {
+	tests := map[string]string{
+		"(set/intersection #{1 2 3} #{2 3 4})":                    "#{2 3}",
+		"(set/intersection #{1 2 3} #{2 3 4} #{3})":               "#{3}",
+		"(set/union #{1 2} #{2 3})":                               "#{1 2 3}",
+		"(set/union)":                                             "#{}",
+		"(set/difference #{1 2 3 4} #{2} #{4 5})":                 "#{1 3}",
+		"(clojure.set/difference #{1 2})":                         "#{1 2}",
+		"[(set/subset? #{1} #{1 2}) (set/subset? #{1 3} #{1 2})]": "[true false]",
+		"[(set/superset? #{1 2} #{2}) (set/superset? #{} #{2})]":  "[true false]",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+	_, err := Eval("(set/union #{1} [2])")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileSetJoin(t *testing.T) {
+	tests := map[string]string{
+		`(set/join #{{:id 1 :name "ann"} {:id 2 :name "bob"}} #{{:id 1 :age 30} {:id 3 :age 40}})`: `#{{:age 30, :id 1, :name "ann"}}`,
+		`(set/join #{{:a 1}} #{{:b 2} {:b 3}})`:                                                    `#{{:a 1, :b 2} {:a 1, :b 3}}`,
+		`(set/join #{} #{{:b 2}})`:                                                                 `#{}`,
+		`(set/index #{{:a 1 :b 2} {:a 1 :b 3} {:a 2 :b 2}} [:a])`:                                  `{{:a 1} #{{:a 1, :b 2} {:a 1, :b 3}}, {:a 2} #{{:a 2, :b 2}}}`,
+		`(set/index #{{:a 1} {:b 2}} [:a])`:                                                        `{{:a 1} #{{:a 1}}, {} #{{:b 2}}}`,
+	}
+	for src, expected := range tests {
+		out, err := Eval("(binding [*print-sorted* true] (str " + src + "))")
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, string(out.(vm.String)), src)
+	}
+	_, err := Eval("(set/join #{1} #{{:a 1}})")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileRecords(t *testing.T) {
+	src := `(defrecord Point [x y])
+		(defprotocol Norm (norm [p]))
+		(extend-type Point Norm (norm [p] (+ (:x p) (:y p))))
+		(def p (->Point 1 2))
+		[p (norm p) (instance? Point p) (map? p) (= p (->Point 1 2)) (= p (hash-map :x 1 :y 2))
+		 (assoc p :x 5) (instance? Point (assoc p :x 5))
+		 (assoc p :z 3) (instance? Point (assoc p :z 3)) (norm (assoc p :z 3))
+		 (instance? Point (dissoc (assoc p :z 3) :z))
+		 (dissoc p :x) (instance? Point (dissoc p :x))
+		 (map->Point (hash-map :x 1 :w 0)) (merge p (hash-map :y 9))]`
+	_, out, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, "[#Point{:x 1, :y 2} 3 true true true false "+
+		"#Point{:x 5, :y 2} true "+
+		"#Point{:x 1, :y 2, :z 3} true 3 "+
+		"true "+
+		"{:y 2} false "+
+		"#Point{:x 1, :y nil, :w 0} #Point{:x 1, :y 9}]", out.String())
+
+	_, err = Eval("(do (defrecord Pair [a b]) (->Pair 1))")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileTypeHints(t *testing.T) {
+	tests := map[string]string{
+		"((fn [^long a ^long b] (+ a b)) 1 2)":                                                                          "3",
+		"((fn [^long a ^long b] [(- a b) (* a b) (< a b) (> a b) (== a b)]) 3 2)":                                       "[1 6 false true false]",
+		"((fn [^double a ^double b] [(+ a b) (- a b) (* a b) (< a b)]) 1.5 0.5)":                                        "[2.0 1.0 0.75 false]",
+		"((fn [^long n] [(inc n) (dec n)]) 5)":                                                                          "[6 4]",
+		"(let [^long x 5 y (* x 2)] (+ x y))":                                                                           "15",
+		"(loop [^long i 0 acc 0] (if (< i 5) (recur (inc i) (+ acc i)) acc))":                                           "10",
+		"(loop [[a b] [1 2] ^long n 3] (if (> n 0) (recur [b a] (dec n)) [a b]))":                                       "[2 1]",
+		"(do (defn hinted-fib [^long n] (if (< n 2) n (+ (hinted-fib (- n 1)) (hinted-fib (- n 2))))) (hinted-fib 10))": "55",
+		// hints are advisory, operands of other types get the generic behavior
+		"((fn [^long a ^long b] (+ a b)) 1.5 2)":                          "3.5",
+		"((fn [^double a] [(inc a) (dec a)]) 1)":                          "[2 0]",
+		"((fn [^long a ^long b] (== a b)) 1 1.0)":                         "true",
+		"(loop [acc 0 i 0] (if (< i 3) (recur (+ acc 0.5) (inc i)) acc))": "1.5",
+		"((fn [^String s ^long n] [s n]) \"a\" 1)":                        `["a" 1]`,
+		"(def ^long hinted-def 3)":                                        "#'lang/hinted-def",
+		"'[^long x (^double y)]":                                          "[x (y)]",
+		// specialized arithmetic still calls the function when it's rebound, literals are hinted too
+		"(with-redefs [+ -] [((fn [^double a ^double b] (+ a b)) 5.0 3.0) ((fn [a b] (+ a b)) 5.0 3.0)])": "[2.0 2.0]",
+		"(with-redefs [+ -] [(+ 1 2) (+ 1.0 2.0)])":                                                       "[-1 -1.0]",
+		"(with-redefs [inc dec < >] ((fn [^double a] [(inc a) (< a 2.0)]) 1.0))":                          "[0.0 false]",
+		// locals shadowing the operators aren't specialized
+		"(let [+ str ^long a 1] (+ a a))": `"11"`,
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+	_, err := Eval("((fn [^long a ^long b] (< a b)) 1 :x)")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileInlineArithmetic(t *testing.T) {
+	cases := map[string]string{
+		"[(+ 1 2) (- 5 7) (* 6 7)]":                                     "[3 -2 42]",
+		"[(< 1 2) (> 1 2) (= 2 2) (== 2 3)]":                            "[true false true false]",
+		"(loop [i 0 acc 0] (if (< i 5) (recur (inc i) (+ acc i)) acc))": "10",
+		// operands other than Ints are passed to the function
+		"[(+ 1.5 2) (< 1 2.5) (= [1] [1]) (= 1 1.0) (== 1 1.0)]": "[3.5 true true false true]",
+		"(+ 1 2 3)": "6",
+		// rebound functions are called even for Ints
+		"(with-redefs [+ -] (let [f (fn [a b] (+ a b))] [(f 5 3) (f 5.0 3.0)]))":             "[2 2.0]",
+		"(with-redefs [inc dec < >] [(inc 1) (let [x 1] (inc x)) (< 1 2)])":                  "[0 0 false]",
+		"(let [f (fn [x] (inc x))] [(with-redefs [inc str] (f 1)) (f 1) (dec 1) (dec 1.5)])": `["1" 2 0 0.5]`,
+		"(let [+ str] (+ 1 2))": `"12"`,
+	}
+	for src, expected := range cases {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+
+	_, err := Eval(`(< 1 "a")`)
+	assert.Error(t, err)
+
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(+ 1 2)")
+	assert.NoError(t, err)
+	op, err := chunk.Get(chunk.Length() - 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "ADD", vm.OpcodeToString(op))
+
+	chunk, err = NewCompiler(rt.NS("lang")).Compile("(inc 1)")
+	assert.NoError(t, err)
+	op, err = chunk.Get(chunk.Length() - 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "INC", vm.OpcodeToString(op))
+}
+
+// recur stores into the slots of the loop bindings so iterating doesn't allocate by itself. Go boxes Ints
+// from 0 to 255 as Values without allocating but allocates for each larger one, so a loop counting to n
+// allocates n-255 times more than one counting to 1 and nothing else may add to that.
+func TestContext_CompileLoopAllocations(t *testing.T) {
+	allocs := func(n int) float64 {
+		chunk, err := NewCompiler(rt.NS("lang")).Compile(fmt.Sprintf("(loop [i 0] (if (< i %d) (recur (inc i)) i))", n))
+		assert.NoError(t, err)
+		return testing.AllocsPerRun(10, func() {
+			// comparing doesn't box n like assert.Equal would
+			if out, err := vm.NewFrame(chunk, nil).Run(); err != nil || out != vm.Int(n) {
+				t.Fatal(out, err)
+			}
+		})
+	}
+	base := allocs(1)
+	assert.Equal(t, base, allocs(200))
+	assert.Equal(t, base+float64(1000-255), allocs(1000))
+	assert.Equal(t, base+float64(10000-255), allocs(10000))
+}
+
+func TestContext_CompileDeepNesting(t *testing.T) {
+	// the depth of the stack grows with nesting, below and above the 32 values frames used to be limited to
+	for _, depth := range []int{5, 100} {
+		src := strings.Repeat("(+ 1 ", depth) + "0" + strings.Repeat(")", depth)
+		assert.NotPanics(t, func() {
+			out, err := Eval(src)
+			assert.NoError(t, err, "depth %d", depth)
+			assert.Equal(t, vm.Int(depth), out)
+		})
+	}
+}
+
+func TestContext_CompileDeepMerge(t *testing.T) {
+	tests := map[string]string{
+		`(= (deep-merge (hash-map :db (hash-map :conn (hash-map :host "a" :port 1) :pool 4))
+		                (hash-map :db (hash-map :conn (hash-map :port 2) :pool (hash-map :max 8)))
+		                (hash-map :db (hash-map :conn (hash-map :user "u"))))
+		    (hash-map :db (hash-map :conn (hash-map :host "a" :port 2 :user "u") :pool (hash-map :max 8))))`: "true",
+		"(deep-merge (array-map :a (array-map :b 1)) (array-map :a 2))":                       "{:a 2}",
+		"(deep-merge nil (array-map :a 1) nil)":                                               "{:a 1}",
+		"(deep-merge-with + (array-map :a (array-map :b 1)) (array-map :a (array-map :b 2)))": "{:a {:b 3}}",
+		"(merge (array-map :a 1 :b 1) (array-map :b 2) nil)":                                  "{:a 1, :b 2}",
+		"(merge-with + (array-map :a 1) (array-map :a 2 :b 1))":                               "{:a 3, :b 1}",
+		"(merge)": "nil",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+
+	_, err := Eval("(merge (array-map) [1 2])")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileCountBy(t *testing.T) {
+	tests := map[string]string{
+		"(distinct? 1 2 3)":                      "true",
+		"(distinct? 1 2 1)":                      "false",
+		"(distinct? 1)":                          "true",
+		"(distinct? [1 2] (list 1 2))":           "false",
+		"(distinct? :a \"a\" 'a)":                "true",
+		"(frequencies [:a :b :a nil nil nil])":   "{:a 2, :b 1, nil 3}",
+		`(count-by count ["a" "bb" "c" "dd"])`:   "{1 2, 2 2}",
+		"(count-by (fn [x] (< x 3)) (range 10))": "{true 3, false 7}",
+		"(count-by identity nil)":                "{}",
+	}
+	for src, expected := range tests {
+		out, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, expected, out.String(), src)
+	}
+
+	_, err := Eval("(distinct?)")
+	assert.Error(t, err)
+}
+
+func TestContext_CompileBadArgumentTypes(t *testing.T) {
+	for _, src := range []string{`(subs 1 2)`, `(subs "abc" "1")`, `(range "a")`, `(+ 1 "a")`, `(lt :a 1)`, `(nthnext [1 2] :a)`, `(map 1 [2])`, `(time/from-unix-millis "0")`} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+		assert.Contains(t, err.Error(), "TypeError", src)
+	}
+}
+
+func TestContext_CompileNativePanic(t *testing.T) {
+	rt.NS("lang").DefNativeTyped("panicky", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Int(vs[0].Unbox().(int) * 2), nil
+	})
+	out, err := Eval("(panicky 21)")
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(42), out)
+
+	out, err = Eval(`(try (panicky "21") (catch Exception e :caught))`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Keyword("caught"), out)
+
+	_, err = Eval(`(map panicky [1 :a])`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "panicky panicked")
+}
+
+func TestContext_CompileRead(t *testing.T) {
+	cases := map[string]string{
+		`(let [r (push-back-reader "(+ 1 2)\n  [a b] :k")] [(read r) (read+string r) (reader-position r) (read r) (read r false :eof)])`: `[(+ 1 2) [[a b] "[a b]"] {:line 2, :column 8} :k :eof]`,
+		`(let [r (push-back-reader "")] (read+string r false 1))`:                                                                        `[1 ""]`,
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(read (push-back-reader "(1 2"))`)
+	assert.Error(t, err)
+	_, err = Eval(`(read (push-back-reader " "))`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "EOF while reading")
+	_, err = Eval(`(read 1)`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileLoad(t *testing.T) {
+	cases := map[string]string{
+		`(load-string "(def x 1) (def y (+ x 1)) y")`: "2",
+		`(load-string "")`: "nil",
+		`(load-reader (push-back-reader "(def z 5) #_ ignored (* z 2)"))`: "10",
+		`(eval (read-string "(+ 1 2)"))`:                                  "3",
+		`(eval (list 'inc 41))`:                                           "42",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(load-string "(def a 1)\n(+ a :b)")`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load form 2 (+ a :b) at (<string>:2:1)")
+	_, err = Eval(`(read-string "")`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileRestNextPeekPop(t *testing.T) {
+	cases := map[string]string{
+		`[(next (list 1)) (rest (list 1)) (next nil) (rest nil) (next [1 2]) (rest [1])]`:        "[nil () nil () [2] []]",
+		`[(next (map inc [1])) (rest (map inc [1 2]))]`:                                          "[nil (3)]",
+		`[(peek [1 2 3]) (pop [1 2 3]) (peek (list 1 2)) (pop (list 1 2)) (peek nil) (pop nil)]`: "[3 [1 2] 1 (2) nil nil]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	for _, src := range []string{`(pop [])`, `(pop (list))`, `(peek 1)`} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileTakeNth(t *testing.T) {
+	cases := map[string]string{
+		`(take-nth 2 (range 10))`: "(0 2 4 6 8)",
+		`(take-nth 3 "abcdefg")`:  `(\a \d \g)`,
+		`(take-nth 1 [1 2])`:      "[1 2]",
+		`[(nthrest [1 2 3] 1) (nthrest [1 2 3] 5) (nthrest [1 2] 0)]`: "[(2 3) () [1 2]]",
+		`[(nthnext [1 2 3] 3) (nthnext nil 1) (nthnext [1 2 3] 0)]`:   "[nil nil (1 2 3)]",
+		`(first (nthnext (map inc (range 5)) 2))`:                     "3",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(take-nth 0 [1])`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileReductions(t *testing.T) {
+	cases := map[string]string{
+		`(reductions + [1 2 3 4])`:              "(1 3 6 10)",
+		`(reductions + 10 [1 2])`:               "(10 11 13)",
+		`(reductions + [])`:                     "(0)",
+		`(reductions + 5 nil)`:                  "(5)",
+		`(reductions conj [] (list 1 2))`:       "([] [1] [1 2])",
+		`(first (reductions + [1 :not-a-num]))`: "1",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(count (reductions + [1 :a]))`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileEmptyBodies(t *testing.T) {
+	cases := map[string]string{
+		`(when false)`: "nil",
+		`(cond)`:       "nil",
+		`(when true)`:  "nil",
+		// surrounding values show the stack stays balanced
+		`[1 (when false) (when true) (cond) (cond false 1) (cond false 1 true) 2]`:             "[1 nil nil nil nil nil 2]",
+		`[1 (when-not true) (when-not false) (when-not false 3 4) (if-not true 5) 2]`:          "[1 nil nil 4 nil 2]",
+		`[1 (if-let [x nil] 3) (if-let [x false] 3 4) (if-let [[a b] [3 4]] (+ a b)) 2]`:       "[1 nil 4 7 2]",
+		`[1 (when-let [x 3]) (when-let [x nil] 3) (when-let [x 3] 4 x) 2]`:                     "[1 nil nil 3 2]",
+		`(let [f (fn [x] (cond (= x 1) :one (= x 2) :two))] [(f 1) (f 2) (f 3) (when (f 3))])`: "[:one :two nil nil]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+}
+
+func TestContext_CompileNumericPredicates(t *testing.T) {
+	cases := map[string]string{
+		`[(not= 1 2) (not= 1 1) (not= 1 1 2) (not= 1) (not nil) (not false) (not 0)]`:        "[true false true false true true false]",
+		`[(zero? 0) (zero? 0.0) (zero? 1) (zero? -0.5)]`:                                     "[true true false false]",
+		`[(pos? 1) (pos? 1.5) (pos? 0) (pos? -1) (neg? -1) (neg? -0.5) (neg? 0) (neg? 0.0)]`: "[true true false false true true false false]",
+		`[(even? 2) (even? 0) (even? -3) (odd? 3) (odd? -3) (odd? 0)]`:                       "[true true false true true false]",
+		`[(number? 1) (number? 1.5) (number? "1") (number? nil)]`:                            "[true true false false]",
+		`[(integer? 1) (integer? 1.0) (integer? :a)]`:                                        "[true false false]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	for _, src := range []string{`(even? 1.0)`, `(odd? 2.5)`, `(zero? :a)`, `(pos? "1")`, `(neg? nil)`, `(even? "2")`} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileBoolean(t *testing.T) {
+	cases := map[string]string{
+		`[(boolean 0) (boolean "") (boolean (list)) (boolean :false) (boolean true)]`: "[true true true true true]",
+		`[(boolean nil) (boolean false)]`:                                             "[false false]",
+		`[(if 0 :t :f) (if "" :t :f) (if nil :t :f) (if false :t :f)]`:                "[:t :t :f :f]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+}
+
+func TestContext_CompileNilSeeded(t *testing.T) {
+	cases := map[string]string{
+		`[(conj nil 1) (conj nil 1 2) (reduce conj nil [1 2 3])]`:                       "[(1) (2 1) (3 2 1)]",
+		`[(assoc nil :a 1) (assoc nil :a 1 :b 2) (map? (assoc nil :a 1))]`:              "[{:a 1} {:a 1, :b 2} true]",
+		`(reduce (fn [m x] (assoc m x (* x x))) nil [1 2 3])`:                           "{1 1, 2 4, 3 9}",
+		`[(get nil :a) (get nil :a 2) (:a nil) (:a nil 3) (dissoc nil :a) (merge nil)]`: "[nil 2 nil 3 nil nil]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+}
+
+func TestContext_CompileVectorOf(t *testing.T) {
+	cases := map[string]string{
+		`(vector-of :int 1 2 3)`:    "[1 2 3]",
+		`(vector-of :double 1 2.5)`: "[1.0 2.5]",
+		`(let [v (vector-of :long 1 2 3)] [(conj v 4) (pop v) (peek v)])`:                          "[[1 2 3 4] [1 2] 3]",
+		`(let [v (vector-of :int 1 2 3)] [(nth v 1) (v 2) (get v 5 :nf) (count v) (= v [1 2 3])])`: "[2 3 :nf 3 true]",
+		`(let [v (vector-of :float 1 2)] [(reduce + v) (map inc v) (first v)])`:                    "[3.0 (2.0 3.0) 1.0]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	for _, src := range []string{`(vector-of :int 1.5)`, `(vector-of :str 1)`, `(conj (vector-of :int) :a)`, `(vector-of)`} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileMapEntries(t *testing.T) {
+	cases := map[string]string{
+		`(reduce (fn [acc e] (+ acc (val e))) 0 (hash-map :a 1 :b 2 :c 3))`:                "6",
+		`(let [[k v] (first (hash-map :a 1))] [k v])`:                                      "[:a 1]",
+		`(map key (sorted-map 2 :b 1 :a))`:                                                 "(1 2)",
+		`(let [e (first (sorted-map 1 :a))] [(map-entry? e) (= e [1 :a]) (e 1) (peek e)])`: "[true true :a :a]",
+		`(conj (hash-map) (first (hash-map :a 1)))`:                                        "{:a 1}",
+		`(map-entry? [1 2])`: "false",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	for _, src := range []string{`(key [1 2])`, `(val nil)`, `(first 1)`} {
+		_, err := Eval(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestContext_CompileMapSetLiterals(t *testing.T) {
+	cases := map[string]string{
+		`{:a 1 :b [2 {:c 3}]}`:                               "{:a 1, :b [2 {:c 3}]}",
+		`(let [f (fn [x] {:a x :b (inc x)})] [(f 1) (f 2)])`: "[{:a 1, :b 2} {:a 2, :b 3}]",
+		`(let [x 2] (count #{1 x 3}))`:                       "3",
+		`(#{:a :b} :b)`:                                      ":b",
+		`'{:a b}`:                                            "{:a b}",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	// constant literals are loaded in one go, others are built by calling hash-map
+	ctx := NewCompiler(rt.NS("user"))
+	single, err := ctx.Compile(`:a`)
+	assert.NoError(t, err)
+	constant, err := ctx.Compile(`{:a 1 :b 2}`)
+	assert.NoError(t, err)
+	assert.Equal(t, single.Length(), constant.Length())
+	built, err := ctx.Compile(`{:a 1 :b (inc 1)}`)
+	assert.NoError(t, err)
+	assert.Greater(t, built.Length(), constant.Length())
+	v, err := vm.NewFrame(built, nil).Run()
+	assert.NoError(t, err)
+	assert.IsType(t, &vm.Map{}, v)
+	assert.Equal(t, vm.Int(2), vm.Get(v, vm.Keyword("b"), vm.NIL))
+}
+
+func TestContext_CompileVectorLiterals(t *testing.T) {
+	cases := map[string]string{
+		`[1 (+ 1 1) 3]`:                            "[1 2 3]",
+		`[[1 (inc 1)] [:a [(str "b")]] []]`:        `[[1 2] [:a ["b"]] []]`,
+		`(let [f (fn [x] [x [x]])] [(f 1) (f 2)])`: "[[1 [1]] [2 [2]]]",
+		`(= [1 2] [(inc 0) (inc 1)])`:              "true",
+	}
+	for src, out := range cases {
+		_, v, err := NewCompiler(rt.NS("user")).SetVerify(true).CompileMultiple(strings.NewReader(src))
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	ctx := NewCompiler(rt.NS("user"))
+	single, err := ctx.Compile(`:a`)
+	assert.NoError(t, err)
+	constant, err := ctx.Compile(`[1 [2 :b] "c"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, single.Length(), constant.Length())
+	built, err := ctx.Compile(`[1 (+ 1 1) 3]`)
+	assert.NoError(t, err)
+	v, err := vm.NewFrame(built, nil).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, vm.ArrayVector{vm.Int(1), vm.Int(2), vm.Int(3)}, v)
+}
+
+func TestContext_Complete(t *testing.T) {
+	ctx := NewCompiler(rt.NS("user"))
+	assert.Equal(t, []string{"if", "if-let", "if-not"}, ctx.Complete("if"))
+	assert.Equal(t, []string{"string/replace"}, ctx.Complete("string/re"))
+	assert.Equal(t, []string{"clojure.string/replace"}, ctx.Complete("clojure.string/"))
+	assert.Empty(t, ctx.Complete("nope/"))
+	assert.Empty(t, ctx.Complete("zzz"))
+	assert.Contains(t, ctx.Complete("/"), "/")
+
+	// the user's own vars come along with the ones referred from lang
+	_, err := ctx.Compile(`(def complete-me 1)`)
+	assert.NoError(t, err)
+	names := ctx.Complete("comp")
+	assert.Contains(t, names, "complete-me")
+	assert.Contains(t, names, "complete")
+	assert.True(t, sort.StringsAreSorted(names))
+
+	v, err := Eval(`(complete "if-" 'lang)`)
+	assert.NoError(t, err)
+	assert.Equal(t, `["if-let" "if-not"]`, v.String())
+	_, err = Eval(`(complete 'if)`)
+	assert.Error(t, err)
+}
+
+type beanPoint struct {
+	X, Y  int
+	Label string
+}
+
+func TestContext_CompileBean(t *testing.T) {
+	rt.NS("user").Def("bean-point", vm.NewBoxed(&beanPoint{X: 1, Y: 2, Label: "p"}))
+	cases := map[string]string{
+		`(:label (bean bean-point))`:                    `"p"`,
+		`(let [b (bean bean-point)] (+ (:x b) (b :y)))`: "3",
+		`(count (bean bean-point))`:                     "3",
+	}
+	for src, out := range cases {
+		_, v, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(src))
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+	_, _, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(`(bean 1)`))
+	assert.Error(t, err)
+}
+
+type hostCircle struct{ R int }
+type hostSquare struct{ Side int }
+
+func TestContext_CompileInstanceOf(t *testing.T) {
+	host, err := vm.NewNamespaceBuilder("shapes").
+		DefType("Circle", hostCircle{}).
+		DefType("Square", hostSquare{}).
+		Def("circle", vm.NewBoxed(&hostCircle{R: 2})).
+		Def("square", vm.NewBoxed(hostSquare{Side: 3})).
+		Build()
+	assert.NoError(t, err)
+	rt.RegisterNS(host)
+
+	src := `(defprotocol HostShape (host-area [s]))
+		(extend-type Circle HostShape (host-area [c] (* 3 (:r (bean c)) (:r (bean c)))))
+		(extend-type Square HostShape (host-area [s] (* (:side (bean s)) (:side (bean s)))))
+		(defn host-kind [s] (cond (instance? shapes/Circle s) :circle (instance? shapes/Square s) :square :else :other))
+		[(host-area shapes/circle) (host-area shapes/square)
+		 (host-kind shapes/circle) (host-kind shapes/square) (host-kind 1)
+		 (instance? shapes/Circle shapes/square)]`
+	_, v, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, "[12 9 :circle :square :other false]", v.String())
+
+	_, _, err = NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(`(instance? :Circle 1)`))
+	assert.Error(t, err)
+}
+
+func TestContext_CompileFutures(t *testing.T) {
+	cases := map[string]string{
+		`(futures-join [(future (time/sleep 30) :a) (future (time/sleep 10) :b) (future :c)])`: "[:a :b :c]",
+		`(futures-join (map (fn [n] (future (time/sleep (- 20 n)) (* n n))) (range 5)))`:       "[0 1 4 9 16]",
+		`(let [f (future (+ 1 2))] [@f (realized? f) (future? f) (future? 1)])`:                "[3 true true false]",
+		`(futures-join [])`: "[]",
+		// bindings are local to the goroutine making them, futures get the ones in effect where they're started
+		`(= (futures-join (map (fn [n] (future (binding [*print-sorted* n] (time/sleep (- 20 n)) *print-sorted*))) (range 20)))
+		    (range 20))`: "true",
+		`(binding [*print-sorted* :outer] @(future *print-sorted*))`:                                       ":outer",
+		`(binding [*print-sorted* :outer] @(future (var-set (var *print-sorted*) :inner)) *print-sorted*)`: ":outer",
+		`(do @(future (binding [*print-sorted* :inner] (time/sleep 1))) *print-sorted*)`:                   "false",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(futures-join [(future (time/sleep 200) 1) (future (throw "failed"))])`)
+	assert.Error(t, err)
+	_, err = Eval(`(futures-join [1])`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileLocking(t *testing.T) {
+	cases := map[string]string{
+		// the read and the reset are separate steps, without the lock increments would get lost
+		`(let [counter (atom 0)
+		       lock (atom nil)
+		       work (fn [] (loop [i 0]
+		                     (when (< i 20)
+		                       (locking lock (let [v @counter] (time/sleep 1) (reset! counter (inc v))))
+		                       (recur (inc i)))))]
+		   (futures-join [(future (work)) (future (work))])
+		   @counter)`: "40",
+		`(let [lock (atom nil)]
+		   [(try (locking lock (throw "failed")) (catch Error e :caught)) (locking lock :locked-again)])`: "[:caught :locked-again]",
+		`(locking :k (+ 1 2))`: "3",
+		// monitors are reentrant
+		`(let [lock (atom nil)] (locking lock (locking lock :nested)))`: ":nested",
+		`(let [lock (atom nil)
+		       f (fn [] (locking lock :again))]
+		   [(locking lock (f)) (locking lock :after)])`: "[:again :after]",
+		`(let [lock (atom nil)
+		       counter (atom 0)
+		       work (fn [] (loop [i 0]
+		                     (when (< i 20)
+		                       (locking lock (locking lock (let [v @counter] (time/sleep 1) (reset! counter (inc v)))))
+		                       (recur (inc i)))))]
+		   (futures-join [(future (work)) (future (work))])
+		   @counter)`: "40",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(locking [1 2] 3)`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileAgents(t *testing.T) {
+	cases := map[string]string{
+		`(let [a (agent [])]
+		   (loop [i 0] (when (< i 100) (send a conj i) (recur (inc i))))
+		   (await a)
+		   (= @a (apply vector (range 100))))`: "true",
+		`(let [a (agent 1)] (send a + 2 3) (send a * 10) (await a) @a)`: "60",
+		`(let [a (agent 1)]
+		   (send a (fn [x] (throw {:failed-at x})))
+		   [(try (await a) (catch Error e e)) (agent-error a) @a])`: "[{:failed-at 1} {:failed-at 1} 1]",
+		`(let [a (agent 1)]
+		   (send a (fn [x] (throw "failed")))
+		   (try (await a) (catch Error e nil))
+		   (restart-agent a 10)
+		   (send a inc)
+		   (await a)
+		   [@a (agent-error a)])`: "[11 nil]",
+		// actions see the bindings in effect where they were sent, not the ones of other senders
+		`(let [a (agent [])]
+		   (binding [*print-sorted* :first] (send a conj *print-sorted*) (send a (fn [v] (conj v *print-sorted*))))
+		   (send a (fn [v] (conj v *print-sorted*)))
+		   (await a)
+		   @a)`: "[:first :first false]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(let [a (agent 1)] (send a (fn [x] (throw "failed"))) (try (await a) (catch Error e nil)) (send a inc))`)
+	assert.Error(t, err)
+	_, err = Eval(`(restart-agent (agent 1) 2)`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompilePrStr(t *testing.T) {
+	cases := map[string]string{
+		`(pr-str "a\"b" \c nil [:k/v "\\"])`:                                                  `"\"a\\\"b\" \\c nil [:k/v \"\\\\\"]"`,
+		`(= "\\" (read-string (pr-str "\\")))`:                                                "true",
+		`(= "" (read-string (pr-str "")))`:                                                    "true",
+		`(let [x {:s "tab\tnew\nline" :c [\newline \space]}] (= x (read-string (pr-str x))))`: "true",
+		`(pr-str)`: `""`,
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	out := &bytes.Buffer{}
+	outVar := rt.NS("lang").Lookup("*out*").(*vm.Var)
+	assert.NoError(t, outVar.PushBinding(vm.NewBoxed(io.Writer(out))))
+	defer outVar.PopBinding()
+	_, err := Eval(`(prn "x" \y 1)`)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"x\" \\y 1\n", out.String())
+}
+
+func TestContext_CompileParse(t *testing.T) {
+	cases := map[string]string{
+		`(parse-long "abc")`: "nil",
+		`(parse-long "-42")`: "-42",
+		`(parse-long "+7")`:  "7",
+		`[(parse-long "") (parse-long "1.5") (parse-long "1_000") (parse-long "99999999999999999999")]`: "[nil nil nil nil]",
+		`[(parse-double "1e3") (parse-double "-2.5E-3") (parse-double "7")]`:                            "[1000.0 -0.0025 7.0]",
+		`[(parse-double "1.2.3") (parse-double "") (parse-double "1e400")]`:                             "[nil nil ##Inf]",
+		`[(parse-double ".5") (parse-double "5.") (parse-double "-Infinity") (parse-double "NaN")]`:     "[0.5 5.0 ##-Inf ##NaN]",
+		// Go only syntax isn't accepted
+		`[(parse-double "1_000.0") (parse-double "0x1p4") (parse-double "0x10")]`:                                         "[nil nil nil]",
+		`[(parse-double "inf") (parse-double "Inf") (parse-double "infinity") (parse-double "nan") (parse-double "NAN")]`: "[nil nil nil nil nil]",
+		`[(parse-double " 1.0") (parse-double "1e") (parse-double ".") (parse-double "+")]`:                               "[nil nil nil nil]",
+		`[(parse-boolean "true") (parse-boolean "false") (parse-boolean "True") (parse-boolean "yes")]`:                   "[true false nil nil]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(parse-long 12)`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompilePrintSorted(t *testing.T) {
+	cases := map[string]string{
+		// array maps print in insertion order, so equal ones built in different orders print differently
+		`(let [a (array-map :b 1 :a 2 :c 3)
+		       b (reduce (fn [m k] (assoc m k ({:a 2 :b 1 :c 3} k))) (array-map) [:c :a :b])]
+		   [(= a b) (= (pr-str a) (pr-str b)) (binding [*print-sorted* true] [(= (pr-str a) (pr-str b)) (pr-str b)])])`: `[true false [true "{:a 2, :b 1, :c 3}"]]`,
+		`(binding [*print-sorted* true] (pr-str (hash-set 10 2 30 1) (conj (hash-set "b" :a nil) 2.5)))`: `"#{1 2 10 30} #{nil :a 2.5 \"b\"}"`,
+		`(binding [*print-sorted* true] (pr-str {[2] {:y 1 :x 2} [1] #{:b :a}}))`:                        `"{[1] #{:a :b}, [2] {:x 2, :y 1}}"`,
+		`(let [s (hash-set 3 1 2)] (binding [*print-sorted* true] (pr-str s)) (= s (hash-set 1 2 3)))`:   "true",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+}
+
+func TestContext_CompileDebugHook(t *testing.T) {
+	cases := map[string]string{
+		// stepping calls the hook before every instruction of the function and the ones it calls
+		`(let [ops (atom []) inc2 (fn [x] (+ x 2))]
+		   [(binding [*debug-hook* (fn [s] (swap! ops conj (:op s)) :step)] (inc2 40))
+		    (= (peek @ops) :RET)
+		    (< 3 (count @ops))])`: "[42 true true]",
+		`(let [calls (atom 0) inc2 (fn [x] (+ x 2))]
+		   [(binding [*debug-hook* (fn [s] (swap! calls inc) :continue)] (inc2 40)) @calls])`: "[42 1]",
+		`(let [seen (atom nil) twice (fn [x] (let [y (* x 2)] y))]
+		   (binding [*debug-hook* (fn [s] (when (= (:op s) :RET) (when (nil? @seen) (reset! seen [(:args s) (:locals s)]))) nil)] (twice 21))
+		   @seen)`: "[[21] [42]]",
+		`(let [inc2 (fn [x] (+ x 2))] (binding [*debug-hook* nil] (inc2 1)))`: "3",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(binding [*debug-hook* (fn [s] (if (= (:op s) :INV) :abort :step))] ((fn [x] (inc x)) 1))`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "aborted by debugger")
+	_, err = Eval(`(binding [*debug-hook* (fn [s] :bogus)] ((fn [] 1)))`)
+	assert.Error(t, err)
+	_, err = Eval(`(binding [*debug-hook* (fn [s] [])] ((fn [] 1)))`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a debugger action")
+}
+
+func TestContext_CompileBreakpoint(t *testing.T) {
+	cases := map[string]string{
+		// without a debugger breakpoints do nothing
+		`((fn [x] (let [y (* x 2)] (breakpoint) (+ x y))) 5)`: "15",
+		`(let [hits (atom [])
+		       f (fn [x] (let [y (* x 2) g (fn [] (breakpoint) y)] (g)))]
+		   (binding [*debug-hook* (fn [s]
+		                            (when (= (:op s) :breakpoint)
+		                              (swap! hits conj (dissoc (:locals s) 'hits 'f 'g)))
+		                            :continue)]
+		     [(f 5) (binding [*print-sorted* true] (pr-str @hits))]))`: `[10 "[{x 5, y 10}]"]`,
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(binding [*debug-hook* (fn [s] (if (= (:op s) :breakpoint) :abort :continue))] ((fn [] (breakpoint) 1)))`)
+	assert.Error(t, err)
+	_, err = Eval(`(breakpoint 1)`)
+	assert.Error(t, err)
+
+	out := &bytes.Buffer{}
+	outVar := rt.NS("lang").Lookup("*out*").(*vm.Var)
+	assert.NoError(t, outVar.PushBinding(vm.NewBoxed(io.Writer(out))))
+	defer outVar.PopBinding()
+	v, err := Eval(`(binding [*in* (push-back-reader "(+ x y) (nope) :continue")
+	                          *debug-hook* debug-repl]
+	                  ((fn [x] (let [y (* x 2)] (breakpoint) (+ x y))) 5))`)
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(15), v)
+	assert.Contains(t, out.String(), "breakpoint, locals: x y\ndebug=> 15\ndebug=> ")
+	assert.Contains(t, out.String(), "unable to resolve symbol: nope")
+}
+
+func TestContext_CompileWithLocalVars(t *testing.T) {
+	cases := map[string]string{
+		`(with-local-vars [sum 0 i 1]
+		   (loop []
+		     (when (< (var-get i) 11)
+		       (var-set sum (+ (var-get sum) (var-get i)))
+		       (var-set i (inc @i))
+		       (recur)))
+		   [(var-get sum) @i])`: "[55 11]",
+		`(with-local-vars [xs []] (doseq [x (range 4)] (var-set xs (conj @xs (* x x)))) @xs)`: "[0 1 4 9]",
+		`(with-local-vars [x 1] (with-local-vars [x 2] (var-set x 3)) @x)`:                    "1",
+		// the vars are unbound once the body is left
+		`(let [v (with-local-vars [x 1] x)] [(var-get v) (try (var-set v 2) (catch Error e :unbound))])`: "[nil :unbound]",
+	}
+	for src, out := range cases {
+		v, err := Eval(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, out, v.String(), src)
+	}
+
+	_, err := Eval(`(var-set (var *out*) 1)`)
+	assert.Error(t, err)
+	_, err = Eval(`(var-get 1)`)
+	assert.Error(t, err)
+}
+
+func TestContext_CompileBytecode(t *testing.T) {
+	src := `(defn bytecode-adder [n] (fn [x] (+ x n)))
+		(def bytecode-calls (atom 0))
+		(swap! bytecode-calls inc)
+		(list ((bytecode-adder 40) 2) '(a [b 1.5] :k "s" \c nil true) @bytecode-calls)`
+	chunk, out, err := NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, `(42 (a [b 1.5] :k "s" \c nil true) 1)`, out.String())
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, vm.EncodeChunk(buf, chunk))
+	encoded := buf.Bytes()
+
+	loaded, err := vm.DecodeChunk(bytes.NewReader(encoded), rt.ResolveVar)
+	assert.NoError(t, err)
+	out, err = vm.NewFrame(loaded, nil).Run()
+	assert.NoError(t, err)
+	// running the program again redefines the atom
+	assert.Equal(t, `(42 (a [b 1.5] :k "s" \c nil true) 1)`, out.String())
+
+	stale := append([]byte{}, encoded...)
+	stale[4] = vm.BytecodeVersion + 1
+	_, err = vm.DecodeChunk(bytes.NewReader(stale), rt.ResolveVar)
+	assert.EqualError(t, err, fmt.Sprintf("ExecutionError: bytecode version %d is not supported, expected %d, compile the source again", vm.BytecodeVersion+1, vm.BytecodeVersion))
+
+	_, err = vm.DecodeChunk(strings.NewReader("(+ 1 2)"), rt.ResolveVar)
+	assert.EqualError(t, err, "ExecutionError: not a let-go bytecode file")
+}
+
+func TestContext_CompileNoCore(t *testing.T) {
+	assert.NoError(t, rt.InstallOnly())
+	defer func() {
+		assert.NoError(t, rt.InstallOnly(rt.StdlibNames()...))
+	}()
+	assert.Nil(t, rt.NS("lang"))
+
+	c := NewCompiler(rt.NS("user"))
+	_, out, err := c.CompileMultiple(strings.NewReader("(def x 1) (let [y [x 2]] y)"))
+	assert.NoError(t, err)
+	assert.Equal(t, []vm.Value{vm.Int(1), vm.Int(2)}, out.Unbox())
+
+	// special forms expanding to calls of lang still work
+	for src, expected := range map[string]string{
+		"(try 1 (finally 2))":                 "1",
+		"((fn [x] {:pre [x] :post [%]} x) 3)": "3",
+		"(let [[a & b] [1 2]] [a b])":         "[1 (2)]",
+	} {
+		_, out, err = c.CompileMultiple(strings.NewReader(src))
+		assert.NoError(t, err, src)
+		if err == nil {
+			assert.Equal(t, expected, out.String(), src)
+		}
+	}
+	_, _, err = c.CompileMultiple(strings.NewReader("(refer 'lang)"))
+	assert.EqualError(t, err, "ExecutionError: no namespace: lang found")
+
+	_, _, err = c.CompileMultiple(strings.NewReader("(+ 1 2)"))
+	assert.Error(t, err)
+	_, _, err = c.CompileMultiple(strings.NewReader("lang/println"))
+	assert.EqualError(t, err, "CompileError: no such namespace: lang")
+
+	assert.NoError(t, rt.InstallOnly("math"))
+	_, out, err = NewCompiler(rt.NS("user")).CompileMultiple(strings.NewReader("(math/sqrt 4.0)"))
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Float(2), out)
+	assert.Error(t, rt.InstallOnly("nope"))
+}
+
+// forms expanding to calls of lang work with only other namespaces installed
+func TestContext_CompileWithoutLang(t *testing.T) {
+	assert.NoError(t, rt.InstallOnly("math"))
+	defer func() {
+		assert.NoError(t, rt.InstallOnly(rt.StdlibNames()...))
+	}()
+
+	c := NewCompiler(rt.NS("user"))
+	cases := map[string]string{
+		"(try (math/sqrt 4.0) (finally 1))":                 "2.0",
+		`(try (math/sqrt "x") (catch Exception e :caught))`: ":caught",
+		"(refer 'math) (sqrt 9.0)":                          "3.0",
+		"((fn [x] {:pre [x] :post [%]} x) 1)":               "1",
+		"(let [[a & b] [1 2 3]] [a b])":                     "[1 (2 3)]",
+	}
+	for src, expected := range cases {
+		_, out, err := c.CompileMultiple(strings.NewReader(src))
+		assert.NoError(t, err, src)
+		if err == nil {
+			assert.Equal(t, expected, out.String(), src)
+		}
+	}
+	_, _, err := c.CompileMultiple(strings.NewReader("((fn [x] {:pre [x]} x) false)"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Assert failed: x")
+	_, _, err = c.CompileMultiple(strings.NewReader("((fn [x] {:post [%]} x) false)"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Assert failed: %")
+}
+
 func TestContext_CompileVar(t *testing.T) {
-	v := vm.NewVar(rt.NS("lang"), "lang", "foo")
+	v := rt.NS("lang").Def("foo", vm.Int(1))
 
 	out, err := Eval("(var foo)")
 	assert.NoError(t, err)
@@ -114,4 +1824,140 @@ func TestContext_CompileVar(t *testing.T) {
 	out, err = Eval("#'foo")
 	assert.NoError(t, err)
 	assert.Equal(t, v, out)
+
+	out, err = Eval("#'println")
+	assert.NoError(t, err)
+	assert.IsType(t, &vm.Var{}, out)
+
+	out, err = Eval("(var math/sqrt)")
+	assert.NoError(t, err)
+	assert.Equal(t, rt.NS("math").Lookup("sqrt"), out)
+
+	_, err = Eval("(var surely-not-defined)")
+	assert.EqualError(t, err, "CompileError at (<default>:1:1): unable to resolve var: surely-not-defined in this context")
+
+	_, err = Eval("(var 1)")
+	assert.Error(t, err)
+}
+
+func benchmarkApply(b *testing.B, src string) {
+	_, err := Eval("(def bench-xs (range 1000))")
+	assert.NoError(b, err)
+	chunk, err := NewCompiler(rt.NS("lang")).Compile(src)
+	assert.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := vm.NewFrame(chunk, nil).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkApplyInstruction measures apply compiled to the APP instruction
+func BenchmarkApplyInstruction(b *testing.B) {
+	benchmarkApply(b, "(apply + bench-xs)")
+}
+
+// BenchmarkApplyNative measures the same call going through the apply native
+func BenchmarkApplyNative(b *testing.B) {
+	benchmarkApply(b, "((var apply) + bench-xs)")
+}
+
+func benchmarkLoop(b *testing.B, run func(f *vm.Frame) (vm.Value, error)) {
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(loop [i 0] (if (< i 1000) (recur (inc i)) i))")
+	assert.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := run(vm.NewFrame(chunk, nil))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoop(b *testing.B) {
+	benchmarkLoop(b, (*vm.Frame).Run)
+}
+
+// BenchmarkLoopWithContext measures the cost of checking for cancellation on every iteration
+func BenchmarkLoopWithContext(b *testing.B) {
+	ctx := context.Background()
+	benchmarkLoop(b, func(f *vm.Frame) (vm.Value, error) {
+		return f.RunWithContext(ctx)
+	})
+}
+
+// benchmarkSum sums numbers below 1000 with a fn taking the limit and a starting value of 0
+func benchmarkSum(b *testing.B, fn string) {
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(" + fn + " 1000 0)")
+	assert.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out, err := vm.NewFrame(chunk, nil).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if out != vm.Int(499500) {
+			b.Fatal(out)
+		}
+	}
+}
+
+func BenchmarkSum(b *testing.B) {
+	benchmarkSum(b, "(fn [n start] (loop [i start acc start] (if (< i n) (recur (inc i) (+ acc i)) acc)))")
+}
+
+func benchmarkFib(b *testing.B, src string) {
+	chunk, err := NewCompiler(rt.NS("lang")).Compile(src)
+	assert.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out, err := vm.NewFrame(chunk, nil).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if out != vm.Int(6765) {
+			b.Fatal(out)
+		}
+	}
+}
+
+// BenchmarkFib computes fib with arithmetic compiled to instructions
+func BenchmarkFib(b *testing.B) {
+	benchmarkFib(b, "(do (defn bench-fib [n] (if (< n 2) n (+ (bench-fib (- n 1)) (bench-fib (- n 2))))) (bench-fib 20))")
+}
+
+// BenchmarkFibCalls computes fib with the operators shadowed by locals so they are called like other functions
+func BenchmarkFibCalls(b *testing.B) {
+	benchmarkFib(b, "(let [< < + + - -] (defn bench-fib-calls [n] (if (< n 2) n (+ (bench-fib-calls (- n 1)) (bench-fib-calls (- n 2))))) (bench-fib-calls 20))")
+}
+
+// BenchmarkCountingLoop reports allocations of a loop counting to 1000, the loop itself doesn't allocate
+// so they come from boxing the 745 Ints above 255, see TestContext_CompileLoopAllocations
+func BenchmarkCountingLoop(b *testing.B) {
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(loop [i 0] (if (< i 1000) (recur (inc i)) i))")
+	assert.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := vm.NewFrame(chunk, nil).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkClosures creates closures capturing three values in a loop
+func BenchmarkClosures(b *testing.B) {
+	chunk, err := NewCompiler(rt.NS("lang")).Compile("(loop [i 0 j 1 f nil] (if (< i 1000) (recur (inc i) j (fn [] (list i j f))) f))")
+	assert.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := vm.NewFrame(chunk, nil).Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/rt"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// Complete returns names starting with prefix which can be used in the context's namespace, sorted and without
+// duplicates. These are its vars, vars of namespaces it refers and special forms. Prefixes qualified with
+// a namespace like string/jo complete vars of that namespace.
+func (c *Context) Complete(prefix string) []string {
+	return complete(c.ns, prefix)
+}
+
+func complete(ns *vm.Namespace, prefix string) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	// a lone / is the division function, not a qualifier
+	if i := strings.IndexByte(prefix, '/'); i > 0 {
+		if other := rt.NS(prefix[:i]); other != nil {
+			for _, s := range other.Symbols() {
+				add(prefix[:i+1] + string(s))
+			}
+		}
+	} else {
+		visited := map[*vm.Namespace]bool{}
+		var addVisible func(n *vm.Namespace)
+		addVisible = func(n *vm.Namespace) {
+			if visited[n] {
+				return
+			}
+			visited[n] = true
+			for _, s := range n.Symbols() {
+				add(string(s))
+			}
+			for _, r := range n.Refers() {
+				addVisible(r)
+			}
+		}
+		addVisible(ns)
+		for s := range specialForms {
+			add(string(s))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// installCompleteFns defines complete in lang, it lives here because it lists special forms
+func installCompleteFns() {
+	ns := rt.Stdlib("lang")
+
+	completef, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 && len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		prefix, ok := vs[0].(vm.String)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a prefix", vm.StringType)
+		}
+		in := rt.NS("user")
+		if len(vs) == 2 {
+			switch n := vs[1].(type) {
+			case *vm.Namespace:
+				in = n
+			case vm.Symbol:
+				if in = rt.NS(string(n)); in == nil {
+					return vm.NIL, vm.NewExecutionError(fmt.Sprintf("no namespace: %s found", n))
+				}
+			default:
+				return vm.NIL, vm.NewTypeError(vs[1], "is not a namespace or symbol", nil)
+			}
+		}
+		names := complete(in, string(prefix))
+		out := make([]vm.Value, len(names))
+		for i := range names {
+			out[i] = vm.String(names[i])
+		}
+		return vm.NewVector(out), nil
+	})
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	ns.Def("complete", completef)
+}
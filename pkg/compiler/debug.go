@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/rt"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// visibleLocals returns names of locals and arguments of the fn being compiled and the fns around it, sorted.
+// Temporaries made by destructuring and loop are left out.
+func (c *Context) visibleLocals() []vm.Symbol {
+	seen := map[vm.Symbol]bool{}
+	var names []vm.Symbol
+	add := func(s vm.Symbol) {
+		if !seen[s] && !strings.Contains(string(s), "__") {
+			seen[s] = true
+			names = append(names, s)
+		}
+	}
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		for _, scope := range ctx.locals {
+			for s := range scope {
+				add(s)
+			}
+		}
+		for s := range ctx.formalArgs {
+			add(s)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// breakpointCompiler compiles (breakpoint) to a call passing breakpoint* the names and values of all locals in scope
+func breakpointCompiler(c *Context, form vm.Value) error {
+	if form.(*vm.List).Rest() != vm.EmptyList {
+		return NewCompileError("breakpoint takes no arguments")
+	}
+	c.EmitWithArg(vm.OPLDC, c.Constant(rt.Stdlib("lang").Lookup("breakpoint*")))
+	c.incSP(1)
+	names := c.visibleLocals()
+	for _, name := range names {
+		c.EmitWithArg(vm.OPLDC, c.Constant(name))
+		c.incSP(1)
+		if err := c.compileForm(name); err != nil {
+			return NewCompileError("compiling breakpoint").Wrap(err)
+		}
+	}
+	c.EmitWithArg(vm.OPINV, 2*len(names))
+	c.decSP(2 * len(names))
+	return nil
+}
+
+// inReader is the reader of *in*, debug-repl reads what to evaluate from it
+func inReader() (*LispReader, error) {
+	return theReader(rt.Stdlib("lang").Lookup("*in*").(*vm.Var).Deref())
+}
+
+// debugREPL is a debug hook reading forms from *in* at breakpoints and evaluating them with the locals
+// of the breakpoint bound, :continue or the end of input resume execution and :abort stops it.
+// Instructions run between breakpoints aren't stepped through.
+func debugREPL(vs []vm.Value) (vm.Value, error) {
+	state := vs[0]
+	if vm.Get(state, vm.Keyword("op"), vm.NIL) != vm.Keyword("breakpoint") {
+		return vm.Keyword("continue"), nil
+	}
+	locals, err := vm.AppendElements(nil, vm.Get(state, vm.Keyword("locals"), vm.EmptyMap))
+	if err != nil {
+		return vm.NIL, err
+	}
+	// locals are bound to their values quoted so they aren't evaluated again
+	bindings := make([]vm.Value, 0, 2*len(locals))
+	names := make([]string, len(locals))
+	for i := range locals {
+		e := locals[i].(vm.MapEntry)
+		bindings = append(bindings, e.Key(), vm.NewList([]vm.Value{vm.Symbol("quote"), e.Val()}))
+		names[i] = e.Key().String()
+	}
+	sort.Strings(names)
+
+	out, ok := rt.Stdlib("lang").Lookup("*out*").(*vm.Var).Deref().Unbox().(io.Writer)
+	if !ok {
+		return vm.NIL, vm.NewExecutionError("*out* is not a writer")
+	}
+	in, err := inReader()
+	if err != nil {
+		return vm.NIL, err
+	}
+	fmt.Fprintf(out, "breakpoint, locals: %s\n", strings.Join(names, " "))
+	for {
+		fmt.Fprint(out, "debug=> ")
+		form, err := in.ReadForm()
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return vm.Keyword("continue"), nil
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		if form == vm.Keyword("continue") || form == vm.Keyword("abort") {
+			return form, nil
+		}
+		let := vm.NewList([]vm.Value{vm.Symbol("let"), vm.NewVector(bindings), form})
+		v, err := NewCompiler(rt.NS("user")).SetSource("<debug>").evalForm(let)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		fmt.Fprintln(out, v.String())
+	}
+}
+
+// installDebugFns defines *in* reading stdin and debug-repl, which need the reader and the compiler
+func installDebugFns() {
+	ns := rt.Stdlib("lang")
+	ns.Def("*in*", NewReaderValue(NewLispReader(os.Stdin, "<stdin>"))).SetDynamic()
+	ns.Def("debug-repl", vm.NativeTyped("debug-repl", []vm.ValueType{vm.AnyType}, debugREPL))
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// destructureCounter keeps names of temporary locals introduced by destructuring unique
+var destructureCounter int
+
+// destructure expands let-style bindings into plain symbol/form pairs.
+// Vector patterns bind elements by position, & binds the remaining elements and :as binds the whole value:
+//
+//	(let [[a [b c] & more :as all] xs] ...)
+//
+// Generated forms call nth and nthnext of lang with langCall so they work even if those names are shadowed locally.
+func destructure(binds vm.ArrayVector) (vm.ArrayVector, error) {
+	out := vm.ArrayVector{}
+	for i := 0; i < len(binds); i += 2 {
+		if i+1 >= len(binds) {
+			return nil, NewCompileError("bindings must have even number of forms")
+		}
+		var err error
+		out, err = destructurePattern(out, binds[i], binds[i+1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func destructurePattern(out vm.ArrayVector, pattern vm.Value, init vm.Value) (vm.ArrayVector, error) {
+	switch p := pattern.(type) {
+	case vm.Symbol, *hintedSymbol:
+		return append(out, p, init), nil
+	case vm.ArrayVector:
+		destructureCounter++
+		tmp := vm.Symbol(fmt.Sprintf("vec__%d", destructureCounter))
+		out = append(out, tmp, init)
+		n := 0
+		for i := 0; i < len(p); i++ {
+			switch p[i] {
+			case vm.Symbol("&"):
+				if i+1 >= len(p) {
+					return nil, NewCompileError("missing binding after & in destructuring pattern")
+				}
+				rest := langCall("nthnext", tmp, vm.Int(n))
+				var err error
+				out, err = destructurePattern(out, p[i+1], rest)
+				if err != nil {
+					return nil, err
+				}
+				i++
+			case vm.Keyword("as"):
+				if i+1 >= len(p) || p[i+1].Type() != vm.SymbolType {
+					return nil, NewCompileError(":as in destructuring pattern must be followed by a symbol")
+				}
+				out = append(out, p[i+1], tmp)
+				i++
+			default:
+				elem := langCall("nth", tmp, vm.Int(n), vm.NIL)
+				var err error
+				out, err = destructurePattern(out, p[i], elem)
+				if err != nil {
+					return nil, err
+				}
+				n++
+			}
+		}
+		return out, nil
+	default:
+		return nil, NewCompileError(fmt.Sprintf("unsupported binding form %v", pattern))
+	}
+}
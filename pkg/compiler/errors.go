@@ -19,8 +19,10 @@ package compiler
 
 import (
 	"fmt"
-	"github.com/nooga/let-go/pkg/errors"
 	"io"
+
+	"github.com/nooga/let-go/pkg/errors"
+	"github.com/nooga/let-go/pkg/vm"
 )
 
 type ReaderError struct {
@@ -63,6 +65,11 @@ func (r *ReaderError) Error() string {
 		))
 }
 
+// Location implements errors.Located
+func (r *ReaderError) Location() (string, int, int) {
+	return r.inputName, r.line + 1, r.column + 1
+}
+
 func (r *ReaderError) Wrap(err error) errors.Error {
 	r.cause = err
 	return r
@@ -75,6 +82,9 @@ func (r *ReaderError) GetCause() error {
 type CompileError struct {
 	message string
 	cause   error
+	source  string
+	line    int
+	column  int
 }
 
 func NewCompileError(message string) *CompileError {
@@ -84,10 +94,47 @@ func NewCompileError(message string) *CompileError {
 }
 
 func (r *CompileError) Error() string {
+	if r.line > 0 {
+		return errors.AddCause(r,
+			fmt.Sprintf("CompileError at (%s:%d:%d): %s", r.source, r.line, r.column, r.message))
+	}
 	return errors.AddCause(r,
 		fmt.Sprintf("CompileError: %s", r.message))
 }
 
+// locate attaches the source position from form's metadata to err unless it already has one
+func (c *Context) locate(err error, form vm.Value) error {
+	cerr, ok := err.(*CompileError)
+	if !ok || cerr.line > 0 {
+		return err
+	}
+	line, column := formPosition(form)
+	if line > 0 {
+		cerr.source, cerr.line, cerr.column = c.source, line, column
+	}
+	return err
+}
+
+// formPosition returns the position the reader recorded in form's metadata or zeroes if there is none
+func formPosition(form vm.Value) (int, int) {
+	m, ok := form.(vm.Metadatable)
+	if !ok {
+		return 0, 0
+	}
+	meta, ok := m.Meta().(*vm.Map)
+	if !ok {
+		return 0, 0
+	}
+	line, _ := meta.ValueAt(vm.Keyword("line")).(vm.Int)
+	column, _ := meta.ValueAt(vm.Keyword("column")).(vm.Int)
+	return int(line), int(column)
+}
+
+// Location implements errors.Located, errors raised where no form had a position have a zero line
+func (r *CompileError) Location() (string, int, int) {
+	return r.source, r.line, r.column
+}
+
 func (r *CompileError) Wrap(err error) errors.Error {
 	r.cause = err
 	return r
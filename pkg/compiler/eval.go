@@ -18,13 +18,15 @@
 package compiler
 
 import (
+	"fmt"
+
 	"github.com/nooga/let-go/pkg/rt"
 	"github.com/nooga/let-go/pkg/vm"
 	"strings"
 )
 
 func Eval(src string) (vm.Value, error) {
-	ns := rt.NS("lang")
+	ns := rt.Stdlib("lang")
 	compiler := NewCompiler(ns)
 
 	_, out, err := compiler.CompileMultiple(strings.NewReader(src))
@@ -42,8 +44,42 @@ func Eval(src string) (vm.Value, error) {
 }
 
 func evalInit() {
+	installMacroexpand()
+	installReadFns()
+	installLoadFns()
+	installCompleteFns()
+	installDebugFns()
 	_, err := Eval(rt.CoreSrc)
 	if err != nil {
 		panic(err)
 	}
+	installInlined()
+}
+
+// installMacroexpand defines macroexpand-1 and macroexpand in lang, they live here because
+// expansion needs the compiler. Symbols in expanded forms are resolved against lang.
+func installMacroexpand() {
+	ns := rt.Stdlib("lang")
+
+	macroexpand1, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		out, _, err := NewCompiler(ns).MacroExpand1(vs[0])
+		return out, err
+	})
+
+	macroexpand, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return NewCompiler(ns).MacroExpand(vs[0])
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	ns.Def("macroexpand-1", macroexpand1)
+	ns.Def("macroexpand", macroexpand)
 }
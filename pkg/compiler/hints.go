@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package compiler
+
+import (
+	"github.com/nooga/let-go/pkg/rt"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+type theHintedSymbolType struct{}
+
+func (t *theHintedSymbolType) Name() string { return "HintedSymbol" }
+
+func (t *theHintedSymbolType) Box(bare interface{}) (vm.Value, error) {
+	return vm.NIL, vm.NewTypeError(bare, "can't be boxed as", t)
+}
+
+var hintedSymbolType = &theHintedSymbolType{}
+
+// hintedSymbol is a symbol read with a type hint like ^long n. Symbols can't carry metadata so the reader
+// wraps hinted ones, binding forms unwrap them and remember the hint for the local or argument they bind.
+type hintedSymbol struct {
+	sym vm.Symbol
+	tag vm.Symbol
+}
+
+// Type implements Value
+func (h *hintedSymbol) Type() vm.ValueType { return hintedSymbolType }
+
+// Unbox implements Value
+func (h *hintedSymbol) Unbox() interface{} {
+	return string(h.sym)
+}
+
+func (h *hintedSymbol) String() string {
+	return "^" + string(h.tag) + " " + string(h.sym)
+}
+
+// stripHints replaces hinted symbols in quoted form with plain ones, like symbols read with metadata in Clojure
+// they are symbols as far as programs can tell. The second result tells whether there were any.
+func stripHints(form vm.Value) (vm.Value, bool) {
+	switch f := form.(type) {
+	case *hintedSymbol:
+		return f.sym, true
+	case *vm.List:
+		elems, changed := stripAll(f.Unbox().([]vm.Value))
+		if !changed {
+			return f, false
+		}
+		return vm.NewList(elems).(*vm.List).WithMeta(f.Meta()), true
+	case vm.ArrayVector:
+		elems, changed := stripAll(append([]vm.Value{}, f...))
+		if !changed {
+			return f, false
+		}
+		return vm.ArrayVector(elems), true
+	}
+	return form, false
+}
+
+// stripAll strips hints from elems in place
+func stripAll(elems []vm.Value) ([]vm.Value, bool) {
+	changed := false
+	for i := range elems {
+		s, ok := stripHints(elems[i])
+		elems[i] = s
+		changed = changed || ok
+	}
+	return elems, changed
+}
+
+// Numeric hints the compiler tracks, arithmetic is specialized for doubles only and other tags are accepted and ignored
+const (
+	hintLong   vm.Symbol = "long"
+	hintDouble vm.Symbol = "double"
+)
+
+// numericHint returns the hint tag stands for, or an empty one when it's not numeric
+func numericHint(tag vm.Symbol) vm.Symbol {
+	switch tag {
+	case "long", "int", "Long":
+		return hintLong
+	case "double", "float", "Double":
+		return hintDouble
+	}
+	return ""
+}
+
+// bindingName returns the symbol a binding form names along with its numeric hint, ok is false if it's not a symbol
+func bindingName(form vm.Value) (vm.Symbol, vm.Symbol, bool) {
+	switch s := form.(type) {
+	case vm.Symbol:
+		return s, "", true
+	case *hintedSymbol:
+		return s.sym, numericHint(s.tag), true
+	}
+	return "", "", false
+}
+
+// hintedOp describes an arithmetic function in lang which has versions specialized for hints,
+// they are named like double-add and double-inc and call the function for other operands.
+// Long arithmetic has no such versions since it compiles to instructions, see inlineOps.
+type hintedOp struct {
+	name  string
+	arity int
+	// keepsHint tells whether the result has the hint of the operands
+	keepsHint bool
+}
+
+var hintedOps = map[vm.Symbol]hintedOp{
+	"+":   {"add", 2, true},
+	"-":   {"sub", 2, true},
+	"*":   {"mul", 2, true},
+	"<":   {"lt", 2, false},
+	">":   {"gt", 2, false},
+	"==":  {"eq", 2, false},
+	"inc": {"inc", 1, true},
+	"dec": {"dec", 1, true},
+}
+
+// setLocalHint remembers the hint of the local in stack slot, slots are reused so a local without one clears it
+func (c *Context) setLocalHint(slot int, hint vm.Symbol) {
+	if hint == "" {
+		delete(c.localHints, slot)
+		return
+	}
+	if c.localHints == nil {
+		c.localHints = map[int]vm.Symbol{}
+	}
+	c.localHints[slot] = hint
+}
+
+// bindLocal makes the value on top of the stack, computed by init, the local named by binding.
+// Locals without a hint of their own take the one of init, hints are checked at runtime so that's always safe.
+func (c *Context) bindLocal(binding vm.Value, init vm.Value) error {
+	name, hint, ok := bindingName(binding)
+	if !ok {
+		return NewCompileError("binding names must be symbols")
+	}
+	if hint == "" {
+		hint = c.exprHint(init)
+	}
+	c.addLocal(name)
+	c.setLocalHint(c.sp-1, hint)
+	return nil
+}
+
+// exprHint tells which numeric hint, if any, the value of form has. Literals have the hint of their type,
+// hinted locals and arguments their hint and arithmetic on operands sharing a hint keeps it.
+func (c *Context) exprHint(form vm.Value) vm.Symbol {
+	switch f := form.(type) {
+	case vm.Int:
+		return hintLong
+	case vm.Float:
+		return hintDouble
+	case *hintedSymbol:
+		return numericHint(f.tag)
+	case vm.Symbol:
+		// closed over values aren't hinted, look locals up without capturing anything
+		if c.closedOvers[f] != nil {
+			return ""
+		}
+		if l := c.LookupLocal(f); l >= 0 {
+			return c.localHints[l]
+		}
+		if a := c.Arg(f); a >= 0 {
+			return c.argHints[a]
+		}
+	case *vm.List:
+		if op, _, hint := c.hintedCall(f); op != nil && op.keepsHint {
+			return hint
+		}
+	}
+	return ""
+}
+
+// hintedCall checks whether form calls an arithmetic function of lang on operands sharing a numeric hint,
+// it returns the operation, the operands and their hint or a nil operation
+func (c *Context) hintedCall(form *vm.List) (*hintedOp, []vm.Value, vm.Symbol) {
+	s, ok := form.First().(vm.Symbol)
+	if !ok {
+		return nil, nil, ""
+	}
+	op, ok := hintedOps[s]
+	if !ok || !c.isLangFn(s) {
+		return nil, nil, ""
+	}
+	args := form.Rest().(*vm.List).Unbox().([]vm.Value)
+	if len(args) != op.arity {
+		return nil, nil, ""
+	}
+	hint := c.exprHint(args[0])
+	for _, a := range args[1:] {
+		if c.exprHint(a) != hint {
+			return nil, nil, ""
+		}
+	}
+	if hint == "" {
+		return nil, nil, ""
+	}
+	return &op, args, hint
+}
+
+// isLangFn tells whether s refers to the var of lang it names
+func (c *Context) isLangFn(s vm.Symbol) bool {
+	if c.shadowed(s) {
+		return false
+	}
+	lang := rt.NS("lang")
+	return lang != nil && c.findVar(s) != nil && c.findVar(s) == lang.Lookup(s)
+}
+
+// shadowed tells whether s names a local, argument or closed over value in this or an enclosing fn.
+// Unlike symbolLookup it doesn't capture anything.
+func (c *Context) shadowed(s vm.Symbol) bool {
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		if ctx.closedOvers[s] != nil || ctx.LookupLocal(s) >= 0 || ctx.Arg(s) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compileHintedCall compiles arithmetic on hinted operands to a call of its specialized version. The version gets
+// the value of the function's var before the operands, like the arithmetic instructions it calls it unless
+// it's the original, so rebinding the function applies. The first result is false when form is not such a call
+// and has to be compiled as usual.
+func (c *Context) compileHintedCall(form *vm.List) (bool, error) {
+	op, args, hint := c.hintedCall(form)
+	if op == nil {
+		return false, nil
+	}
+	fn, ok := rt.NS("lang").Lookup(vm.Symbol(string(hint) + "-" + op.name)).(*vm.Var)
+	if !ok {
+		return false, nil
+	}
+	c.EmitWithArg(vm.OPLDC, c.Constant(fn))
+	c.Emit(vm.OPLDV)
+	c.incSP(1)
+	if err := c.compileForm(form.First()); err != nil {
+		return true, NewCompileError("compiling function position").Wrap(err)
+	}
+	for _, a := range args {
+		if err := c.compileForm(a); err != nil {
+			return true, NewCompileError("compiling arguments").Wrap(err)
+		}
+	}
+	c.EmitWithArg(vm.OPINV, len(args)+1)
+	c.decSP(len(args) + 1)
+	return true, nil
+}
+
+// inlineOps maps arithmetic functions of lang to instructions computing their calls and the number of operands
+// they take. The instructions find the function below its operands on the stack and call it unless it's the
+// original function of lang and the operands are Ints, see installInlined.
+var inlineOps = map[vm.Symbol]struct {
+	op    uint8
+	arity int
+}{
+	"+":   {vm.OPADD, 2},
+	"-":   {vm.OPSUB, 2},
+	"*":   {vm.OPMUL, 2},
+	"<":   {vm.OPLT, 2},
+	">":   {vm.OPGT, 2},
+	"==":  {vm.OPEQ, 2},
+	"=":   {vm.OPEQ, 2},
+	"inc": {vm.OPINC, 1},
+	"dec": {vm.OPDEC, 1},
+}
+
+// installInlined registers the functions of lang the arithmetic instructions compute calls of,
+// the values of their vars are taken once core is loaded so rebinding them later doesn't register anything
+func installInlined() {
+	lang := rt.Stdlib("lang")
+	for s, o := range inlineOps {
+		if v, ok := lang.Lookup(s).(*vm.Var); ok {
+			vm.Inline(o.op, v.Deref())
+		}
+	}
+}
+
+// compileInlineOp compiles a call of an arithmetic function to its instruction,
+// the first result is false when form is not such a call and has to be compiled as usual
+func (c *Context) compileInlineOp(form *vm.List) (bool, error) {
+	s, ok := form.First().(vm.Symbol)
+	if !ok {
+		return false, nil
+	}
+	o, ok := inlineOps[s]
+	args := form.Rest().(*vm.List).Unbox().([]vm.Value)
+	if !ok || len(args) != o.arity || !c.isLangFn(s) {
+		return false, nil
+	}
+	// the function stays below the operands to be called when the instruction doesn't compute the result
+	if err := c.compileForm(s); err != nil {
+		return true, NewCompileError("compiling function position").Wrap(err)
+	}
+	for _, a := range args {
+		if err := c.compileForm(a); err != nil {
+			return true, NewCompileError("compiling arguments").Wrap(err)
+		}
+	}
+	c.Emit(o.op)
+	c.decSP(o.arity)
+	return true, nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/rt"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// maxFormText is how much of a failing form's source Load quotes in its error
+const maxFormText = 40
+
+// Load reads, compiles and runs the forms from r one at a time returning the value of the last one.
+// Unlike CompileMultiple it doesn't keep the code around so r can be a never ending stream.
+func (c *Context) Load(r *LispReader) (vm.Value, error) {
+	var result vm.Value = vm.NIL
+	for n := 1; ; n++ {
+		form, text, err := r.ReadFormString()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return vm.NIL, err
+		}
+		result, err = c.evalForm(form)
+		if err != nil {
+			return vm.NIL, c.loadError(n, form, text).Wrap(err)
+		}
+	}
+}
+
+// evalForm compiles a single form and runs it
+func (c *Context) evalForm(form vm.Value) (vm.Value, error) {
+	c.chunk = vm.NewCodeChunk(c.consts)
+	if err := c.compileForm(form); err != nil {
+		return vm.NIL, err
+	}
+	c.Emit(vm.OPRET)
+	if err := c.finishChunk(); err != nil {
+		return vm.NIL, err
+	}
+	c.decSP(1)
+	return vm.NewFrame(c.chunk, nil).Run()
+}
+
+// loadError names the nth form which failed to load quoting the beginning of its source
+func (c *Context) loadError(n int, form vm.Value, text string) *vm.ExecutionError {
+	if len(text) > maxFormText {
+		text = text[:maxFormText] + "..."
+	}
+	msg := fmt.Sprintf("failed to load form %d %s", n, text)
+	if line, column := formPosition(form); line > 0 {
+		msg = fmt.Sprintf("%s at (%s:%d:%d)", msg, c.source, line, column)
+	}
+	return vm.NewExecutionError(msg)
+}
+
+// installLoadFns defines eval, read-string, load-string and load-reader in lang.
+// Like programs run by letgo the code they evaluate runs in the user namespace.
+func installLoadFns() {
+	ns := rt.Stdlib("lang")
+
+	eval := vm.NativeTyped("eval", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return NewCompiler(rt.NS("user")).SetSource("<eval>").evalForm(vs[0])
+	})
+
+	readString := vm.NativeTyped("read-string", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		r := NewLispReader(strings.NewReader(string(vs[0].(vm.String))), "<string>")
+		form, err := r.ReadForm()
+		if err == io.EOF {
+			return vm.NIL, NewReaderError(r, "EOF while reading")
+		}
+		return form, err
+	})
+
+	loadString := vm.NativeTyped("load-string", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		r := NewLispReader(strings.NewReader(string(vs[0].(vm.String))), "<string>")
+		return NewCompiler(rt.NS("user")).SetSource("<string>").Load(r)
+	})
+
+	loadReader := vm.NativeTyped("load-reader", []vm.ValueType{vm.BoxedType}, func(vs []vm.Value) (vm.Value, error) {
+		r, err := theReader(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return NewCompiler(rt.NS("user")).SetSource(r.inputName).Load(r)
+	})
+
+	ns.Def("eval", eval)
+	ns.Def("read-string", readString)
+	ns.Def("load-string", loadString)
+	ns.Def("load-reader", loadReader)
+}
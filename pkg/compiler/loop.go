@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// loopTarget describes where recur jumps to and which stack slots it rebinds
+type loopTarget struct {
+	addr int
+	base int
+	n    int
+}
+
+// loopCompiler compiles (loop [bindings...] body...), bindings live in stack slots like let locals
+// and recur stores new values into them before jumping back to the start of the body.
+// Destructuring bindings are bound to plain locals first and destructured by a let inside the loop.
+func loopCompiler(c *Context, form vm.Value) error {
+	bindings := form.(*vm.List).Rest()
+	binds, ok := bindings.First().(vm.ArrayVector)
+	if !ok {
+		return NewCompileError("loop bindings should be a vector")
+	}
+	if len(binds)%2 != 0 {
+		return NewCompileError("loop bindings should have an even number of forms")
+	}
+	body := bindings.Rest().Unbox().([]vm.Value)
+
+	var destructured vm.ArrayVector
+	plain := make(vm.ArrayVector, len(binds))
+	copy(plain, binds)
+	for i := 0; i < len(plain); i += 2 {
+		if _, _, ok := bindingName(plain[i]); ok {
+			continue
+		}
+		destructureCounter++
+		tmp := vm.Symbol(fmt.Sprintf("loop__%d", destructureCounter))
+		destructured = append(destructured, plain[i], tmp)
+		plain[i] = tmp
+	}
+	if destructured != nil {
+		body = []vm.Value{vm.NewList(append([]vm.Value{vm.Symbol("let"), destructured}, body...))}
+	}
+
+	c.pushLocals()
+	base := c.sp
+	for i := 0; i < len(plain); i += 2 {
+		err := c.compileForm(plain[i+1])
+		if err != nil {
+			return NewCompileError("compiling loop binding").Wrap(err)
+		}
+		if err := c.bindLocal(plain[i], plain[i+1]); err != nil {
+			return err
+		}
+	}
+	n := len(plain) / 2
+	c.loops = append(c.loops, &loopTarget{addr: c.CurrentAddress(), base: base, n: n})
+	if len(body) == 0 {
+		c.EmitWithArg(vm.OPLDC, c.Constant(vm.NIL))
+		c.incSP(1)
+	}
+	for i := range body {
+		err := c.compileForm(body[i])
+		if err != nil {
+			return NewCompileError("compiling loop body").Wrap(err)
+		}
+		if i < len(body)-1 {
+			c.Emit(vm.OPPOP)
+			c.decSP(1)
+		}
+	}
+	c.loops = c.loops[:len(c.loops)-1]
+	c.popLocals()
+	c.EmitWithArg(vm.OPPON, n)
+	c.decSP(n)
+	return nil
+}
+
+// recurCompiler compiles (recur values...) to stores into the slots of the innermost loop followed by
+// a jump back to its body. recur is expected in tail position, this isn't checked.
+func recurCompiler(c *Context, form vm.Value) error {
+	if len(c.loops) == 0 {
+		return NewCompileError("recur outside of loop")
+	}
+	t := c.loops[len(c.loops)-1]
+	args := form.(*vm.List).Rest().Unbox().([]vm.Value)
+	if len(args) != t.n {
+		return NewCompileError(fmt.Sprintf("recur: wrong number of arguments (%d), need %d", len(args), t.n))
+	}
+	start := c.sp
+	for i := range args {
+		err := c.compileForm(args[i])
+		if err != nil {
+			return NewCompileError("compiling recur argument").Wrap(err)
+		}
+	}
+	// all new values are computed before any slot is overwritten, the last one is on top
+	for i := t.n - 1; i >= 0; i-- {
+		c.decSP(1)
+		c.EmitWithArg(vm.OPSTL, c.sp-1-(t.base+i))
+	}
+	for c.sp > t.base+t.n {
+		c.Emit(vm.OPPOP)
+		c.decSP(1)
+	}
+	c.EmitWithArg(vm.OPJMP, t.addr-c.CurrentAddress())
+	// control never gets past the jump but recur is accounted for like any expression yielding a value
+	c.incSP(start + 1 - c.sp)
+	return nil
+}
+
+// fnLoop wraps a fn body which uses recur in a loop rebinding the arguments so recur can target the fn
+func fnLoop(args []vm.Value, body []vm.Value) []vm.Value {
+	if !mentionsRecur(vm.ArrayVector(body)) {
+		return body
+	}
+	binds := vm.ArrayVector{}
+	for _, a := range args {
+		if a == vm.Symbol("&") {
+			continue
+		}
+		binds = append(binds, a, a)
+	}
+	return []vm.Value{vm.NewList(append([]vm.Value{vm.Symbol("loop"), binds}, body...))}
+}
+
+func mentionsRecur(form vm.Value) bool {
+	switch f := form.(type) {
+	case vm.Symbol:
+		return f == "recur"
+	case *vm.List:
+		for s := vm.Seq(f); s != vm.EmptyList; s = s.Rest() {
+			if mentionsRecur(s.First()) {
+				return true
+			}
+		}
+	case vm.ArrayVector:
+		for i := range f {
+			if mentionsRecur(f[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
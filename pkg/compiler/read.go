@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/rt"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// Readers are LispReaders boxed as let-go values, read pulls forms out of them one at a time
+// so a stream of many forms never has to be parsed in one go.
+
+// NewReaderValue boxes r so it can be passed to read, read+string and reader-position
+func NewReaderValue(r *LispReader) vm.Value {
+	return vm.NewBoxed(r)
+}
+
+func theReader(v vm.Value) (*LispReader, error) {
+	if b, ok := v.(*vm.Boxed); ok {
+		if r, ok := b.Unbox().(*LispReader); ok {
+			return r, nil
+		}
+	}
+	return nil, vm.NewTypeError(v, "is not a reader", nil)
+}
+
+// readArgs handles (read reader) which fails at the end of input and (read reader eof-error? eof-value)
+// which returns eof-value there instead when eof-error? is false
+func readArgs(vs []vm.Value) (*LispReader, bool, vm.Value, error) {
+	if len(vs) != 1 && len(vs) != 3 {
+		return nil, false, vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+	}
+	r, err := theReader(vs[0])
+	if err != nil {
+		return nil, false, vm.NIL, err
+	}
+	if len(vs) == 1 {
+		return r, true, vm.NIL, nil
+	}
+	return r, vm.IsTruthy(vs[1]), vs[2], nil
+}
+
+func installReadFns() {
+	ns := rt.Stdlib("lang")
+
+	pushBackReader := vm.NativeTyped("push-back-reader", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		return NewReaderValue(NewLispReader(strings.NewReader(string(vs[0].(vm.String))), "<string>")), nil
+	})
+
+	read, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		r, eofError, eofValue, err := readArgs(vs)
+		if err != nil {
+			return vm.NIL, err
+		}
+		form, err := r.ReadForm()
+		if err == io.EOF && !eofError {
+			return eofValue, nil
+		}
+		if err == io.EOF {
+			return vm.NIL, NewReaderError(r, "EOF while reading")
+		}
+		return form, err
+	})
+
+	readString, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		r, eofError, eofValue, err := readArgs(vs)
+		if err != nil {
+			return vm.NIL, err
+		}
+		form, text, err := r.ReadFormString()
+		if err == io.EOF && !eofError {
+			return vm.NewVector([]vm.Value{eofValue, vm.String("")}), nil
+		}
+		if err == io.EOF {
+			return vm.NIL, NewReaderError(r, "EOF while reading")
+		}
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NewVector([]vm.Value{form, vm.String(text)}), nil
+	})
+
+	readerPosition := vm.NativeTyped("reader-position", []vm.ValueType{vm.BoxedType}, func(vs []vm.Value) (vm.Value, error) {
+		r, err := theReader(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return positionMeta(r.Position()), nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	ns.Def("push-back-reader", pushBackReader)
+	ns.Def("read", read)
+	ns.Def("read+string", readString)
+	ns.Def("reader-position", readerPosition)
+}
@@ -21,6 +21,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 	"unicode"
@@ -34,8 +35,13 @@ type LispReader struct {
 	pos       int
 	line      int
 	column    int
-	lastRune  rune
-	r         *bufio.Reader
+	// column before the last rune was read, so unread can restore it after a newline
+	prevColumn int
+	lastRune   rune
+	r          *bufio.Reader
+	// runes read while capturing is on, read+string uses them to return the source of a form
+	capturing bool
+	captured  []rune
 }
 
 func NewLispReader(r io.Reader, inputName string) *LispReader {
@@ -47,31 +53,73 @@ func NewLispReader(r io.Reader, inputName string) *LispReader {
 
 func (r *LispReader) next() (rune, error) {
 	c, _, err := r.r.ReadRune()
-	if err != nil {
+	if err == nil {
+		r.prevColumn = r.column
 		if c == '\n' {
 			r.line++
+			r.column = 0
 		} else {
 			r.column++
 		}
 		r.pos++
 		r.lastRune = c
+		if r.capturing {
+			r.captured = append(r.captured, c)
+		}
 	}
 	return c, err
 }
 
 func (r *LispReader) unread() error {
 	err := r.r.UnreadRune()
-	if err != nil {
+	if err == nil {
 		r.pos--
 		if r.lastRune == '\n' {
 			r.line--
-		} else {
-			r.column--
+		}
+		r.column = r.prevColumn
+		if r.capturing && len(r.captured) > 0 {
+			r.captured = r.captured[:len(r.captured)-1]
 		}
 	}
 	return err
 }
 
+// Position returns the 1-based line and column of the next rune to be read
+func (r *LispReader) Position() (int, int) {
+	return r.line + 1, r.column + 1
+}
+
+// ReadForm reads the next form skipping comments and discarded forms, it returns io.EOF at the end of input
+// but fails when the input ends in the middle of a form
+func (r *LispReader) ReadForm() (vm.Value, error) {
+	form, _, err := r.readForm(false)
+	return form, err
+}
+
+// ReadFormString is like ReadForm but also returns the source text of the form without surrounding whitespace
+func (r *LispReader) ReadFormString() (vm.Value, string, error) {
+	return r.readForm(true)
+}
+
+func (r *LispReader) readForm(capture bool) (vm.Value, string, error) {
+	r.capturing = capture
+	defer func() { r.capturing = false }()
+	for {
+		r.captured = r.captured[:0]
+		form, err := r.Read()
+		if err != nil {
+			if isErrorEOF(err) {
+				return vm.NIL, "", io.EOF
+			}
+			return vm.NIL, "", err
+		}
+		if form.Type() != vm.VoidType {
+			return form, strings.TrimSpace(string(r.captured)), nil
+		}
+	}
+}
+
 func (r *LispReader) peek() (rune, error) {
 	for peekBytes := 4; peekBytes > 0; peekBytes-- {
 		b, err := r.r.Peek(peekBytes)
@@ -100,6 +148,16 @@ func (r *LispReader) eatWhitespace() (rune, error) {
 	return ch, err
 }
 
+// readNonVoid reads the next form skipping comments and discarded forms
+func (r *LispReader) readNonVoid() (vm.Value, error) {
+	for {
+		form, err := r.Read()
+		if err != nil || form.Type() != vm.VoidType {
+			return form, err
+		}
+	}
+}
+
 func appendNonVoid(vs []vm.Value, v vm.Value) []vm.Value {
 	if v.Type() == vm.VoidType {
 		return vs
@@ -338,6 +396,20 @@ func readNumber(r *LispReader, ru rune) (vm.Value, error) {
 		s.WriteRune(ch)
 	}
 	sn := s.String()
+	if isHexLiteral(sn) {
+		i, err := strconv.ParseInt(sn, 0, 64)
+		if err != nil {
+			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+		}
+		return vm.Int(i), nil
+	}
+	if strings.ContainsAny(sn, ".eE") {
+		f, err := strconv.ParseFloat(sn, 64)
+		if err != nil {
+			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+		}
+		return vm.Float(f), nil
+	}
 	i, err := strconv.Atoi(sn)
 	if err != nil {
 		return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
@@ -345,12 +417,19 @@ func readNumber(r *LispReader, ru rune) (vm.Value, error) {
 	return vm.Int(i), nil
 }
 
+func isHexLiteral(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+}
+
 func readList(r *LispReader, _ rune) (vm.Value, error) {
+	// the opening paren has been consumed already
+	line, column := r.line+1, r.column
 	var ret []vm.Value
 	for {
 		ch2, err := r.eatWhitespace()
 		if err != nil {
-			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+			return vm.NIL, unterminated(r, "list", err)
 		}
 		if ch2 == ')' {
 			break
@@ -360,37 +439,101 @@ func readList(r *LispReader, _ rune) (vm.Value, error) {
 		}
 		form, err := r.Read()
 		if err != nil {
-			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+			return vm.NIL, unterminated(r, "list", err)
 		}
 		ret = appendNonVoid(ret, form)
 	}
-	return vm.ListType.Box(ret)
+	if len(ret) == 0 {
+		return vm.EmptyList, nil
+	}
+	l, err := vm.ListType.Box(ret)
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "boxing list").Wrap(err)
+	}
+	return l.(*vm.List).WithMeta(positionMeta(line, column)), nil
 }
 
-func readVector(r *LispReader, _ rune) (vm.Value, error) {
+// unterminated reports errors hit while reading a collection, running out of input there is
+// an error in its own right and must not look like a clean end of input
+func unterminated(r *LispReader, what string, err error) error {
+	if isErrorEOF(err) {
+		return NewReaderError(r, fmt.Sprintf("EOF while reading %s", what))
+	}
+	return NewReaderError(r, "unexpected error").Wrap(err)
+}
+
+// positionMeta makes metadata describing a 1-based source position
+func positionMeta(line, column int) vm.Value {
+	return vm.NewMap([]vm.Value{vm.Keyword("line"), vm.Int(line), vm.Keyword("column"), vm.Int(column)})
+}
+
+// readDelimited reads forms up to the closing delimiter end, what names the collection in errors
+func readDelimited(r *LispReader, end rune, what string) ([]vm.Value, error) {
 	ret := make([]vm.Value, 0)
 	for {
 		ch2, err := r.eatWhitespace()
 		if err != nil {
-			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+			return nil, unterminated(r, what, err)
 		}
-		if ch2 == ']' {
-			break
+		if ch2 == end {
+			return ret, nil
 		}
 		if err = r.unread(); err != nil {
-			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+			return nil, NewReaderError(r, "unexpected error").Wrap(err)
 		}
 		form, err := r.Read()
 		if err != nil {
-			return vm.NIL, NewReaderError(r, "unexpected error").Wrap(err)
+			return nil, unterminated(r, what, err)
 		}
 		ret = appendNonVoid(ret, form)
 	}
+}
+
+func readVector(r *LispReader, _ rune) (vm.Value, error) {
+	ret, err := readDelimited(r, ']', "vector")
+	if err != nil {
+		return vm.NIL, err
+	}
 	return vm.ArrayVector(ret), nil
 }
 
+// readMap reads a {k v ...} literal, the forms are kept unevaluated and the compiler decides how to build the map
+func readMap(r *LispReader, _ rune) (vm.Value, error) {
+	kvs, err := readDelimited(r, '}', "map")
+	if err != nil {
+		return vm.NIL, err
+	}
+	if len(kvs)%2 != 0 {
+		return vm.NIL, NewReaderError(r, "map literal must contain an even number of forms")
+	}
+	m := vm.EmptyMap
+	for i := 0; i < len(kvs); i += 2 {
+		if m.Contains(kvs[i]) {
+			return vm.NIL, NewReaderError(r, fmt.Sprintf("duplicate key: %s", kvs[i]))
+		}
+		m = m.Assoc(kvs[i], kvs[i+1])
+	}
+	return m, nil
+}
+
+// readSet reads a #{...} literal
+func readSet(r *LispReader, _ rune) (vm.Value, error) {
+	elems, err := readDelimited(r, '}', "set")
+	if err != nil {
+		return vm.NIL, err
+	}
+	s := vm.EmptySet
+	for _, e := range elems {
+		if s.Contains(e) {
+			return vm.NIL, NewReaderError(r, fmt.Sprintf("duplicate set element: %s", e))
+		}
+		s = s.Conj(e)
+	}
+	return s, nil
+}
+
 func readQuote(r *LispReader, _ rune) (vm.Value, error) {
-	form, err := r.Read()
+	form, err := r.readNonVoid()
 	if err != nil {
 		return vm.NIL, NewReaderError(r, "reading quoted form").Wrap(err)
 	}
@@ -402,8 +545,66 @@ func readQuote(r *LispReader, _ rune) (vm.Value, error) {
 	return ret, nil
 }
 
+func readDeref(r *LispReader, _ rune) (vm.Value, error) {
+	form, err := r.readNonVoid()
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "reading dereferenced form").Wrap(err)
+	}
+	ret, err := vm.ListType.Box([]vm.Value{vm.Symbol("deref"), form})
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "boxing deref").Wrap(err)
+	}
+	return ret, nil
+}
+
+// readMeta reads ^meta form attaching meta to form. ^sym and ^"str" are short for {:tag sym} and ^:kw for {:kw true}.
+// Symbols can't carry metadata so a symbol only keeps its :tag, as a type hint, and other keys are dropped.
+func readMeta(r *LispReader, _ rune) (vm.Value, error) {
+	m, err := r.readNonVoid()
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "reading metadata").Wrap(err)
+	}
+	var meta *vm.Map
+	switch mv := m.(type) {
+	case vm.Symbol, vm.String:
+		meta = vm.EmptyMap.Assoc(vm.Keyword("tag"), mv)
+	case vm.Keyword:
+		meta = vm.EmptyMap.Assoc(mv, vm.TRUE)
+	case *vm.Map:
+		meta = mv
+	default:
+		return vm.NIL, NewReaderError(r, "metadata must be a symbol, keyword, string or map")
+	}
+	form, err := r.readNonVoid()
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "reading form with metadata").Wrap(err)
+	}
+	switch f := form.(type) {
+	case vm.Symbol:
+		if tag, ok := meta.ValueAtOr(vm.Keyword("tag"), vm.NIL).(vm.Symbol); ok {
+			return &hintedSymbol{sym: f, tag: tag}, nil
+		}
+		return f, nil
+	case *hintedSymbol:
+		if tag, ok := meta.ValueAtOr(vm.Keyword("tag"), vm.NIL).(vm.Symbol); ok {
+			return &hintedSymbol{sym: f.sym, tag: tag}, nil
+		}
+		return f, nil
+	case vm.Metadatable:
+		merged := vm.Value(meta)
+		if old, ok := f.Meta().(*vm.Map); ok {
+			merged = old
+			for _, k := range meta.Keys() {
+				merged = merged.(*vm.Map).Assoc(k, meta.ValueAtOr(k, vm.NIL))
+			}
+		}
+		return f.WithMeta(merged), nil
+	}
+	return form, nil
+}
+
 func readVarQuote(r *LispReader, _ rune) (vm.Value, error) {
-	form, err := r.Read()
+	form, err := r.readNonVoid()
 	if err != nil {
 		return vm.NIL, NewReaderError(r, "reading quoted var").Wrap(err)
 	}
@@ -418,6 +619,71 @@ func readVarQuote(r *LispReader, _ rune) (vm.Value, error) {
 	return ret, nil
 }
 
+// readRegex reads a #"..." literal, backslashes are kept as they are so the pattern reaches the regex compiler intact
+func readRegex(r *LispReader, _ rune) (vm.Value, error) {
+	s := strings.Builder{}
+	for {
+		ch, err := r.next()
+		if err != nil {
+			return vm.NIL, NewReaderError(r, "unexpected error while reading regex").Wrap(err)
+		}
+		if ch == '"' {
+			break
+		}
+		s.WriteRune(ch)
+		if ch == '\\' {
+			ch, err = r.next()
+			if err != nil {
+				return vm.NIL, NewReaderError(r, "unexpected error while reading regex").Wrap(err)
+			}
+			s.WriteRune(ch)
+		}
+	}
+	re, err := vm.NewRegex(s.String())
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "invalid regex").Wrap(err)
+	}
+	return re, nil
+}
+
+// readShebang skips a #! line so scripts can be made executable, it's only allowed at the very start of the input
+func readShebang(r *LispReader, _ rune) (vm.Value, error) {
+	if r.pos != 2 {
+		return vm.NIL, NewReaderError(r, "#! is only allowed on the first line")
+	}
+	return readLineComment(r, '!')
+}
+
+// readDiscard skips the next complete form for #_, discards can be stacked so #_ #_ a b skips both a and b
+func readDiscard(r *LispReader, _ rune) (vm.Value, error) {
+	_, err := r.readNonVoid()
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "reading discarded form").Wrap(err)
+	}
+	return vm.VOID, nil
+}
+
+// readSymbolicValue reads the floats which have no literal, ##NaN, ##Inf and ##-Inf
+func readSymbolicValue(r *LispReader, _ rune) (vm.Value, error) {
+	ch, err := r.next()
+	if err != nil {
+		return vm.NIL, NewReaderError(r, "reading symbolic value").Wrap(err)
+	}
+	tok, err := readToken(r, ch)
+	if err != nil {
+		return vm.NIL, err
+	}
+	switch tok {
+	case vm.Symbol("NaN"):
+		return vm.Float(math.NaN()), nil
+	case vm.Symbol("Inf"):
+		return vm.Float(math.Inf(1)), nil
+	case vm.Symbol("-Inf"):
+		return vm.Float(math.Inf(-1)), nil
+	}
+	return vm.NIL, NewReaderError(r, fmt.Sprintf("unknown symbolic value: ##%s", tok))
+}
+
 func readHashMacro(r *LispReader, _ rune) (vm.Value, error) {
 	ch, err := r.next()
 	if err != nil {
@@ -465,15 +731,24 @@ func readerInit() {
 		')':  unmatchedDelimReader(')'),
 		'[':  readVector,
 		']':  unmatchedDelimReader(']'),
+		'{':  readMap,
+		'}':  unmatchedDelimReader('}'),
 		'"':  readString,
 		'\\': readChar,
 		'\'': readQuote,
 		';':  readLineComment,
+		'@':  readDeref,
 		'#':  readHashMacro,
+		'^':  readMeta,
 	}
 
 	hashMacros = map[rune]readerFunc{
 		'\'': readVarQuote,
+		'"':  readRegex,
+		'_':  readDiscard,
+		'{':  readSet,
+		'!':  readShebang,
+		'#':  readSymbolicValue,
 	}
 }
 
@@ -18,6 +18,9 @@
 package compiler
 
 import (
+	"io"
+	"math"
+	"math/rand"
 	"strings"
 	"testing"
 
@@ -33,13 +36,18 @@ func TestReaderBasic(t *testing.T) {
 		"987654321":            vm.Int(987654321),
 		"+987654321":           vm.Int(987654321),
 		"-987654321":           vm.Int(-987654321),
+		"1.5":                  vm.Float(1.5),
+		"-0.25":                vm.Float(-0.25),
+		"1e3":                  vm.Float(1000),
+		"0xFF":                 vm.Int(255),
+		"-0x0e":                vm.Int(-14),
 		"true":                 vm.TRUE,
 		"false":                vm.FALSE,
 		"nil":                  vm.NIL,
 		"foo":                  vm.Symbol("foo"),
 		"()":                   vm.EmptyList,
 		"(    )":               vm.EmptyList,
-		"(1 2)":                vm.EmptyList.Cons(vm.Int(2)).Cons(vm.Int(1)),
+		"(1 2)":                vm.EmptyList.Cons(vm.Int(2)).Cons(vm.Int(1)).(*vm.List).WithMeta(positionMeta(1, 1)),
 		"\"hello\"":            vm.String("hello"),
 		"\"h\\\"el\\tl\\\\o\"": vm.String("h\"el\tl\\o"),
 		":foo":                 vm.Keyword("foo"),
@@ -51,6 +59,7 @@ func TestReaderBasic(t *testing.T) {
 		"[]":                   vm.ArrayVector{},
 		"[1 :foo true]":        vm.ArrayVector{vm.Int(1), vm.Keyword("foo")}.Cons(vm.TRUE),
 		"'foo":                 vm.EmptyList.Cons(vm.Symbol("foo")).Cons(vm.Symbol("quote")),
+		"@foo":                 vm.EmptyList.Cons(vm.Symbol("foo")).Cons(vm.Symbol("deref")),
 	}
 
 	for p, e := range cases {
@@ -61,6 +70,91 @@ func TestReaderBasic(t *testing.T) {
 	}
 }
 
+func TestReaderDiscard(t *testing.T) {
+	cases := map[string]string{
+		"[1 #_2 3]":                 "[1 3]",
+		"[1 #_ #_ 2 3 4]":           "[1 4]",
+		"[1 #_(a [b (c)] \"d\") 2]": "[1 2]",
+		"[1 #_2]":                   "[1]",
+		"'#_a b":                    "(quote b)",
+		"(f 1, 2,,3)":               "(f 1 2 3)",
+	}
+	for p, e := range cases {
+		r := NewLispReader(strings.NewReader(p), "<reader>")
+		o, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, e, o.String())
+	}
+}
+
+func TestReaderUnterminated(t *testing.T) {
+	for _, p := range []string{"(1 2", "[1 (2 3)", "(a [b"} {
+		r := NewLispReader(strings.NewReader(p), "<reader>")
+		_, err := r.Read()
+		assert.Error(t, err)
+		assert.False(t, isErrorEOF(err), p)
+	}
+}
+
+func TestReaderMapSet(t *testing.T) {
+	r := NewLispReader(strings.NewReader("{:a 1, :b (f x)} #{1 x} {} #{}"), "<reader>")
+	m, err := r.Read()
+	assert.NoError(t, err)
+	assert.IsType(t, &vm.Map{}, m)
+	assert.Equal(t, vm.Int(1), vm.Get(m, vm.Keyword("a"), vm.NIL))
+	assert.Equal(t, "(f x)", vm.Get(m, vm.Keyword("b"), vm.NIL).String())
+	s, err := r.Read()
+	assert.NoError(t, err)
+	assert.True(t, s.(*vm.Set).Contains(vm.Symbol("x")))
+	assert.Equal(t, vm.Int(2), s.(*vm.Set).Count())
+	for _, empty := range []vm.Value{vm.Int(0), vm.Int(0)} {
+		o, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, empty, o.(vm.Collection).Count())
+	}
+
+	for _, p := range []string{"{:a}", "{:a 1 :a 2}", "#{1 2 1}", "{:a 1", "#{1 2", "{:a 1}}"} {
+		r := NewLispReader(strings.NewReader(p), "<reader>")
+		_, err := r.Read()
+		if err == nil {
+			_, err = r.Read()
+		}
+		assert.Error(t, err, p)
+		assert.False(t, isErrorEOF(err), p)
+	}
+}
+
+func TestReaderShebang(t *testing.T) {
+	r := NewLispReader(strings.NewReader("#!/usr/bin/env letgo\n; comment\n(+ 1 2)"), "<reader>")
+	o, err := r.readNonVoid()
+	assert.NoError(t, err)
+	assert.Equal(t, "(+ 1 2)", o.String())
+
+	r = NewLispReader(strings.NewReader("(+ 1 2)\n#!/usr/bin/env letgo\n"), "<reader>")
+	_, err = r.Read()
+	assert.NoError(t, err)
+	_, err = r.Read()
+	assert.Error(t, err)
+}
+
+func TestReaderRegex(t *testing.T) {
+	cases := map[string]string{
+		`#"a+b"`:        "a+b",
+		`#"\d+\.\d"`:    `\d+\.\d`,
+		`#"say \"hi\""`: `say \"hi\"`,
+	}
+	for p, e := range cases {
+		r := NewLispReader(strings.NewReader(p), "<reader>")
+		o, err := r.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, e, o.(*vm.Regex).Regexp().String())
+	}
+
+	r := NewLispReader(strings.NewReader(`#"("`), "<reader>")
+	_, err := r.Read()
+	assert.Error(t, err)
+}
+
 func TestSimpleCall(t *testing.T) {
 	p := "(+ 40 2)"
 	r := NewLispReader(strings.NewReader(p), "<reader>")
@@ -74,5 +168,139 @@ func TestSimpleCall(t *testing.T) {
 	})
 
 	assert.NoError(t, err)
-	assert.Equal(t, out, o)
+	assert.Equal(t, out.(*vm.List).WithMeta(positionMeta(1, 1)), o)
+}
+
+func TestReaderPositions(t *testing.T) {
+	p := "(do\n  (foo\n    (bar 1)))"
+	r := NewLispReader(strings.NewReader(p), "<reader>")
+	o, err := r.Read()
+	assert.NoError(t, err)
+
+	foo := o.(*vm.List).Rest().First().(*vm.List)
+	bar := foo.Rest().First().(*vm.List)
+	assert.Equal(t, positionMeta(1, 1), o.(*vm.List).Meta())
+	assert.Equal(t, positionMeta(2, 3), foo.Meta())
+	assert.Equal(t, positionMeta(3, 5), bar.Meta())
+}
+
+func TestReaderMeta(t *testing.T) {
+	r := NewLispReader(strings.NewReader("^long n ^:private ^{:doc \"d\"} (f) ^String s ^:dynamic x ^1 y"), "<reader>")
+	o, err := r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &hintedSymbol{sym: "n", tag: "long"}, o)
+	assert.Equal(t, "^long n", o.String())
+
+	o, err = r.Read()
+	assert.NoError(t, err)
+	meta := o.(*vm.List).Meta()
+	assert.Equal(t, vm.TRUE, vm.Get(meta, vm.Keyword("private"), vm.NIL))
+	assert.Equal(t, vm.String("d"), vm.Get(meta, vm.Keyword("doc"), vm.NIL))
+	assert.Equal(t, vm.Int(1), vm.Get(meta, vm.Keyword("line"), vm.NIL))
+
+	o, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &hintedSymbol{sym: "s", tag: "String"}, o)
+
+	// symbols only keep their type hint
+	o, err = r.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Symbol("x"), o)
+
+	_, err = r.Read()
+	assert.Error(t, err)
+}
+
+func TestReaderReadForm(t *testing.T) {
+	r := NewLispReader(strings.NewReader("(+ 1 2) ; one\n #_ skipped [a\n b] :k"), "<reader>")
+	o, err := r.ReadForm()
+	assert.NoError(t, err)
+	assert.Equal(t, "(+ 1 2)", o.String())
+
+	o, text, err := r.ReadFormString()
+	assert.NoError(t, err)
+	assert.Equal(t, "[a b]", o.String())
+	assert.Equal(t, "[a\n b]", text)
+
+	line, column := r.Position()
+	assert.Equal(t, 3, line)
+	assert.Equal(t, 4, column)
+
+	o, err = r.ReadForm()
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Keyword("k"), o)
+
+	_, err = r.ReadForm()
+	assert.Equal(t, io.EOF, err)
+
+	r = NewLispReader(strings.NewReader("(1 2"), "<reader>")
+	_, err = r.ReadForm()
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+// readPrinted reads back what the printer makes of v
+func readPrinted(t *testing.T, v vm.Value) vm.Value {
+	r := NewLispReader(strings.NewReader(v.String()), "<reader>")
+	o, err := r.Read()
+	assert.NoError(t, err, v.String())
+	return o
+}
+
+func TestReaderRoundTrip(t *testing.T) {
+	values := []vm.Value{
+		vm.String(""),
+		vm.String(`\`),
+		vm.String(`"`),
+		vm.String(`say "hi"\n`),
+		vm.String("line\nbreak\ttab\rreturn\bback\fform"),
+		vm.String("\x00\x01\x1f\x7f\u0085"),
+		vm.String("zażółć gęślą jaźń 日本語 😀"),
+		vm.String(`A`),
+		vm.Keyword("a/b"),
+		vm.Keyword("ns.sub/name?"),
+		vm.Symbol("foo/bar"),
+		vm.Symbol("/"),
+		vm.Int(-42),
+		vm.NIL,
+		vm.TRUE,
+		vm.NewVector([]vm.Value{vm.String(`\`), vm.Char('\\'), vm.Char('"'), vm.Char(' '), vm.Char('\n')}),
+		vm.NewList([]vm.Value{vm.Symbol("quote"), vm.Symbol("x/y")}),
+	}
+	for ch := vm.Char(0); ch < 0x250; ch++ {
+		values = append(values, ch)
+	}
+	for _, c := range []vm.Char{'日', '😀', ' '} {
+		values = append(values, c)
+	}
+
+	// random strings mixing characters the printer has to escape with plain and multibyte ones
+	alphabet := []rune("ab \"\\\n\t\r\b\f\x00\x1b/:;#{}()[]ńł日😀")
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		s := make([]rune, rng.Intn(12))
+		for j := range s {
+			s[j] = alphabet[rng.Intn(len(alphabet))]
+		}
+		values = append(values, vm.String(s))
+	}
+
+	for _, v := range values {
+		o := readPrinted(t, v)
+		assert.True(t, vm.Equal(v, o), "%s read back as %s", v, o)
+	}
+	// floats print with the shortest digits which parse back to the same value
+	for _, f := range []float64{0.1, 0.30000000000000004, 1.0 / 3, 2.0 / 3, 100, -0.0, 1e21, 1e-7, 123456789.125, 5e-324,
+		2.2250738585072014e-308, 1.7976931348623157e308, 4.35, 9007199254740993, math.Inf(1), math.Inf(-1)} {
+		values = append(values, vm.Float(f))
+	}
+	for _, v := range values[len(values)-16:] {
+		o := readPrinted(t, v)
+		assert.True(t, vm.Equal(v, o), "%s read back as %s", v, o)
+	}
+	nan, ok := readPrinted(t, vm.Float(math.NaN())).(vm.Float)
+	assert.True(t, ok && math.IsNaN(float64(nan)))
+
+	m := vm.NewMap([]vm.Value{vm.Keyword("k/v"), vm.String(`a"b\c`), vm.String("\n"), vm.Char('\t')})
+	assert.True(t, vm.Equal(m, readPrinted(t, m)))
 }
@@ -17,7 +17,10 @@
 
 package errors
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Error interface {
 	error
@@ -32,3 +35,32 @@ func AddCause(e Error, s string) string {
 	}
 	return fmt.Sprintf("%s\n\tcaused by %s", s, cause.Error())
 }
+
+// Located is implemented by errors which know the place in the source they come from,
+// lines and columns are 1-based
+type Located interface {
+	Location() (source string, line int, column int)
+}
+
+// Chain returns err followed by its causes, outermost first
+func Chain(err error) []error {
+	var out []error
+	for err != nil {
+		out = append(out, err)
+		e, ok := err.(Error)
+		if !ok {
+			break
+		}
+		err = e.GetCause()
+	}
+	return out
+}
+
+// Message returns what err says without the causes AddCause appended to it
+func Message(err error) string {
+	s := err.Error()
+	if e, ok := err.(Error); ok && e.GetCause() != nil {
+		return strings.TrimSuffix(s, "\n\tcaused by "+e.GetCause().Error())
+	}
+	return s
+}
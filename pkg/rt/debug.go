@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+var debugHookVar *vm.Var
+
+// debugger calls the fn bound to *debug-hook* with a map describing the instruction about to run,
+// it returns :step or nil to be called again before the next one, :continue to run on or :abort to stop.
+func debugger() vm.DebugHook {
+	if debugHookVar.Deref() == vm.NIL {
+		return nil
+	}
+	return func(info vm.DebugInfo) (vm.DebugAction, error) {
+		return callDebugHook(vm.NewMap([]vm.Value{
+			vm.Keyword("ip"), vm.Int(info.IP),
+			vm.Keyword("op"), vm.Keyword(info.Op),
+			vm.Keyword("args"), vm.NewVector(info.Args),
+			vm.Keyword("locals"), vm.NewVector(info.Locals),
+		}))
+	}
+}
+
+// callDebugHook passes state to *debug-hook* and tells what it wants done.
+// The hook runs with *debug-hook* bound to nil so it isn't debugged itself.
+func callDebugHook(state vm.Value) (vm.DebugAction, error) {
+	f, err := vm.AsFn(debugHookVar.Deref())
+	if err != nil {
+		return vm.DebugAbort, err
+	}
+	if err := debugHookVar.PushBinding(vm.NIL); err != nil {
+		return vm.DebugAbort, err
+	}
+	out, err := f.Invoke([]vm.Value{state})
+	debugHookVar.PopBinding()
+	if err != nil {
+		return vm.DebugAbort, err
+	}
+	// a switch rather than a map lookup since the hook may return values which can't be hashed
+	switch out {
+	case vm.NIL, vm.Keyword("step"):
+		return vm.DebugStep, nil
+	case vm.Keyword("continue"):
+		return vm.DebugContinue, nil
+	case vm.Keyword("abort"):
+		return vm.DebugAbort, nil
+	}
+	return vm.DebugAbort, vm.NewTypeError(out, "is not a debugger action, expected :step, :continue or :abort", nil)
+}
+
+func installDebugFns(ns *vm.Namespace) {
+	// breakpoint* is what (breakpoint) compiles to, it's passed names and values of the locals around it in pairs.
+	// With a debugger attached it calls the hook with :op :breakpoint and the locals in a map, otherwise it does nothing.
+	breakpoint, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if debugHookVar.Deref() == vm.NIL {
+			return vm.NIL, nil
+		}
+		locals, err := vm.MapType.Box(vs)
+		if err != nil {
+			return vm.NIL, err
+		}
+		state := vm.NewMap([]vm.Value{vm.Keyword("op"), vm.Keyword("breakpoint"), vm.Keyword("locals"), locals})
+		action, err := callDebugHook(state)
+		if err != nil {
+			return vm.NIL, err
+		}
+		if action == vm.DebugAbort {
+			return vm.NIL, vm.NewExecutionError("aborted by debugger")
+		}
+		return vm.NIL, nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	debugHookVar = ns.Def("*debug-hook*", vm.NIL).SetDynamic()
+	vm.Debugger = debugger
+	ns.Def("breakpoint*", breakpoint)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// Arithmetic specialized for operands hinted ^double, the compiler calls these instead of the generic functions.
+// They get the function the call names first and compute it only if it's the one of lang the matching instruction
+// computes, so rebinding the function still applies. Hints are only advisory so operands of other types and other
+// functions are passed to the function. Arithmetic on longs compiles to instructions of the VM instead.
+
+func doubleOp(name string, inst uint8, op func(a, b vm.Float) vm.Value) *vm.NativeFn {
+	return vm.NativeTyped(name, []vm.ValueType{vm.AnyType, vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if a, ok := vs[1].(vm.Float); ok {
+			if b, ok := vs[2].(vm.Float); ok && vm.Inlines(inst, vs[0]) {
+				return op(a, b), nil
+			}
+		}
+		return callOperator(vs)
+	})
+}
+
+func doubleStep(name string, inst uint8, delta vm.Float) *vm.NativeFn {
+	return vm.NativeTyped(name, []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if a, ok := vs[1].(vm.Float); ok && vm.Inlines(inst, vs[0]) {
+			return a + delta, nil
+		}
+		return callOperator(vs)
+	})
+}
+
+// callOperator calls the function in vs[0] with the rest of vs
+func callOperator(vs []vm.Value) (vm.Value, error) {
+	fn, err := vm.AsFn(vs[0])
+	if err != nil {
+		return vm.NIL, err
+	}
+	return fn.Invoke(vs[1:])
+}
+
+func installHintFns(ns *vm.Namespace) {
+	ns.Def("double-add", doubleOp("double-add", vm.OPADD, func(a, b vm.Float) vm.Value { return a + b }))
+	ns.Def("double-sub", doubleOp("double-sub", vm.OPSUB, func(a, b vm.Float) vm.Value { return a - b }))
+	ns.Def("double-mul", doubleOp("double-mul", vm.OPMUL, func(a, b vm.Float) vm.Value { return a * b }))
+	ns.Def("double-lt", doubleOp("double-lt", vm.OPLT, func(a, b vm.Float) vm.Value { return vm.Boolean(a < b) }))
+	ns.Def("double-gt", doubleOp("double-gt", vm.OPGT, func(a, b vm.Float) vm.Value { return vm.Boolean(a > b) }))
+	ns.Def("double-eq", doubleOp("double-eq", vm.OPEQ, func(a, b vm.Float) vm.Value { return vm.Boolean(a == b) }))
+	ns.Def("double-inc", doubleStep("double-inc", vm.OPINC, 1))
+	ns.Def("double-dec", doubleStep("double-dec", vm.OPDEC, -1))
+}
@@ -19,189 +19,2029 @@ package rt
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"github.com/nooga/let-go/pkg/vm"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var nsRegistry map[string]*vm.Namespace
 
+// stdlib holds the standard namespaces whether they are installed or not
+var stdlib map[string]*vm.Namespace
+
+// stdlibNames lists the standard namespaces in the order they are installed
+var stdlibNames = []string{"lang", "math", "time", "shell", "string", "walk", "set"}
+
+// stdlibAliases are the Clojure names standard namespaces are reachable under too
+var stdlibAliases = map[string]string{
+	"clojure.string": "string",
+	"clojure.walk":   "walk",
+	"clojure.set":    "set",
+}
+
+var outVar *vm.Var
+var commandLineArgsVar *vm.Var
+
 func init() {
 	nsRegistry = make(map[string]*vm.Namespace)
 
-	installLangNS()
-}
+	installLangNS()
+	installMathNS()
+	installTimeNS()
+	installShellNS()
+	installStringNS()
+	installWalkNS()
+	installSetNS()
+
+	stdlib = make(map[string]*vm.Namespace)
+	for _, name := range stdlibNames {
+		stdlib[name] = nsRegistry[name]
+	}
+	installUserNS()
+}
+
+// StdlibNames returns names of all standard namespaces, by default all of them are installed
+func StdlibNames() []string {
+	return append([]string{}, stdlibNames...)
+}
+
+// Stdlib returns the standard namespace called name even when it isn't installed, nil if there is no such namespace
+func Stdlib(name string) *vm.Namespace {
+	return stdlib[name]
+}
+
+// InstallOnly replaces all installed namespaces with the standard ones named and a fresh user namespace.
+// Programs can only see installed namespaces, user refers lang when it's among them.
+// With no names programs get an empty user namespace and nothing but special forms.
+func InstallOnly(names ...string) error {
+	registry := make(map[string]*vm.Namespace)
+	for _, name := range names {
+		ns, ok := stdlib[name]
+		if !ok {
+			return fmt.Errorf("no such standard namespace: %s", name)
+		}
+		registry[name] = ns
+	}
+	for alias, name := range stdlibAliases {
+		if ns, ok := registry[name]; ok {
+			registry[alias] = ns
+		}
+	}
+	nsRegistry = registry
+	installUserNS()
+	return nil
+}
+
+func NS(name string) *vm.Namespace {
+	return nsRegistry[name]
+}
+
+// RegisterNS makes namespace available to programs, which can call its vars qualified or (refer) it.
+// Host functions are easiest exposed by registering a namespace made with vm.NamespaceBuilder before evaluating any code.
+// Registering a namespace again does nothing. A different namespace registered under a name which is taken
+// is merged into the registered one, which is returned, so code already using its vars sees the new definitions.
+func RegisterNS(namespace *vm.Namespace) *vm.Namespace {
+	return registerAs(namespace.Name(), namespace)
+}
+
+// registerAs registers namespace under name like RegisterNS, standard namespaces use it for their Clojure aliases
+func registerAs(name string, namespace *vm.Namespace) *vm.Namespace {
+	registered, ok := nsRegistry[name]
+	if !ok {
+		nsRegistry[name] = namespace
+		return namespace
+	}
+	if registered != namespace {
+		registered.Merge(namespace)
+	}
+	return registered
+}
+
+// SetCommandLineArgs makes args available to programs as *command-line-args*
+func SetCommandLineArgs(args []string) {
+	if len(args) == 0 {
+		commandLineArgsVar.SetRoot(vm.NIL)
+		return
+	}
+	vs := make([]vm.Value, len(args))
+	for i := range args {
+		vs[i] = vm.String(args[i])
+	}
+	commandLineArgsVar.SetRoot(vm.NewList(vs))
+}
+
+// outWriter returns the writer currently bound to *out*
+func outWriter() (io.Writer, error) {
+	w, ok := outVar.Deref().Unbox().(io.Writer)
+	if !ok {
+		return nil, vm.NewTypeError(outVar.Deref(), "is not a writer", nil)
+	}
+	return w, nil
+}
+
+// strOf is what str makes of v, strings and chars are taken as they are and nil is empty
+func strOf(v vm.Value) string {
+	switch v := v.(type) {
+	case vm.String:
+		return string(v)
+	case vm.Char:
+		return string(rune(v))
+	case *vm.Nil:
+		return ""
+	default:
+		return v.String()
+	}
+}
+
+// readably joins the printed forms of vs with spaces, the way pr-str and prn print them
+func readably(vs []vm.Value) string {
+	b := &strings.Builder{}
+	for i := range vs {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteString(vs[i].String())
+	}
+	return b.String()
+}
+
+// seqToSlice collects the elements of a collection into a slice
+func seqToSlice(v vm.Value) ([]vm.Value, error) {
+	// vectors are immutable so their backing array can be shared
+	if c, ok := v.(vm.ArrayVector); ok {
+		return c, nil
+	}
+	return vm.AppendElements(nil, v)
+}
+
+// seqOf presents the elements of coll as a sequence, sequences are returned as they are so lazy ones stay lazy
+func seqOf(coll vm.Value) (vm.Seq, error) {
+	switch c := coll.(type) {
+	case *vm.Nil:
+		return vm.EmptyList, nil
+	case vm.ArrayVector:
+		return vm.SeqFromSlice(c), nil
+	case vm.Seq:
+		return c, nil
+	}
+	elems, err := vm.AppendElements(nil, coll)
+	if err != nil {
+		return nil, err
+	}
+	return vm.SeqFromSlice(elems), nil
+}
+
+// asSeq is like seqOf but keeps values which already are seqs, vectors included, as they are
+func asSeq(coll vm.Value) (vm.Seq, error) {
+	if s, ok := coll.(vm.Seq); ok {
+		return s, nil
+	}
+	return seqOf(coll)
+}
+
+// stepper computes the element an input element at index i turns into, or says it should be dropped
+type stepper func(i int, x vm.Value) (vm.Value, bool, error)
+
+// lazyStep lazily transforms elements of s with step starting at index i
+func lazyStep(step stepper, s vm.Seq, i int) vm.Seq {
+	return vm.NewLazySeq(func() (vm.Seq, error) {
+		for ; ; s, i = s.Rest(), i+1 {
+			if err := vm.SeqError(s); err != nil {
+				return nil, err
+			}
+			if vm.IsEmpty(s) {
+				return vm.EmptyList, nil
+			}
+			r, ok, err := step(i, s.First())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return vm.NewCons(r, lazyStep(step, s.Rest(), i+1)), nil
+			}
+		}
+	})
+}
+
+// lazyReductions lazily yields acc followed by the accumulations of elements of s with f
+func lazyReductions(f vm.Fn, acc vm.Value, s vm.Seq) vm.Seq {
+	return vm.NewCons(acc, vm.NewLazySeq(func() (vm.Seq, error) {
+		if err := vm.SeqError(s); err != nil {
+			return nil, err
+		}
+		if vm.IsEmpty(s) {
+			return vm.EmptyList, nil
+		}
+		next, err := f.Invoke([]vm.Value{acc, s.First()})
+		if err != nil {
+			return nil, err
+		}
+		return lazyReductions(f, next, s.Rest()), nil
+	}))
+}
+
+// dropSeq walks past the first n elements of s, stopping early at its end
+func dropSeq(s vm.Seq, n int) (vm.Seq, error) {
+	for i := 0; i < n; i++ {
+		if err := vm.SeqError(s); err != nil {
+			return nil, err
+		}
+		if vm.IsEmpty(s) {
+			break
+		}
+		s = s.Rest()
+	}
+	return s, vm.SeqError(s)
+}
+
+// assoc1 returns coll with key mapped to val, for vectors the key is an index
+func assoc1(coll vm.Value, key vm.Value, val vm.Value) (vm.Value, error) {
+	switch c := coll.(type) {
+	case *vm.Nil:
+		// like conj onto nil makes a list, assoc onto nil makes a map
+		return vm.EmptyArrayMap.Assoc(key, val), nil
+	case *vm.Map:
+		return c.Assoc(key, val), nil
+	case *vm.ArrayMap:
+		return c.Assoc(key, val), nil
+	case *vm.SortedMap:
+		return c.Assoc(key, val)
+	case *vm.Record:
+		return c.Assoc(key, val), nil
+	case vm.ArrayVector, *vm.PersistentVector:
+		i, ok := key.(vm.Int)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(key, "is not an index", vm.IntType)
+		}
+		if v, ok := c.(*vm.PersistentVector); ok {
+			return v.Assoc(int(i), val)
+		}
+		return c.(vm.ArrayVector).Assoc(int(i), val)
+	}
+	return vm.NIL, vm.NewTypeError(coll, "is not associative", nil)
+}
+
+// dissoc1 returns map m without key
+func dissoc1(m vm.Value, key vm.Value) (vm.Value, error) {
+	switch c := m.(type) {
+	case *vm.Nil:
+		return vm.NIL, nil
+	case *vm.Map:
+		return c.Dissoc(key), nil
+	case *vm.ArrayMap:
+		return c.Dissoc(key), nil
+	case *vm.SortedMap:
+		return c.Dissoc(key)
+	case *vm.Record:
+		return c.Dissoc(key), nil
+	}
+	return vm.NIL, vm.NewTypeError(m, "is not a map", nil)
+}
+
+// conj1 adds x to coll where it's cheapest: at the front of lists and seqs, at the end of vectors.
+// Maps take [key value] pairs and nil is treated as an empty list.
+func conj1(coll vm.Value, x vm.Value) (vm.Value, error) {
+	switch c := coll.(type) {
+	case *vm.Nil:
+		return vm.EmptyList.Cons(x), nil
+	case *vm.PersistentVector:
+		return c.Conj(x), nil
+	case *vm.PrimitiveVector:
+		return c.Conj(x)
+	case *vm.Set:
+		return c.Conj(x), nil
+	case *vm.Map, *vm.ArrayMap, *vm.SortedMap, *vm.Record:
+		var kv []vm.Value
+		switch e := x.(type) {
+		case vm.MapEntry:
+			return assoc1(coll, e.Key(), e.Val())
+		case vm.ArrayVector:
+			kv = e
+		case *vm.PersistentVector:
+			kv = e.Unbox().([]vm.Value)
+		}
+		if len(kv) != 2 {
+			return vm.NIL, vm.NewTypeError(x, "is not a [key value] pair", nil)
+		}
+		return assoc1(coll, kv[0], kv[1])
+	case vm.Seq:
+		return c.Cons(x), nil
+	}
+	return vm.NIL, vm.NewTypeError(coll, "can't be conjed to", nil)
+}
+
+// keyedMap is implemented by all kinds of maps
+type keyedMap interface {
+	vm.Value
+	Contains(key vm.Value) bool
+	ValueAtOr(key vm.Value, dflt vm.Value) vm.Value
+}
+
+func isMap(v vm.Value) bool {
+	switch v.(type) {
+	case *vm.Map, *vm.ArrayMap, *vm.SortedMap, *vm.Record:
+		return true
+	}
+	return false
+}
+
+// mergeWith merges maps from left to right skipping nils, keys present in both are resolved with (f old new).
+// When f is nil the later value wins.
+func mergeWith(f vm.Fn, maps []vm.Value) (vm.Value, error) {
+	var out vm.Value = vm.NIL
+	for _, m := range maps {
+		if m == vm.NIL {
+			continue
+		}
+		if !isMap(m) {
+			return vm.NIL, vm.NewTypeError(m, "is not a map", nil)
+		}
+		if out == vm.NIL {
+			out = m
+			continue
+		}
+		entries, err := vm.AppendElements(nil, m)
+		if err != nil {
+			return vm.NIL, err
+		}
+		for _, e := range entries {
+			kv := e.(vm.MapEntry)
+			val := kv.Val()
+			if into := out.(keyedMap); f != nil && into.Contains(kv.Key()) {
+				val, err = f.Invoke([]vm.Value{into.ValueAtOr(kv.Key(), vm.NIL), val})
+				if err != nil {
+					return vm.NIL, err
+				}
+			}
+			if out, err = assoc1(out, kv.Key(), val); err != nil {
+				return vm.NIL, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// countBy maps (f x) for each x in coll to the number of times it came up, a nil f counts elements themselves
+func countBy(f vm.Fn, coll vm.Value) (vm.Value, error) {
+	xs, err := vm.AppendElements(nil, coll)
+	if err != nil {
+		return vm.NIL, err
+	}
+	var counts vm.Value = vm.EmptyArrayMap
+	for _, x := range xs {
+		if f != nil {
+			if x, err = f.Invoke([]vm.Value{x}); err != nil {
+				return vm.NIL, err
+			}
+		}
+		n := counts.(keyedMap).ValueAtOr(x, vm.Int(0)).(vm.Int)
+		if counts, err = assoc1(counts, x, n+1); err != nil {
+			return vm.NIL, err
+		}
+	}
+	return counts, nil
+}
+
+// fnComparator orders values with a Lisp function returning a number like compare does,
+// or a boolean telling whether its first argument goes first like < does
+func fnComparator(f vm.Fn) vm.Comparator {
+	return func(a vm.Value, b vm.Value) (int, error) {
+		r, err := f.Invoke([]vm.Value{a, b})
+		if err != nil {
+			return 0, err
+		}
+		switch r := r.(type) {
+		case vm.Int:
+			return int(r), nil
+		case vm.Boolean:
+			if r {
+				return -1, nil
+			}
+			r2, err := f.Invoke([]vm.Value{b, a})
+			if err != nil {
+				return 0, err
+			}
+			if vm.IsTruthy(r2) {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		return 0, vm.NewTypeError(r, "is not a comparison result", nil)
+	}
+}
+
+// sortedMapOf makes a sorted map ordered by cmp out of alternating keys and values
+func sortedMapOf(cmp vm.Comparator, kvs []vm.Value) (vm.Value, error) {
+	if len(kvs)%2 != 0 {
+		return vm.NIL, fmt.Errorf("sorted map expects an even number of keys and values, got %d", len(kvs))
+	}
+	m := vm.NewSortedMap(cmp)
+	for i := 0; i < len(kvs); i += 2 {
+		var err error
+		m, err = m.Assoc(kvs[i], kvs[i+1])
+		if err != nil {
+			return vm.NIL, err
+		}
+	}
+	return m, nil
+}
+
+// subseq returns entries of a sorted map with keys passing one or two tests like (> key 3) in the given order
+func subseq(ascending bool, vs []vm.Value) (vm.Value, error) {
+	if len(vs) != 3 && len(vs) != 5 {
+		return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+	}
+	sm, ok := vs[0].(*vm.SortedMap)
+	if !ok {
+		return vm.NIL, vm.NewTypeError(vs[0], "is not a sorted map", vm.SortedMapType)
+	}
+	cmp := sm.Comparator()
+	entries, err := sm.Range(ascending, func(k vm.Value) (bool, error) {
+		for i := 1; i < len(vs); i += 2 {
+			test, err := vm.AsFn(vs[i])
+			if err != nil {
+				return false, err
+			}
+			c, err := cmp(k, vs[i+1])
+			if err != nil {
+				return false, err
+			}
+			r, err := test.Invoke([]vm.Value{vm.Int(c), vm.Int(0)})
+			if err != nil || !vm.IsTruthy(r) {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil || len(entries) == 0 {
+		return vm.NIL, err
+	}
+	return vm.NewList(entries), nil
+}
+
+func allEqual(vs []vm.Value) bool {
+	for i := 1; i < len(vs); i++ {
+		if !vm.Equal(vs[0], vs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// foldNumbers reduces vs with a binary numeric operation starting from init
+func foldNumbers(op func(vm.Value, vm.Value) (vm.Value, error), init vm.Value, vs []vm.Value) (vm.Value, error) {
+	acc := init
+	for i := range vs {
+		n, err := op(acc, vs[i])
+		if err != nil {
+			return vm.NIL, err
+		}
+		acc = n
+	}
+	return acc, nil
+}
+
+//go:embed core/core.lg
+var CoreSrc string
+
+// langNS is the lang namespace once it's installed
+var langNS *vm.Namespace
+
+// installLangNS defines lang, installing it again does nothing as natives and vars like *out* would be replaced
+// behind the backs of programs holding them
+func installLangNS() {
+	if langNS != nil {
+		return
+	}
+
+	plus, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return foldNumbers(vm.Add, vm.Int(0), vs)
+	})
+
+	mul, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return foldNumbers(vm.Mul, vm.Int(1), vs)
+	})
+
+	sub, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if len(vs) == 1 {
+			return foldNumbers(vm.Sub, vm.Int(0), vs)
+		}
+		return foldNumbers(vm.Sub, vs[0], vs[1:])
+	})
+
+	// there are no ratios so dividing Ints gives an Int when they divide evenly and a Float otherwise
+	div, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if len(vs) == 1 {
+			return foldNumbers(vm.Div, vm.Int(1), vs)
+		}
+		return foldNumbers(vm.Div, vs[0], vs[1:])
+	})
+
+	equals, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.Boolean(allEqual(vs)), nil
+	})
+
+	notEquals, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.Boolean(!allEqual(vs)), nil
+	})
+
+	not := vm.NativeTyped("not", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(!vm.IsTruthy(vs[0])), nil
+	})
+
+	boolean := vm.NativeTyped("boolean", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vm.IsTruthy(vs[0])), nil
+	})
+
+	compare := vm.NativeTyped("compare", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		c, err := vm.Compare(vs[0], vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Int(c), nil
+	})
+
+	atom := vm.NativeTyped("atom", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.NewAtom(vs[0]), nil
+	})
+
+	deref := vm.NativeTyped("deref", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if f, ok := vs[0].(vm.Forceable); ok {
+			return f.Force()
+		}
+		r, ok := vs[0].(vm.Derefable)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "can't be dereferenced", nil)
+		}
+		return r.Deref(), nil
+	})
+
+	makeDelay := vm.NativeTyped("make-delay", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NewDelay(f), nil
+	})
+
+	futureCall := vm.NativeTyped("future-call", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NewFuture(f), nil
+	})
+
+	isFuture := vm.NativeTyped("future?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		_, ok := vs[0].(*vm.Future)
+		return vm.Boolean(ok), nil
+	})
+
+	// futuresJoin waits for a collection of futures giving a vector of their values, it fails as soon as any of them does
+	futuresJoin := vm.NativeTyped("futures-join", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		elems, err := seqToSlice(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		fs := make([]*vm.Future, len(elems))
+		for i := range elems {
+			f, ok := elems[i].(*vm.Future)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(elems[i], "is not a future", vm.FutureType)
+			}
+			fs[i] = f
+		}
+		out, err := vm.JoinFutures(fs)
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NewVector(out), nil
+	})
+
+	agent := vm.NativeTyped("agent", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.NewAgent(vs[0]), nil
+	})
+
+	// send queues (apply f state args) on an agent and returns the agent without waiting for it
+	send, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		a, ok := vs[0].(*vm.Agent)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not an agent", vm.AgentType)
+		}
+		f, err := vm.AsFn(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := a.Send(f, append([]vm.Value{}, vs[2:]...)); err != nil {
+			return vm.NIL, err
+		}
+		return a, nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	// await blocks until the actions sent to the agents so far are done, failing if any of the agents has failed
+	await, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		for i := range vs {
+			a, ok := vs[i].(*vm.Agent)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(vs[i], "is not an agent", vm.AgentType)
+			}
+			if err := a.Await(); err != nil {
+				return vm.NIL, err
+			}
+		}
+		return vm.NIL, nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	// agentError returns what the failed action threw, so it can be inspected like a caught exception
+	agentError := vm.NativeTyped("agent-error", []vm.ValueType{vm.AgentType}, func(vs []vm.Value) (vm.Value, error) {
+		err := vs[0].(*vm.Agent).Error()
+		if err == nil {
+			return vm.NIL, nil
+		}
+		return vm.ErrorValue(err), nil
+	})
+
+	restartAgent := vm.NativeTyped("restart-agent", []vm.ValueType{vm.AgentType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		a := vs[0].(*vm.Agent)
+		if err := a.Restart(vs[1]); err != nil {
+			return vm.NIL, err
+		}
+		return a, nil
+	})
+
+	// force computes delays and returns anything else as it is
+	force := vm.NativeTyped("force", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if d, ok := vs[0].(*vm.Delay); ok {
+			return d.Force()
+		}
+		return vs[0], nil
+	})
+
+	realized := vm.NativeTyped("realized?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		p, ok := vs[0].(vm.Pending)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "doesn't support realized?", nil)
+		}
+		return vm.Boolean(p.IsRealized()), nil
+	})
+
+	reset := vm.NativeTyped("reset!", []vm.ValueType{vm.AtomType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vs[0].(*vm.Atom).Reset(vs[1]), nil
+	})
+
+	compareAndSet := vm.NativeTyped("compare-and-set!", []vm.ValueType{vm.AtomType, vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vs[0].(*vm.Atom).CompareAndSet(vs[1], vs[2])), nil
+	})
+
+	swap, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		a, ok := vs[0].(*vm.Atom)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not an atom", vm.AtomType)
+		}
+		f, err := vm.AsFn(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return a.Swap(f, vs[2:])
+	})
+
+	bound, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		for i := range vs {
+			v, ok := vs[i].(*vm.Var)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(vs[i], "is not a Var", nil)
+			}
+			if !v.IsBound() {
+				return vm.FALSE, nil
+			}
+		}
+		return vm.TRUE, nil
+	})
+
+	meta := vm.NativeTyped("meta", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if m, ok := vs[0].(vm.Metadatable); ok {
+			return m.Meta(), nil
+		}
+		return vm.NIL, nil
+	})
+
+	withMeta := vm.NativeTyped("with-meta", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		m, ok := vs[0].(vm.Metadatable)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "can't carry metadata", nil)
+		}
+		return m.WithMeta(vs[1]), nil
+	})
+
+	// vary-meta replaces the metadata of obj with (apply f (meta obj) args)
+	varyMeta, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		m, ok := vs[0].(vm.Metadatable)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "can't carry metadata", nil)
+		}
+		f, err := vm.AsFn(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		meta, err := f.Invoke(append([]vm.Value{m.Meta()}, vs[2:]...))
+		if err != nil {
+			return vm.NIL, err
+		}
+		return m.WithMeta(meta), nil
+	})
+
+	identical := vm.NativeTyped("identical?", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vm.Identical(vs[0], vs[1])), nil
+	})
+
+	numEquals, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		for i := 1; i < len(vs); i++ {
+			eq, err := vm.NumEqual(vs[0], vs[i])
+			if err != nil {
+				return vm.NIL, err
+			}
+			if !eq {
+				return vm.FALSE, nil
+			}
+		}
+		return vm.TRUE, nil
+	})
+
+	gt := vm.NativeTyped("gt", []vm.ValueType{vm.NumberType, vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+		c, err := vm.NumCompare(vs[0], vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Boolean(c > 0), nil
+	})
+
+	lt := vm.NativeTyped("lt", []vm.ValueType{vm.NumberType, vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+		c, err := vm.NumCompare(vs[0], vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Boolean(c < 0), nil
+	})
+
+	// sign compares a number with zero, predicates built on it fail for values which aren't numbers
+	sign := func(name string, pred func(int) bool) *vm.NativeFn {
+		return vm.NativeTyped(name, []vm.ValueType{vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+			c, err := vm.NumCompare(vs[0], vm.Int(0))
+			if err != nil {
+				return vm.NIL, err
+			}
+			return vm.Boolean(pred(c)), nil
+		})
+	}
+	zero := sign("zero?", func(c int) bool { return c == 0 })
+	pos := sign("pos?", func(c int) bool { return c > 0 })
+	neg := sign("neg?", func(c int) bool { return c < 0 })
+
+	// even? and odd? only make sense for integers so Floats are rejected
+	even := vm.NativeTyped("even?", []vm.ValueType{vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vs[0].(vm.Int)%2 == 0), nil
+	})
+
+	odd := vm.NativeTyped("odd?", []vm.ValueType{vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vs[0].(vm.Int)%2 != 0), nil
+	})
+
+	isNumber := vm.NativeTyped("number?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vm.IsNumber(vs[0])), nil
+	})
+
+	isInteger := vm.NativeTyped("integer?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		_, ok := vs[0].(vm.Int)
+		return vm.Boolean(ok), nil
+	})
+
+	bitAnd, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return foldNumbers(vm.BitAnd, vs[0], vs[1:])
+	})
+
+	bitOr, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return foldNumbers(vm.BitOr, vs[0], vs[1:])
+	})
+
+	bitXor, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return foldNumbers(vm.BitXor, vs[0], vs[1:])
+	})
+
+	bitNot, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.BitNot(vs[0])
+	})
+
+	bitShiftLeft, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.BitShiftLeft(vs[0], vs[1])
+	})
+
+	bitShiftRight, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.BitShiftRight(vs[0], vs[1])
+	})
+
+	unsignedBitShiftRight, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.UnsignedBitShiftRight(vs[0], vs[1])
+	})
+
+	setMacro, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		m, ok := vs[0].(*vm.Var)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a Var", nil)
+		}
+		m.SetMacro()
+		return m, nil
+	})
+
+	vector, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return vm.NewVector(vs), nil
+	})
+
+	// (vector-of :int 1 2 3) makes a vector keeping numbers unboxed, :int and :long hold Ints while :float and
+	// :double hold Floats
+	vectorOf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		k, _ := vs[0].(vm.Keyword)
+		kind, ok := vm.PrimitiveKindOf(k)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a primitive type, expected :int, :long, :float or :double", nil)
+		}
+		return vm.NewPrimitiveVector(kind, vs[1:])
+	})
+
+	list, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return vm.ListType.Box(vs)
+	})
+
+	// apply is also compiled directly to the APP instruction when called by name, see the compiler
+	apply, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		args := make([]vm.Value, len(vs)-2)
+		copy(args, vs[1:len(vs)-1])
+		args, err = vm.AppendElements(args, vs[len(vs)-1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := vm.CheckArity(f, len(args)); err != nil {
+			return vm.NIL, err
+		}
+		return f.Invoke(args)
+	})
+
+	rangef, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 || len(vs) > 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		bounds := []vm.Int{0, 0, 1}
+		for i := range vs {
+			n, err := vm.AsInt(vs[i])
+			if err != nil {
+				return vm.NIL, err
+			}
+			bounds[i] = vm.Int(n)
+		}
+		if len(vs) == 1 {
+			bounds[0], bounds[1] = 0, bounds[0]
+		}
+		start, end, step := bounds[0], bounds[1], bounds[2]
+		if step == 0 {
+			return vm.NIL, fmt.Errorf("range step can't be 0")
+		}
+		n := (end - start) / step
+		if (end-start)%step != 0 {
+			n++
+		}
+		if n > 0 {
+			if err := vm.Allocate(int(n)); err != nil {
+				return vm.NIL, err
+			}
+		}
+		var elems []vm.Value
+		for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+			elems = append(elems, i)
+		}
+		return vm.NewList(elems), nil
+	})
+
+	mapf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		colls := make([][]vm.Value, len(vs)-1)
+		n := -1
+		for i := range colls {
+			elems, err := seqToSlice(vs[i+1])
+			if err != nil {
+				return vm.NIL, err
+			}
+			colls[i] = elems
+			if n < 0 || len(elems) < n {
+				n = len(elems)
+			}
+		}
+		// with many collections f gets an element of each and mapping stops at the shortest one
+		out := make([]vm.Value, n)
+		for i := 0; i < n; i++ {
+			args := make([]vm.Value, len(colls))
+			for j := range colls {
+				args[j] = colls[j][i]
+			}
+			r, err := f.Invoke(args)
+			if err != nil {
+				return vm.NIL, err
+			}
+			out[i] = r
+		}
+		return vm.NewList(out), nil
+	})
+
+	filter, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		pred, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		elems, err := seqToSlice(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		var out []vm.Value
+		for i := range elems {
+			r, err := pred.Invoke([]vm.Value{elems[i]})
+			if err != nil {
+				return vm.NIL, err
+			}
+			if vm.IsTruthy(r) {
+				out = append(out, elems[i])
+			}
+		}
+		return vm.NewList(out), nil
+	})
+
+	// lazyf makes a lazy sequence function taking a function and a collection, mk turns the function into a stepper
+	lazyf := func(mk func(f vm.Fn) stepper) (vm.Value, error) {
+		return vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+			if len(vs) != 2 {
+				return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+			}
+			f, err := vm.AsFn(vs[0])
+			if err != nil {
+				return vm.NIL, err
+			}
+			s, err := seqOf(vs[1])
+			if err != nil {
+				return vm.NIL, err
+			}
+			return lazyStep(mk(f), s, 0), nil
+		})
+	}
+
+	keep, err := lazyf(func(f vm.Fn) stepper {
+		return func(_ int, x vm.Value) (vm.Value, bool, error) {
+			r, err := f.Invoke([]vm.Value{x})
+			return r, r != vm.NIL, err
+		}
+	})
+
+	keepIndexed, err := lazyf(func(f vm.Fn) stepper {
+		return func(i int, x vm.Value) (vm.Value, bool, error) {
+			r, err := f.Invoke([]vm.Value{vm.Int(i), x})
+			return r, r != vm.NIL, err
+		}
+	})
+
+	mapIndexed, err := lazyf(func(f vm.Fn) stepper {
+		return func(i int, x vm.Value) (vm.Value, bool, error) {
+			r, err := f.Invoke([]vm.Value{vm.Int(i), x})
+			return r, true, err
+		}
+	})
+
+	remove, err := lazyf(func(pred vm.Fn) stepper {
+		return func(_ int, x vm.Value) (vm.Value, bool, error) {
+			r, err := pred.Invoke([]vm.Value{x})
+			return x, !vm.IsTruthy(r), err
+		}
+	})
+
+	reduce, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 && len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		elems, err := seqToSlice(vs[len(vs)-1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		var acc vm.Value
+		if len(vs) == 3 {
+			acc = vs[1]
+		} else {
+			// like in Clojure (reduce f []) is (f) and (reduce f [x]) is x
+			if len(elems) == 0 {
+				return f.Invoke(nil)
+			}
+			acc, elems = elems[0], elems[1:]
+		}
+		for i := range elems {
+			acc, err = f.Invoke([]vm.Value{acc, elems[i]})
+			if err != nil {
+				return vm.NIL, err
+			}
+		}
+		return acc, nil
+	})
+
+	// reductions is a lazy seq of the values reduce goes through, like reduce without init it starts with the
+	// first element or (f) when there are none
+	reductions, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 && len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		s, err := seqOf(vs[len(vs)-1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if len(vs) == 3 {
+			return lazyReductions(f, vs[1], s), nil
+		}
+		if err := vm.SeqError(s); err != nil {
+			return vm.NIL, err
+		}
+		if vm.IsEmpty(s) {
+			acc, err := f.Invoke(nil)
+			if err != nil {
+				return vm.NIL, err
+			}
+			return vm.NewList([]vm.Value{acc}), nil
+		}
+		return lazyReductions(f, s.First(), s.Rest()), nil
+	})
+
+	// listStar conses all but the last argument onto the last one which must be a collection
+	listStar, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		tail, err := seqToSlice(vs[len(vs)-1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		n := len(vs) - 1 + len(tail)
+		if n == 0 {
+			return vm.NIL, nil
+		}
+		elems := make([]vm.Value, 0, n)
+		elems = append(elems, vs[:len(vs)-1]...)
+		elems = append(elems, tail...)
+		return vm.NewList(elems), nil
+	})
+
+	hashMap, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs)%2 != 0 {
+			return vm.NIL, fmt.Errorf("hash-map expects an even number of arguments, got %d", len(vs))
+		}
+		return vm.MapType.Box(vs)
+	})
+
+	arrayMap, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs)%2 != 0 {
+			return vm.NIL, fmt.Errorf("array-map expects an even number of arguments, got %d", len(vs))
+		}
+		return vm.ArrayMapType.Box(vs)
+	})
+
+	assoc, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 3 || len(vs)%2 != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		coll := vs[0]
+		for i := 1; i < len(vs); i += 2 {
+			var err error
+			coll, err = assoc1(coll, vs[i], vs[i+1])
+			if err != nil {
+				return vm.NIL, err
+			}
+		}
+		return coll, nil
+	})
+
+	conj, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) == 0 {
+			return vm.EmptyPersistentVector, nil
+		}
+		coll := vs[0]
+		for _, x := range vs[1:] {
+			var err error
+			coll, err = conj1(coll, x)
+			if err != nil {
+				return vm.NIL, err
+			}
+		}
+		return coll, nil
+	})
+
+	merge, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return mergeWith(nil, vs)
+	})
+
+	mergeWithf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return mergeWith(f, vs[1:])
+	})
+
+	frequencies := vm.NativeTyped("frequencies", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return countBy(nil, vs[0])
+	})
+
+	countByf := vm.NativeTyped("count-by", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return countBy(f, vs[1])
+	})
+
+	// distinct? buckets arguments by hash and stops at the first one equal to an earlier one
+	distinct, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		seen := make(map[uint32][]vm.Value, len(vs))
+		for _, v := range vs {
+			h := vm.Hash(v)
+			for _, s := range seen[h] {
+				if vm.Equal(s, v) {
+					return vm.FALSE, nil
+				}
+			}
+			seen[h] = append(seen[h], v)
+		}
+		return vm.TRUE, nil
+	})
+
+	isMapf := vm.NativeTyped("map?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(isMap(vs[0])), nil
+	})
+
+	// bean shows fields of a boxed Go struct as a read-only map
+	bean := vm.NativeTyped("bean", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		if b, ok := vs[0].(*vm.Bean); ok {
+			return b, nil
+		}
+		if vs[0].Type() == vm.BoxedType {
+			if b, ok := vm.NewBean(vs[0].Unbox()); ok {
+				return b, nil
+			}
+		}
+		return vm.NIL, vm.NewTypeError(vs[0], "is not a Go struct", nil)
+	})
+
+	dissoc, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		m := vs[0]
+		for i := 1; i < len(vs); i++ {
+			var err error
+			m, err = dissoc1(m, vs[i])
+			if err != nil {
+				return vm.NIL, err
+			}
+		}
+		return m, nil
+	})
+
+	sortedMap, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return sortedMapOf(vm.Compare, vs)
+	})
+
+	sortedMapBy, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return sortedMapOf(fnComparator(f), vs[1:])
+	})
+
+	subseqf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return subseq(true, vs)
+	})
+
+	rsubseqf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return subseq(false, vs)
+	})
+
+	hashSet, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return vm.SetType.Box(vs)
+	})
+
+	cons, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		elem := vs[0]
+		if vs[1] == vm.NIL {
+			return vm.EmptyList.Cons(elem), nil
+		}
+		seq, ok := vs[1].(vm.Seq)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[1], "is not a sequence", nil)
+		}
+		return seq.Cons(elem), nil
+	})
+
+	first, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if vs[0] == vm.NIL {
+			return vm.NIL, nil
+		}
+		seq, err := asSeq(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := vm.SeqError(seq); err != nil {
+			return vm.NIL, err
+		}
+		return seq.First(), nil
+	})
 
-func NS(name string) *vm.Namespace {
-	return nsRegistry[name]
-}
+	second, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if vs[0] == vm.NIL {
+			return vm.NIL, nil
+		}
+		seq, err := asSeq(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := vm.SeqError(seq); err != nil {
+			return vm.NIL, err
+		}
+		return seq.Rest().First(), nil
+	})
 
-func RegisterNS(namespace *vm.Namespace) *vm.Namespace {
-	nsRegistry[namespace.Name()] = namespace
-	return namespace
-}
+	next, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if vs[0] == vm.NIL {
+			return vm.NIL, nil
+		}
+		seq, err := asSeq(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := vm.SeqError(seq); err != nil {
+			return vm.NIL, err
+		}
 
-//go:embed core/core.lg
-var CoreSrc string
+		if n := seq.Next(); n != nil {
+			return n, nil
+		}
+		return vm.NIL, nil
+	})
 
-func installLangNS() {
-	plus, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		n := 0
-		for i := range vs {
-			n += vs[i].Unbox().(int)
+	rest, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if vs[0] == vm.NIL {
+			return vm.EmptyList, nil
 		}
-		return vm.Int(n)
+		seq, err := asSeq(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if err := vm.SeqError(seq); err != nil {
+			return vm.NIL, err
+		}
+		return seq.Rest(), nil
 	})
 
-	mul, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		n := 1
-		for i := range vs {
-			n *= vs[i].Unbox().(int)
+	// entries of maps come out of their seqs
+	key := vm.NativeTyped("key", []vm.ValueType{vm.MapEntryType}, func(vs []vm.Value) (vm.Value, error) {
+		return vs[0].(vm.MapEntry).Key(), nil
+	})
+
+	val := vm.NativeTyped("val", []vm.ValueType{vm.MapEntryType}, func(vs []vm.Value) (vm.Value, error) {
+		return vs[0].(vm.MapEntry).Val(), nil
+	})
+
+	isMapEntry := vm.NativeTyped("map-entry?", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		_, ok := vs[0].(vm.MapEntry)
+		return vm.Boolean(ok), nil
+	})
+
+	// peek and pop work on the end where conj adds, the front of lists and the back of vectors
+	peek := vm.NativeTyped("peek", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		switch c := vs[0].(type) {
+		case *vm.Nil:
+			return vm.NIL, nil
+		case *vm.List:
+			return c.First(), nil
+		case vm.ArrayVector:
+			if len(c) == 0 {
+				return vm.NIL, nil
+			}
+			return c[len(c)-1], nil
+		case *vm.PersistentVector:
+			return c.ValueAtOr(c.Count().(vm.Int)-1, vm.NIL), nil
+		case *vm.PrimitiveVector:
+			return c.ValueAtOr(c.Count().(vm.Int)-1, vm.NIL), nil
+		case vm.MapEntry:
+			return c.Val(), nil
 		}
-		return vm.Int(n)
+		return vm.NIL, vm.NewTypeError(vs[0], "can't be peeked", nil)
 	})
 
-	sub, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		if len(vs) < 1 {
-			// FIXME error out
-			return vm.NIL
+	pop := vm.NativeTyped("pop", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		switch c := vs[0].(type) {
+		case *vm.Nil:
+			return vm.NIL, nil
+		case *vm.List:
+			if c.Count().(vm.Int) == 0 {
+				return vm.NIL, vm.NewExecutionError("can't pop empty list")
+			}
+			return c.Rest(), nil
+		case vm.ArrayVector:
+			if len(c) == 0 {
+				return vm.NIL, vm.NewExecutionError("can't pop empty vector")
+			}
+			return c[:len(c)-1], nil
+		case *vm.PersistentVector:
+			return c.Pop()
+		case *vm.PrimitiveVector:
+			return c.Pop()
 		}
-		n := vs[0].Unbox().(int)
-		if len(vs) == 1 {
-			// FIXME error out
-			return vm.Int(-n)
+		return vm.NIL, vm.NewTypeError(vs[0], "can't be popped", nil)
+	})
+
+	nth, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 && len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		for i := 1; i < len(vs); i++ {
-			n -= vs[i].Unbox().(int)
+		i, ok := vs[1].(vm.Int)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[1], "is not an index", vm.IntType)
+		}
+		var elem vm.Value
+		if str, ok := vs[0].(vm.String); ok {
+			elem, ok = str.Nth(int(i))
+			if !ok {
+				elem = nil
+			}
+		} else if v, ok := vs[0].(*vm.PersistentVector); ok {
+			elem, ok = v.Nth(int(i))
+			if !ok {
+				elem = nil
+			}
+		} else if v, ok := vs[0].(*vm.PrimitiveVector); ok {
+			elem, ok = v.Nth(int(i))
+			if !ok {
+				elem = nil
+			}
+		} else {
+			elems, err := seqToSlice(vs[0])
+			if err != nil {
+				return vm.NIL, err
+			}
+			if i >= 0 && int(i) < len(elems) {
+				elem = elems[i]
+			}
+		}
+		if elem == nil {
+			if len(vs) == 3 {
+				return vs[2], nil
+			}
+			return vm.NIL, fmt.Errorf("index %d out of bounds", i)
 		}
-		return vm.Int(n)
+		return elem, nil
 	})
 
-	div, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		n := 0
-		if len(vs) < 1 {
-			// FIXME error out
-			return vm.NIL
+	// nthrest and nthnext walk the seq so they work on infinite ones, nthnext returns nil when nothing is left
+	nthrest := vm.NativeTyped("nthrest", []vm.ValueType{vm.AnyType, vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		n := int(vs[1].(vm.Int))
+		if n <= 0 {
+			return vs[0], nil
 		}
-		for i := range vs {
-			n /= vs[i].Unbox().(int)
+		s, err := seqOf(vs[0])
+		if err != nil {
+			return vm.NIL, err
 		}
-		return vm.Int(n)
+		return dropSeq(s, n)
 	})
 
-	equals, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		if len(vs) < 1 {
-			// FIXME error out
-			return vm.NIL
+	nthnext := vm.NativeTyped("nthnext", []vm.ValueType{vm.AnyType, vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		s, err := seqOf(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if s, err = dropSeq(s, int(vs[1].(vm.Int))); err != nil {
+			return vm.NIL, err
+		}
+		if vm.IsEmpty(s) {
+			return vm.NIL, nil
+		}
+		return s, nil
+	})
+
+	// take-nth lazily keeps every nth element starting with the first, with n of 1 that's coll itself
+	takeNth := vm.NativeTyped("take-nth", []vm.ValueType{vm.IntType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		n := int(vs[0].(vm.Int))
+		if n < 1 {
+			return vm.NIL, vm.NewExecutionError(fmt.Sprintf("take-nth step must be positive, got %d", n))
+		}
+		if n == 1 {
+			return vs[1], nil
+		}
+		s, err := seqOf(vs[1])
+		if err != nil {
+			return vm.NIL, err
 		}
-		for i := range vs[1:] {
-			if vs[0] != vs[i] {
-				return vm.FALSE
+		return lazyStep(func(i int, x vm.Value) (vm.Value, bool, error) {
+			return x, i%n == 0, nil
+		}, s, 0), nil
+	})
+
+	count, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		switch c := vs[0].(type) {
+		case *vm.Nil:
+			return vm.Int(0), nil
+		case vm.Counted:
+			return c.Count(), nil
+		case vm.Seq:
+			// sequences which don't know their size have to be walked
+			elems, err := vm.AppendElements(nil, c)
+			return vm.Int(len(elems)), err
+		default:
+			return vm.NIL, vm.NewTypeError(vs[0], "can't be counted", nil)
+		}
+	})
+
+	// bounded-count walks at most n elements of sequences which don't know their size, so it's safe on infinite ones
+	boundedCount := vm.NativeTyped("bounded-count", []vm.ValueType{vm.IntType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		n := vs[0].(vm.Int)
+		if c, ok := vs[1].(vm.Counted); ok {
+			return c.Count(), nil
+		}
+		s, err := seqOf(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		i := vm.Int(0)
+		for ; i < n; i, s = i+1, s.Rest() {
+			if err := vm.SeqError(s); err != nil {
+				return vm.NIL, err
+			}
+			if vm.IsEmpty(s) {
+				break
 			}
 		}
-		return vm.TRUE
+		return i, nil
 	})
 
-	gt, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		if len(vs) != 2 {
-			// FIXME error out
-			return vm.NIL
+	get, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 && len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		var notFound vm.Value = vm.NIL
+		if len(vs) == 3 {
+			notFound = vs[2]
+		}
+		return vm.Get(vs[0], vs[1], notFound), nil
+	})
+
+	// seq returns nil for empty collections so it can be used as a condition
+	seq, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		ret, err := vm.BooleanType.Box(vs[0].Unbox().(int) > vs[1].Unbox().(int))
+		elems, err := seqToSlice(vs[0])
 		if err != nil {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, err
+		}
+		if len(elems) == 0 {
+			return vm.NIL, nil
 		}
-		return ret
+		if s, ok := vs[0].(vm.Seq); ok {
+			return s, nil
+		}
+		return vm.NewList(elems), nil
 	})
 
-	lt, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	// run! calls f on every element of coll for side effects and returns nil
+	runBang, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		if len(vs) != 2 {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		elems, err := seqToSlice(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		for i := range elems {
+			if _, err := f.Invoke([]vm.Value{elems[i]}); err != nil {
+				return vm.NIL, err
+			}
+		}
+		return vm.NIL, nil
+	})
+
+	str, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		b := &strings.Builder{}
+		for i := range vs {
+			b.WriteString(strOf(vs[i]))
+		}
+		return vm.String(b.String()), nil
+	})
+
+	// symbol makes a symbol named by a string or a symbol, (symbol ns name) makes ns/name
+	symbol, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 || len(vs) > 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		names := make([]string, len(vs))
+		for i := range vs {
+			switch n := vs[i].(type) {
+			case vm.String:
+				names[i] = string(n)
+			case vm.Symbol:
+				names[i] = string(n)
+			default:
+				return vm.NIL, vm.NewTypeError(vs[i], "is not a name", nil)
+			}
+		}
+		return vm.Symbol(strings.Join(names, "/")), nil
+	})
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	// parseLong, parseDouble and parseBoolean give nil for strings which aren't valid instead of failing
+	parseLong := vm.NativeTyped("parse-long", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		i, err := strconv.ParseInt(string(vs[0].(vm.String)), 10, 64)
+		if err != nil {
+			return vm.NIL, nil
+		}
+		return vm.Int(i), nil
+	})
+
+	// ParseFloat also takes Go syntax like underscores, hex floats and inf, only decimals and the exact
+	// spellings NaN and Infinity are doubles in Clojure
+	doubleSyntax := regexp.MustCompile(`^[+-]?(NaN|Infinity|(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?)$`)
+	parseDouble := vm.NativeTyped("parse-double", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		if !doubleSyntax.MatchString(string(vs[0].(vm.String))) {
+			return vm.NIL, nil
+		}
+		f, err := strconv.ParseFloat(string(vs[0].(vm.String)), 64)
+		// values too large to represent are infinite rather than invalid
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return vm.NIL, nil
+		}
+		return vm.Float(f), nil
+	})
+
+	parseBoolean := vm.NativeTyped("parse-boolean", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		switch vs[0].(vm.String) {
+		case "true":
+			return vm.TRUE, nil
+		case "false":
+			return vm.FALSE, nil
+		}
+		return vm.NIL, nil
+	})
+
+	// subs counts in runes so it never splits a multibyte character
+	subs, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 && len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		str, err := vm.AsString(vs[0])
+		if err != nil {
+			return vm.NIL, err
 		}
-		ret, err := vm.BooleanType.Box(vs[0].Unbox().(int) < vs[1].Unbox().(int))
+		start, err := vm.AsInt(vs[1])
 		if err != nil {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, err
+		}
+		end := utf8.RuneCountInString(str)
+		if len(vs) == 3 {
+			if end, err = vm.AsInt(vs[2]); err != nil {
+				return vm.NIL, err
+			}
+		}
+		sub, ok := runeSubstring(str, start, end)
+		if !ok {
+			return vm.NIL, fmt.Errorf("string index out of range: %d, %d", start, end)
 		}
-		return ret
+		return vm.String(sub), nil
 	})
 
-	setMacro, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	rePattern, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		if len(vs) != 1 {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		m := vs[0].(*vm.Var)
-		m.SetMacro()
-		return m
+		switch p := vs[0].(type) {
+		case *vm.Regex:
+			return p, nil
+		case vm.String:
+			re, err := vm.NewRegex(string(p))
+			if err != nil {
+				return vm.NIL, err
+			}
+			return re, nil
+		default:
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a valid pattern", vm.StringType)
+		}
+	})
+
+	throw, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		// rethrowing a caught Go error keeps it intact
+		if err, ok := vs[0].Unbox().(error); ok && vs[0].Type() == vm.BoxedType {
+			return vm.NIL, err
+		}
+		return vm.NIL, vm.NewThrown(vs[0])
+	})
+
+	// tryStar backs the try special form, it takes the body, catch handler and finally thunks, the last two may be nil
+	tryStar, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		var fns [3]vm.Fn
+		for i := range vs {
+			if vs[i] == vm.NIL {
+				continue
+			}
+			f, err := vm.AsFn(vs[i])
+			if err != nil {
+				return vm.NIL, err
+			}
+			fns[i] = f
+		}
+		ret, err := fns[0].Invoke(nil)
+		if err != nil && fns[1] != nil {
+			ret, err = fns[1].Invoke([]vm.Value{vm.ErrorValue(err)})
+		}
+		if fns[2] != nil {
+			if _, ferr := fns[2].Invoke(nil); ferr != nil {
+				return vm.NIL, ferr
+			}
+		}
+		return ret, err
+	})
+
+	exMessage, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		if err, ok := vs[0].Unbox().(error); ok && vs[0].Type() == vm.BoxedType {
+			return vm.String(err.Error()), nil
+		}
+		if s, ok := vs[0].(vm.String); ok {
+			return s, nil
+		}
+		return vm.String(vs[0].String()), nil
 	})
 
-	vector, err := vm.NativeFnType.Wrap(vm.NewArrayVector)
-	list, err := vm.NativeFnType.Wrap(vm.NewList)
+	// swapRoots sets roots of vars in a var->value map and returns a map of their previous roots
+	swapRoots, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		roots, ok := vs[0].(*vm.Map)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a map of vars", nil)
+		}
+		vars := roots.Keys()
+		for i := range vars {
+			if _, ok := vars[i].(*vm.Var); !ok {
+				return vm.NIL, vm.NewTypeError(vars[i], "is not a Var", nil)
+			}
+		}
+		olds := vm.EmptyMap
+		for i := range vars {
+			v := vars[i].(*vm.Var)
+			olds = olds.Assoc(v, v.Root())
+			v.SetRoot(roots.ValueAt(v))
+		}
+		return olds, nil
+	})
 
-	cons, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	withBindings, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		if len(vs) != 2 {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		elem := vs[0]
-		seq, ok := vs[1].(vm.Seq)
+		bindings, ok := vs[0].(*vm.Map)
 		if !ok {
-			// FIXME make this an error (we need to handle exceptions first)
-			return vm.NIL
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a map of bindings", nil)
+		}
+		fn, err := vm.AsFn(vs[1])
+		if err != nil {
+			return vm.NIL, err
 		}
-		return seq.Cons(elem)
+		vars := bindings.Keys()
+		for i := range vars {
+			v, ok := vars[i].(*vm.Var)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(vars[i], "is not a Var", nil)
+			}
+			if err := v.PushBinding(bindings.ValueAt(v)); err != nil {
+				for j := 0; j < i; j++ {
+					vars[j].(*vm.Var).PopBinding()
+				}
+				return vm.NIL, err
+			}
+		}
+		defer func() {
+			for i := range vars {
+				vars[i].(*vm.Var).PopBinding()
+			}
+		}()
+		return fn.Invoke(nil)
 	})
 
-	first, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	localVar := vm.NativeTyped("local-var", []vm.ValueType{vm.SymbolType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.NewLocalVar(string(vs[0].(vm.Symbol))), nil
+	})
+
+	// var-get and var-set aren't typed as a Var's type is the type of its value
+	varGet, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		if len(vs) != 1 {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		seq, ok := vs[0].(vm.Seq)
+		v, ok := vs[0].(*vm.Var)
 		if !ok {
-			// FIXME make this an error (we need to handle exceptions first)
-			return vm.NIL
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a Var", nil)
 		}
-		return seq.First()
+		return v.Deref(), nil
 	})
 
-	second, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
-		if len(vs) != 1 {
-			// FIXME error out
-			return vm.NIL
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	varSet, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
 		}
-		seq, ok := vs[0].(vm.Seq)
+		v, ok := vs[0].(*vm.Var)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a Var", nil)
+		}
+		if err := v.SetBinding(vs[1]); err != nil {
+			return vm.NIL, err
+		}
+		return vs[1], nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	// rngVar holds *rng*, the source of randomness for rand and friends
+	var rngVar *vm.Var
+	rng := func() (*rand.Rand, error) {
+		r, ok := rngVar.Deref().Unbox().(*rand.Rand)
 		if !ok {
-			// FIXME make this an error (we need to handle exceptions first)
-			return vm.NIL
+			return nil, vm.NewTypeError(rngVar.Deref(), "is not a random number generator", nil)
+		}
+		return r, nil
+	}
+
+	makeRng := vm.NativeTyped("make-rng", []vm.ValueType{vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		seed := vs[0].(vm.Int)
+		return vm.NewBoxed(rand.New(rand.NewSource(int64(seed)))), nil
+	})
+
+	randf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) > 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		r, err := rng()
+		if err != nil {
+			return vm.NIL, err
+		}
+		x := vm.Float(r.Float64())
+		if len(vs) == 0 {
+			return x, nil
+		}
+		return vm.Mul(x, vs[0])
+	})
+
+	randInt := vm.NativeTyped("rand-int", []vm.ValueType{vm.IntType}, func(vs []vm.Value) (vm.Value, error) {
+		n := vs[0].(vm.Int)
+		r, err := rng()
+		if err != nil {
+			return vm.NIL, err
+		}
+		// like (int (rand n)) so it never panics on non-positive n
+		return vm.Int(r.Float64() * float64(n)), nil
+	})
+
+	randNth, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		elems, err := seqToSlice(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		if len(elems) == 0 {
+			return vm.NIL, fmt.Errorf("rand-nth of an empty collection")
 		}
-		return seq.Next().First()
+		r, err := rng()
+		if err != nil {
+			return vm.NIL, err
+		}
+		return elems[r.Intn(len(elems))], nil
 	})
 
-	next, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	shuffle, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		if len(vs) != 1 {
-			// FIXME error out
-			return vm.NIL
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		elems, err := seqToSlice(vs[0])
+		if err != nil {
+			return vm.NIL, err
 		}
-		seq, ok := vs[0].(vm.Seq)
+		r, err := rng()
+		if err != nil {
+			return vm.NIL, err
+		}
+		// Fisher-Yates on a fresh copy so the input stays untouched
+		out := make(vm.ArrayVector, len(elems))
+		copy(out, elems)
+		for i := len(out) - 1; i > 0; i-- {
+			j := r.Intn(i + 1)
+			out[i], out[j] = out[j], out[i]
+		}
+		return out, nil
+	})
+
+	getenv := vm.NativeTyped("getenv", []vm.ValueType{vm.StringType}, func(vs []vm.Value) (vm.Value, error) {
+		name := vs[0].(vm.String)
+		// nil tells an unset variable apart from one set to ""
+		val, ok := os.LookupEnv(string(name))
 		if !ok {
-			// FIXME make this an error (we need to handle exceptions first)
-			return vm.NIL
+			return vm.NIL, nil
+		}
+		return vm.String(val), nil
+	})
+
+	exit, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) > 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		code := vm.Int(0)
+		if len(vs) == 1 {
+			c, ok := vs[0].(vm.Int)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(vs[0], "is not a valid exit code", vm.IntType)
+			}
+			code = c
+		}
+		if w, err := outWriter(); err == nil {
+			if f, ok := w.(interface{ Flush() error }); ok {
+				_ = f.Flush()
+			}
 		}
+		os.Exit(int(code))
+		return vm.NIL, nil
+	})
+
+	// prStr prints values readably, separated by spaces, so read-string gives them back
+	prStr, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		return vm.String(readably(vs)), nil
+	})
 
-		n := seq.Next()
+	if err != nil {
+		panic("lang NS init failed")
+	}
 
-		// FIXME move that to Seq.Next()
-		if n.(vm.Collection).Count().(vm.Int) == 0 {
-			return vm.NIL
+	prn, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		w, err := outWriter()
+		if err != nil {
+			return vm.NIL, err
 		}
-		return n
+		if _, err := fmt.Fprintln(w, readably(vs)); err != nil {
+			return vm.NIL, err
+		}
+		return vm.NIL, nil
 	})
 
-	printlnf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) vm.Value {
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	printlnf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
 		b := &strings.Builder{}
 		for i := range vs {
 			if i > 0 {
@@ -213,8 +2053,14 @@ func installLangNS() {
 			}
 			b.WriteString(vs[i].String())
 		}
-		fmt.Println(b)
-		return vm.NIL
+		w, err := outWriter()
+		if err != nil {
+			return vm.NIL, err
+		}
+		if _, err := fmt.Fprintln(w, b); err != nil {
+			return vm.NIL, err
+		}
+		return vm.NIL, nil
 	})
 
 	if err != nil {
@@ -228,19 +2074,149 @@ func installLangNS() {
 	ns.Def("/", div)
 
 	ns.Def("=", equals)
+	ns.Def("not=", notEquals)
+	ns.Def("not", not)
+	ns.Def("boolean", boolean)
+	ns.Def("==", numEquals)
+	ns.Def("identical?", identical)
+	ns.Def("meta", meta)
+	ns.Def("with-meta", withMeta)
+	ns.Def("vary-meta", varyMeta)
+	ns.Def("bound?", bound)
+	ns.Def("atom", atom)
+	ns.Def("deref", deref)
+	ns.Def("realized?", realized)
+	ns.Def("make-delay", makeDelay)
+	ns.Def("force", force)
+	ns.Def("future-call", futureCall)
+	ns.Def("future?", isFuture)
+	ns.Def("futures-join", futuresJoin)
+	ns.Def("agent", agent)
+	ns.Def("send", send)
+	ns.Def("await", await)
+	ns.Def("agent-error", agentError)
+	ns.Def("restart-agent", restartAgent)
+	ns.Def("reset!", reset)
+	ns.Def("compare-and-set!", compareAndSet)
+	ns.Def("swap!", swap)
+	ns.Def("compare", compare)
 	ns.Def("gt", gt)
 	ns.Def("lt", lt)
+	ns.Def("zero?", zero)
+	ns.Def("pos?", pos)
+	ns.Def("neg?", neg)
+	ns.Def("even?", even)
+	ns.Def("odd?", odd)
+	ns.Def("number?", isNumber)
+	ns.Def("integer?", isInteger)
+
+	ns.Def("bit-and", bitAnd)
+	ns.Def("bit-or", bitOr)
+	ns.Def("bit-xor", bitXor)
+	ns.Def("bit-not", bitNot)
+	ns.Def("bit-shift-left", bitShiftLeft)
+	ns.Def("bit-shift-right", bitShiftRight)
+	ns.Def("unsigned-bit-shift-right", unsignedBitShiftRight)
 
 	ns.Def("set-macro!", setMacro)
 
 	ns.Def("vector", vector)
+	ns.Def("vector-of", vectorOf)
 	ns.Def("list", list)
+	ns.Def("list*", listStar)
+	ns.Def("apply", apply)
+	ns.Def("range", rangef)
+	ns.Def("map", mapf)
+	ns.Def("filter", filter)
+	ns.Def("keep", keep)
+	ns.Def("keep-indexed", keepIndexed)
+	ns.Def("map-indexed", mapIndexed)
+	ns.Def("remove", remove)
+	ns.Def("reduce", reduce)
+	ns.Def("reductions", reductions)
+	ns.Def("hash-map", hashMap)
+	ns.Def("array-map", arrayMap)
+	ns.Def("assoc", assoc)
+	ns.Def("conj", conj)
+	ns.Def("merge", merge)
+	ns.Def("merge-with", mergeWithf)
+	ns.Def("map?", isMapf)
+	ns.Def("bean", bean)
+	ns.Def("frequencies", frequencies)
+	ns.Def("count-by", countByf)
+	ns.Def("distinct?", distinct)
+	ns.Def("dissoc", dissoc)
+	ns.Def("sorted-map", sortedMap)
+	ns.Def("sorted-map-by", sortedMapBy)
+	ns.Def("subseq", subseqf)
+	ns.Def("rsubseq", rsubseqf)
+	ns.Def("hash-set", hashSet)
 	ns.Def("cons", cons)
 	ns.Def("first", first)
 	ns.Def("second", second)
 	ns.Def("next", next)
+	ns.Def("rest", rest)
+	ns.Def("key", key)
+	ns.Def("val", val)
+	ns.Def("map-entry?", isMapEntry)
+	ns.Def("peek", peek)
+	ns.Def("pop", pop)
+
+	ns.Def("nth", nth)
+	ns.Def("nthnext", nthnext)
+	ns.Def("nthrest", nthrest)
+	ns.Def("take-nth", takeNth)
+	ns.Def("seq", seq)
+	ns.Def("count", count)
+	ns.Def("bounded-count", boundedCount)
+	ns.Def("get", get)
+	ns.Def("run!", runBang)
+
+	ns.Def("str", str)
+	ns.Def("symbol", symbol)
+	ns.Def("subs", subs)
+	ns.Def("parse-long", parseLong)
+	ns.Def("parse-double", parseDouble)
+	ns.Def("parse-boolean", parseBoolean)
+	ns.Def("re-pattern", rePattern)
+	ns.Def("throw", throw)
+	ns.Def("try*", tryStar)
+	ns.Def("ex-message", exMessage)
+	ns.Def("swap-roots!", swapRoots)
+
+	ns.Def("with-bindings*", withBindings)
+	ns.Def("local-var", localVar)
+	ns.Def("var-get", varGet)
+	ns.Def("var-set", varSet)
+
+	rngVar = ns.Def("*rng*", vm.NewBoxed(rand.New(rand.NewSource(time.Now().UnixNano())))).SetDynamic()
+	ns.Def("make-rng", makeRng)
+	ns.Def("rand", randf)
+	ns.Def("rand-int", randInt)
+	ns.Def("rand-nth", randNth)
+	ns.Def("shuffle", shuffle)
+
+	outVar = ns.Def("*out*", vm.NewBoxed(io.Writer(os.Stdout))).SetDynamic()
+	commandLineArgsVar = ns.Def("*command-line-args*", vm.NIL)
+	ns.Def("getenv", getenv)
+	ns.Def("exit", exit)
+
+	printSorted := ns.Def("*print-sorted*", vm.FALSE).SetDynamic()
+	vm.PrintSorted = func() bool { return vm.IsTruthy(printSorted.Deref()) }
 
 	ns.Def("println", printlnf)
+	ns.Def("pr-str", prStr)
+	ns.Def("prn", prn)
+
+	installTestFns(ns)
+	installNSFns(ns)
+	installProtocolFns(ns)
+	installTapFns(ns)
+	installTableFns(ns)
+	installLockingFns(ns)
+	installDebugFns(ns)
+	installHintFns(ns)
+	installReplVars(ns)
 
-	RegisterNS(ns)
+	langNS = RegisterNS(ns)
 }
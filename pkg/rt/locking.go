@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// monitor is the mutex locking associates with a value, it's kept only while someone holds or waits for it.
+// owner and depth are guarded by monitors and tell which goroutine holds mu and how many times it locked it.
+type monitor struct {
+	mu    sync.Mutex
+	users int
+	owner uintptr
+	depth int
+}
+
+// monitors maps values to their monitors, values are compared like map keys so a value's identity
+// is its pointer for reference types and its contents for scalars
+var monitors = struct {
+	sync.Mutex
+	m map[vm.Value]*monitor
+}{m: map[vm.Value]*monitor{}}
+
+// lockValue blocks until it holds the monitor of v and returns a function releasing it.
+// Monitors are reentrant, a goroutine holding one locks it again right away and releases it with its last release.
+func lockValue(v vm.Value) (func(), error) {
+	if !reflect.TypeOf(v).Comparable() {
+		return nil, vm.NewTypeError(v, "can't be locked", nil)
+	}
+	id := vm.GoroutineID()
+	monitors.Lock()
+	m := monitors.m[v]
+	if m == nil {
+		m = &monitor{}
+		monitors.m[v] = m
+	}
+	if m.depth > 0 && m.owner == id {
+		m.depth++
+		monitors.Unlock()
+		return func() { unlockMonitor(v, m) }, nil
+	}
+	m.users++
+	monitors.Unlock()
+
+	m.mu.Lock()
+	monitors.Lock()
+	m.owner = id
+	m.depth = 1
+	monitors.Unlock()
+	return func() { unlockMonitor(v, m) }, nil
+}
+
+// unlockMonitor undoes one lockValue of v by the goroutine holding m
+func unlockMonitor(v vm.Value, m *monitor) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	m.depth--
+	if m.depth > 0 {
+		return
+	}
+	m.owner = 0
+	m.mu.Unlock()
+	m.users--
+	if m.users == 0 {
+		delete(monitors.m, v)
+	}
+}
+
+func installLockingFns(ns *vm.Namespace) {
+	// locking* calls f holding the monitor of x, it's released however f returns
+	locking := vm.NativeTyped("locking*", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		unlock, err := lockValue(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		defer unlock()
+		return f.Invoke(nil)
+	})
+
+	ns.Def("locking*", locking)
+}
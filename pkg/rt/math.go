@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// wrapUnaryMath wraps a float64 -> float64 function from the math package as a native fn.
+// Domain errors are not thrown, they yield NaN (or ±Inf) just like in Go and on the JVM.
+func wrapUnaryMath(name string, f func(float64) float64) vm.Value {
+	return vm.NativeTyped(name, []vm.ValueType{vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+		x, _ := vm.AsFloat(vs[0])
+		return vm.Float(f(x)), nil
+	})
+}
+
+func installMathNS() {
+	sqrt := wrapUnaryMath("sqrt", math.Sqrt)
+	floor := wrapUnaryMath("floor", math.Floor)
+	ceil := wrapUnaryMath("ceil", math.Ceil)
+	sin := wrapUnaryMath("sin", math.Sin)
+	cos := wrapUnaryMath("cos", math.Cos)
+	tan := wrapUnaryMath("tan", math.Tan)
+	exp := wrapUnaryMath("exp", math.Exp)
+	log := wrapUnaryMath("log", math.Log)
+
+	// pow always returns a Float, even for two Int arguments
+	pow := vm.NativeTyped("pow", []vm.ValueType{vm.NumberType, vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+		x, _ := vm.AsFloat(vs[0])
+		y, _ := vm.AsFloat(vs[1])
+		return vm.Float(math.Pow(x, y)), nil
+	})
+
+	// round returns the closest Int, rounding half away from zero
+	round := vm.NativeTyped("round", []vm.ValueType{vm.NumberType}, func(vs []vm.Value) (vm.Value, error) {
+		x, _ := vm.AsFloat(vs[0])
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return vm.NIL, fmt.Errorf("can't round %v to an integer", x)
+		}
+		return vm.Int(math.Round(x)), nil
+	})
+
+	ns := vm.NewNamespace("math")
+	ns.Def("PI", vm.Float(math.Pi))
+	ns.Def("E", vm.Float(math.E))
+
+	ns.Def("sqrt", sqrt)
+	ns.Def("pow", pow)
+	ns.Def("floor", floor)
+	ns.Def("ceil", ceil)
+	ns.Def("round", round)
+	ns.Def("sin", sin)
+	ns.Def("cos", cos)
+	ns.Def("tan", tan)
+	ns.Def("exp", exp)
+	ns.Def("log", log)
+
+	RegisterNS(ns)
+}
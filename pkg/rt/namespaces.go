@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// installUserNS registers user, the namespace programs start in, it sees everything defined in lang if it's installed
+func installUserNS() {
+	user := vm.NewNamespace("user")
+	if lang := NS("lang"); lang != nil {
+		user.Refer(lang)
+	}
+	RegisterNS(user)
+}
+
+// ResolveVar finds the var ns/name interning it if needed, it's how loaded bytecode finds its vars
+func ResolveVar(ns string, name string) (*vm.Var, error) {
+	n := NS(ns)
+	if n == nil {
+		return nil, fmt.Errorf("no such namespace: %s", ns)
+	}
+	return n.LookupOrAdd(vm.Symbol(name)).(*vm.Var), nil
+}
+
+// allNS returns registered namespaces sorted by name, aliases are listed once
+func allNS() []vm.Value {
+	seen := map[*vm.Namespace]bool{}
+	var nss []*vm.Namespace
+	for _, n := range nsRegistry {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		nss = append(nss, n)
+	}
+	sort.Slice(nss, func(i, j int) bool { return nss[i].Name() < nss[j].Name() })
+	out := make([]vm.Value, len(nss))
+	for i := range nss {
+		out[i] = nss[i]
+	}
+	return out
+}
+
+// theNS coerces v to a namespace, v can be a namespace or a symbol naming a registered one
+func theNS(v vm.Value) (*vm.Namespace, error) {
+	switch n := v.(type) {
+	case *vm.Namespace:
+		return n, nil
+	case vm.Symbol:
+		ns := NS(string(n))
+		if ns == nil {
+			return nil, vm.NewExecutionError(fmt.Sprintf("no namespace: %s found", n))
+		}
+		return ns, nil
+	default:
+		return nil, vm.NewTypeError(v, "is not a namespace or symbol", nil)
+	}
+}
+
+func installNSFns(ns *vm.Namespace) {
+	findNS, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		s, ok := vs[0].(vm.Symbol)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a symbol", vm.SymbolType)
+		}
+		if n := NS(string(s)); n != nil {
+			return n, nil
+		}
+		return vm.NIL, nil
+	})
+
+	allNSf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 0 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.NewList(allNS()), nil
+	})
+
+	theNSf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return theNS(vs[0])
+	})
+
+	nsName, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		n, err := theNS(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Symbol(n.Name()), nil
+	})
+
+	require, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		for _, v := range vs {
+			if _, err := theNS(v); err != nil {
+				return vm.NIL, err
+			}
+		}
+		return vm.NIL, nil
+	})
+
+	// refer* backs the refer special form, which passes the namespace it's compiled in as the first argument
+	referStar, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		into, err := theNS(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		for _, v := range vs[1:] {
+			n, err := theNS(v)
+			if err != nil {
+				return vm.NIL, err
+			}
+			into.Refer(n)
+		}
+		return vm.NIL, nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	ns.Def("find-ns", findNS)
+	ns.Def("all-ns", allNSf)
+	ns.Def("the-ns", theNSf)
+	ns.Def("ns-name", nsName)
+	ns.Def("require", require)
+	ns.Def("refer*", referStar)
+}
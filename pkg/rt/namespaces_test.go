@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"testing"
+
+	"github.com/nooga/let-go/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallLangNSTwice(t *testing.T) {
+	lang := NS("lang")
+	plus := lang.Lookup("+")
+	out := outVar
+
+	installLangNS()
+
+	assert.Same(t, lang, NS("lang"))
+	assert.Same(t, plus, NS("lang").Lookup("+"))
+	assert.Same(t, out, outVar)
+	sum, err := plus.(*vm.Var).Invoke([]vm.Value{vm.Int(1), vm.Int(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, vm.Int(3), sum)
+}
+
+func TestRegisterNSMerge(t *testing.T) {
+	first := vm.NewNamespace("register-twice")
+	kept := first.Def("kept", vm.Int(1))
+	first.Def("replaced", vm.Int(2))
+	assert.Same(t, first, RegisterNS(first))
+	assert.Same(t, first, RegisterNS(first))
+
+	second := vm.NewNamespace("register-twice")
+	second.Def("replaced", vm.Int(20))
+	second.Def("added", vm.Int(30)).SetDynamic()
+	second.Refer(NS("lang"))
+	replaced := first.Lookup("replaced")
+
+	assert.Same(t, first, RegisterNS(second))
+	assert.Same(t, first, NS("register-twice"))
+	assert.Same(t, kept, first.Lookup("kept"))
+	// vars already resolved see the new definitions
+	assert.Same(t, replaced, first.Lookup("replaced"))
+	assert.Equal(t, vm.Int(20), replaced.(*vm.Var).Deref())
+	assert.Equal(t, vm.Int(30), first.Lookup("added").(*vm.Var).Deref())
+	assert.True(t, first.Lookup("added").(*vm.Var).IsDynamic())
+	assert.NotEqual(t, vm.NIL, first.Lookup("map"))
+}
+
+func TestInstallAliasedNSTwice(t *testing.T) {
+	str := NS("string")
+	replace := str.Lookup("replace")
+
+	installStringNS()
+
+	assert.Same(t, str, NS("string"))
+	assert.Same(t, str, NS("clojure.string"))
+	assert.Same(t, replace, NS("clojure.string").Lookup("replace"))
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// typeName resolves a type designator used with extend-type, types are named by symbols like Int or String
+// or by the names registered Go types go by
+func typeName(v vm.Value) (string, error) {
+	switch t := v.(type) {
+	case vm.Symbol:
+		return string(t), nil
+	case vm.String:
+		return string(t), nil
+	case *vm.Nil:
+		return vm.NilType.Name(), nil
+	case *vm.GoType:
+		return t.Name(), nil
+	}
+	return "", vm.NewTypeError(v, "is not a type name", nil)
+}
+
+func installProtocolFns(ns *vm.Namespace) {
+	makeProtocol := vm.NativeTyped("make-protocol", []vm.ValueType{vm.SymbolType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		ms, err := seqToSlice(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		methods := make([]string, len(ms))
+		for i := range ms {
+			m, ok := ms[i].(vm.Symbol)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(ms[i], "is not a method name", vm.SymbolType)
+			}
+			methods[i] = string(m)
+		}
+		return vm.NewProtocol(string(vs[0].(vm.Symbol)), methods), nil
+	})
+
+	protocolMethod := vm.NativeTyped("protocol-method", []vm.ValueType{vm.ProtocolType, vm.SymbolType}, func(vs []vm.Value) (vm.Value, error) {
+		return vs[0].(*vm.Protocol).Method(string(vs[1].(vm.Symbol)))
+	})
+
+	extend := vm.NativeTyped("extend!", []vm.ValueType{vm.ProtocolType, vm.AnyType, vm.SymbolType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		t, err := typeName(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		fn, err := vm.AsFn(vs[3])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NIL, vs[0].(*vm.Protocol).Extend(t, string(vs[2].(vm.Symbol)), fn)
+	})
+
+	satisfies := vm.NativeTyped("satisfies?", []vm.ValueType{vm.ProtocolType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(vs[0].(*vm.Protocol).Satisfies(vs[1])), nil
+	})
+
+	instance := vm.NativeTyped("instance?", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		switch t := vs[0].(type) {
+		case *vm.GoType:
+			return vm.Boolean(t.IsInstance(vs[1])), nil
+		case *vm.RecordType:
+			return vm.Boolean(t.IsInstance(vs[1])), nil
+		}
+		return vm.NIL, vm.NewTypeError(vs[0], "is not a type", nil)
+	})
+
+	makeRecordType := vm.NativeTyped("make-record-type", []vm.ValueType{vm.SymbolType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		fs, err := seqToSlice(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		fields := make([]vm.Keyword, len(fs))
+		for i := range fs {
+			f, ok := fs[i].(vm.Symbol)
+			if !ok {
+				return vm.NIL, vm.NewTypeError(fs[i], "is not a field name", vm.SymbolType)
+			}
+			fields[i] = vm.Keyword(f)
+		}
+		return vm.NewRecordType(string(vs[0].(vm.Symbol)), fields), nil
+	})
+
+	newRecord := vm.NativeTyped("new-record", []vm.ValueType{vm.RecordTypeType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		vals, err := seqToSlice(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vs[0].(*vm.RecordType).New(vals)
+	})
+
+	mapToRecord := vm.NativeTyped("map->record", []vm.ValueType{vm.RecordTypeType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vs[0].(*vm.RecordType).FromMap(vs[1])
+	})
+
+	ns.Def("make-protocol", makeProtocol)
+	ns.Def("protocol-method", protocolMethod)
+	ns.Def("extend!", extend)
+	ns.Def("satisfies?", satisfies)
+	ns.Def("instance?", instance)
+	ns.Def("make-record-type", makeRecordType)
+	ns.Def("new-record", newRecord)
+	ns.Def("map->record", mapToRecord)
+}
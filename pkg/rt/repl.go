@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/errors"
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// resultVars are *1, *2 and *3 holding the last three values evaluated in the REPL, most recent first
+var resultVars [3]*vm.Var
+
+// errorVar is *e holding the last error raised in the REPL
+var errorVar *vm.Var
+
+func installReplVars(ns *vm.Namespace) {
+	resultVars[0] = ns.Def("*1", vm.NIL)
+	resultVars[1] = ns.Def("*2", vm.NIL)
+	resultVars[2] = ns.Def("*3", vm.NIL)
+	errorVar = ns.Def("*e", vm.NIL)
+}
+
+// RecordResult makes v the value of *1 shifting the previous results to *2 and *3,
+// REPLs call it after every successful evaluation
+func RecordResult(v vm.Value) {
+	resultVars[2].SetRoot(resultVars[1].Deref())
+	resultVars[1].SetRoot(resultVars[0].Deref())
+	resultVars[0].SetRoot(v)
+}
+
+// RecordError makes err the value of *e, REPLs call it when an evaluation fails.
+// Values thrown by programs are kept as they are and other errors are boxed.
+func RecordError(err error) {
+	errorVar.SetRoot(vm.ErrorValue(err))
+}
+
+// UseColor tells if output written to f should be colorized, which is when f is a terminal and NO_COLOR isn't set
+func UseColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return st.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiError = "\x1b[1;31m"
+	ansiDim   = "\x1b[2m"
+	ansiMark  = "\x1b[1;33m"
+)
+
+// painter wraps text in ANSI escapes when colors are on
+type painter bool
+
+func (p painter) paint(escape string, s string) string {
+	if !p {
+		return s
+	}
+	return escape + s + ansiReset
+}
+
+// category highlights the error kind leading a message like TypeError: ... or the whole line if there's none
+func (p painter) category(line string) string {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 || strings.IndexFunc(line[:i], func(r rune) bool { return !isLetter(r) }) >= 0 {
+		return p.paint(ansiError, line)
+	}
+	return p.paint(ansiError, line[:i]) + line[i:]
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// FormatError writes err for people to read: its category and message, the errors which caused it,
+// the line of src the innermost located error points at and the value thrown if that's a map of error data.
+// src is the source which was evaluated, it may be empty if it's not known.
+func FormatError(w io.Writer, err error, src string, color bool) {
+	p := painter(color)
+	var loc errors.Located
+	for i, e := range errors.Chain(err) {
+		msg := strings.Replace(errors.Message(e), "\n", "\n    ", -1)
+		if i == 0 {
+			fmt.Fprintln(w, p.category(msg))
+		} else {
+			fmt.Fprintln(w, p.paint(ansiDim, "  caused by ")+p.category(msg))
+		}
+		// the innermost location is the most precise
+		if l, ok := e.(errors.Located); ok {
+			if _, line, _ := l.Location(); line > 0 {
+				loc = l
+			}
+		}
+	}
+	if loc != nil {
+		writeSourceLine(w, p, loc, src)
+	}
+	if data := vm.ErrorValue(err); isMap(data) {
+		fmt.Fprintln(w, p.paint(ansiDim, "  data: ")+data.String())
+	}
+}
+
+// writeSourceLine shows the line of src where loc is with a caret under its column
+func writeSourceLine(w io.Writer, p painter, loc errors.Located, src string) {
+	_, line, column := loc.Location()
+	lines := strings.Split(src, "\n")
+	if line > len(lines) {
+		return
+	}
+	gutter := fmt.Sprintf("  %d | ", line)
+	fmt.Fprintln(w, p.paint(ansiDim, gutter)+lines[line-1])
+	if column > 0 {
+		pad := strings.Repeat(" ", len(gutter)-2) + "| " + strings.Repeat(" ", column-1)
+		fmt.Fprintln(w, p.paint(ansiDim, pad)+p.paint(ansiMark, "^"))
+	}
+}
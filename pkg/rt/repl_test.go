@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nooga/let-go/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordResult(t *testing.T) {
+	results := func() []vm.Value {
+		return []vm.Value{resultVars[0].Deref(), resultVars[1].Deref(), resultVars[2].Deref()}
+	}
+	RecordResult(vm.Int(1))
+	RecordResult(vm.Int(2))
+	assert.Equal(t, []vm.Value{vm.Int(2), vm.Int(1)}, results()[:2])
+	RecordResult(vm.Int(3))
+	RecordResult(vm.String("four"))
+	assert.Equal(t, []vm.Value{vm.String("four"), vm.Int(3), vm.Int(2)}, results())
+
+	// failures don't shift results
+	RecordError(vm.NewThrown(vm.Keyword("oops")))
+	assert.Equal(t, vm.Keyword("oops"), NS("lang").Lookup("*e").(*vm.Var).Deref())
+	assert.Equal(t, vm.String("four"), NS("lang").Lookup("*1").(*vm.Var).Deref())
+}
+
+type locatedError struct {
+	*vm.ExecutionError
+	line, column int
+}
+
+func (e locatedError) Location() (string, int, int) { return "test", e.line, e.column }
+
+func TestFormatError(t *testing.T) {
+	inner := locatedError{vm.NewExecutionError("bad thing"), 2, 3}
+	err := vm.NewTypeError(vm.Int(1), "is not a fn", nil).Wrap(inner)
+	b := &strings.Builder{}
+	FormatError(b, err, "(first line)\n(oh no)", false)
+	assert.Equal(t, `TypeError: Int is not a fn 
+  caused by ExecutionError: bad thing
+  2 | (oh no)
+    |   ^
+`, b.String())
+
+	b.Reset()
+	FormatError(b, vm.NewThrown(vm.NewMap([]vm.Value{vm.Keyword("code"), vm.Int(7)})), "", true)
+	assert.Equal(t, "\x1b[1;31mThrown\x1b[0m: {:code 7}\n\x1b[2m  data: \x1b[0m{:code 7}\n", b.String())
+
+	old, had := os.LookupEnv("NO_COLOR")
+	os.Setenv("NO_COLOR", "1")
+	assert.False(t, UseColor(os.Stdout))
+	if had {
+		os.Setenv("NO_COLOR", old)
+	} else {
+		os.Unsetenv("NO_COLOR")
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// setArgs checks that all arguments passed to the set function name are sets, at least min of them
+func setArgs(name string, vs []vm.Value, min int) ([]*vm.Set, error) {
+	if len(vs) < min {
+		return nil, vm.NewExecutionError(fmt.Sprintf("wrong number of arguments (%d) passed to %s, expected at least %d", len(vs), name, min))
+	}
+	sets := make([]*vm.Set, len(vs))
+	for i := range vs {
+		s, ok := vs[i].(*vm.Set)
+		if !ok {
+			return nil, vm.NewTypeError(vs[i], "is not a set", vm.SetType)
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// largest returns the index of the set with most elements
+func largest(sets []*vm.Set) int {
+	max := 0
+	for i := range sets {
+		if sets[i].Count().(vm.Int) > sets[max].Count().(vm.Int) {
+			max = i
+		}
+	}
+	return max
+}
+
+// smallest returns the index of the set with fewest elements
+func smallest(sets []*vm.Set) int {
+	min := 0
+	for i := range sets {
+		if sets[i].Count().(vm.Int) < sets[min].Count().(vm.Int) {
+			min = i
+		}
+	}
+	return min
+}
+
+// union conjs the elements of the smaller sets into the largest one
+func union(sets []*vm.Set) *vm.Set {
+	if len(sets) == 0 {
+		return vm.EmptySet
+	}
+	l := largest(sets)
+	out := sets[l]
+	for i := range sets {
+		if i == l {
+			continue
+		}
+		for _, e := range sets[i].Unbox().([]vm.Value) {
+			out = out.Conj(e)
+		}
+	}
+	return out
+}
+
+// intersection keeps the elements of the smallest set which are in all the others
+func intersection(sets []*vm.Set) *vm.Set {
+	s := smallest(sets)
+	out := sets[s]
+	for _, e := range sets[s].Unbox().([]vm.Value) {
+		for i := range sets {
+			if i != s && !sets[i].Contains(e) {
+				out = out.Disj(e)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// difference removes the elements of the rest of sets from the first one
+func difference(sets []*vm.Set) *vm.Set {
+	out := sets[0]
+	for _, other := range sets[1:] {
+		if other.Count().(vm.Int) < out.Count().(vm.Int) {
+			for _, e := range other.Unbox().([]vm.Value) {
+				out = out.Disj(e)
+			}
+			continue
+		}
+		for _, e := range out.Unbox().([]vm.Value) {
+			if other.Contains(e) {
+				out = out.Disj(e)
+			}
+		}
+	}
+	return out
+}
+
+// subset tells whether all elements of a are in b
+func subset(a *vm.Set, b *vm.Set) bool {
+	if a.Count().(vm.Int) > b.Count().(vm.Int) {
+		return false
+	}
+	for _, e := range a.Unbox().([]vm.Value) {
+		if !b.Contains(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectKeys returns a map of the entries of m under keys ks
+func selectKeys(m vm.Value, ks []vm.Value) (vm.Value, error) {
+	km, ok := m.(keyedMap)
+	if !ok || !isMap(m) {
+		return vm.NIL, vm.NewTypeError(m, "is not a map", nil)
+	}
+	var out vm.Value = vm.EmptyArrayMap
+	for _, k := range ks {
+		if !km.Contains(k) {
+			continue
+		}
+		var err error
+		out, err = assoc1(out, k, km.ValueAtOr(k, vm.NIL))
+		if err != nil {
+			return vm.NIL, err
+		}
+	}
+	return out, nil
+}
+
+// index groups maps in xrel by their entries under keys ks, mapping them to sets of maps sharing them
+func index(xrel *vm.Set, ks []vm.Value) (vm.Value, error) {
+	var out vm.Value = vm.EmptyArrayMap
+	for _, m := range xrel.Unbox().([]vm.Value) {
+		k, err := selectKeys(m, ks)
+		if err != nil {
+			return vm.NIL, err
+		}
+		rows, ok := out.(keyedMap).ValueAtOr(k, vm.EmptySet).(*vm.Set)
+		if !ok {
+			rows = vm.EmptySet
+		}
+		out, err = assoc1(out, k, rows.Conj(m))
+		if err != nil {
+			return vm.NIL, err
+		}
+	}
+	return out, nil
+}
+
+// join is the natural join of relations xrel and yrel, sets of maps, on the keys they share.
+// The smaller relation is indexed and the rows of the larger one are merged with the rows matching them.
+func join(xrel *vm.Set, yrel *vm.Set) (vm.Value, error) {
+	xs := xrel.Unbox().([]vm.Value)
+	ys := yrel.Unbox().([]vm.Value)
+	if len(xs) == 0 || len(ys) == 0 {
+		return vm.EmptySet, nil
+	}
+	if len(xs) > len(ys) {
+		xrel, yrel = yrel, xrel
+		xs, ys = ys, xs
+	}
+	ks, err := sharedKeys(xs[0], ys[0])
+	if err != nil {
+		return vm.NIL, err
+	}
+	idx, err := index(xrel, ks)
+	if err != nil {
+		return vm.NIL, err
+	}
+	out := vm.EmptySet
+	for _, y := range ys {
+		k, err := selectKeys(y, ks)
+		if err != nil {
+			return vm.NIL, err
+		}
+		found, ok := idx.(keyedMap).ValueAtOr(k, vm.NIL).(*vm.Set)
+		if !ok {
+			continue
+		}
+		for _, x := range found.Unbox().([]vm.Value) {
+			row, err := mergeWith(nil, []vm.Value{x, y})
+			if err != nil {
+				return vm.NIL, err
+			}
+			out = out.Conj(row)
+		}
+	}
+	return out, nil
+}
+
+// sharedKeys returns the keys of map x which are also in map y
+func sharedKeys(x vm.Value, y vm.Value) ([]vm.Value, error) {
+	ym, ok := y.(keyedMap)
+	if !ok || !isMap(y) {
+		return nil, vm.NewTypeError(y, "is not a map", nil)
+	}
+	if !isMap(x) {
+		return nil, vm.NewTypeError(x, "is not a map", nil)
+	}
+	entries, err := vm.AppendElements(nil, x)
+	if err != nil {
+		return nil, err
+	}
+	var ks []vm.Value
+	for _, e := range entries {
+		if k := e.(vm.MapEntry).Key(); ym.Contains(k) {
+			ks = append(ks, k)
+		}
+	}
+	return ks, nil
+}
+
+func installSetNS() {
+	setFn := func(name string, min int, fn func([]*vm.Set) *vm.Set) vm.Value {
+		f, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+			sets, err := setArgs(name, vs, min)
+			if err != nil {
+				return vm.NIL, err
+			}
+			return fn(sets), nil
+		})
+		if err != nil {
+			panic("set NS init failed")
+		}
+		return f
+	}
+
+	subsetp := vm.NativeTyped("subset?", []vm.ValueType{vm.SetType, vm.SetType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(subset(vs[0].(*vm.Set), vs[1].(*vm.Set))), nil
+	})
+
+	supersetp := vm.NativeTyped("superset?", []vm.ValueType{vm.SetType, vm.SetType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(subset(vs[1].(*vm.Set), vs[0].(*vm.Set))), nil
+	})
+
+	indexf := vm.NativeTyped("index", []vm.ValueType{vm.SetType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		ks, err := vm.AppendElements(nil, vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return index(vs[0].(*vm.Set), ks)
+	})
+
+	joinf := vm.NativeTyped("join", []vm.ValueType{vm.SetType, vm.SetType}, func(vs []vm.Value) (vm.Value, error) {
+		return join(vs[0].(*vm.Set), vs[1].(*vm.Set))
+	})
+
+	ns := vm.NewNamespace("set")
+	ns.Def("union", setFn("union", 0, union))
+	ns.Def("intersection", setFn("intersection", 1, intersection))
+	ns.Def("difference", setFn("difference", 1, difference))
+	ns.Def("subset?", subsetp)
+	ns.Def("superset?", supersetp)
+	ns.Def("index", indexf)
+	ns.Def("join", joinf)
+
+	registerAs("clojure.set", RegisterNS(ns))
+}
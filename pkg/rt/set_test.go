@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nooga/let-go/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func intSet(from, to int) *vm.Set {
+	s := vm.EmptySet
+	for i := from; i < to; i++ {
+		s = s.Conj(vm.Int(i))
+	}
+	return s
+}
+
+func TestSetOps(t *testing.T) {
+	a, b := intSet(0, 3000), intSet(1500, 4500)
+	assert.Equal(t, vm.Int(4500), union([]*vm.Set{a, b}).Count())
+	assert.True(t, intersection([]*vm.Set{a, b}).Equals(intSet(1500, 3000)))
+	assert.True(t, difference([]*vm.Set{a, b}).Equals(intSet(0, 1500)))
+	assert.True(t, subset(intSet(10, 20), a))
+	assert.False(t, subset(b, a))
+}
+
+// BenchmarkSetOps combines two sets of a few thousand elements overlapping by half
+func BenchmarkSetOps(b *testing.B) {
+	for _, n := range []int{1000, 5000} {
+		x, y := intSet(0, n), intSet(n/2, n+n/2)
+		ops := map[string]func([]*vm.Set) *vm.Set{"union": union, "intersection": intersection, "difference": difference}
+		for name, op := range ops {
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					op([]*vm.Set{x, y})
+				}
+			})
+		}
+		b.Run(fmt.Sprintf("conj/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				intSet(0, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// sh runs an external command and returns {:out "..." :err "..." :exit n}.
+// Arguments are strings up to the first keyword, the rest are options:
+// :in sets the string fed to stdin and :dir sets the working directory.
+// A non-zero exit status is not an error, failing to start the process is.
+func sh(vs []vm.Value) (vm.Value, error) {
+	var args []string
+	i := 0
+	for ; i < len(vs); i++ {
+		if vs[i].Type() == vm.KeywordType {
+			break
+		}
+		s, err := vm.AsString(vs[i])
+		if err != nil {
+			return vm.NIL, err
+		}
+		args = append(args, s)
+	}
+	if len(args) == 0 {
+		return vm.NIL, fmt.Errorf("sh needs a command to run")
+	}
+	opts := vs[i:]
+	if len(opts)%2 != 0 {
+		return vm.NIL, fmt.Errorf("sh options must come in pairs")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	for j := 0; j < len(opts); j += 2 {
+		val, err := vm.AsString(opts[j+1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		switch opts[j] {
+		case vm.Keyword("in"):
+			cmd.Stdin = strings.NewReader(val)
+		case vm.Keyword("dir"):
+			cmd.Dir = val
+		default:
+			return vm.NIL, fmt.Errorf("unknown sh option %s", opts[j])
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return vm.NIL, err
+		}
+	}
+	return vm.NewMap([]vm.Value{
+		vm.Keyword("out"), vm.String(stdout.String()),
+		vm.Keyword("err"), vm.String(stderr.String()),
+		vm.Keyword("exit"), vm.Int(cmd.ProcessState.ExitCode()),
+	}), nil
+}
+
+func installShellNS() {
+	shf, err := vm.NativeFnType.Wrap(sh)
+	if err != nil {
+		panic("shell NS init failed")
+	}
+
+	ns := vm.NewNamespace("shell")
+	ns.Def("sh", shf)
+
+	RegisterNS(ns)
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// runeSubstring returns the part of s between rune indices start (inclusive) and end (exclusive).
+// ASCII runs are walked byte by byte so plain strings don't pay for UTF-8 decoding.
+func runeSubstring(s string, start int, end int) (string, bool) {
+	if start < 0 || end < start {
+		return "", false
+	}
+	if end <= len(s) && isASCII(s[:end]) {
+		return s[start:end], true
+	}
+	from, to := -1, -1
+	n, i := 0, 0
+	for {
+		if n == start {
+			from = i
+		}
+		if n == end {
+			to = i
+			break
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] < utf8.RuneSelf {
+			i++
+		} else {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+		}
+		n++
+	}
+	if from < 0 || to < 0 {
+		return "", false
+	}
+	return s[from:to], true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceWithFn replaces every match of re in s with the result of calling f on it.
+// f receives the matched string, or a vector of the match followed by its groups when re has groups.
+func replaceWithFn(s string, re *regexp.Regexp, f vm.Fn) (string, error) {
+	b := &strings.Builder{}
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(s[last:m[0]])
+		var arg vm.Value = vm.String(s[m[0]:m[1]])
+		if len(m) > 2 {
+			groups := make(vm.ArrayVector, len(m)/2)
+			for i := range groups {
+				if m[2*i] < 0 {
+					groups[i] = vm.NIL
+					continue
+				}
+				groups[i] = vm.String(s[m[2*i]:m[2*i+1]])
+			}
+			arg = groups
+		}
+		out, err := f.Invoke([]vm.Value{arg})
+		if err != nil {
+			return "", err
+		}
+		rs, ok := out.(vm.String)
+		if !ok {
+			return "", vm.NewTypeError(out, "is not a valid replacement", vm.StringType)
+		}
+		b.WriteString(string(rs))
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// groupRefs rewrites a replacement string from Clojure's $1 syntax to the one Regexp.Expand takes.
+// Go would read $1x as the group named 1x, so numbered groups become ${1}, and dollars not starting
+// a group reference, or escaped with a backslash, are kept literally.
+func groupRefs(r string) string {
+	if !strings.ContainsAny(r, "$\\") {
+		return r
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '\\' && i+1 < len(r):
+			i++
+			if r[i] == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(r[i])
+			}
+		case c == '$' && i+1 < len(r) && r[i+1] >= '0' && r[i+1] <= '9':
+			j := i + 1
+			for j < len(r) && r[j] >= '0' && r[j] <= '9' {
+				j++
+			}
+			b.WriteString("${" + r[i+1:j] + "}")
+			i = j - 1
+		case c == '$' && i+1 < len(r) && r[i+1] == '{':
+			b.WriteByte(c)
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func installStringNS() {
+	// replace accepts a string or a regex to match and a string or a function producing the replacement,
+	// string replacements for regex matches may refer to groups with $1 or ${1} and escape a dollar with \$
+	replace, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 3 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		s, err := vm.AsString(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		var re *regexp.Regexp
+		switch m := vs[1].(type) {
+		case vm.String:
+			if r, ok := vs[2].(vm.String); ok {
+				return vm.String(strings.ReplaceAll(s, string(m), string(r))), nil
+			}
+			re = regexp.MustCompile(regexp.QuoteMeta(string(m)))
+		case *vm.Regex:
+			re = m.Regexp()
+		default:
+			return vm.NIL, vm.NewTypeError(vs[1], "is not a string or regex", nil)
+		}
+		switch r := vs[2].(type) {
+		case vm.String:
+			return vm.String(re.ReplaceAllString(s, groupRefs(string(r)))), nil
+		case vm.Fn:
+			out, err := replaceWithFn(s, re, r)
+			if err != nil {
+				return vm.NIL, err
+			}
+			return vm.String(out), nil
+		default:
+			return vm.NIL, vm.NewTypeError(vs[2], "is not a string or function", nil)
+		}
+	})
+
+	if err != nil {
+		panic("string NS init failed")
+	}
+
+	ns := vm.NewNamespace("string")
+	ns.Def("replace", replace)
+
+	registerAs("clojure.string", RegisterNS(ns))
+}
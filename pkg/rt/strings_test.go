@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuneSubstring(t *testing.T) {
+	s, ok := runeSubstring("héllo", 1, 3)
+	assert.True(t, ok)
+	assert.Equal(t, "él", s)
+
+	s, ok = runeSubstring("日本語", 2, 3)
+	assert.True(t, ok)
+	assert.Equal(t, "語", s)
+
+	s, ok = runeSubstring("abc", 3, 3)
+	assert.True(t, ok)
+	assert.Equal(t, "", s)
+
+	_, ok = runeSubstring("abc", 2, 4)
+	assert.False(t, ok)
+	_, ok = runeSubstring("abc", -1, 2)
+	assert.False(t, ok)
+	_, ok = runeSubstring("abc", 2, 1)
+	assert.False(t, ok)
+}
+
+func TestGroupRefs(t *testing.T) {
+	assert.Equal(t, "plain", groupRefs("plain"))
+	assert.Equal(t, "${1}x", groupRefs("$1x"))
+	assert.Equal(t, "${12} ${name}", groupRefs("$12 ${name}"))
+	assert.Equal(t, "$$ and $$1", groupRefs("$ and \\$1"))
+	assert.Equal(t, "a\\b", groupRefs("a\\\\b"))
+}
+
+func BenchmarkRuneSubstringASCII(b *testing.B) {
+	s := strings.Repeat("hello world ", 100)
+	for i := 0; i < b.N; i++ {
+		runeSubstring(s, 500, 1000)
+	}
+}
+
+func BenchmarkRuneSubstringMultibyte(b *testing.B) {
+	s := strings.Repeat("héllo wörld ", 100)
+	for i := 0; i < b.N; i++ {
+		runeSubstring(s, 500, 1000)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// tableKeys collects keys of all rows in the order they first appear
+func tableKeys(rows []vm.Value) ([]vm.Value, error) {
+	var keys []vm.Value
+	for _, row := range rows {
+		if row == vm.NIL {
+			continue
+		}
+		entries, err := vm.AppendElements(nil, row)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			k := e.(vm.MapEntry).Key()
+			if !containsValue(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func containsValue(vs []vm.Value, v vm.Value) bool {
+	for i := range vs {
+		if vm.Equal(vs[i], v) {
+			return true
+		}
+	}
+	return false
+}
+
+// printTable writes rows as a table with a column for each key, cells are right aligned to the widest one in
+// their column and rows lacking a key get an empty cell
+func printTable(w io.Writer, keys []vm.Value, rows []vm.Value) error {
+	cells := make([][]string, len(rows)+1)
+	widths := make([]int, len(keys))
+	cells[0] = make([]string, len(keys))
+	for i, k := range keys {
+		cells[0][i] = strOf(k)
+	}
+	for r, row := range rows {
+		cells[r+1] = make([]string, len(keys))
+		if row == vm.NIL {
+			continue
+		}
+		m, ok := row.(keyedMap)
+		if !ok || !isMap(row) {
+			return vm.NewTypeError(row, "is not a map", nil)
+		}
+		for i, k := range keys {
+			cells[r+1][i] = strOf(m.ValueAtOr(k, vm.NIL))
+		}
+	}
+	for _, line := range cells {
+		for i, c := range line {
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	writeRow := func(line []string) {
+		for i, c := range line {
+			b.WriteString("| ")
+			b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)))
+			b.WriteString(c)
+			b.WriteString(" ")
+		}
+		b.WriteString("|\n")
+	}
+	b.WriteString("\n")
+	writeRow(cells[0])
+	for i := range widths {
+		if i == 0 {
+			b.WriteString("|-")
+		} else {
+			b.WriteString("+-")
+		}
+		b.WriteString(strings.Repeat("-", widths[i]+1))
+	}
+	b.WriteString("|\n")
+	for _, line := range cells[1:] {
+		writeRow(line)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func installTableFns(ns *vm.Namespace) {
+	// (print-table rows) takes columns from keys of the rows, (print-table ks rows) prints only the ones in ks
+	printTablef, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 && len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		rows, err := seqToSlice(vs[len(vs)-1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		var keys []vm.Value
+		if len(vs) == 2 {
+			keys, err = seqToSlice(vs[0])
+		} else {
+			keys, err = tableKeys(rows)
+		}
+		if err != nil {
+			return vm.NIL, err
+		}
+		if len(keys) == 0 {
+			return vm.NIL, nil
+		}
+		w, err := outWriter()
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.NIL, printTable(w, keys, rows)
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	ns.Def("print-table", printTablef)
+}
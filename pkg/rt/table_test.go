@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nooga/let-go/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func tableRow(kvs ...vm.Value) vm.Value {
+	var m vm.Value = vm.EmptyArrayMap
+	for i := 0; i < len(kvs); i += 2 {
+		m = m.(*vm.ArrayMap).Assoc(kvs[i], kvs[i+1])
+	}
+	return m
+}
+
+func TestPrintTable(t *testing.T) {
+	rows := []vm.Value{
+		tableRow(vm.Keyword("a"), vm.Int(1), vm.Keyword("b"), vm.String("hello")),
+		tableRow(vm.Keyword("a"), vm.Int(100)),
+		tableRow(vm.Keyword("b"), vm.Int(2), vm.Keyword("c"), vm.Keyword("x")),
+	}
+	keys, err := tableKeys(rows)
+	assert.NoError(t, err)
+	b := &strings.Builder{}
+	assert.NoError(t, printTable(b, keys, rows))
+	assert.Equal(t, `
+|  :a |    :b | :c |
+|-----+-------+----|
+|   1 | hello |    |
+| 100 |       |    |
+|     |     2 | :x |
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, printTable(b, []vm.Value{vm.Keyword("b")}, rows[:1]))
+	assert.Equal(t, "\n|    :b |\n|-------|\n| hello |\n", b.String())
+
+	assert.Error(t, printTable(b, keys, []vm.Value{vm.Int(1)}))
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"sync"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// tapQueueSize is how many values tap> can enqueue ahead of the taps before it starts dropping them
+const tapQueueSize = 1024
+
+// tapSet holds the functions added with add-tap and feeds them values sent with tap>.
+// Values are delivered by a single goroutine in the order they were enqueued so taps never block the sender
+// and see what each producer sent in order.
+type tapSet struct {
+	mu    sync.Mutex
+	fns   []vm.Fn
+	queue chan vm.Value
+	once  sync.Once
+}
+
+var taps = &tapSet{}
+
+func (t *tapSet) add(f vm.Fn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, g := range t.fns {
+		if g == f {
+			return
+		}
+	}
+	t.fns = append(t.fns, f)
+}
+
+func (t *tapSet) remove(f vm.Fn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, g := range t.fns {
+		if g == f {
+			t.fns = append(t.fns[:i:i], t.fns[i+1:]...)
+			return
+		}
+	}
+}
+
+// send enqueues v for the taps, it returns false when the queue is full and v was dropped
+func (t *tapSet) send(v vm.Value) bool {
+	t.once.Do(func() {
+		t.queue = make(chan vm.Value, tapQueueSize)
+		go t.loop()
+	})
+	select {
+	case t.queue <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *tapSet) loop() {
+	for v := range t.queue {
+		t.mu.Lock()
+		fns := t.fns
+		t.mu.Unlock()
+		for _, f := range fns {
+			// like in Clojure errors thrown by taps are ignored
+			_, _ = f.Invoke([]vm.Value{v})
+		}
+	}
+}
+
+func installTapFns(ns *vm.Namespace) {
+	addTap := vm.NativeTyped("add-tap", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		taps.add(f)
+		return vm.NIL, nil
+	})
+
+	removeTap := vm.NativeTyped("remove-tap", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := vm.AsFn(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		taps.remove(f)
+		return vm.NIL, nil
+	})
+
+	tap := vm.NativeTyped("tap>", []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		return vm.Boolean(taps.send(vs[0])), nil
+	})
+
+	ns.Def("add-tap", addTap)
+	ns.Def("remove-tap", removeTap)
+	ns.Def("tap>", tap)
+}
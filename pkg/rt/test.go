@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// testReport accumulates results of assertions made with is
+type testReport struct {
+	test    *vm.Var
+	tests   int
+	asserts int
+	pass    int
+	fail    int
+	error   int
+}
+
+// tests keeps vars defined with deftest in order of definition, grouped by namespace
+var tests map[string][]*vm.Var
+
+func addTest(v *vm.Var) {
+	if tests == nil {
+		tests = map[string][]*vm.Var{}
+	}
+	for _, t := range tests[v.NSName()] {
+		if t == v {
+			return
+		}
+	}
+	tests[v.NSName()] = append(tests[v.NSName()], v)
+}
+
+func (r *testReport) location() string {
+	if r.test == nil {
+		return ""
+	}
+	return " in (" + r.test.Name() + ")"
+}
+
+func (r *testReport) summary() vm.Value {
+	return vm.NewMap([]vm.Value{
+		vm.Keyword("test"), vm.Int(r.tests),
+		vm.Keyword("pass"), vm.Int(r.pass),
+		vm.Keyword("fail"), vm.Int(r.fail),
+		vm.Keyword("error"), vm.Int(r.error),
+	})
+}
+
+// isSpecial tells whether a form head can't be evaluated as a function for reporting purposes
+func isSpecial(head vm.Value) bool {
+	s, ok := head.(vm.Symbol)
+	if !ok {
+		return true
+	}
+	switch s {
+	case "if", "do", "def", "fn", "quote", "var", "let", "try":
+		return true
+	}
+	if lang := NS("lang"); lang != nil {
+		if v, ok := lang.Lookup(s).(*vm.Var); ok && v.IsMacro() {
+			return true
+		}
+	}
+	return false
+}
+
+func installTestFns(ns *vm.Namespace) {
+	var reportVar *vm.Var
+	report := func() (*testReport, error) {
+		r, ok := reportVar.Deref().Unbox().(*testReport)
+		if !ok {
+			return nil, vm.NewTypeError(reportVar.Deref(), "is not a test report", nil)
+		}
+		return r, nil
+	}
+
+	addTestf, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		v, ok := vs[0].(*vm.Var)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a Var", nil)
+		}
+		addTest(v)
+		return v, nil
+	})
+
+	// (is form) expands to a call to is* passing the quoted form and a thunk,
+	// for plain function calls the thunk returns the function followed by evaluated arguments
+	// so failures can show the values that went in
+	is, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) < 1 || len(vs) > 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		form := vs[0]
+		var msg vm.Value = vm.NIL
+		if len(vs) == 2 {
+			msg = vs[1]
+		}
+		quoted := vm.NewList([]vm.Value{vm.Symbol("quote"), form})
+		if l, ok := form.(*vm.List); ok && l.Count().(vm.Int) > 0 && !isSpecial(l.First()) {
+			thunk := vm.NewList([]vm.Value{vm.Symbol("fn"), vm.ArrayVector{}, vm.NewList(append([]vm.Value{vm.Symbol("list")}, l.Unbox().([]vm.Value)...))})
+			return vm.NewList([]vm.Value{vm.Symbol("lang/is*"), quoted, thunk, vm.TRUE, msg}), nil
+		}
+		thunk := vm.NewList([]vm.Value{vm.Symbol("fn"), vm.ArrayVector{}, form})
+		return vm.NewList([]vm.Value{vm.Symbol("lang/is*"), quoted, thunk, vm.FALSE, msg}), nil
+	})
+
+	isStar, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 4 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		r, err := report()
+		if err != nil {
+			return vm.NIL, err
+		}
+		w, err := outWriter()
+		if err != nil {
+			return vm.NIL, err
+		}
+		form, thunk, isCall, msg := vs[0], vs[1].(vm.Fn), vs[2] == vm.TRUE, vs[3]
+		r.asserts++
+		result, err := thunk.Invoke(nil)
+		actual := result
+		if err == nil && isCall {
+			call := result.Unbox().([]vm.Value)
+			actual = vm.NewList(append([]vm.Value{form.(*vm.List).First()}, call[1:]...))
+			if f, ok := call[0].(vm.Fn); ok {
+				result, err = f.Invoke(call[1:])
+			} else {
+				err = vm.NewTypeError(call[0], "is not a function", nil)
+			}
+		}
+		header := func(kind string) {
+			fmt.Fprintf(w, "\n%s%s\n", kind, r.location())
+			if s, ok := msg.(vm.String); ok {
+				fmt.Fprintln(w, string(s))
+			} else if msg != vm.NIL {
+				fmt.Fprintln(w, msg)
+			}
+			fmt.Fprintln(w, "expected:", form)
+		}
+		switch {
+		case err != nil:
+			r.error++
+			header("ERROR")
+			fmt.Fprintln(w, "  actual:", err)
+			return vm.FALSE, nil
+		case vm.IsTruthy(result):
+			r.pass++
+			return vm.TRUE, nil
+		default:
+			r.fail++
+			header("FAIL")
+			if isCall {
+				fmt.Fprintln(w, "  actual:", vm.NewList([]vm.Value{vm.Symbol("not"), actual}))
+			} else {
+				fmt.Fprintln(w, "  actual:", actual)
+			}
+			return vm.FALSE, nil
+		}
+	})
+
+	// run-tests runs tests of the given namespaces, or all tests when called without arguments,
+	// and returns a summary map like {:test 2 :pass 5 :fail 1 :error 0}
+	runTests, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		var names []string
+		for i := range vs {
+			switch n := vs[i].(type) {
+			case vm.Symbol:
+				names = append(names, string(n))
+			case vm.String:
+				names = append(names, string(n))
+			default:
+				return vm.NIL, vm.NewTypeError(vs[i], "is not a namespace name", nil)
+			}
+		}
+		if len(vs) == 0 {
+			for name := range tests {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		w, err := outWriter()
+		if err != nil {
+			return vm.NIL, err
+		}
+		r := &testReport{}
+		if err := reportVar.PushBinding(vm.NewBoxed(r)); err != nil {
+			return vm.NIL, err
+		}
+		defer reportVar.PopBinding()
+		for _, name := range names {
+			fmt.Fprintf(w, "\nTesting %s\n", name)
+			for _, t := range tests[name] {
+				r.test = t
+				r.tests++
+				if _, err := t.Invoke(nil); err != nil {
+					r.error++
+					fmt.Fprintf(w, "\nERROR%s\nuncaught: %s\n", r.location(), err)
+				}
+			}
+		}
+		r.test = nil
+		fmt.Fprintf(w, "\nRan %d tests containing %d assertions.\n%d failures, %d errors.\n",
+			r.tests, r.asserts, r.fail, r.error)
+		return r.summary(), nil
+	})
+
+	if err != nil {
+		panic("lang NS init failed")
+	}
+
+	// outside of run-tests assertions are counted in a throwaway report
+	reportVar = ns.Def("*test-report*", vm.NewBoxed(&testReport{})).SetDynamic()
+	ns.Def("add-test!", addTestf)
+	ns.Def("is", is).SetMacro()
+	ns.Def("is*", isStar)
+	ns.Def("run-tests", runTests)
+}
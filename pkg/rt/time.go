@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+// instantArg unwraps an Instant argument
+func instantArg(v vm.Value) (time.Time, error) {
+	i, ok := v.(vm.Instant)
+	if !ok {
+		return time.Time{}, vm.NewTypeError(v, "is not an Instant", vm.InstantType)
+	}
+	return i.Time(), nil
+}
+
+// Durations are plain Ints counting milliseconds, so they mix freely with regular arithmetic.
+func installTimeNS() {
+	now, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 0 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		return vm.Instant(time.Now()), nil
+	})
+
+	format, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		t, err := instantArg(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		layout, ok := vs[1].(vm.String)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[1], "is not a layout string", vm.StringType)
+		}
+		return vm.String(t.Format(string(layout))), nil
+	})
+
+	parse, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		layout, ok := vs[0].(vm.String)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a layout string", vm.StringType)
+		}
+		s, err := vm.AsString(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		t, err := time.Parse(string(layout), s)
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Instant(t), nil
+	})
+
+	plus, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		t, err := instantArg(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		ms, ok := vs[1].(vm.Int)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[1], "is not a duration in milliseconds", vm.IntType)
+		}
+		return vm.Instant(t.Add(time.Duration(ms) * time.Millisecond)), nil
+	})
+
+	between, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 2 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		a, err := instantArg(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		b, err := instantArg(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Int(b.Sub(a).Milliseconds()), nil
+	})
+
+	unixMillis, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		t, err := instantArg(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Int(t.UnixNano() / int64(time.Millisecond)), nil
+	})
+
+	fromUnixMillis, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		ms, err := vm.AsInt(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return vm.Instant(time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()), nil
+	})
+
+	sleep, err := vm.NativeFnType.Wrap(func(vs []vm.Value) (vm.Value, error) {
+		if len(vs) != 1 {
+			return vm.NIL, fmt.Errorf("wrong number of arguments %d", len(vs))
+		}
+		ms, ok := vs[0].(vm.Int)
+		if !ok {
+			return vm.NIL, vm.NewTypeError(vs[0], "is not a duration in milliseconds", vm.IntType)
+		}
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return vm.NIL, nil
+	})
+
+	if err != nil {
+		panic("time NS init failed")
+	}
+
+	ns := vm.NewNamespace("time")
+
+	ns.Def("RFC3339", vm.String(time.RFC3339))
+	ns.Def("RFC3339Nano", vm.String(time.RFC3339Nano))
+	ns.Def("RFC1123", vm.String(time.RFC1123))
+	ns.Def("Kitchen", vm.String(time.Kitchen))
+
+	ns.Def("now", now)
+	ns.Def("format", format)
+	ns.Def("parse", parse)
+	ns.Def("plus", plus)
+	ns.Def("between", between)
+	ns.Def("unix-millis", unixMillis)
+	ns.Def("from-unix-millis", fromUnixMillis)
+	ns.Def("sleep", sleep)
+
+	RegisterNS(ns)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"github.com/nooga/let-go/pkg/vm"
+)
+
+type walkFn func(vm.Value) (vm.Value, error)
+
+// walk applies inner to each element of form and outer to form rebuilt from the results.
+// Collections are rebuilt as the same kind keeping their metadata, other seqs become lists.
+// Elements of maps are MapEntries and inner has to return [key value] pairs for them too.
+func walk(inner walkFn, outer walkFn, form vm.Value) (vm.Value, error) {
+	var out vm.Value
+	switch c := form.(type) {
+	case *vm.Map, *vm.ArrayMap, *vm.SortedMap, *vm.Set:
+		elems, err := vm.AppendElements(nil, c)
+		if err != nil {
+			return vm.NIL, err
+		}
+		out = c.(vm.Collection).Empty()
+		for _, e := range elems {
+			w, err := inner(e)
+			if err != nil {
+				return vm.NIL, err
+			}
+			if out, err = conj1(out, w); err != nil {
+				return vm.NIL, err
+			}
+		}
+	case vm.ArrayVector, *vm.PersistentVector, *vm.PrimitiveVector, vm.MapEntry, vm.Seq:
+		elems, err := vm.AppendElements(nil, c)
+		if err != nil {
+			return vm.NIL, err
+		}
+		for i := range elems {
+			if elems[i], err = inner(elems[i]); err != nil {
+				return vm.NIL, err
+			}
+		}
+		switch c.(type) {
+		case vm.ArrayVector, *vm.PersistentVector, *vm.PrimitiveVector, vm.MapEntry:
+			out = vm.NewVector(elems)
+		default:
+			out = vm.NewList(elems)
+		}
+	default:
+		return outer(form)
+	}
+	if m, ok := form.(vm.Metadatable); ok && m.Meta() != vm.NIL {
+		out = out.(vm.Metadatable).WithMeta(m.Meta())
+	}
+	return outer(out)
+}
+
+func postwalk(f walkFn, form vm.Value) (vm.Value, error) {
+	return walk(func(v vm.Value) (vm.Value, error) { return postwalk(f, v) }, f, form)
+}
+
+func prewalk(f walkFn, form vm.Value) (vm.Value, error) {
+	form, err := f(form)
+	if err != nil {
+		return vm.NIL, err
+	}
+	return walk(func(v vm.Value) (vm.Value, error) { return prewalk(f, v) }, func(v vm.Value) (vm.Value, error) { return v, nil }, form)
+}
+
+// invoker adapts a Lisp function to a walkFn
+func invoker(v vm.Value) (walkFn, error) {
+	f, err := vm.AsFn(v)
+	if err != nil {
+		return nil, err
+	}
+	return func(x vm.Value) (vm.Value, error) { return f.Invoke([]vm.Value{x}) }, nil
+}
+
+func installWalkNS() {
+	walkf := vm.NativeTyped("walk", []vm.ValueType{vm.AnyType, vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		inner, err := invoker(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		outer, err := invoker(vs[1])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return walk(inner, outer, vs[2])
+	})
+
+	postwalkf := vm.NativeTyped("postwalk", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := invoker(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return postwalk(f, vs[1])
+	})
+
+	prewalkf := vm.NativeTyped("prewalk", []vm.ValueType{vm.AnyType, vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+		f, err := invoker(vs[0])
+		if err != nil {
+			return vm.NIL, err
+		}
+		return prewalk(f, vs[1])
+	})
+
+	// keys of maps nested anywhere in form converted with f
+	mapKeys := func(name string, f func(vm.Value) vm.Value) *vm.NativeFn {
+		return vm.NativeTyped(name, []vm.ValueType{vm.AnyType}, func(vs []vm.Value) (vm.Value, error) {
+			return postwalk(func(v vm.Value) (vm.Value, error) {
+				switch v.(type) {
+				case *vm.Map, *vm.ArrayMap, *vm.SortedMap:
+				default:
+					return v, nil
+				}
+				entries, err := vm.AppendElements(nil, v)
+				if err != nil {
+					return vm.NIL, err
+				}
+				var out vm.Value = v.(vm.Collection).Empty()
+				for _, e := range entries {
+					kv := e.(vm.MapEntry)
+					if out, err = assoc1(out, f(kv.Key()), kv.Val()); err != nil {
+						return vm.NIL, err
+					}
+				}
+				return out, nil
+			}, vs[0])
+		})
+	}
+
+	stringifyKeys := mapKeys("stringify-keys", func(k vm.Value) vm.Value {
+		if kw, ok := k.(vm.Keyword); ok {
+			return vm.String(kw)
+		}
+		return k
+	})
+
+	keywordizeKeys := mapKeys("keywordize-keys", func(k vm.Value) vm.Value {
+		if s, ok := k.(vm.String); ok {
+			return vm.Keyword(s)
+		}
+		return k
+	})
+
+	ns := vm.NewNamespace("walk")
+	ns.Def("walk", walkf)
+	ns.Def("postwalk", postwalkf)
+	ns.Def("prewalk", prewalkf)
+	ns.Def("stringify-keys", stringifyKeys)
+	ns.Def("keywordize-keys", keywordizeKeys)
+
+	registerAs("clojure.walk", RegisterNS(ns))
+}
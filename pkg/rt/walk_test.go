@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package rt
+
+import (
+	"testing"
+
+	"github.com/nooga/let-go/pkg/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func incInts(v vm.Value) (vm.Value, error) {
+	if n, ok := v.(vm.Int); ok {
+		return n + 1, nil
+	}
+	return v, nil
+}
+
+func TestPostwalk(t *testing.T) {
+	sm := vm.NewSortedMap(func(a vm.Value, b vm.Value) (int, error) { return int(a.(vm.Int) - b.(vm.Int)), nil })
+	sm, err := sm.Assoc(vm.Int(2), vm.Int(20))
+	assert.NoError(t, err)
+	form := vm.NewList([]vm.Value{
+		vm.Int(1),
+		vm.ArrayVector{vm.Int(2), vm.EmptyArrayMap.Assoc(vm.Keyword("a"), vm.ArrayVector{vm.Int(3)})},
+		vm.NewSet([]vm.Value{vm.Int(4)}),
+		sm,
+		vm.String("s"),
+	})
+	out, err := postwalk(incInts, form)
+	assert.NoError(t, err)
+	assert.Equal(t, `(2 [3 {:a [4]}] #{5} {3 21} "s")`, out.String())
+	assert.IsType(t, &vm.SortedMap{}, out.(*vm.List).Rest().Rest().Rest().First())
+
+	var seen []string
+	_, err = prewalk(func(v vm.Value) (vm.Value, error) {
+		seen = append(seen, v.String())
+		return v, nil
+	}, vm.ArrayVector{vm.Int(1), vm.ArrayVector{vm.Int(2)}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"[1 [2]]", "1", "[2]", "2"}, seen)
+}
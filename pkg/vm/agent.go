@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"fmt"
+	"sync"
+)
+
+type theAgentType struct{}
+
+func (t *theAgentType) Name() string { return "Agent" }
+
+func (t *theAgentType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// AgentType is the type of Agents
+var AgentType *theAgentType
+
+func init() {
+	AgentType = &theAgentType{}
+}
+
+type agentAction struct {
+	fn   Fn
+	args []Value
+	// state of the goroutine which sent the action
+	conveyed *conveyed
+}
+
+// Agent holds state changed by actions applied one at a time, in the order they were sent, on a goroutine of its own.
+// An action failing puts the agent in a failed state, dropping the actions queued behind it, until it's restarted.
+type Agent struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	value   Value
+	err     error
+	queue   []agentAction
+	running bool
+}
+
+// NewAgent returns an agent holding value
+func NewAgent(value Value) *Agent {
+	a := &Agent{value: value}
+	a.idle = sync.NewCond(&a.mu)
+	return a
+}
+
+// Send queues fn to be called with the agent's state followed by args, its result becomes the new state.
+// The action runs with the state of the goroutine sending it.
+func (a *Agent) Send(fn Fn, args []Value) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return fmt.Errorf("agent has failed, restart it first: %w", a.err)
+	}
+	a.queue = append(a.queue, agentAction{fn: fn, args: args, conveyed: convey()})
+	if !a.running {
+		a.running = true
+		go a.run()
+	}
+	return nil
+}
+
+// run applies queued actions until there are none left
+func (a *Agent) run() {
+	a.mu.Lock()
+	for len(a.queue) > 0 {
+		action := a.queue[0]
+		a.queue = a.queue[1:]
+		state := a.value
+		a.mu.Unlock()
+
+		var v Value
+		var err error
+		action.conveyed.apply(func() {
+			v, err = action.fn.Invoke(append([]Value{state}, action.args...))
+		})
+
+		a.mu.Lock()
+		if err != nil {
+			a.err = err
+			a.queue = nil
+			break
+		}
+		a.value = v
+	}
+	a.running = false
+	a.idle.Broadcast()
+	a.mu.Unlock()
+}
+
+// Await blocks until all actions sent so far have been applied, it returns the error if the agent has failed
+func (a *Agent) Await() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.running {
+		a.idle.Wait()
+	}
+	return a.err
+}
+
+// Error returns the error of the action which failed the agent, or nil
+func (a *Agent) Error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Restart clears the failure of an agent setting its state to value
+func (a *Agent) Restart(value Value) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		return fmt.Errorf("agent has not failed, no need to restart it")
+	}
+	a.err = nil
+	a.value = value
+	return nil
+}
+
+// Deref implements Derefable
+func (a *Agent) Deref() Value {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.value
+}
+
+// Type implements Value
+func (a *Agent) Type() ValueType { return AgentType }
+
+// Unbox implements Value
+func (a *Agent) Unbox() interface{} {
+	return a.Deref().Unbox()
+}
+
+func (a *Agent) String() string {
+	return fmt.Sprintf("#object[Agent %p {:val %s}]", a, a.Deref())
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "sync/atomic"
+
+// Collections count the elements they allocate so hosts running untrusted code can cap memory use.
+// Counting is global and off until a limit is set with SetAllocationLimit.
+var (
+	allocationLimit int64
+	allocated       int64
+)
+
+// SetAllocationLimit caps the number of collection elements which can be allocated from now on,
+// zero or a negative limit disables the guard. The count of allocated elements starts over.
+func SetAllocationLimit(n int) {
+	atomic.StoreInt64(&allocated, 0)
+	atomic.StoreInt64(&allocationLimit, int64(n))
+}
+
+// Allocated returns the number of collection elements allocated since the limit was set
+func Allocated() int {
+	return int(atomic.LoadInt64(&allocated))
+}
+
+// Allocate fails if allocating n more elements would exceed the limit, natives building big collections
+// should call it up front. It doesn't count them, the collections do once they are built.
+func Allocate(n int) error {
+	limit := atomic.LoadInt64(&allocationLimit)
+	if limit > 0 && atomic.LoadInt64(&allocated)+int64(n) > limit {
+		return NewExecutionError("allocation limit exceeded")
+	}
+	return nil
+}
+
+// trackAllocation accounts for n allocated elements in places which can't fail,
+// calls report exceeding the limit once the call that caused it returns, see NativeFn.Invoke
+func trackAllocation(n int) {
+	if atomic.LoadInt64(&allocationLimit) > 0 {
+		atomic.AddInt64(&allocated, int64(n))
+	}
+}
+
+// allocationExceeded returns an error if the allocation limit was exceeded
+func allocationExceeded() error {
+	limit := atomic.LoadInt64(&allocationLimit)
+	if limit > 0 && atomic.LoadInt64(&allocated) > limit {
+		return NewExecutionError("allocation limit exceeded")
+	}
+	return nil
+}
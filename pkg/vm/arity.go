@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "fmt"
+
+// ArityOf tells how many arguments fn accepts, functions which don't implement Callable are assumed to take any number
+func ArityOf(fn Fn) (int, int, bool) {
+	if c, ok := fn.(Callable); ok {
+		return c.ArityInfo()
+	}
+	return 0, -1, true
+}
+
+// CheckArity returns an error when fn can't be called with n arguments
+func CheckArity(fn Fn, n int) error {
+	min, max, variadic := ArityOf(fn)
+	if n < min || (max >= 0 && n > max) {
+		return arityError(describeFn(fn), n, min, max, variadic)
+	}
+	return nil
+}
+
+func arityError(name string, n int, min int, max int, variadic bool) error {
+	var expected string
+	switch {
+	case variadic || max < 0:
+		expected = fmt.Sprintf("at least %d", min)
+	case min == max:
+		expected = fmt.Sprintf("%d", min)
+	case max == min+1:
+		expected = fmt.Sprintf("%d or %d", min, max)
+	default:
+		expected = fmt.Sprintf("%d to %d", min, max)
+	}
+	return NewExecutionError(fmt.Sprintf("wrong number of arguments (%d) passed to %s, expected %s", n, name, expected))
+}
+
+// describeFn names fn in error messages
+func describeFn(fn Fn) string {
+	switch f := fn.(type) {
+	case *Func:
+		return f.describe()
+	case *NativeFn:
+		if f.name != "" {
+			return f.name
+		}
+	}
+	return fn.String()
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "strings"
+
+type theArrayMapType struct{}
+
+func (mt *theArrayMapType) Name() string { return "ArrayMap" }
+
+func (mt *theArrayMapType) Box(bare interface{}) (Value, error) {
+	arr, ok := bare.([]Value)
+	if !ok || len(arr)%2 != 0 {
+		return EmptyArrayMap, NewTypeError(bare, "can't be boxed as", mt)
+	}
+	var ret Value = EmptyArrayMap
+	for i := 0; i < len(arr); i += 2 {
+		ret = assocMap(ret, arr[i], arr[i+1])
+	}
+	return ret, nil
+}
+
+// ArrayMapType is the type of ArrayMaps
+var ArrayMapType *theArrayMapType
+
+// EmptyArrayMap is an empty ArrayMap
+var EmptyArrayMap *ArrayMap
+
+func init() {
+	ArrayMapType = &theArrayMapType{}
+	EmptyArrayMap = &ArrayMap{}
+}
+
+// ArrayMapThreshold is the number of entries above which ArrayMaps turn into hashed Maps
+const ArrayMapThreshold = 8
+
+// ArrayMap is a small associative collection keeping entries in insertion order.
+// It's a flat array of alternating keys and values which is copied on every update,
+// so once it grows past ArrayMapThreshold entries Assoc returns a Map instead.
+type ArrayMap struct {
+	kvs  []Value
+	meta Value
+}
+
+// assocMap assocs to either kind of unsorted map
+func assocMap(m Value, key Value, val Value) Value {
+	if am, ok := m.(*ArrayMap); ok {
+		return am.Assoc(key, val)
+	}
+	return m.(*Map).Assoc(key, val)
+}
+
+// Type implements Value
+func (m *ArrayMap) Type() ValueType { return ArrayMapType }
+
+// Unbox implements Value
+// Keys of the resulting Go map are compared with ==, so they must be comparable Go values.
+func (m *ArrayMap) Unbox() interface{} {
+	bare := make(map[Value]Value, len(m.kvs)/2)
+	for i := 0; i < len(m.kvs); i += 2 {
+		bare[m.kvs[i]] = m.kvs[i+1]
+	}
+	return bare
+}
+
+func (m *ArrayMap) indexOf(key Value) int {
+	for i := 0; i < len(m.kvs); i += 2 {
+		if Equal(m.kvs[i], key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Assoc returns a new map with key mapped to val, it's a Map when the result has too many entries for an ArrayMap
+func (m *ArrayMap) Assoc(key Value, val Value) Value {
+	i := m.indexOf(key)
+	if i >= 0 {
+		kvs := make([]Value, len(m.kvs))
+		copy(kvs, m.kvs)
+		kvs[i+1] = val
+		return &ArrayMap{kvs: kvs, meta: m.meta}
+	}
+	if len(m.kvs)/2 >= ArrayMapThreshold {
+		hm := EmptyMap
+		for i := 0; i < len(m.kvs); i += 2 {
+			hm = hm.Assoc(m.kvs[i], m.kvs[i+1])
+		}
+		hm = hm.Assoc(key, val)
+		hm.meta = m.meta
+		return hm
+	}
+	trackAllocation(2)
+	kvs := make([]Value, len(m.kvs), len(m.kvs)+2)
+	copy(kvs, m.kvs)
+	return &ArrayMap{kvs: append(kvs, key, val), meta: m.meta}
+}
+
+// Dissoc returns a new ArrayMap without key
+func (m *ArrayMap) Dissoc(key Value) *ArrayMap {
+	i := m.indexOf(key)
+	if i < 0 {
+		return m
+	}
+	kvs := make([]Value, 0, len(m.kvs)-2)
+	kvs = append(kvs, m.kvs[:i]...)
+	return &ArrayMap{kvs: append(kvs, m.kvs[i+2:]...), meta: m.meta}
+}
+
+// Meta implements Metadatable
+func (m *ArrayMap) Meta() Value { return metaOrNil(m.meta) }
+
+// WithMeta implements Metadatable
+func (m *ArrayMap) WithMeta(meta Value) Value {
+	return &ArrayMap{kvs: m.kvs, meta: meta}
+}
+
+// ValueAtOr returns the value mapped to key or dflt if there is no such key
+func (m *ArrayMap) ValueAtOr(key Value, dflt Value) Value {
+	i := m.indexOf(key)
+	if i < 0 {
+		return dflt
+	}
+	return m.kvs[i+1]
+}
+
+// Contains tells whether key is present in the ArrayMap
+func (m *ArrayMap) Contains(key Value) bool {
+	return m.indexOf(key) >= 0
+}
+
+func (m *ArrayMap) lookup(key Value) (Value, bool) {
+	i := m.indexOf(key)
+	if i < 0 {
+		return nil, false
+	}
+	return m.kvs[i+1], true
+}
+
+func (m *ArrayMap) eachEntry(f func(k, v Value) bool) bool {
+	for i := 0; i < len(m.kvs); i += 2 {
+		if !f(m.kvs[i], m.kvs[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count implements Collection
+func (m *ArrayMap) Count() Value {
+	return Int(len(m.kvs) / 2)
+}
+
+// Empty implements Collection
+func (m *ArrayMap) Empty() Collection {
+	return EmptyArrayMap
+}
+
+// Equals implements Equaler
+func (m *ArrayMap) Equals(o Value) bool {
+	return mapEquals(m, o)
+}
+
+func (m *ArrayMap) String() string {
+	return mapString(m)
+}
+
+// entryMap is implemented by all kinds of maps
+type entryMap interface {
+	Value
+	Count() Value
+	lookup(key Value) (Value, bool)
+	// eachEntry calls f with entries in iteration order until it returns false
+	eachEntry(f func(k, v Value) bool) bool
+}
+
+// recordTypeOf returns the type of records, nil for other maps
+func recordTypeOf(m entryMap) *RecordType {
+	if r, ok := m.(*Record); ok {
+		return r.rtype
+	}
+	return nil
+}
+
+// mapEquals compares maps of any kind by their entries, records are only equal to records of the same type
+func mapEquals(m entryMap, o Value) bool {
+	om, ok := o.(entryMap)
+	if !ok || recordTypeOf(m) != recordTypeOf(om) || m.Count() != om.Count() {
+		return false
+	}
+	return m.eachEntry(func(k, v Value) bool {
+		ov, ok := om.lookup(k)
+		return ok && Equal(v, ov)
+	})
+}
+
+// mapHash hashes maps of any kind by their entries regardless of order
+func mapHash(m entryMap) uint32 {
+	var acc uint32
+	m.eachEntry(func(k, v Value) bool {
+		acc += Hash(k) ^ Hash(v)
+		return true
+	})
+	return acc
+}
+
+func mapString(m entryMap) string {
+	b := &strings.Builder{}
+	b.WriteRune('{')
+	write := func(k, v Value) bool {
+		if b.Len() > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k.String())
+		b.WriteRune(' ')
+		b.WriteString(v.String())
+		return true
+	}
+	if PrintSorted() {
+		var keys []Value
+		m.eachEntry(func(k, _ Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		sortForPrinting(keys)
+		for _, k := range keys {
+			v, _ := m.lookup(k)
+			write(k, v)
+		}
+	} else {
+		m.eachEntry(write)
+	}
+	b.WriteRune('}')
+	return b.String()
+}
+
+// mapEntries returns MapEntries of all entries of a map in iteration order
+func mapEntries(dst []Value, m entryMap) []Value {
+	m.eachEntry(func(k, v Value) bool {
+		dst = append(dst, NewMapEntry(k, v))
+		return true
+	})
+	return dst
+}
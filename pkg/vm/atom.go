@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"fmt"
+	"sync"
+)
+
+type theAtomType struct{}
+
+func (t *theAtomType) Name() string { return "Atom" }
+
+func (t *theAtomType) Box(bare interface{}) (Value, error) {
+	v, ok := bare.(Value)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return NewAtom(v), nil
+}
+
+// AtomType is the type of Atoms
+var AtomType *theAtomType
+
+func init() {
+	AtomType = &theAtomType{}
+}
+
+// Derefable is implemented by reference types which can be dereferenced with deref or @
+type Derefable interface {
+	Value
+	Deref() Value
+}
+
+// Atom is a reference to a value which can be changed atomically
+type Atom struct {
+	mu    sync.Mutex
+	value Value
+}
+
+func NewAtom(value Value) *Atom {
+	return &Atom{value: value}
+}
+
+// Type implements Value
+func (a *Atom) Type() ValueType { return AtomType }
+
+// Unbox implements Value
+func (a *Atom) Unbox() interface{} {
+	return a.Deref().Unbox()
+}
+
+// Deref implements Derefable
+func (a *Atom) Deref() Value {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.value
+}
+
+// Reset sets the value of the atom unconditionally
+func (a *Atom) Reset(value Value) Value {
+	a.mu.Lock()
+	a.value = value
+	a.mu.Unlock()
+	return value
+}
+
+// CompareAndSet sets the value of the atom to value only if its current value is identical to old
+func (a *Atom) CompareAndSet(old Value, value Value) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !Identical(a.value, old) {
+		return false
+	}
+	a.value = value
+	return true
+}
+
+// Swap sets the value of the atom to (f current args...), f may be called many times if other
+// goroutines change the atom in the meantime so it should be free of side effects
+func (a *Atom) Swap(f Fn, args []Value) (Value, error) {
+	for {
+		old := a.Deref()
+		fargs := make([]Value, 0, len(args)+1)
+		fargs = append(fargs, old)
+		fargs = append(fargs, args...)
+		value, err := f.Invoke(fargs)
+		if err != nil {
+			return NIL, err
+		}
+		if a.CompareAndSet(old, value) {
+			return value, nil
+		}
+	}
+}
+
+func (a *Atom) String() string {
+	return fmt.Sprintf("#object[Atom %p {:val %s}]", a, a.Deref())
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"reflect"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type theBeanType struct{}
+
+func (t *theBeanType) Name() string { return "Bean" }
+
+func (t *theBeanType) Box(bare interface{}) (Value, error) {
+	b, ok := NewBean(bare)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return b, nil
+}
+
+// BeanType is the type of Beans
+var BeanType *theBeanType
+
+func init() {
+	BeanType = &theBeanType{}
+}
+
+// Bean presents exported fields of a Go struct as a read-only map keyed by keywords named after the fields.
+// Field values are converted when they are looked up, structs among them become Beans too.
+type Bean struct {
+	value  reflect.Value
+	fields []beanField
+}
+
+type beanField struct {
+	key   Keyword
+	index int
+}
+
+// NewBean wraps a struct or a non-nil pointer to one, ok is false for anything else
+func NewBean(v interface{}) (*Bean, bool) {
+	return newBean(reflect.ValueOf(v))
+}
+
+func newBean(rv reflect.Value) (*Bean, bool) {
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, false
+	}
+	t := rv.Type()
+	b := &Bean{value: rv}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		b.fields = append(b.fields, beanField{key: Keyword(beanKey(f.Name)), index: i})
+	}
+	return b, true
+}
+
+// beanKey lowercases the first letter of a field name unless it starts an acronym, so Name is :name and URL stays :URL
+func beanKey(name string) string {
+	first, n := utf8.DecodeRuneInString(name)
+	if second, _ := utf8.DecodeRuneInString(name[n:]); unicode.IsUpper(second) {
+		return name
+	}
+	return string(unicode.ToLower(first)) + name[n:]
+}
+
+// beanValue converts a field value to a Value, anything without a counterpart stays Boxed
+func beanValue(v reflect.Value) Value {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return NIL
+		}
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case Value:
+		return x
+	case time.Time:
+		return Instant(x)
+	}
+	if b, ok := newBean(v); ok {
+		return b
+	}
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int(v.Uint())
+	}
+	if out, err := BoxValue(v); err == nil {
+		return out
+	}
+	return NewBoxed(v.Interface())
+}
+
+// Type implements Value
+func (b *Bean) Type() ValueType { return BeanType }
+
+// Unbox implements Value, it returns the wrapped struct
+func (b *Bean) Unbox() interface{} {
+	return b.value.Interface()
+}
+
+func (b *Bean) lookup(key Value) (Value, bool) {
+	k, ok := key.(Keyword)
+	if !ok {
+		return NIL, false
+	}
+	for _, f := range b.fields {
+		if f.key == k {
+			return beanValue(b.value.Field(f.index)), true
+		}
+	}
+	return NIL, false
+}
+
+func (b *Bean) eachEntry(f func(k, v Value) bool) bool {
+	for _, fld := range b.fields {
+		if !f(fld.key, beanValue(b.value.Field(fld.index))) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValueAtOr implements Lookup
+func (b *Bean) ValueAtOr(key Value, notFound Value) Value {
+	if v, ok := b.lookup(key); ok {
+		return v
+	}
+	return notFound
+}
+
+// Contains tells if the struct has a field named by key
+func (b *Bean) Contains(key Value) bool {
+	_, ok := b.lookup(key)
+	return ok
+}
+
+// Count implements Collection
+func (b *Bean) Count() Value {
+	return Int(len(b.fields))
+}
+
+// Empty implements Collection, Beans can't be changed so this is an empty map
+func (b *Bean) Empty() Collection {
+	return EmptyMap
+}
+
+// Equals implements Equaler, Beans are equal to maps with the same entries
+func (b *Bean) Equals(o Value) bool {
+	return mapEquals(b, o)
+}
+
+// Invoke implements Fn, (b k) and (b k not-found) look k up
+func (b *Bean) Invoke(args []Value) (Value, error) {
+	key, dflt, err := lookupArgs(b, args)
+	if err != nil {
+		return NIL, err
+	}
+	return b.ValueAtOr(key, dflt), nil
+}
+
+// Arity implements Fn
+func (b *Bean) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (b *Bean) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+func (b *Bean) String() string {
+	return mapString(b)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "fmt"
+
+type theBoxedType struct{}
+
+func (t *theBoxedType) Name() string { return "Boxed" }
+
+func (t *theBoxedType) Box(bare interface{}) (Value, error) {
+	return NewBoxed(bare), nil
+}
+
+// BoxedType is the type of Boxed values
+var BoxedType *theBoxedType
+
+func init() {
+	BoxedType = &theBoxedType{}
+}
+
+// Boxed is an opaque wrapper for arbitrary Go values that have no let-go counterpart
+type Boxed struct {
+	value interface{}
+}
+
+func NewBoxed(value interface{}) *Boxed {
+	return &Boxed{value: value}
+}
+
+// Type implements Value
+func (b *Boxed) Type() ValueType { return BoxedType }
+
+// Unbox implements Value
+func (b *Boxed) Unbox() interface{} {
+	return b.value
+}
+
+func (b *Boxed) String() string {
+	return fmt.Sprintf("#object[%T %p]", b.value, b)
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// BytecodeVersion is written to serialized bytecode and has to match when loading it.
+// It must change whenever opcodes, their arguments or the encoding change.
+const BytecodeVersion = 4
+
+var bytecodeMagic = []byte("LGC\x00")
+
+// VarResolver finds the var named name in namespace ns when loading bytecode
+type VarResolver func(ns string, name string) (*Var, error)
+
+// value tags of the serialized constants
+const (
+	tagNil uint8 = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagFloat
+	tagString
+	tagKeyword
+	tagSymbol
+	tagChar
+	tagList
+	tagVector
+	tagMap
+	tagArrayMap
+	tagSet
+	tagVar
+	tagFunc
+	tagRegex
+	tagVoid
+)
+
+type bytecodeEncoder struct {
+	w     *bufio.Writer
+	pools map[*[]Value]int
+	order []*[]Value
+}
+
+// EncodeChunk serializes chunk along with all constants and functions it refers to.
+// Vars are written as references by namespace and name, they are looked up again when decoding.
+// Constants which can't be serialized, like native functions or atoms, are reported as errors.
+func EncodeChunk(w io.Writer, chunk *CodeChunk) error {
+	e := &bytecodeEncoder{w: bufio.NewWriter(w), pools: map[*[]Value]int{}}
+	e.collectPools(chunk.consts)
+	if _, err := e.w.Write(bytecodeMagic); err != nil {
+		return err
+	}
+	e.uint(BytecodeVersion)
+	e.uint(uint64(len(e.order)))
+	for _, pool := range e.order {
+		e.uint(uint64(len(*pool)))
+		for _, v := range *pool {
+			if err := e.value(v); err != nil {
+				return err
+			}
+		}
+	}
+	e.chunk(chunk)
+	return e.w.Flush()
+}
+
+// collectPools numbers constant pools reachable from pool, functions may have pools of their own
+func (e *bytecodeEncoder) collectPools(pool *[]Value) {
+	if _, ok := e.pools[pool]; ok {
+		return
+	}
+	e.pools[pool] = len(e.order)
+	e.order = append(e.order, pool)
+	for _, v := range *pool {
+		if f, ok := v.(*Func); ok {
+			e.collectPools(f.chunk.consts)
+		}
+	}
+}
+
+func (e *bytecodeEncoder) uint(n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.w.Write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+func (e *bytecodeEncoder) int(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.w.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+func (e *bytecodeEncoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *bytecodeEncoder) chunk(c *CodeChunk) {
+	e.uint(uint64(e.pools[c.consts]))
+	e.uint(uint64(c.maxStack))
+	e.uint(uint64(c.length))
+	e.w.Write(c.code[:c.length])
+}
+
+func (e *bytecodeEncoder) values(vs []Value) error {
+	e.uint(uint64(len(vs)))
+	for i := range vs {
+		if err := e.value(vs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *bytecodeEncoder) value(v Value) error {
+	switch v := v.(type) {
+	case *Nil:
+		e.w.WriteByte(tagNil)
+	case Boolean:
+		if v {
+			e.w.WriteByte(tagTrue)
+		} else {
+			e.w.WriteByte(tagFalse)
+		}
+	case Int:
+		e.w.WriteByte(tagInt)
+		e.int(int64(v))
+	case Float:
+		e.w.WriteByte(tagFloat)
+		e.uint(math.Float64bits(float64(v)))
+	case String:
+		e.w.WriteByte(tagString)
+		e.string(string(v))
+	case Keyword:
+		e.w.WriteByte(tagKeyword)
+		e.string(string(v))
+	case Symbol:
+		e.w.WriteByte(tagSymbol)
+		e.string(string(v))
+	case Char:
+		e.w.WriteByte(tagChar)
+		e.int(int64(v))
+	case *Void:
+		e.w.WriteByte(tagVoid)
+	case *Regex:
+		e.w.WriteByte(tagRegex)
+		e.string(v.re.String())
+	case *Var:
+		e.w.WriteByte(tagVar)
+		e.string(v.ns)
+		e.string(v.name)
+	case *Func:
+		e.w.WriteByte(tagFunc)
+		e.uint(uint64(v.arity))
+		if v.isVariadric {
+			e.w.WriteByte(1)
+		} else {
+			e.w.WriteByte(0)
+		}
+		e.uint(uint64(v.closedOversCount))
+		e.string(v.name)
+		e.uint(uint64(v.line))
+		e.chunk(v.chunk)
+	case *List:
+		e.w.WriteByte(tagList)
+		return e.values(v.Unbox().([]Value))
+	case ArrayVector:
+		e.w.WriteByte(tagVector)
+		return e.values(v)
+	case MapEntry:
+		e.w.WriteByte(tagVector)
+		return e.values(v.vector())
+	case *PersistentVector:
+		e.w.WriteByte(tagVector)
+		return e.values(v.Unbox().([]Value))
+	case *Map:
+		e.w.WriteByte(tagMap)
+		return e.values(mapKVs(v))
+	case *ArrayMap:
+		e.w.WriteByte(tagArrayMap)
+		return e.values(v.kvs)
+	case *Set:
+		e.w.WriteByte(tagSet)
+		return e.values(v.m.Keys())
+	default:
+		return NewTypeError(v, "can't be serialized as bytecode", nil)
+	}
+	return nil
+}
+
+// mapKVs returns alternating keys and values of m
+func mapKVs(m entryMap) []Value {
+	var kvs []Value
+	m.eachEntry(func(k, v Value) bool {
+		kvs = append(kvs, k, v)
+		return true
+	})
+	return kvs
+}
+
+type bytecodeDecoder struct {
+	r       *bufio.Reader
+	pools   []*[]Value
+	resolve VarResolver
+}
+
+// DecodeChunk loads a chunk serialized with EncodeChunk, vars it refers to are found with resolve.
+// Bytecode written by a different BytecodeVersion is rejected.
+func DecodeChunk(r io.Reader, resolve VarResolver) (*CodeChunk, error) {
+	d := &bytecodeDecoder{r: bufio.NewReader(r), resolve: resolve}
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != string(bytecodeMagic) {
+		return nil, NewExecutionError("not a let-go bytecode file")
+	}
+	version, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	if version != BytecodeVersion {
+		return nil, NewExecutionError(fmt.Sprintf("bytecode version %d is not supported, expected %d, compile the source again", version, BytecodeVersion))
+	}
+	npools, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	// pools are made up front since functions may refer to ones which come later
+	d.pools = make([]*[]Value, npools)
+	for i := range d.pools {
+		d.pools[i] = &[]Value{}
+	}
+	for _, pool := range d.pools {
+		vs, err := d.values()
+		if err != nil {
+			return nil, err
+		}
+		*pool = vs
+	}
+	return d.chunk()
+}
+
+func (d *bytecodeDecoder) corrupt(err error) error {
+	return NewExecutionError("corrupt bytecode").Wrap(err)
+}
+
+func (d *bytecodeDecoder) uint() (uint64, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, d.corrupt(err)
+	}
+	return n, nil
+}
+
+func (d *bytecodeDecoder) int() (int64, error) {
+	n, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return 0, d.corrupt(err)
+	}
+	return n, nil
+}
+
+func (d *bytecodeDecoder) bytes() ([]byte, error) {
+	n, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, d.corrupt(err)
+	}
+	return buf, nil
+}
+
+func (d *bytecodeDecoder) string() (string, error) {
+	b, err := d.bytes()
+	return string(b), err
+}
+
+func (d *bytecodeDecoder) chunk() (*CodeChunk, error) {
+	pool, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	if pool >= uint64(len(d.pools)) {
+		return nil, d.corrupt(fmt.Errorf("no constant pool %d", pool))
+	}
+	maxStack, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	code, err := d.bytes()
+	if err != nil {
+		return nil, err
+	}
+	c := NewCodeChunk(d.pools[pool])
+	c.code = code
+	c.length = len(code)
+	c.maxStack = int(maxStack)
+	return c, nil
+}
+
+func (d *bytecodeDecoder) values() ([]Value, error) {
+	n, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	vs := make([]Value, n)
+	for i := range vs {
+		if vs[i], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+func (d *bytecodeDecoder) value() (Value, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, d.corrupt(err)
+	}
+	switch tag {
+	case tagNil:
+		return NIL, nil
+	case tagFalse:
+		return FALSE, nil
+	case tagTrue:
+		return TRUE, nil
+	case tagVoid:
+		return VOID, nil
+	case tagInt:
+		n, err := d.int()
+		return Int(n), err
+	case tagChar:
+		n, err := d.int()
+		return Char(n), err
+	case tagFloat:
+		n, err := d.uint()
+		return Float(math.Float64frombits(n)), err
+	case tagString, tagKeyword, tagSymbol, tagRegex:
+		s, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagString:
+			return String(s), nil
+		case tagKeyword:
+			return Keyword(s), nil
+		case tagSymbol:
+			return Symbol(s), nil
+		}
+		return NewRegex(s)
+	case tagVar:
+		ns, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		name, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		return d.resolve(ns, name)
+	case tagFunc:
+		return d.fn()
+	case tagList, tagVector, tagMap, tagArrayMap, tagSet:
+		vs, err := d.values()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagList:
+			return NewList(vs), nil
+		case tagVector:
+			return NewVector(vs), nil
+		case tagMap:
+			return MapType.Box(vs)
+		case tagArrayMap:
+			return &ArrayMap{kvs: vs}, nil
+		}
+		return NewSet(vs), nil
+	}
+	return nil, d.corrupt(fmt.Errorf("unknown value tag %d", tag))
+}
+
+func (d *bytecodeDecoder) fn() (Value, error) {
+	arity, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	variadic, err := d.r.ReadByte()
+	if err != nil {
+		return nil, d.corrupt(err)
+	}
+	closedOvers, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	name, err := d.string()
+	if err != nil {
+		return nil, err
+	}
+	line, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := d.chunk()
+	if err != nil {
+		return nil, err
+	}
+	f := MakeFunc(int(arity), variadic == 1, chunk).SetClosedOversCount(int(closedOvers)).SetLine(int(line))
+	f.name = name
+	return f, nil
+}
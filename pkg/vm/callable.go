@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "fmt"
+
+// Keywords, maps, sets and vectors can be called like functions, doing a lookup of their argument.
+// They report an arity of -1 like natives, ArityInfo tells the exact number of arguments they take.
+
+// lookupArgs splits arguments of a callable collection into the key and the not-found value
+func lookupArgs(callee Value, args []Value) (Value, Value, error) {
+	switch len(args) {
+	case 1:
+		return args[0], NIL, nil
+	case 2:
+		return args[0], args[1], nil
+	}
+	return NIL, NIL, arityError(callee.String(), len(args), 1, 2, false)
+}
+
+// Invoke looks the keyword up in coll like get, (:k coll) and (:k coll not-found) return NIL or not-found
+// for missing keys and for colls which can't be searched
+func (l Keyword) Invoke(args []Value) (Value, error) {
+	coll, dflt, err := lookupArgs(l, args)
+	if err != nil {
+		return NIL, err
+	}
+	return Get(coll, l, dflt), nil
+}
+
+// Arity implements Fn
+func (l Keyword) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (l Keyword) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+// Invoke implements Fn, (m k) and (m k not-found) look k up
+func (m *Map) Invoke(args []Value) (Value, error) {
+	key, dflt, err := lookupArgs(m, args)
+	if err != nil {
+		return NIL, err
+	}
+	return m.ValueAtOr(key, dflt), nil
+}
+
+// Arity implements Fn
+func (m *Map) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (m *Map) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+// Invoke implements Fn, (m k) and (m k not-found) look k up
+func (m *ArrayMap) Invoke(args []Value) (Value, error) {
+	key, dflt, err := lookupArgs(m, args)
+	if err != nil {
+		return NIL, err
+	}
+	return m.ValueAtOr(key, dflt), nil
+}
+
+// Arity implements Fn
+func (m *ArrayMap) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (m *ArrayMap) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+// Invoke implements Fn, (m k) and (m k not-found) look k up
+func (m *SortedMap) Invoke(args []Value) (Value, error) {
+	key, dflt, err := lookupArgs(m, args)
+	if err != nil {
+		return NIL, err
+	}
+	return m.ValueAtOr(key, dflt), nil
+}
+
+// Arity implements Fn
+func (m *SortedMap) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (m *SortedMap) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+// Invoke implements Fn, (s x) and (s x not-found) return x when it's a member
+func (s *Set) Invoke(args []Value) (Value, error) {
+	val, dflt, err := lookupArgs(s, args)
+	if err != nil {
+		return NIL, err
+	}
+	return s.ValueAtOr(val, dflt), nil
+}
+
+// Arity implements Fn
+func (s *Set) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (s *Set) ArityInfo() (int, int, bool) { return 1, 2, false }
+
+// vectorIndex checks the single index argument of a vector called as a function
+func vectorIndex(v Value, count int, args []Value) (int, error) {
+	if len(args) != 1 {
+		return 0, arityError(v.String(), len(args), 1, 1, false)
+	}
+	i, ok := args[0].(Int)
+	if !ok {
+		return 0, NewTypeError(args[0], "is not a vector index", IntType)
+	}
+	if int(i) < 0 || int(i) >= count {
+		return 0, NewExecutionError(fmt.Sprintf("index %d out of bounds for vector of %d", i, count))
+	}
+	return int(i), nil
+}
+
+// Invoke implements Fn, (v i) returns element i and fails when it's out of bounds
+func (l ArrayVector) Invoke(args []Value) (Value, error) {
+	i, err := vectorIndex(l, len(l), args)
+	if err != nil {
+		return NIL, err
+	}
+	return l[i], nil
+}
+
+// Arity implements Fn
+func (l ArrayVector) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (l ArrayVector) ArityInfo() (int, int, bool) { return 1, 1, false }
+
+// Invoke implements Fn, (v i) returns element i and fails when it's out of bounds
+func (v *PersistentVector) Invoke(args []Value) (Value, error) {
+	i, err := vectorIndex(v, v.count, args)
+	if err != nil {
+		return NIL, err
+	}
+	val, _ := v.Nth(i)
+	return val, nil
+}
+
+// Arity implements Fn
+func (v *PersistentVector) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (v *PersistentVector) ArityInfo() (int, int, bool) { return 1, 1, false }
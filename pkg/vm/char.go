@@ -18,6 +18,8 @@
 package vm
 
 import (
+	"fmt"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -53,6 +55,23 @@ func (l Char) Unbox() interface{} {
 	return rune(l)
 }
 
+// charNames are the names the reader knows for whitespace characters
+var charNames = map[Char]string{
+	' ':  "space",
+	'\t': "tab",
+	'\b': "backspace",
+	'\n': "newline",
+	'\f': "formfeed",
+	'\r': "return",
+}
+
+// String prints the char the way the reader reads it back, using names or \u escapes for invisible ones
 func (l Char) String() string {
+	if name, ok := charNames[l]; ok {
+		return "\\" + name
+	}
+	if unicode.IsControl(rune(l)) {
+		return fmt.Sprintf("\\u%04x", rune(l))
+	}
 	return "\\" + string(l)
 }
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+type theConsType struct{}
+
+func (t *theConsType) Name() string { return "Cons" }
+
+func (t *theConsType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// ConsType is the type of Cons cells
+var ConsType *theConsType
+
+func init() {
+	ConsType = &theConsType{}
+}
+
+// Cons prepends a value to any sequence without realizing it, it's what consing onto lazy sequences gives
+type Cons struct {
+	first Value
+	more  Seq
+}
+
+// NewCons makes a sequence starting with first followed by more
+func NewCons(first Value, more Seq) *Cons {
+	trackAllocation(1)
+	return &Cons{first: first, more: more}
+}
+
+// Type implements Value
+func (c *Cons) Type() ValueType { return ConsType }
+
+// Unbox implements Value
+func (c *Cons) Unbox() interface{} {
+	vs, _ := AppendElements(nil, c)
+	return vs
+}
+
+// First implements Seq
+func (c *Cons) First() Value {
+	return c.first
+}
+
+// Rest implements Seq
+func (c *Cons) Rest() Seq {
+	return c.more
+}
+
+// Next implements Seq
+func (c *Cons) Next() Seq {
+	return nextOf(c)
+}
+
+// Cons implements Seq
+func (c *Cons) Cons(val Value) Seq {
+	return NewCons(val, c)
+}
+
+// IsEmpty implements EmptyChecker
+func (c *Cons) IsEmpty() bool {
+	return false
+}
+
+// Equals implements Equaler
+func (c *Cons) Equals(o Value) bool {
+	return seqEquals(c, o)
+}
+
+func (c *Cons) String() string {
+	return seqString(c)
+}
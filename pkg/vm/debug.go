@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+// DebugAction is what a debug hook wants the frame to do next
+type DebugAction int
+
+const (
+	// DebugStep runs the instruction and calls the hook again before the next one
+	DebugStep DebugAction = iota
+	// DebugContinue runs on without calling the hook
+	DebugContinue
+	// DebugAbort stops the run with an error
+	DebugAbort
+)
+
+// DebugInfo describes the instruction a debugged frame is about to execute
+type DebugInfo struct {
+	IP     int
+	Op     string
+	Args   []Value
+	Locals []Value
+}
+
+// DebugHook is called before instructions of debugged frames
+type DebugHook func(info DebugInfo) (DebugAction, error)
+
+// Debugger returns the hook let-go functions called while it's set are debugged with, nil when not debugging.
+// It's consulted once per call so leaving it nil costs nothing per instruction. The runtime points it at *debug-hook*.
+var Debugger = func() DebugHook { return nil }
+
+// debugState is the run state of a call made while debugging, nil when not debugging
+func debugState() *runState {
+	hook := Debugger()
+	if hook == nil {
+		return nil
+	}
+	return &runState{debug: hook, stepping: true}
+}
+
+// step calls the debug hook with a snapshot of the frame
+func (s *runState) step(f *Frame) error {
+	inst, _ := f.code.Get(f.ip)
+	info := DebugInfo{
+		IP:     f.ip,
+		Op:     OpcodeToString(inst),
+		Args:   append([]Value{}, f.args...),
+		Locals: append([]Value{}, f.stack[:f.sp]...),
+	}
+	action, err := s.debug(info)
+	if err != nil {
+		return NewExecutionError("debug hook failed").Wrap(err)
+	}
+	switch action {
+	case DebugContinue:
+		s.stepping = false
+	case DebugAbort:
+		return NewExecutionError("aborted by debugger")
+	}
+	return nil
+}
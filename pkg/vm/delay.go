@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type theDelayType struct{}
+
+func (t *theDelayType) Name() string { return "Delay" }
+
+func (t *theDelayType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// DelayType is the type of Delays
+var DelayType *theDelayType
+
+func init() {
+	DelayType = &theDelayType{}
+}
+
+// Forceable is implemented by references computing their value on demand, which may fail
+type Forceable interface {
+	Derefable
+	Force() (Value, error)
+}
+
+// Delay is a value computed by calling a function the first time it's needed.
+// Both the result and the error, if computing it failed, are cached.
+type Delay struct {
+	once  sync.Once
+	fn    Fn
+	value Value
+	err   error
+	done  uint32
+}
+
+// NewDelay makes a Delay computed by calling fn with no arguments
+func NewDelay(fn Fn) *Delay {
+	return &Delay{fn: fn, value: NIL}
+}
+
+// Force computes the value if that didn't happen yet and returns it
+func (d *Delay) Force() (Value, error) {
+	d.once.Do(func() {
+		d.value, d.err = d.fn.Invoke(nil)
+		d.fn = nil
+		atomic.StoreUint32(&d.done, 1)
+	})
+	return d.value, d.err
+}
+
+// Deref implements Derefable, errors are only reported by Force
+func (d *Delay) Deref() Value {
+	v, err := d.Force()
+	if err != nil {
+		return NIL
+	}
+	return v
+}
+
+// IsRealized implements Pending
+func (d *Delay) IsRealized() bool {
+	return atomic.LoadUint32(&d.done) == 1
+}
+
+// Type implements Value
+func (d *Delay) Type() ValueType { return DelayType }
+
+// Unbox implements Value
+func (d *Delay) Unbox() interface{} {
+	return d.Deref().Unbox()
+}
+
+func (d *Delay) String() string {
+	if !d.IsRealized() {
+		return "#<delay :pending>"
+	}
+	return "#<delay " + d.value.String() + ">"
+}
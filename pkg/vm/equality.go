@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+// Equaler is implemented by values that define their own notion of equality.
+// Values that don't implement it are compared with Go's == operator, so they must be comparable.
+type Equaler interface {
+	Equals(Value) bool
+}
+
+// Equal tells whether two values are equal in the sense of Clojure's =
+// All sequential collections (lists and vectors) are equal when they hold equal elements in the same order,
+// maps and sets are equal when they hold the same contents regardless of order.
+// Equal is type-sensitive for numbers so 1 and 1.0 are not equal, use NumEqual to compare them by value.
+func Equal(a Value, b Value) bool {
+	if ae, ok := a.(Equaler); ok {
+		return ae.Equals(b)
+	}
+	if _, ok := b.(Equaler); ok {
+		return false
+	}
+	return a == b
+}
+
+// Identical tells whether a and b are the very same object, like Clojure's identical?
+// Reference types (lists, maps, sets, functions, vars...) are identical only when they are the same pointer.
+// Vectors are identical when they share the same backing array and length.
+// Immutable scalars (Int, Float, Keyword, String, Char, Boolean, nil) have no identity of their own,
+// they are identical whenever they are of the same type and hold the same value.
+func Identical(a Value, b Value) bool {
+	if av, ok := a.(ArrayVector); ok {
+		bv, ok := b.(ArrayVector)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		return len(av) == 0 || &av[0] == &bv[0]
+	}
+	if _, ok := b.(ArrayVector); ok {
+		return false
+	}
+	return a == b
+}
+
+func seqEmpty(s Seq) bool {
+	if e, ok := s.(EmptyChecker); ok {
+		return e.IsEmpty()
+	}
+	c, ok := s.(Collection)
+	if !ok {
+		return false
+	}
+	return c.Count().(Int) == 0
+}
+
+// seqEquals walks two sequences in lockstep comparing their elements
+func seqEquals(a Seq, o Value) bool {
+	b, ok := o.(Seq)
+	if !ok {
+		return false
+	}
+	for {
+		ae, be := seqEmpty(a), seqEmpty(b)
+		if ae || be {
+			return ae && be
+		}
+		if !Equal(a.First(), b.First()) {
+			return false
+		}
+		a, b = a.Rest(), b.Rest()
+	}
+}
+
+// Compare orders two values returning a negative number, zero or a positive number when a is
+// respectively less than, equal to, or greater than b.
+// Sequential collections are ordered by length first and then element-wise, like Clojure vectors.
+func Compare(a Value, b Value) (int, error) {
+	if a == NIL || b == NIL {
+		switch {
+		case a == NIL && b == NIL:
+			return 0, nil
+		case a == NIL:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+	if IsNumber(a) && IsNumber(b) {
+		return NumCompare(a, b)
+	}
+	switch av := a.(type) {
+	case String:
+		bv, ok := b.(String)
+		if !ok {
+			break
+		}
+		return compareStrings(string(av), string(bv)), nil
+	case Keyword:
+		bv, ok := b.(Keyword)
+		if !ok {
+			break
+		}
+		return compareStrings(string(av), string(bv)), nil
+	case Symbol:
+		bv, ok := b.(Symbol)
+		if !ok {
+			break
+		}
+		return compareStrings(string(av), string(bv)), nil
+	case Char:
+		bv, ok := b.(Char)
+		if !ok {
+			break
+		}
+		return compareInts(int(av), int(bv)), nil
+	case Boolean:
+		bv, ok := b.(Boolean)
+		if !ok {
+			break
+		}
+		switch {
+		case av == bv:
+			return 0, nil
+		case av == FALSE:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	case Instant:
+		bv, ok := b.(Instant)
+		if !ok {
+			break
+		}
+		switch {
+		case av.Time().Before(bv.Time()):
+			return -1, nil
+		case av.Time().After(bv.Time()):
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case Seq:
+		bv, ok := b.(Seq)
+		if !ok {
+			break
+		}
+		return compareSeqs(av, bv)
+	}
+	return 0, NewTypeError(a, "can't be compared with "+b.Type().Name(), nil)
+}
+
+func compareSeqs(a Seq, b Seq) (int, error) {
+	ac, aok := a.(Collection)
+	bc, bok := b.(Collection)
+	if !aok || !bok {
+		return 0, NewTypeError(a, "can't be compared", nil)
+	}
+	if c := compareInts(int(ac.Count().(Int)), int(bc.Count().(Int))); c != 0 {
+		return c, nil
+	}
+	for !seqEmpty(a) {
+		c, err := Compare(a.First(), b.First())
+		if err != nil || c != 0 {
+			return c, err
+		}
+		a, b = a.Rest(), b.Rest()
+	}
+	return 0, nil
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareStrings(a string, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
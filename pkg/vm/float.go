@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type theFloatType struct {
+	zero Float
+}
+
+func (lt *theFloatType) Name() string { return "Float" }
+
+func (lt *theFloatType) Box(bare interface{}) (Value, error) {
+	switch raw := bare.(type) {
+	case float64:
+		return Float(raw), nil
+	case float32:
+		return Float(raw), nil
+	default:
+		return FloatType.zero, NewTypeError(bare, "can't be boxed as", lt)
+	}
+}
+
+// FloatType is the type of FloatValues
+var FloatType *theFloatType
+
+func init() {
+	FloatType = &theFloatType{zero: 0}
+}
+
+// Float is boxed float64
+type Float float64
+
+// Type implements Value
+func (l Float) Type() ValueType { return FloatType }
+
+// Unbox implements Unbox
+func (l Float) Unbox() interface{} {
+	return float64(l)
+}
+
+// String prints the shortest representation which reads back as the same float.
+// Like in Clojure very large and very small magnitudes use an exponent and NaN and infinities are ##NaN, ##Inf and ##-Inf.
+func (l Float) String() string {
+	f := float64(l)
+	switch {
+	case math.IsNaN(f):
+		return "##NaN"
+	case math.IsInf(f, 1):
+		return "##Inf"
+	case math.IsInf(f, -1):
+		return "##-Inf"
+	}
+	if a := math.Abs(f); a != 0 && (a < 1e-3 || a >= 1e7) {
+		s := strconv.FormatFloat(f, 'E', -1, 64)
+		i := strings.IndexByte(s, 'E')
+		mantissa := s[:i]
+		if !strings.ContainsRune(mantissa, '.') {
+			mantissa += ".0"
+		}
+		// Go pads the exponent to two digits and signs it, Clojure doesn't
+		exponent, _ := strconv.Atoi(s[i+1:])
+		return mantissa + "E" + strconv.Itoa(exponent)
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsRune(s, '.') {
+		s += ".0"
+	}
+	return s
+}
@@ -40,6 +40,10 @@ type Func struct {
 	isVariadric bool
 	chunk       *CodeChunk
 	closedOvers []Value
+	// number of values closures made from this function capture, known at compile time
+	closedOversCount int
+	name             string
+	line             int
 }
 
 func MakeFunc(arity int, variadric bool, c *CodeChunk) *Func {
@@ -50,6 +54,39 @@ func MakeFunc(arity int, variadric bool, c *CodeChunk) *Func {
 	}
 }
 
+// MakeClosure returns a fresh instance of the function ready to receive its own closed over values.
+// The compiled function in the constant pool acts as a template and is never mutated.
+func (l *Func) MakeClosure() *Func {
+	c := *l
+	c.closedOvers = make([]Value, 0, l.closedOversCount)
+	return &c
+}
+
+// SetClosedOversCount tells how many values closures made from this function capture so
+// MakeClosure can size their storage up front
+func (l *Func) SetClosedOversCount(n int) *Func {
+	l.closedOversCount = n
+	return l
+}
+
+// WithName returns a copy of the function carrying name, which is used when printing it and in errors
+func (l *Func) WithName(name string) *Func {
+	c := *l
+	c.name = name
+	return &c
+}
+
+// Name returns the name given with WithName or "" for anonymous functions
+func (l *Func) Name() string {
+	return l.name
+}
+
+// SetLine records the source line the function was defined at
+func (l *Func) SetLine(line int) *Func {
+	l.line = line
+	return l
+}
+
 func (l *Func) Type() ValueType { return FuncType }
 
 type FuncInterface func(interface{})
@@ -77,23 +114,79 @@ func (l *Func) Arity() int {
 	return l.arity
 }
 
-func (l *Func) Invoke(pargs []Value) Value {
+// Invoke calls the function as part of the run the calling goroutine is in, so functions called back
+// from natives are bound by the same budget and context as the code calling the native
+func (l *Func) Invoke(pargs []Value) (Value, error) {
+	state := currentRun()
+	if state != nil {
+		if err := state.check(); err != nil {
+			return NIL, err
+		}
+	}
+	return l.invoke(state, pargs)
+}
+
+func (l *Func) invoke(state *runState, pargs []Value) (Value, error) {
+	if err := l.checkArity(len(pargs)); err != nil {
+		return NIL, err
+	}
 	args := pargs
 	if l.isVariadric {
 		// pretty sure variadric should guarantee arity >= 1
-		sargs := args[0 : l.arity-1]
-		rest := args[l.arity-1:]
-		// FIXME don't swallow the error, make invoke return an error
-		restlist, _ := ListType.Box(rest)
-		args = append(sargs, restlist)
+		rest := pargs[l.arity-1:]
+		// like in Clojure, rest args are nil rather than an empty list when there are none
+		var restlist Value = NIL
+		if len(rest) > 0 {
+			l, err := ListType.Box(rest)
+			if err != nil {
+				return NIL, NewExecutionError("boxing rest args").Wrap(err)
+			}
+			restlist = l
+		}
+		// a fresh slice so the caller's arguments aren't overwritten by the rest list
+		args = make([]Value, l.arity)
+		copy(args, pargs[:l.arity-1])
+		args[l.arity-1] = restlist
+	}
+	if state == nil {
+		state = debugState()
 	}
 	f := NewFrame(l.chunk, args)
 	f.closedOvers = l.closedOvers
-	// FIXME don't swallow the error, make invoke return an error
-	v, _ := f.Run()
-	return v
+	f.state = state
+	return f.Run()
+}
+
+// describe names the function in error messages
+func (l *Func) describe() string {
+	if l.name != "" {
+		return l.name
+	}
+	return l.String()
+}
+
+// ArityInfo implements Callable, variadic functions take the rest arguments in their last parameter
+func (l *Func) ArityInfo() (int, int, bool) {
+	if l.isVariadric {
+		return l.arity - 1, -1, true
+	}
+	return l.arity, l.arity, false
+}
+
+func (l *Func) checkArity(n int) error {
+	min, max, variadic := l.ArityInfo()
+	if n < min || (!variadic && n > max) {
+		return arityError(l.describe(), n, min, max, variadic)
+	}
+	return nil
 }
 
 func (l *Func) String() string {
-	return fmt.Sprintf("<fn %p>", l)
+	switch {
+	case l.name != "":
+		return fmt.Sprintf("#<fn %s>", l.name)
+	case l.line > 0:
+		return fmt.Sprintf("#<fn at line %d>", l.line)
+	}
+	return "#<fn>"
 }
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"reflect"
+)
+
+type theFutureType struct{}
+
+func (t *theFutureType) Name() string { return "Future" }
+
+func (t *theFutureType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// FutureType is the type of Futures
+var FutureType *theFutureType
+
+func init() {
+	FutureType = &theFutureType{}
+}
+
+// Future is a value computed by calling a function on its own goroutine.
+// Forcing it blocks until the function returns, its result or error is kept.
+type Future struct {
+	done  chan struct{}
+	value Value
+	err   error
+}
+
+// NewFuture starts calling fn with no arguments on a new goroutine, which conveys the state of the calling one
+func NewFuture(fn Fn) *Future {
+	f := &Future{done: make(chan struct{}), value: NIL}
+	c := convey()
+	go func() {
+		c.apply(func() {
+			f.value, f.err = fn.Invoke(nil)
+		})
+		close(f.done)
+	}()
+	return f
+}
+
+// Force waits for the future to complete and returns its value
+func (f *Future) Force() (Value, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Deref implements Derefable, errors are only reported by Force
+func (f *Future) Deref() Value {
+	v, err := f.Force()
+	if err != nil {
+		return NIL
+	}
+	return v
+}
+
+// IsRealized implements Pending
+func (f *Future) IsRealized() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// JoinFutures waits for all futures and returns their values in order. It returns as soon as any of them fails
+// with the error of the first one to fail, it starts no goroutines of its own so returning early leaves nothing
+// behind, though futures still running keep running.
+func JoinFutures(fs []*Future) ([]Value, error) {
+	cases := make([]reflect.SelectCase, len(fs))
+	index := make([]int, len(fs))
+	for i := range fs {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(fs[i].done)}
+		index[i] = i
+	}
+	for len(cases) > 0 {
+		chosen, _, _ := reflect.Select(cases)
+		if err := fs[index[chosen]].err; err != nil {
+			return nil, err
+		}
+		cases = append(cases[:chosen], cases[chosen+1:]...)
+		index = append(index[:chosen], index[chosen+1:]...)
+	}
+	out := make([]Value, len(fs))
+	for i := range fs {
+		out[i] = fs[i].value
+	}
+	return out, nil
+}
+
+// Type implements Value
+func (f *Future) Type() ValueType { return FutureType }
+
+// Unbox implements Value
+func (f *Future) Unbox() interface{} {
+	return f.Deref().Unbox()
+}
+
+func (f *Future) String() string {
+	if !f.IsRealized() {
+		return "#<future :pending>"
+	}
+	if f.err != nil {
+		return "#<future :failed>"
+	}
+	return "#<future " + f.value.String() + ">"
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "sync"
+
+type theSliceSeqType struct{}
+
+func (t *theSliceSeqType) Name() string { return "SliceSeq" }
+
+func (t *theSliceSeqType) Box(bare interface{}) (Value, error) {
+	vs, ok := bare.([]Value)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return SeqFromSlice(vs), nil
+}
+
+type theChanSeqType struct{}
+
+func (t *theChanSeqType) Name() string { return "ChanSeq" }
+
+func (t *theChanSeqType) Box(bare interface{}) (Value, error) {
+	ch, ok := bare.(chan Value)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return SeqFromChan(ch), nil
+}
+
+// SliceSeqType is the type of sequences backed by Go slices
+var SliceSeqType *theSliceSeqType
+
+// ChanSeqType is the type of sequences backed by Go channels
+var ChanSeqType *theChanSeqType
+
+func init() {
+	SliceSeqType = &theSliceSeqType{}
+	ChanSeqType = &theChanSeqType{}
+}
+
+// SliceSeq presents a Go slice as a sequence without copying it.
+// The slice must not be modified while the sequence is in use.
+type SliceSeq struct {
+	vs []Value
+}
+
+// SeqFromSlice exposes vs as a sequence without copying it
+func SeqFromSlice(vs []Value) Seq {
+	return &SliceSeq{vs: vs}
+}
+
+// Type implements Value
+func (s *SliceSeq) Type() ValueType { return SliceSeqType }
+
+// Unbox implements Value
+func (s *SliceSeq) Unbox() interface{} {
+	return s.vs
+}
+
+// First implements Seq
+func (s *SliceSeq) First() Value {
+	if len(s.vs) == 0 {
+		return NIL
+	}
+	return s.vs[0]
+}
+
+// Rest implements Seq
+func (s *SliceSeq) Rest() Seq {
+	if len(s.vs) <= 1 {
+		return EmptyList
+	}
+	return &SliceSeq{vs: s.vs[1:]}
+}
+
+// Next implements Seq
+func (s *SliceSeq) Next() Seq {
+	return nextOf(s)
+}
+
+// Cons implements Seq
+func (s *SliceSeq) Cons(val Value) Seq {
+	return NewCons(val, s)
+}
+
+// Count implements Collection
+func (s *SliceSeq) Count() Value {
+	return Int(len(s.vs))
+}
+
+// Empty implements Collection
+func (s *SliceSeq) Empty() Collection {
+	return EmptyList
+}
+
+// Equals implements Equaler
+func (s *SliceSeq) Equals(o Value) bool {
+	return seqEquals(s, o)
+}
+
+func (s *SliceSeq) String() string {
+	return seqString(s)
+}
+
+// ChanSeq lazily presents values received from a Go channel as a sequence.
+// Each element is received once, when first needed, and cached so the sequence can be walked many times.
+// The sequence ends when the channel is closed.
+type ChanSeq struct {
+	ch    <-chan Value
+	once  sync.Once
+	first Value
+	ok    bool
+	rest  *ChanSeq
+}
+
+// SeqFromChan exposes values received from ch as a lazy sequence
+func SeqFromChan(ch <-chan Value) Seq {
+	return &ChanSeq{ch: ch}
+}
+
+func (s *ChanSeq) realize() {
+	s.once.Do(func() {
+		s.first, s.ok = <-s.ch
+		if s.ok {
+			s.rest = &ChanSeq{ch: s.ch}
+		}
+	})
+}
+
+// Type implements Value
+func (s *ChanSeq) Type() ValueType { return ChanSeqType }
+
+// Unbox implements Value, it blocks until the channel is closed
+func (s *ChanSeq) Unbox() interface{} {
+	vs, _ := AppendElements(nil, s)
+	return vs
+}
+
+// First implements Seq
+func (s *ChanSeq) First() Value {
+	s.realize()
+	if !s.ok {
+		return NIL
+	}
+	return s.first
+}
+
+// Rest implements Seq
+func (s *ChanSeq) Rest() Seq {
+	s.realize()
+	if !s.ok {
+		return EmptyList
+	}
+	return s.rest
+}
+
+// Next implements Seq
+func (s *ChanSeq) Next() Seq {
+	return nextOf(s)
+}
+
+// Cons implements Seq
+func (s *ChanSeq) Cons(val Value) Seq {
+	return NewCons(val, s)
+}
+
+// IsEmpty implements EmptyChecker
+func (s *ChanSeq) IsEmpty() bool {
+	s.realize()
+	return !s.ok
+}
+
+// Equals implements Equaler
+func (s *ChanSeq) Equals(o Value) bool {
+	return seqEquals(s, o)
+}
+
+// String implements Value, it blocks until the channel is closed
+func (s *ChanSeq) String() string {
+	return seqString(s)
+}
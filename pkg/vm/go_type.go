@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type theGoTypeType struct{}
+
+func (t *theGoTypeType) Name() string { return "GoType" }
+
+func (t *theGoTypeType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// GoTypeType is the type of GoTypes
+var GoTypeType *theGoTypeType
+
+func init() {
+	GoTypeType = &theGoTypeType{}
+}
+
+// GoType is a Go type registered under a name so programs can tell boxed values of it apart.
+// There is one GoType per Go type so they compare by identity.
+type GoType struct {
+	name string
+	t    reflect.Type
+}
+
+var goTypes = struct {
+	sync.RWMutex
+	byType map[reflect.Type]*GoType
+}{byType: map[reflect.Type]*GoType{}}
+
+// RegisterGoType names the Go type of example, pointers are registered as the type they point to.
+// Boxed values of the type, or pointers to it, are instances of the returned GoType and protocols
+// dispatch on them by name. Registering a type again renames it and returns the same GoType.
+func RegisterGoType(name string, example interface{}) *GoType {
+	t := reflect.TypeOf(example)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	goTypes.Lock()
+	defer goTypes.Unlock()
+	gt := goTypes.byType[t]
+	if gt == nil {
+		gt = &GoType{t: t}
+		goTypes.byType[t] = gt
+	}
+	gt.name = name
+	return gt
+}
+
+// goTypeOf returns the registered type of a Go value, nil if it has none
+func goTypeOf(bare interface{}) *GoType {
+	t := reflect.TypeOf(bare)
+	if t == nil {
+		return nil
+	}
+	goTypes.RLock()
+	defer goTypes.RUnlock()
+	if gt := goTypes.byType[t]; gt != nil {
+		return gt
+	}
+	if t.Kind() == reflect.Ptr {
+		return goTypes.byType[t.Elem()]
+	}
+	return nil
+}
+
+// TypeName names the type of v for dispatch, boxed values of registered Go types go by the registered name
+func TypeName(v Value) string {
+	if b, ok := v.(*Boxed); ok {
+		if gt := goTypeOf(b.value); gt != nil {
+			return gt.Name()
+		}
+	}
+	return v.Type().Name()
+}
+
+// IsInstance tells if v is a boxed value of the type or a pointer to one
+func (g *GoType) IsInstance(v Value) bool {
+	b, ok := v.(*Boxed)
+	return ok && goTypeOf(b.value) == g
+}
+
+// Name returns the name the type was registered under
+func (g *GoType) Name() string {
+	goTypes.RLock()
+	defer goTypes.RUnlock()
+	return g.name
+}
+
+// Type implements Value
+func (g *GoType) Type() ValueType { return GoTypeType }
+
+// Unbox implements Value, it returns the reflect.Type
+func (g *GoType) Unbox() interface{} {
+	return g.t
+}
+
+func (g *GoType) String() string {
+	return fmt.Sprintf("#<go-type %s %s>", g.Name(), g.t)
+}
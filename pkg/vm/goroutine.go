@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// goroutineState is what let-go code running on a goroutine sees besides its arguments, like a Clojure thread's
+// state. Goroutines have no local storage so states live in a registry keyed by goroutine, only goroutines
+// which have some state are registered and the registry isn't consulted at all while it's empty.
+type goroutineState struct {
+	// run is the run of the frame started with RunWithContext or RunWithBudget on the goroutine
+	run *runState
+	// bindings are the dynamic bindings of vars made on the goroutine, innermost last
+	bindings map[*Var][]Value
+	// entered counts enterState calls not yet matched by leave
+	entered int
+}
+
+var goroutines = struct {
+	sync.RWMutex
+	m map[uintptr]*goroutineState
+}{m: map[uintptr]*goroutineState{}}
+
+// registeredGoroutines is the size of the registry, kept apart so checking for an empty one is a single load
+var registeredGoroutines int32
+
+// currentState returns the state of the calling goroutine, nil if it has none
+func currentState() *goroutineState {
+	if atomic.LoadInt32(&registeredGoroutines) == 0 {
+		return nil
+	}
+	id := goroutineID()
+	goroutines.RLock()
+	s := goroutines.m[id]
+	goroutines.RUnlock()
+	return s
+}
+
+// enterState returns the state of the calling goroutine registering a fresh one if it has none,
+// callers release it with leave once they're done with it
+func enterState() *goroutineState {
+	if s := currentState(); s != nil {
+		s.entered++
+		return s
+	}
+	s := &goroutineState{bindings: map[*Var][]Value{}, entered: 1}
+	goroutines.Lock()
+	goroutines.m[goroutineID()] = s
+	goroutines.Unlock()
+	atomic.AddInt32(&registeredGoroutines, 1)
+	return s
+}
+
+// leave unregisters the state of the calling goroutine once every enterState was matched by leave.
+// Finished goroutines must not stay registered since the runtime reuses their ids.
+func (s *goroutineState) leave() {
+	s.entered--
+	if s.entered > 0 {
+		return
+	}
+	goroutines.Lock()
+	delete(goroutines.m, goroutineID())
+	goroutines.Unlock()
+	atomic.AddInt32(&registeredGoroutines, -1)
+}
+
+// currentRun returns the run the calling goroutine is part of, nil if it isn't running a frame with a run state
+func currentRun() *runState {
+	if s := currentState(); s != nil {
+		return s.run
+	}
+	return nil
+}
+
+// conveyed is the state a goroutine passes on to the goroutines running futures and agent actions it starts
+type conveyed struct {
+	run      *runState
+	bindings map[*Var]Value
+}
+
+// convey captures the state of the calling goroutine to be passed on, nil when there's nothing to pass.
+// Bindings are captured by value, setting them later on either goroutine isn't seen by the other.
+func convey() *conveyed {
+	s := currentState()
+	if s == nil {
+		return nil
+	}
+	c := &conveyed{run: s.run, bindings: make(map[*Var]Value, len(s.bindings))}
+	for v, b := range s.bindings {
+		c.bindings[v] = b[len(b)-1]
+	}
+	return c
+}
+
+// apply calls f with the conveyed state on the calling goroutine
+func (c *conveyed) apply(f func()) {
+	if c == nil {
+		f()
+		return
+	}
+	g := enterState()
+	outer, outerBindings := g.run, g.bindings
+	g.run = c.run
+	g.bindings = make(map[*Var][]Value, len(c.bindings))
+	for v, val := range c.bindings {
+		g.bindings[v] = []Value{val}
+		atomic.AddInt32(&v.bindings, 1)
+	}
+	defer func() {
+		for v := range g.bindings {
+			atomic.AddInt32(&v.bindings, -int32(len(g.bindings[v])))
+		}
+		g.run, g.bindings = outer, outerBindings
+		g.leave()
+	}()
+	f()
+}
+
+// GoroutineID identifies the calling goroutine among the running ones, ids of finished goroutines get reused
+func GoroutineID() uintptr {
+	return goroutineID()
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"math"
+	"reflect"
+)
+
+// Hasher is implemented by values which compute their own hash, it must agree with their Equals
+type Hasher interface {
+	Hash() uint32
+}
+
+const (
+	hashSeed    = 0x9e3779b9
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// Hash computes a hash of v consistent with Equal, values which are Equal hash the same.
+// Sequential collections hash alike regardless of their concrete type and maps and sets hash
+// their contents regardless of order, like they compare.
+func Hash(v Value) uint32 {
+	switch h := v.(type) {
+	case Hasher:
+		return h.Hash()
+	case *Nil:
+		return 0
+	case Int:
+		return mix64(uint64(h))
+	case Float:
+		return mix64(math.Float64bits(float64(h))) ^ 1
+	case Char:
+		return mix64(uint64(h)) ^ 2
+	case Boolean:
+		if h {
+			return 1231
+		}
+		return 1237
+	case String:
+		return hashString(string(h))
+	case Keyword:
+		return hashString(string(h)) + hashSeed
+	case Symbol:
+		return hashString(string(h)) ^ hashSeed
+	case Instant:
+		return mix64(uint64(h.Time().UnixNano()))
+	case entryMap:
+		return mapHash(h)
+	case *Set:
+		var acc uint32
+		h.each(func(e Value) bool {
+			acc += Hash(e)
+			return true
+		})
+		return acc + hashSeed
+	case Seq:
+		acc := uint32(1)
+		for s := Seq(h); !seqEmpty(s); s = s.Rest() {
+			acc = 31*acc + Hash(s.First())
+		}
+		return acc
+	}
+	// everything else is compared with == so pointers hash by address
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Chan, reflect.Map, reflect.UnsafePointer:
+		return mix64(uint64(rv.Pointer()))
+	}
+	return hashString(v.Type().Name())
+}
+
+func hashString(s string) uint32 {
+	h := uint32(fnvOffset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= fnvPrime32
+	}
+	return h
+}
+
+// mix64 is the finalizer of MurmurHash3 folded to 32 bits
+func mix64(k uint64) uint32 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb53fe1a85ec1
+	k ^= k >> 33
+	return uint32(k) ^ uint32(k>>32)
+}
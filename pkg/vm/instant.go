@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"time"
+)
+
+type theInstantType struct {
+	zero Instant
+}
+
+func (lt *theInstantType) Name() string { return "Instant" }
+
+func (lt *theInstantType) Box(bare interface{}) (Value, error) {
+	raw, ok := bare.(time.Time)
+	if !ok {
+		return InstantType.zero, NewTypeError(bare, "can't be boxed as", lt)
+	}
+	return Instant(raw), nil
+}
+
+// InstantType is the type of Instants
+var InstantType *theInstantType
+
+func init() {
+	InstantType = &theInstantType{zero: Instant(time.Time{})}
+}
+
+// Instant is boxed time.Time
+type Instant time.Time
+
+// Type implements Value
+func (l Instant) Type() ValueType { return InstantType }
+
+// Unbox implements Unbox
+func (l Instant) Unbox() interface{} {
+	return time.Time(l)
+}
+
+// Time returns the underlying time.Time
+func (l Instant) Time() time.Time {
+	return time.Time(l)
+}
+
+// Equals implements Equaler, instants are equal when they denote the same moment regardless of location
+func (l Instant) Equals(o Value) bool {
+	r, ok := o.(Instant)
+	if !ok {
+		return false
+	}
+	return l.Time().Equal(r.Time())
+}
+
+func (l Instant) String() string {
+	return "#inst \"" + l.Time().Format(time.RFC3339Nano) + "\""
+}
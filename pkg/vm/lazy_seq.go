@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type theLazySeqType struct{}
+
+func (t *theLazySeqType) Name() string { return "LazySeq" }
+
+func (t *theLazySeqType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// LazySeqType is the type of LazySeqs
+var LazySeqType *theLazySeqType
+
+func init() {
+	LazySeqType = &theLazySeqType{}
+}
+
+// Pending is implemented by values computed on demand which can tell whether that already happened
+type Pending interface {
+	IsRealized() bool
+}
+
+// LazySeq is a sequence computed by a Go function the first time any of its elements is needed.
+// The result is cached so the function runs at most once.
+// If the function fails the sequence is empty and the error is kept, see SeqError.
+type LazySeq struct {
+	once sync.Once
+	fn   func() (Seq, error)
+	seq  Seq
+	err  error
+	done uint32
+}
+
+// NewLazySeq makes a sequence which is the result of calling fn when first needed
+func NewLazySeq(fn func() (Seq, error)) *LazySeq {
+	return &LazySeq{fn: fn}
+}
+
+func (l *LazySeq) realize() Seq {
+	l.once.Do(func() {
+		s, err := l.fn()
+		l.fn = nil
+		// lazy sequences returning lazy sequences are unwrapped so walking them doesn't nest
+		if ls, ok := s.(*LazySeq); ok {
+			s, err = ls.realize(), ls.err
+		}
+		if s == nil || err != nil {
+			s = EmptyList
+		}
+		l.seq, l.err = s, err
+		atomic.StoreUint32(&l.done, 1)
+	})
+	return l.seq
+}
+
+// IsRealized implements Pending
+func (l *LazySeq) IsRealized() bool {
+	return atomic.LoadUint32(&l.done) == 1
+}
+
+// Err realizes the sequence and returns the error it failed with, if any
+func (l *LazySeq) Err() error {
+	l.realize()
+	return l.err
+}
+
+// SeqError returns the error realizing s failed with, sequences which aren't lazy never fail
+func SeqError(s Seq) error {
+	if l, ok := s.(*LazySeq); ok {
+		return l.Err()
+	}
+	return nil
+}
+
+// Type implements Value
+func (l *LazySeq) Type() ValueType { return LazySeqType }
+
+// Unbox implements Value, it realizes the whole sequence
+func (l *LazySeq) Unbox() interface{} {
+	vs, _ := AppendElements(nil, l)
+	return vs
+}
+
+// First implements Seq
+func (l *LazySeq) First() Value {
+	return l.realize().First()
+}
+
+// Rest implements Seq
+func (l *LazySeq) Rest() Seq {
+	return l.realize().Rest()
+}
+
+// Next implements Seq
+func (l *LazySeq) Next() Seq {
+	return l.realize().Next()
+}
+
+// Cons implements Seq
+func (l *LazySeq) Cons(val Value) Seq {
+	return NewCons(val, l)
+}
+
+// IsEmpty implements EmptyChecker
+func (l *LazySeq) IsEmpty() bool {
+	return seqEmpty(l.realize())
+}
+
+// Equals implements Equaler
+func (l *LazySeq) Equals(o Value) bool {
+	return seqEquals(l, o)
+}
+
+func (l *LazySeq) String() string {
+	return seqString(l)
+}
@@ -55,6 +55,7 @@ type List struct {
 	first Value
 	next  *List
 	count int
+	meta  Value
 }
 
 // Type implements Value
@@ -86,8 +87,8 @@ func (l *List) First() Value {
 	return l.first
 }
 
-// More implements Seq
-func (l *List) More() Seq {
+// Rest implements Seq
+func (l *List) Rest() Seq {
 	if l.count == 0 {
 		return l
 	}
@@ -96,14 +97,15 @@ func (l *List) More() Seq {
 
 // Next implements Seq
 func (l *List) Next() Seq {
-	if l.count == 0 {
-		return l
+	if l.count <= 1 {
+		return nil
 	}
 	return l.next
 }
 
 // Cons implements Seq
 func (l *List) Cons(val Value) Seq {
+	trackAllocation(1)
 	return &List{
 		first: val,
 		next:  l,
@@ -111,6 +113,24 @@ func (l *List) Cons(val Value) Seq {
 	}
 }
 
+// Meta implements Metadatable
+func (l *List) Meta() Value {
+	if l.meta == nil {
+		return NIL
+	}
+	return l.meta
+}
+
+// WithMeta implements Metadatable, the returned list shares its tail with l
+func (l *List) WithMeta(meta Value) Value {
+	return &List{
+		first: l.first,
+		next:  l.next,
+		count: l.count,
+		meta:  meta,
+	}
+}
+
 // Count implements Collection
 func (l *List) Count() Value {
 	ret, _ := IntType.Box(l.count)
@@ -122,6 +142,11 @@ func (l *List) Empty() Collection {
 	return EmptyList
 }
 
+// Equals implements Equaler
+func (l *List) Equals(o Value) bool {
+	return seqEquals(l, o)
+}
+
 func (l *List) String() string {
 	b := &strings.Builder{}
 	b.WriteRune('(')
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+// Lookup is implemented by values which can be searched by key, get and invoking keywords or collections go
+// through it so all of them agree on what's found. Maps look keys up, sets their members, vectors and strings
+// take integer indexes. Missing keys and keys of the wrong type give notFound.
+type Lookup interface {
+	ValueAtOr(key Value, notFound Value) Value
+}
+
+// Get looks key up in coll returning notFound when it's missing or coll can't be searched
+func Get(coll Value, key Value, notFound Value) Value {
+	if l, ok := coll.(Lookup); ok {
+		return l.ValueAtOr(key, notFound)
+	}
+	return notFound
+}
+
+// ValueAtOr implements Lookup, members of the set map to themselves
+func (s *Set) ValueAtOr(key Value, notFound Value) Value {
+	if s.Contains(key) {
+		return key
+	}
+	return notFound
+}
+
+// ValueAtOr implements Lookup
+func (l ArrayVector) ValueAtOr(key Value, notFound Value) Value {
+	if i, ok := key.(Int); ok && i >= 0 && int(i) < len(l) {
+		return l[i]
+	}
+	return notFound
+}
+
+// ValueAtOr implements Lookup
+func (v *PersistentVector) ValueAtOr(key Value, notFound Value) Value {
+	if i, ok := key.(Int); ok {
+		if e, ok := v.Nth(int(i)); ok {
+			return e
+		}
+	}
+	return notFound
+}
+
+// Nth returns the i-th character counting in runes or false when i is out of bounds
+func (l String) Nth(i int) (Value, bool) {
+	if i < 0 {
+		return NIL, false
+	}
+	n := 0
+	for _, r := range l {
+		if n == i {
+			return Char(r), true
+		}
+		n++
+	}
+	return NIL, false
+}
+
+// ValueAtOr implements Lookup
+func (l String) ValueAtOr(key Value, notFound Value) Value {
+	if i, ok := key.(Int); ok {
+		if c, ok := l.Nth(int(i)); ok {
+			return c
+		}
+	}
+	return notFound
+}
@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "math/bits"
+
+type theMapType struct{}
+
+func (mt *theMapType) Name() string { return "Map" }
+
+func (mt *theMapType) Box(bare interface{}) (Value, error) {
+	arr, ok := bare.([]Value)
+	if !ok || len(arr)%2 != 0 {
+		return EmptyMap, NewTypeError(bare, "can't be boxed as", mt)
+	}
+	ret := EmptyMap
+	for i := 0; i < len(arr); i += 2 {
+		ret = ret.Assoc(arr[i], arr[i+1])
+	}
+	return ret, nil
+}
+
+// MapType is the type of Maps
+var MapType *theMapType
+
+// EmptyMap is an empty Map
+var EmptyMap *Map
+
+func init() {
+	MapType = &theMapType{}
+	EmptyMap = &Map{root: &hamtNode{}}
+}
+
+// Map is a boxed associative collection mapping keys to values.
+// It's a hash array mapped trie keyed by Hash so updates are O(log32 n) and copy only the path to the changed entry.
+// Entries are kept in hash order.
+type Map struct {
+	count int
+	root  *hamtNode
+	meta  Value
+}
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+	// below this shift all hash bits were used up and keys with equal hashes end up in collision nodes
+	hamtMaxShift = 32
+)
+
+// hamtEntry is either a key and its value or a child node
+type hamtEntry struct {
+	hash  uint32
+	key   Value
+	val   Value
+	child *hamtNode
+}
+
+// hamtNode holds entries for the hash bits set in bitmap, in order.
+// Collision nodes hold entries with the same hash and ignore the bitmap.
+type hamtNode struct {
+	bitmap    uint32
+	entries   []hamtEntry
+	collision bool
+}
+
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// with returns a copy of the node with entry i replaced by e
+func (n *hamtNode) with(i int, e hamtEntry) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries))
+	copy(entries, n.entries)
+	entries[i] = e
+	return &hamtNode{bitmap: n.bitmap, entries: entries, collision: n.collision}
+}
+
+// inserting returns a copy of the node with e inserted at i
+func (n *hamtNode) inserting(i int, bit uint32, e hamtEntry) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries)+1)
+	copy(entries, n.entries[:i])
+	entries[i] = e
+	copy(entries[i+1:], n.entries[i:])
+	return &hamtNode{bitmap: n.bitmap | bit, entries: entries, collision: n.collision}
+}
+
+// removing returns a copy of the node without entry i
+func (n *hamtNode) removing(i int, bit uint32) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries)-1)
+	copy(entries, n.entries[:i])
+	copy(entries[i:], n.entries[i+1:])
+	return &hamtNode{bitmap: n.bitmap &^ bit, entries: entries, collision: n.collision}
+}
+
+func (n *hamtNode) find(shift uint, hash uint32, key Value) (Value, bool) {
+	for {
+		if n.collision {
+			for i := range n.entries {
+				if Equal(n.entries[i].key, key) {
+					return n.entries[i].val, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & hamtMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := &n.entries[n.index(bit)]
+		if e.child == nil {
+			if e.hash == hash && Equal(e.key, key) {
+				return e.val, true
+			}
+			return nil, false
+		}
+		n, shift = e.child, shift+hamtBits
+	}
+}
+
+// assoc returns the node with key mapped to val and whether a new entry was added
+func (n *hamtNode) assoc(shift uint, e hamtEntry) (*hamtNode, bool) {
+	if n.collision {
+		for i := range n.entries {
+			if Equal(n.entries[i].key, e.key) {
+				return n.with(i, e), false
+			}
+		}
+		return n.inserting(len(n.entries), 0, e), true
+	}
+	bit := uint32(1) << ((e.hash >> shift) & hamtMask)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		return n.inserting(i, bit, e), true
+	}
+	old := n.entries[i]
+	if old.child != nil {
+		child, added := old.child.assoc(shift+hamtBits, e)
+		return n.with(i, hamtEntry{child: child}), added
+	}
+	if old.hash == e.hash && Equal(old.key, e.key) {
+		return n.with(i, e), false
+	}
+	return n.with(i, hamtEntry{child: mergeHamtEntries(shift+hamtBits, old, e)}), true
+}
+
+// mergeHamtEntries makes a node holding two entries whose hashes agree up to shift
+func mergeHamtEntries(shift uint, a hamtEntry, b hamtEntry) *hamtNode {
+	if shift >= hamtMaxShift {
+		return &hamtNode{entries: []hamtEntry{a, b}, collision: true}
+	}
+	ai, bi := (a.hash>>shift)&hamtMask, (b.hash>>shift)&hamtMask
+	if ai == bi {
+		return &hamtNode{bitmap: 1 << ai, entries: []hamtEntry{{child: mergeHamtEntries(shift+hamtBits, a, b)}}}
+	}
+	if ai > bi {
+		a, b = b, a
+	}
+	return &hamtNode{bitmap: 1<<ai | 1<<bi, entries: []hamtEntry{a, b}}
+}
+
+// dissoc returns the node without key and whether it was present, the node may end up empty
+func (n *hamtNode) dissoc(shift uint, hash uint32, key Value) (*hamtNode, bool) {
+	if n.collision {
+		for i := range n.entries {
+			if Equal(n.entries[i].key, key) {
+				return n.removing(i, 0), true
+			}
+		}
+		return n, false
+	}
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := n.index(bit)
+	e := n.entries[i]
+	if e.child == nil {
+		if e.hash == hash && Equal(e.key, key) {
+			return n.removing(i, bit), true
+		}
+		return n, false
+	}
+	child, removed := e.child.dissoc(shift+hamtBits, hash, key)
+	if !removed {
+		return n, false
+	}
+	switch {
+	case len(child.entries) == 0:
+		return n.removing(i, bit), true
+	case len(child.entries) == 1 && child.entries[0].child == nil:
+		// a lone entry moves up so lookups don't walk chains of single entry nodes
+		return n.with(i, child.entries[0]), true
+	}
+	return n.with(i, hamtEntry{child: child}), true
+}
+
+func (n *hamtNode) each(f func(k, v Value) bool) bool {
+	for i := range n.entries {
+		e := &n.entries[i]
+		if e.child != nil {
+			if !e.child.each(f) {
+				return false
+			}
+			continue
+		}
+		if !f(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Map) eachEntry(f func(k, v Value) bool) bool {
+	return m.root.each(f)
+}
+
+func (m *Map) lookup(key Value) (Value, bool) {
+	return m.root.find(0, Hash(key), key)
+}
+
+// Type implements Value
+func (m *Map) Type() ValueType { return MapType }
+
+// Unbox implements Value
+// Keys of the resulting Go map are compared with ==, so they must be comparable Go values.
+func (m *Map) Unbox() interface{} {
+	bare := make(map[Value]Value, m.count)
+	m.eachEntry(func(k, v Value) bool {
+		bare[k] = v
+		return true
+	})
+	return bare
+}
+
+// Assoc returns a new Map with key mapped to val
+func (m *Map) Assoc(key Value, val Value) *Map {
+	root, added := m.root.assoc(0, hamtEntry{hash: Hash(key), key: key, val: val})
+	count := m.count
+	if added {
+		trackAllocation(2)
+		count++
+	}
+	return &Map{count: count, root: root, meta: m.meta}
+}
+
+// Dissoc returns a new Map without key
+func (m *Map) Dissoc(key Value) *Map {
+	root, removed := m.root.dissoc(0, Hash(key), key)
+	if !removed {
+		return m
+	}
+	return &Map{count: m.count - 1, root: root, meta: m.meta}
+}
+
+// Meta implements Metadatable
+func (m *Map) Meta() Value { return metaOrNil(m.meta) }
+
+// WithMeta implements Metadatable
+func (m *Map) WithMeta(meta Value) Value {
+	return &Map{count: m.count, root: m.root, meta: meta}
+}
+
+// ValueAt returns the value mapped to key or NIL if there is no such key
+func (m *Map) ValueAt(key Value) Value {
+	return m.ValueAtOr(key, NIL)
+}
+
+// ValueAtOr returns the value mapped to key or dflt if there is no such key
+func (m *Map) ValueAtOr(key Value, dflt Value) Value {
+	v, ok := m.root.find(0, Hash(key), key)
+	if !ok {
+		return dflt
+	}
+	return v
+}
+
+// Contains tells whether key is present in the Map
+func (m *Map) Contains(key Value) bool {
+	_, ok := m.root.find(0, Hash(key), key)
+	return ok
+}
+
+// Keys returns a vector of all keys in the Map
+func (m *Map) Keys() ArrayVector {
+	keys := make(ArrayVector, 0, m.count)
+	m.eachEntry(func(k, _ Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// Vals returns a vector of all values in the Map, in the same order as Keys
+func (m *Map) Vals() ArrayVector {
+	vals := make(ArrayVector, 0, m.count)
+	m.eachEntry(func(_, v Value) bool {
+		vals = append(vals, v)
+		return true
+	})
+	return vals
+}
+
+// Count implements Collection
+func (m *Map) Count() Value {
+	return Int(m.count)
+}
+
+// Empty implements Collection
+func (m *Map) Empty() Collection {
+	return EmptyMap
+}
+
+// Equals implements Equaler
+func (m *Map) Equals(o Value) bool {
+	return mapEquals(m, o)
+}
+
+func (m *Map) String() string {
+	return mapString(m)
+}
+
+func NewMap(kvs []Value) Value {
+	m, err := MapType.Box(kvs)
+	if err != nil {
+		return EmptyMap
+	}
+	return m
+}
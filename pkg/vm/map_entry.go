@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+type theMapEntryType struct{}
+
+func (t *theMapEntryType) Name() string { return "MapEntry" }
+
+func (t *theMapEntryType) Box(bare interface{}) (Value, error) {
+	kv, ok := bare.([]Value)
+	if !ok || len(kv) != 2 {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return NewMapEntry(kv[0], kv[1]), nil
+}
+
+// MapEntryType is the type of MapEntries
+var MapEntryType *theMapEntryType
+
+func init() {
+	MapEntryType = &theMapEntryType{}
+}
+
+// MapEntry is a key and value pair of a map, seqs of maps yield these.
+// It behaves like a 2 element vector so entries can be destructured as [k v].
+type MapEntry struct {
+	key Value
+	val Value
+}
+
+// NewMapEntry pairs key with val
+func NewMapEntry(key Value, val Value) MapEntry {
+	return MapEntry{key: key, val: val}
+}
+
+// Key returns the key of the entry
+func (e MapEntry) Key() Value { return e.key }
+
+// Val returns the value of the entry
+func (e MapEntry) Val() Value { return e.val }
+
+func (e MapEntry) vector() ArrayVector { return ArrayVector{e.key, e.val} }
+
+// Type implements Value
+func (e MapEntry) Type() ValueType { return MapEntryType }
+
+// Unbox implements Value
+func (e MapEntry) Unbox() interface{} {
+	return []Value{e.key, e.val}
+}
+
+// First implements Seq
+func (e MapEntry) First() Value { return e.key }
+
+// Rest implements Seq
+func (e MapEntry) Rest() Seq { return ArrayVector{e.val} }
+
+// Next implements Seq
+func (e MapEntry) Next() Seq { return ArrayVector{e.val} }
+
+// Cons implements Seq, like on vectors it appends giving a plain vector
+func (e MapEntry) Cons(val Value) Seq {
+	return ArrayVector{e.key, e.val, val}
+}
+
+// Count implements Collection
+func (e MapEntry) Count() Value { return Int(2) }
+
+// Empty implements Collection
+func (e MapEntry) Empty() Collection { return make(ArrayVector, 0) }
+
+// Equals implements Equaler, entries are equal to vectors holding the same key and value
+func (e MapEntry) Equals(o Value) bool {
+	return seqEquals(e, o)
+}
+
+// ValueAtOr implements Lookup, 0 is the key and 1 the value
+func (e MapEntry) ValueAtOr(key Value, notFound Value) Value {
+	return e.vector().ValueAtOr(key, notFound)
+}
+
+// Invoke implements Fn, (e i) returns element i like on vectors
+func (e MapEntry) Invoke(args []Value) (Value, error) {
+	return e.vector().Invoke(args)
+}
+
+// Arity implements Fn
+func (e MapEntry) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (e MapEntry) ArityInfo() (int, int, bool) { return 1, 1, false }
+
+func (e MapEntry) String() string {
+	return e.vector().String()
+}
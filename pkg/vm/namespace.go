@@ -19,9 +19,29 @@ package vm
 
 import "fmt"
 
+type theNamespaceType struct{}
+
+func (t *theNamespaceType) Name() string { return "Namespace" }
+
+func (t *theNamespaceType) Box(bare interface{}) (Value, error) {
+	ns, ok := bare.(*Namespace)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return ns, nil
+}
+
+// NamespaceType is the type of Namespace values
+var NamespaceType *theNamespaceType
+
+func init() {
+	NamespaceType = &theNamespaceType{}
+}
+
 type Namespace struct {
 	name     string
 	registry map[Symbol]*Var
+	refers   []*Namespace
 }
 
 func NewNamespace(name string) *Namespace {
@@ -39,20 +59,79 @@ func (n *Namespace) Def(name string, val Value) *Var {
 	return va
 }
 
+// LookupOrAdd returns the var named by symbol, interning a new unbound one if there is none
 func (n *Namespace) LookupOrAdd(symbol Symbol) Value {
 	val, ok := n.registry[symbol]
 	if !ok {
-		return n.Def(string(symbol), NIL)
+		va := NewVar(n, n.name, string(symbol))
+		n.registry[symbol] = va
+		return va
 	}
 	return val
 }
 
+// Refer makes vars of other visible in the namespace, its own vars take precedence
+func (n *Namespace) Refer(other *Namespace) *Namespace {
+	for _, r := range n.refers {
+		if r == other {
+			return n
+		}
+	}
+	n.refers = append(n.refers, other)
+	return n
+}
+
+// Merge defines the vars of other in n and refers what other refers.
+// Vars n already has are kept and take the root and flags of other's, so code which resolved them sees the new values.
+func (n *Namespace) Merge(other *Namespace) *Namespace {
+	for sym, src := range other.registry {
+		dst := n.LookupOrAdd(sym).(*Var)
+		if src.isBound {
+			dst.SetRoot(src.root)
+		}
+		dst.isMacro = src.isMacro
+		dst.isDynamic = src.isDynamic
+	}
+	for _, r := range other.refers {
+		n.Refer(r)
+	}
+	return n
+}
+
+// Lookup returns the var named by symbol in the namespace or the ones it refers, NIL if there is none
 func (n *Namespace) Lookup(symbol Symbol) Value {
 	val, ok := n.registry[symbol]
-	if !ok {
-		return NIL
+	if ok {
+		return val
 	}
-	return val
+	for _, r := range n.refers {
+		if v := r.Lookup(symbol); v != NIL {
+			return v
+		}
+	}
+	return NIL
+}
+
+// Type implements Value
+func (n *Namespace) Type() ValueType { return NamespaceType }
+
+// Unbox implements Value
+func (n *Namespace) Unbox() interface{} {
+	return n
+}
+
+// Symbols returns names of all vars defined in the namespace in no particular order
+func (n *Namespace) Symbols() []Symbol {
+	syms := make([]Symbol, 0, len(n.registry))
+	for s := range n.registry {
+		syms = append(syms, s)
+	}
+	return syms
+}
+
+// Refers returns the namespaces referred by n in the order they are looked up
+func (n *Namespace) Refers() []*Namespace {
+	return n.refers
 }
 
 func (n *Namespace) Name() string {
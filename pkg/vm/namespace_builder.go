@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+// NamespaceBuilder assembles a namespace of host values and native functions so it can be handed to the runtime
+// in one piece. Errors are remembered and reported by Build, which lets definitions be chained.
+type NamespaceBuilder struct {
+	ns  *Namespace
+	err error
+}
+
+// NewNamespaceBuilder starts building an empty namespace called name
+func NewNamespaceBuilder(name string) *NamespaceBuilder {
+	return &NamespaceBuilder{ns: NewNamespace(name)}
+}
+
+// Def defines name as val
+func (b *NamespaceBuilder) Def(name string, val Value) *NamespaceBuilder {
+	b.ns.Def(name, val)
+	return b
+}
+
+// DefNative defines name as a native function receiving its arguments boxed
+func (b *NamespaceBuilder) DefNative(name string, fn func(args []Value) (Value, error)) *NamespaceBuilder {
+	f, err := NativeFnType.Wrap(fn)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	b.ns.Def(name, f)
+	return b
+}
+
+// DefFunc defines name as an arbitrary Go function, arguments are unboxed and results boxed by reflection.
+// A trailing error result is surfaced as a let-go error.
+func (b *NamespaceBuilder) DefFunc(name string, fn interface{}) *NamespaceBuilder {
+	f, err := NativeFnType.Box(fn)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	b.ns.Def(name, f)
+	return b
+}
+
+// DefType registers the Go type of example as name, see RegisterGoType, and defines name as it
+// so programs can check values with instance? and extend protocols to the type
+func (b *NamespaceBuilder) DefType(name string, example interface{}) *NamespaceBuilder {
+	b.ns.Def(name, RegisterGoType(name, example))
+	return b
+}
+
+// Refer makes vars of other visible in the namespace being built
+func (b *NamespaceBuilder) Refer(other *Namespace) *NamespaceBuilder {
+	b.ns.Refer(other)
+	return b
+}
+
+// Build returns the namespace or the first error hit while defining it
+func (b *NamespaceBuilder) Build() (*Namespace, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.ns, nil
+}
+
+func (b *NamespaceBuilder) fail(name string, err error) *NamespaceBuilder {
+	if b.err == nil {
+		b.err = NewExecutionError("defining " + b.ns.Name() + "/" + name).Wrap(err)
+	}
+	return b
+}
@@ -20,6 +20,7 @@ package vm
 import (
 	"fmt"
 	"reflect"
+	"runtime/debug"
 )
 
 type theNativeFnType struct{}
@@ -35,20 +36,30 @@ func (t *theNativeFnType) Box(fn interface{}) (Value, error) {
 
 	v := reflect.ValueOf(fn)
 
-	proxy := func(args []Value) Value {
+	// functions returning an error as their last result get it surfaced as a let-go error
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	returnsError := ty.NumOut() > 0 && ty.Out(ty.NumOut()-1) == errorType
+
+	proxy := func(args []Value) (Value, error) {
 		rawArgs := make([]reflect.Value, len(args))
 		for i := range args {
 			rawArgs[i] = reflect.ValueOf(args[i].Unbox())
 		}
 		res := v.Call(rawArgs)
+		if returnsError {
+			if err, _ := res[len(res)-1].Interface().(error); err != nil {
+				return NIL, err
+			}
+			res = res[:len(res)-1]
+		}
 		if len(res) == 0 {
-			return NIL
+			return NIL, nil
 		}
 		wv, err := BoxValue(res[0])
 		if err != nil {
-			return NIL
+			return NIL, NewTypeError(res[0], "can't be boxed as a return value", nil).Wrap(err)
 		}
-		return wv
+		return wv, nil
 	}
 
 	f := &NativeFn{
@@ -61,7 +72,7 @@ func (t *theNativeFnType) Box(fn interface{}) (Value, error) {
 	return f, nil
 }
 
-func (t *theNativeFnType) Wrap(fn func(args []Value) Value) (Value, error) {
+func (t *theNativeFnType) Wrap(fn func(args []Value) (Value, error)) (Value, error) {
 	f := &NativeFn{
 		arity:       -1,
 		isVariadric: false,
@@ -88,7 +99,8 @@ type NativeFn struct {
 	arity       int
 	isVariadric bool
 	fn          interface{}
-	proxy       func([]Value) Value
+	proxy       func([]Value) (Value, error)
+	name        string
 }
 
 func (l *NativeFn) Type() ValueType { return NativeFnType }
@@ -102,8 +114,46 @@ func (l *NativeFn) Arity() int {
 	return l.arity
 }
 
-func (l *NativeFn) Invoke(args []Value) Value {
-	return l.proxy(args)
+// ArityInfo implements Callable, natives wrapped without a known arity accept any number of arguments
+func (l *NativeFn) ArityInfo() (int, int, bool) {
+	switch {
+	case l.arity < 0:
+		return 0, -1, true
+	case l.isVariadric:
+		return l.arity - 1, -1, true
+	}
+	return l.arity, l.arity, false
+}
+
+// DebugPanics makes errors recovered from panicking natives carry the Go stack trace of the panic
+var DebugPanics bool
+
+// Invoke calls the native. A panic inside it, most likely from a type assertion on an unchecked argument,
+// is recovered and returned as an ExecutionError so the call fails instead of the whole host process.
+// Exceeding the allocation limit fails the call too, so natives called from natives, like conj passed to reduce,
+// stop the build-up as soon as the limit is crossed.
+func (l *NativeFn) Invoke(args []Value) (ret Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret, err = NIL, l.panicError(r)
+		}
+	}()
+	ret, err = l.proxy(args)
+	if err != nil {
+		return NIL, err
+	}
+	if err := allocationExceeded(); err != nil {
+		return NIL, err
+	}
+	return ret, nil
+}
+
+func (l *NativeFn) panicError(r interface{}) error {
+	msg := fmt.Sprintf("%s panicked: %v", describeFn(l), r)
+	if DebugPanics {
+		msg += "\n" + string(debug.Stack())
+	}
+	return NewExecutionError(msg)
 }
 
 func (l *NativeFn) String() string {
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type theAnyType struct{}
+
+func (t *theAnyType) Name() string { return "Any" }
+
+func (t *theAnyType) Box(bare interface{}) (Value, error) {
+	return BoxValue(reflect.ValueOf(bare))
+}
+
+type theNumberType struct{}
+
+func (t *theNumberType) Name() string { return "Number" }
+
+func (t *theNumberType) Box(bare interface{}) (Value, error) {
+	switch raw := bare.(type) {
+	case int:
+		return Int(raw), nil
+	case float64:
+		return Float(raw), nil
+	default:
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+}
+
+// AnyType is a pseudo-type accepting any value in argument specs of typed natives
+var AnyType *theAnyType
+
+// NumberType is a pseudo-type accepting both Ints and Floats in argument specs of typed natives
+var NumberType *theNumberType
+
+func init() {
+	AnyType = &theAnyType{}
+	NumberType = &theNumberType{}
+}
+
+// Accepts tells whether value v fits expected type t, taking the pseudo-types into account
+func Accepts(t ValueType, v Value) bool {
+	switch t {
+	case AnyType:
+		return true
+	case NumberType:
+		return IsNumber(v)
+	default:
+		return v.Type() == t
+	}
+}
+
+// NativeTyped wraps fn into a native function which checks that it receives exactly len(types) arguments
+// of matching types before calling fn, so fn itself can assume well-formed input.
+// Mismatches are reported as errors naming the function, the offending argument and the expected type.
+func NativeTyped(name string, types []ValueType, fn func([]Value) (Value, error)) *NativeFn {
+	guarded := func(vs []Value) (Value, error) {
+		if len(vs) != len(types) {
+			return NIL, NewExecutionError(fmt.Sprintf("wrong number of arguments (%d) passed to %s, expected %d", len(vs), name, len(types)))
+		}
+		for i := range types {
+			if !Accepts(types[i], vs[i]) {
+				return NIL, NewTypeError(vs[i], fmt.Sprintf("passed as argument %d to %s is not of type", i+1, name), types[i])
+			}
+		}
+		return fn(vs)
+	}
+	return &NativeFn{
+		arity: len(types),
+		fn:    guarded,
+		proxy: guarded,
+		name:  name,
+	}
+}
+
+// DefNativeTyped defines a native function guarded by NativeTyped in the namespace
+func (n *Namespace) DefNativeTyped(name string, types []ValueType, fn func([]Value) (Value, error)) *Var {
+	return n.Def(name, NativeTyped(name, types, fn))
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+// The numeric tower currently consists of Int and Float. Operations on two Ints stay exact and yield an Int,
+// as soon as a Float is involved the other operand is promoted and the result is a Float.
+
+// IsNumber tells whether v belongs to the numeric tower
+func IsNumber(v Value) bool {
+	switch v.(type) {
+	case Int, Float:
+		return true
+	default:
+		return false
+	}
+}
+
+func toFloat(v Value) (Float, error) {
+	f, err := AsFloat(v)
+	return Float(f), err
+}
+
+// numericOp applies iop when both operands are Ints and fop otherwise
+func numericOp(a Value, b Value, iop func(Int, Int) (Value, error), fop func(Float, Float) Value) (Value, error) {
+	if ai, ok := a.(Int); ok {
+		if bi, ok := b.(Int); ok {
+			return iop(ai, bi)
+		}
+	}
+	af, err := toFloat(a)
+	if err != nil {
+		return NIL, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return NIL, err
+	}
+	return fop(af, bf), nil
+}
+
+// Add returns a + b
+func Add(a Value, b Value) (Value, error) {
+	return numericOp(a, b,
+		func(x Int, y Int) (Value, error) { return x + y, nil },
+		func(x Float, y Float) Value { return x + y })
+}
+
+// Sub returns a - b
+func Sub(a Value, b Value) (Value, error) {
+	return numericOp(a, b,
+		func(x Int, y Int) (Value, error) { return x - y, nil },
+		func(x Float, y Float) Value { return x - y })
+}
+
+// Mul returns a * b
+func Mul(a Value, b Value) (Value, error) {
+	return numericOp(a, b,
+		func(x Int, y Int) (Value, error) { return x * y, nil },
+		func(x Float, y Float) Value { return x * y })
+}
+
+// Div returns a / b
+// Dividing Ints stays exact when possible and yields a Float otherwise since there are no ratios yet.
+func Div(a Value, b Value) (Value, error) {
+	return numericOp(a, b,
+		func(x Int, y Int) (Value, error) {
+			if y == 0 {
+				return NIL, NewExecutionError("divide by zero")
+			}
+			if x%y == 0 {
+				return x / y, nil
+			}
+			return Float(x) / Float(y), nil
+		},
+		func(x Float, y Float) Value { return x / y })
+}
+
+// NumCompare orders two numbers by their mathematical value
+func NumCompare(a Value, b Value) (int, error) {
+	if ai, ok := a.(Int); ok {
+		if bi, ok := b.(Int); ok {
+			return compareInts(int(ai), int(bi)), nil
+		}
+	}
+	af, err := toFloat(a)
+	if err != nil {
+		return 0, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case af < bf:
+		return -1, nil
+	case af > bf:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// NumEqual compares two numbers by their mathematical value regardless of their type, this is Clojure's ==
+// Unlike Equal (Clojure's =) which is type-sensitive and considers 1 and 1.0 different.
+func NumEqual(a Value, b Value) (bool, error) {
+	if ai, ok := a.(Int); ok {
+		if bi, ok := b.(Int); ok {
+			return ai == bi, nil
+		}
+	}
+	af, err := toFloat(a)
+	if err != nil {
+		return false, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return false, err
+	}
+	return af == bf, nil
+}
+
+func toInt(v Value) (Int, error) {
+	i, err := AsInt(v)
+	return Int(i), err
+}
+
+// intOp applies op to a and b which both have to be Ints
+func intOp(a Value, b Value, op func(Int, Int) Int) (Value, error) {
+	ai, err := toInt(a)
+	if err != nil {
+		return NIL, err
+	}
+	bi, err := toInt(b)
+	if err != nil {
+		return NIL, err
+	}
+	return op(ai, bi), nil
+}
+
+// BitAnd returns bitwise a & b
+func BitAnd(a Value, b Value) (Value, error) {
+	return intOp(a, b, func(x Int, y Int) Int { return x & y })
+}
+
+// BitOr returns bitwise a | b
+func BitOr(a Value, b Value) (Value, error) {
+	return intOp(a, b, func(x Int, y Int) Int { return x | y })
+}
+
+// BitXor returns bitwise a ^ b
+func BitXor(a Value, b Value) (Value, error) {
+	return intOp(a, b, func(x Int, y Int) Int { return x ^ y })
+}
+
+// BitNot returns the bitwise complement of a
+func BitNot(a Value) (Value, error) {
+	ai, err := toInt(a)
+	if err != nil {
+		return NIL, err
+	}
+	return ^ai, nil
+}
+
+// Shift distances are taken modulo 64 like on the JVM so negative or oversized shifts don't panic.
+
+// BitShiftLeft returns a << n
+func BitShiftLeft(a Value, n Value) (Value, error) {
+	return intOp(a, n, func(x Int, y Int) Int { return x << uint(y&63) })
+}
+
+// BitShiftRight returns a >> n preserving the sign of a (arithmetic shift)
+func BitShiftRight(a Value, n Value) (Value, error) {
+	return intOp(a, n, func(x Int, y Int) Int { return x >> uint(y&63) })
+}
+
+// UnsignedBitShiftRight returns a >> n filling the vacated bits with zeroes (logical shift)
+func UnsignedBitShiftRight(a Value, n Value) (Value, error) {
+	return intOp(a, n, func(x Int, y Int) Int { return Int(uint64(x) >> uint(y&63)) })
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "strings"
+
+type thePersistentVectorType struct{}
+
+func (t *thePersistentVectorType) Name() string { return "PersistentVector" }
+
+func (t *thePersistentVectorType) Box(bare interface{}) (Value, error) {
+	arr, ok := bare.([]Value)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return NewPersistentVector(arr), nil
+}
+
+type theVectorSeqType struct{}
+
+func (t *theVectorSeqType) Name() string { return "VectorSeq" }
+
+func (t *theVectorSeqType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// PersistentVectorType is the type of PersistentVectors
+var PersistentVectorType *thePersistentVectorType
+
+// VectorSeqType is the type of sequences walking PersistentVectors
+var VectorSeqType *theVectorSeqType
+
+func init() {
+	PersistentVectorType = &thePersistentVectorType{}
+	VectorSeqType = &theVectorSeqType{}
+}
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vectorNode is a node of the trie, inner nodes have children and leaves have values
+type vectorNode struct {
+	children []*vectorNode
+	values   []Value
+}
+
+// PersistentVector is an immutable vector stored as a 32-way bit-partitioned trie like Clojure's.
+// Updates copy only the path to the changed leaf so they are O(log32 n) and share everything else.
+// The last up to 32 elements live in a separate tail which makes appending cheap.
+type PersistentVector struct {
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Value
+	meta  Value
+}
+
+var emptyVectorNode = &vectorNode{}
+
+// EmptyPersistentVector is a PersistentVector with no elements
+var EmptyPersistentVector = &PersistentVector{shift: vectorBits, root: emptyVectorNode}
+
+// NewPersistentVector makes a PersistentVector holding the elements of vs
+func NewPersistentVector(vs []Value) *PersistentVector {
+	v := EmptyPersistentVector
+	for i := range vs {
+		v = v.Conj(vs[i])
+	}
+	return v
+}
+
+// NewVector makes a vector holding a copy of vs.
+// Small vectors are plain ArrayVectors, bigger ones are PersistentVectors so updating them is cheap.
+func NewVector(vs []Value) Value {
+	if len(vs) <= vectorWidth {
+		return NewArrayVector(vs)
+	}
+	return NewPersistentVector(vs)
+}
+
+// tailOffset is the index of the first element stored in the tail
+func (v *PersistentVector) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return ((v.count - 1) >> vectorBits) << vectorBits
+}
+
+// leafFor returns the leaf holding element i, which must be in bounds
+func (v *PersistentVector) leafFor(i int) []Value {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+// Nth returns element i or false when i is out of bounds
+func (v *PersistentVector) Nth(i int) (Value, bool) {
+	if i < 0 || i >= v.count {
+		return NIL, false
+	}
+	return v.leafFor(i)[i&vectorMask], true
+}
+
+// Conj returns a vector with val appended
+func (v *PersistentVector) Conj(val Value) *PersistentVector {
+	trackAllocation(1)
+	if v.count-v.tailOffset() < vectorWidth {
+		tail := make([]Value, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = val
+		return &PersistentVector{count: v.count + 1, shift: v.shift, root: v.root, tail: tail, meta: v.meta}
+	}
+	// the tail is full so it moves into the trie, which grows a level when the root is full too
+	leaf := &vectorNode{values: v.tail}
+	shift := v.shift
+	var root *vectorNode
+	if (v.count >> vectorBits) > (1 << v.shift) {
+		root = &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, leaf)}}
+		shift += vectorBits
+	} else {
+		root = v.pushTail(v.shift, v.root, leaf)
+	}
+	tail := make([]Value, 1)
+	tail[0] = val
+	return &PersistentVector{count: v.count + 1, shift: shift, root: root, tail: tail, meta: v.meta}
+}
+
+func (v *PersistentVector) pushTail(level uint, parent *vectorNode, leaf *vectorNode) *vectorNode {
+	sub := ((v.count - 1) >> level) & vectorMask
+	n := len(parent.children)
+	if sub >= n {
+		n = sub + 1
+	}
+	children := make([]*vectorNode, n)
+	copy(children, parent.children)
+	if level == vectorBits {
+		children[sub] = leaf
+	} else if sub < len(parent.children) {
+		children[sub] = v.pushTail(level-vectorBits, parent.children[sub], leaf)
+	} else {
+		children[sub] = newVectorPath(level-vectorBits, leaf)
+	}
+	return &vectorNode{children: children}
+}
+
+func newVectorPath(level uint, node *vectorNode) *vectorNode {
+	if level == 0 {
+		return node
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level-vectorBits, node)}}
+}
+
+// Pop returns the vector without its last element
+func (v *PersistentVector) Pop() (*PersistentVector, error) {
+	switch {
+	case v.count == 0:
+		return nil, NewExecutionError("can't pop empty vector")
+	case v.count == 1:
+		return &PersistentVector{shift: vectorBits, root: emptyVectorNode, meta: v.meta}, nil
+	case v.count-v.tailOffset() > 1:
+		// Conj copies the tail so it can be shared
+		return &PersistentVector{count: v.count - 1, shift: v.shift, root: v.root, tail: v.tail[:len(v.tail)-1], meta: v.meta}, nil
+	}
+	// the last leaf of the trie becomes the tail, the root loses a level when only one child is left
+	tail := v.leafFor(v.count - 2)
+	shift := v.shift
+	root := v.popTail(v.shift, v.root)
+	if root == nil {
+		root = emptyVectorNode
+	}
+	if shift > vectorBits && len(root.children) == 1 {
+		root = root.children[0]
+		shift -= vectorBits
+	}
+	return &PersistentVector{count: v.count - 1, shift: shift, root: root, tail: tail, meta: v.meta}, nil
+}
+
+// popTail returns a copy of node without the rightmost leaf or nil when nothing is left
+func (v *PersistentVector) popTail(level uint, node *vectorNode) *vectorNode {
+	sub := ((v.count - 2) >> level) & vectorMask
+	if level > vectorBits {
+		child := v.popTail(level-vectorBits, node.children[sub])
+		if child == nil && sub == 0 {
+			return nil
+		}
+		children := make([]*vectorNode, sub+1)
+		copy(children, node.children)
+		if child == nil {
+			return &vectorNode{children: children[:sub]}
+		}
+		children[sub] = child
+		return &vectorNode{children: children}
+	}
+	if sub == 0 {
+		return nil
+	}
+	children := make([]*vectorNode, sub)
+	copy(children, node.children)
+	return &vectorNode{children: children}
+}
+
+// Assoc returns a vector with element i replaced by val, i equal to the count appends
+func (v *PersistentVector) Assoc(i int, val Value) (*PersistentVector, error) {
+	if i == v.count {
+		return v.Conj(val), nil
+	}
+	if i < 0 || i > v.count {
+		return nil, NewExecutionError("index out of bounds")
+	}
+	if i >= v.tailOffset() {
+		tail := make([]Value, len(v.tail))
+		copy(tail, v.tail)
+		tail[i&vectorMask] = val
+		return &PersistentVector{count: v.count, shift: v.shift, root: v.root, tail: tail, meta: v.meta}, nil
+	}
+	return &PersistentVector{count: v.count, shift: v.shift, root: assocVectorNode(v.shift, v.root, i, val), tail: v.tail, meta: v.meta}, nil
+}
+
+// Meta implements Metadatable
+func (v *PersistentVector) Meta() Value { return metaOrNil(v.meta) }
+
+// WithMeta implements Metadatable
+func (v *PersistentVector) WithMeta(meta Value) Value {
+	c := *v
+	c.meta = meta
+	return &c
+}
+
+func assocVectorNode(level uint, node *vectorNode, i int, val Value) *vectorNode {
+	if level == 0 {
+		values := make([]Value, len(node.values))
+		copy(values, node.values)
+		values[i&vectorMask] = val
+		return &vectorNode{values: values}
+	}
+	children := make([]*vectorNode, len(node.children))
+	copy(children, node.children)
+	sub := (i >> level) & vectorMask
+	children[sub] = assocVectorNode(level-vectorBits, node.children[sub], i, val)
+	return &vectorNode{children: children}
+}
+
+// Type implements Value
+func (v *PersistentVector) Type() ValueType { return PersistentVectorType }
+
+// Unbox implements Value
+func (v *PersistentVector) Unbox() interface{} {
+	out, _ := AppendElements(make([]Value, 0, v.count), v)
+	return out
+}
+
+func (v *PersistentVector) seq() Seq {
+	if v.count == 0 {
+		return EmptyList
+	}
+	return &VectorSeq{vec: v, leaf: v.leafFor(0)}
+}
+
+// First implements Seq
+func (v *PersistentVector) First() Value {
+	return v.seq().First()
+}
+
+// Rest implements Seq
+func (v *PersistentVector) Rest() Seq {
+	return v.seq().Rest()
+}
+
+// Next implements Seq
+func (v *PersistentVector) Next() Seq {
+	return v.seq().Next()
+}
+
+// Cons implements Seq, like for ArrayVectors it appends
+func (v *PersistentVector) Cons(val Value) Seq {
+	return v.Conj(val)
+}
+
+// Count implements Collection
+func (v *PersistentVector) Count() Value {
+	return Int(v.count)
+}
+
+// Empty implements Collection
+func (v *PersistentVector) Empty() Collection {
+	return make(ArrayVector, 0)
+}
+
+// Equals implements Equaler
+func (v *PersistentVector) Equals(o Value) bool {
+	return seqEquals(v, o)
+}
+
+func (v *PersistentVector) String() string {
+	b := &strings.Builder{}
+	b.WriteRune('[')
+	for i := 0; i < v.count; i++ {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		e, _ := v.Nth(i)
+		b.WriteString(e.String())
+	}
+	b.WriteRune(']')
+	return b.String()
+}
+
+// VectorSeq walks a PersistentVector a leaf at a time
+type VectorSeq struct {
+	vec  *PersistentVector
+	leaf []Value
+	base int
+	off  int
+}
+
+// Type implements Value
+func (s *VectorSeq) Type() ValueType { return VectorSeqType }
+
+// Unbox implements Value
+func (s *VectorSeq) Unbox() interface{} {
+	vs, _ := AppendElements(nil, s)
+	return vs
+}
+
+// First implements Seq
+func (s *VectorSeq) First() Value {
+	return s.leaf[s.off]
+}
+
+// Rest implements Seq
+func (s *VectorSeq) Rest() Seq {
+	if s.off+1 < len(s.leaf) {
+		return &VectorSeq{vec: s.vec, leaf: s.leaf, base: s.base, off: s.off + 1}
+	}
+	base := s.base + len(s.leaf)
+	if base >= s.vec.count {
+		return EmptyList
+	}
+	return &VectorSeq{vec: s.vec, leaf: s.vec.leafFor(base), base: base}
+}
+
+// Next implements Seq
+func (s *VectorSeq) Next() Seq {
+	return nextOf(s)
+}
+
+// Cons implements Seq
+func (s *VectorSeq) Cons(val Value) Seq {
+	return NewCons(val, s)
+}
+
+// Count implements Collection
+func (s *VectorSeq) Count() Value {
+	return Int(s.vec.count - s.base - s.off)
+}
+
+// Empty implements Collection
+func (s *VectorSeq) Empty() Collection {
+	return EmptyList
+}
+
+// Equals implements Equaler
+func (s *VectorSeq) Equals(o Value) bool {
+	return seqEquals(s, o)
+}
+
+func (s *VectorSeq) String() string {
+	return seqString(s)
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "strings"
+
+type thePrimitiveVectorType struct{}
+
+func (t *thePrimitiveVectorType) Name() string { return "PrimitiveVector" }
+
+func (t *thePrimitiveVectorType) Box(bare interface{}) (Value, error) {
+	switch arr := bare.(type) {
+	case []int:
+		return &PrimitiveVector{kind: IntKind, ints: arr}, nil
+	case []float64:
+		return &PrimitiveVector{kind: FloatKind, floats: arr}, nil
+	}
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// PrimitiveVectorType is the type of PrimitiveVectors
+var PrimitiveVectorType *thePrimitiveVectorType
+
+func init() {
+	PrimitiveVectorType = &thePrimitiveVectorType{}
+}
+
+// PrimitiveKind is the type of elements of a PrimitiveVector
+type PrimitiveKind int
+
+const (
+	// IntKind vectors hold Ints as ints
+	IntKind PrimitiveKind = iota
+	// FloatKind vectors hold Floats as float64s, Ints put into them are converted
+	FloatKind
+)
+
+// PrimitiveKindOf maps the keywords vector-of takes to kinds
+func PrimitiveKindOf(k Keyword) (PrimitiveKind, bool) {
+	switch k {
+	case "int", "long", "short", "byte":
+		return IntKind, true
+	case "float", "double":
+		return FloatKind, true
+	}
+	return 0, false
+}
+
+// PrimitiveVector is a vector of numbers of one kind kept unboxed in a Go slice, so big numeric vectors take
+// a fraction of the memory and aren't made of one allocation per element. Elements are boxed when read.
+// Like ArrayVectors they copy on every update which makes them best built all at once.
+type PrimitiveVector struct {
+	kind   PrimitiveKind
+	ints   []int
+	floats []float64
+	meta   Value
+}
+
+// NewPrimitiveVector makes a vector of kind holding vs, which have to be numbers fitting the kind
+func NewPrimitiveVector(kind PrimitiveKind, vs []Value) (*PrimitiveVector, error) {
+	v := &PrimitiveVector{kind: kind}
+	trackAllocation(len(vs))
+	if kind == IntKind {
+		v.ints = make([]int, len(vs))
+	} else {
+		v.floats = make([]float64, len(vs))
+	}
+	for i := range vs {
+		if err := v.set(i, vs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *PrimitiveVector) set(i int, val Value) error {
+	var err error
+	if v.kind == IntKind {
+		v.ints[i], err = AsInt(val)
+	} else {
+		v.floats[i], err = AsFloat(val)
+	}
+	return err
+}
+
+// Kind returns the type of elements
+func (v *PrimitiveVector) Kind() PrimitiveKind { return v.kind }
+
+func (v *PrimitiveVector) len() int {
+	if v.kind == IntKind {
+		return len(v.ints)
+	}
+	return len(v.floats)
+}
+
+func (v *PrimitiveVector) slice(from int) *PrimitiveVector {
+	if v.kind == IntKind {
+		return &PrimitiveVector{kind: v.kind, ints: v.ints[from:]}
+	}
+	return &PrimitiveVector{kind: v.kind, floats: v.floats[from:]}
+}
+
+// Nth returns element i boxed or false when i is out of bounds
+func (v *PrimitiveVector) Nth(i int) (Value, bool) {
+	if i < 0 || i >= v.len() {
+		return NIL, false
+	}
+	if v.kind == IntKind {
+		return Int(v.ints[i]), true
+	}
+	return Float(v.floats[i]), true
+}
+
+// Conj returns a copy of the vector with val appended, it fails when val doesn't fit the kind
+func (v *PrimitiveVector) Conj(val Value) (*PrimitiveVector, error) {
+	n := v.len()
+	trackAllocation(n + 1)
+	out := &PrimitiveVector{kind: v.kind, meta: v.meta}
+	if v.kind == IntKind {
+		out.ints = make([]int, n+1)
+		copy(out.ints, v.ints)
+	} else {
+		out.floats = make([]float64, n+1)
+		copy(out.floats, v.floats)
+	}
+	if err := out.set(n, val); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Pop returns the vector without its last element
+func (v *PrimitiveVector) Pop() (*PrimitiveVector, error) {
+	n := v.len()
+	if n == 0 {
+		return nil, NewExecutionError("can't pop empty vector")
+	}
+	out := &PrimitiveVector{kind: v.kind, meta: v.meta}
+	// the capacity is cut so appending never writes into the original
+	if v.kind == IntKind {
+		out.ints = v.ints[: n-1 : n-1]
+	} else {
+		out.floats = v.floats[: n-1 : n-1]
+	}
+	return out, nil
+}
+
+// Type implements Value
+func (v *PrimitiveVector) Type() ValueType { return PrimitiveVectorType }
+
+// Unbox implements Value returning the backing []int or []float64, which must not be modified
+func (v *PrimitiveVector) Unbox() interface{} {
+	if v.kind == IntKind {
+		return v.ints
+	}
+	return v.floats
+}
+
+// First implements Seq
+func (v *PrimitiveVector) First() Value {
+	f, _ := v.Nth(0)
+	return f
+}
+
+// Rest implements Seq
+func (v *PrimitiveVector) Rest() Seq {
+	if v.len() == 0 {
+		return v.slice(0)
+	}
+	return v.slice(1)
+}
+
+// Next implements Seq
+func (v *PrimitiveVector) Next() Seq {
+	if v.len() <= 1 {
+		return nil
+	}
+	return v.slice(1)
+}
+
+// Cons implements Seq appending like for other vectors, values which don't fit the kind turn it into a boxed vector
+func (v *PrimitiveVector) Cons(val Value) Seq {
+	out, err := v.Conj(val)
+	if err != nil {
+		elems, _ := AppendElements(make([]Value, 0, v.len()+1), v)
+		return NewVector(append(elems, val)).(Seq)
+	}
+	return out
+}
+
+// Count implements Collection
+func (v *PrimitiveVector) Count() Value { return Int(v.len()) }
+
+// Empty implements Collection
+func (v *PrimitiveVector) Empty() Collection {
+	return &PrimitiveVector{kind: v.kind, ints: []int{}, floats: []float64{}}
+}
+
+// Equals implements Equaler
+func (v *PrimitiveVector) Equals(o Value) bool {
+	return seqEquals(v, o)
+}
+
+// Meta implements Metadatable
+func (v *PrimitiveVector) Meta() Value { return metaOrNil(v.meta) }
+
+// WithMeta implements Metadatable
+func (v *PrimitiveVector) WithMeta(meta Value) Value {
+	c := *v
+	c.meta = meta
+	return &c
+}
+
+// ValueAtOr implements Lookup
+func (v *PrimitiveVector) ValueAtOr(key Value, notFound Value) Value {
+	if i, ok := key.(Int); ok {
+		if e, ok := v.Nth(int(i)); ok {
+			return e
+		}
+	}
+	return notFound
+}
+
+// Invoke implements Fn, (v i) returns element i and fails when it's out of bounds
+func (v *PrimitiveVector) Invoke(args []Value) (Value, error) {
+	i, err := vectorIndex(v, v.len(), args)
+	if err != nil {
+		return NIL, err
+	}
+	e, _ := v.Nth(i)
+	return e, nil
+}
+
+// Arity implements Fn
+func (v *PrimitiveVector) Arity() int { return -1 }
+
+// ArityInfo implements Callable
+func (v *PrimitiveVector) ArityInfo() (int, int, bool) { return 1, 1, false }
+
+func (v *PrimitiveVector) String() string {
+	b := &strings.Builder{}
+	b.WriteRune('[')
+	for i := 0; i < v.len(); i++ {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		e, _ := v.Nth(i)
+		b.WriteString(e.String())
+	}
+	b.WriteRune(']')
+	return b.String()
+}
+
+// appendPrimitives boxes the elements of v onto dst
+func appendPrimitives(dst []Value, v *PrimitiveVector) []Value {
+	if v.kind == IntKind {
+		for _, x := range v.ints {
+			dst = append(dst, Int(x))
+		}
+		return dst
+	}
+	for _, x := range v.floats {
+		dst = append(dst, Float(x))
+	}
+	return dst
+}
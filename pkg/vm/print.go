@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "sort"
+
+// PrintSorted tells whether maps and sets print their contents in sorted order rather than iteration order,
+// which makes printing them reproducible. The runtime points it at *print-sorted*.
+var PrintSorted = func() bool { return false }
+
+// sortForPrinting sorts values in their natural order as far as Compare can tell, values it can't compare
+// are grouped by type and ordered by how they print, so the order is total
+func sortForPrinting(vs []Value) {
+	kind := func(v Value) string {
+		if IsNumber(v) {
+			return "Number"
+		}
+		return v.Type().Name()
+	}
+	sort.SliceStable(vs, func(i, j int) bool {
+		a, b := vs[i], vs[j]
+		if a == NIL || b == NIL {
+			return a == NIL && b != NIL
+		}
+		if ka, kb := kind(a), kind(b); ka != kb {
+			return ka < kb
+		}
+		if c, err := Compare(a, b); err == nil {
+			return c < 0
+		}
+		return a.String() < b.String()
+	})
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type theProtocolType struct{}
+
+func (t *theProtocolType) Name() string { return "Protocol" }
+
+func (t *theProtocolType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// ProtocolType is the type of Protocols
+var ProtocolType *theProtocolType
+
+func init() {
+	ProtocolType = &theProtocolType{}
+}
+
+// Protocol is a named set of methods which value types can implement, methods dispatch on
+// the type of their first argument. Types are identified by name, see TypeName.
+type Protocol struct {
+	name    string
+	methods []string
+	mu      sync.RWMutex
+	impls   map[string]map[string]Fn
+}
+
+func NewProtocol(name string, methods []string) *Protocol {
+	return &Protocol{
+		name:    name,
+		methods: methods,
+		impls:   map[string]map[string]Fn{},
+	}
+}
+
+// Type implements Value
+func (p *Protocol) Type() ValueType { return ProtocolType }
+
+// Unbox implements Value
+func (p *Protocol) Unbox() interface{} {
+	return p
+}
+
+func (p *Protocol) String() string {
+	return fmt.Sprintf("#<protocol %s [%s]>", p.name, strings.Join(p.methods, " "))
+}
+
+// Name returns the name of the protocol
+func (p *Protocol) Name() string {
+	return p.name
+}
+
+func (p *Protocol) hasMethod(method string) bool {
+	for _, m := range p.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Extend registers fn as the implementation of method for the type named typeName
+func (p *Protocol) Extend(typeName string, method string, fn Fn) error {
+	if !p.hasMethod(method) {
+		return NewExecutionError(fmt.Sprintf("%s is not a method of protocol %s", method, p.name))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.impls[typeName] == nil {
+		p.impls[typeName] = map[string]Fn{}
+	}
+	p.impls[typeName][method] = fn
+	return nil
+}
+
+// Satisfies tells whether the type of v has been extended with the protocol
+func (p *Protocol) Satisfies(v Value) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.impls[TypeName(v)] != nil
+}
+
+// Method returns a function calling the implementation of method for the type of its first argument
+func (p *Protocol) Method(method string) (Fn, error) {
+	if !p.hasMethod(method) {
+		return nil, NewExecutionError(fmt.Sprintf("%s is not a method of protocol %s", method, p.name))
+	}
+	fn, err := NativeFnType.Wrap(func(vs []Value) (Value, error) {
+		if len(vs) < 1 {
+			return NIL, NewExecutionError(fmt.Sprintf("wrong number of arguments (0) passed to %s", method))
+		}
+		typeName := TypeName(vs[0])
+		p.mu.RLock()
+		fn := p.impls[typeName][method]
+		p.mu.RUnlock()
+		if fn == nil {
+			return NIL, NewExecutionError(fmt.Sprintf("no implementation of method %s of protocol %s found for type %s", method, p.name, typeName))
+		}
+		return fn.Invoke(vs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// methods dispatch on their first argument so they need at least one
+	return fn.(*NativeFn).WithArity(2, true), nil
+}
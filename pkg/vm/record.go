@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type theRecordTypeType struct{}
+
+func (t *theRecordTypeType) Name() string { return "RecordType" }
+
+func (t *theRecordTypeType) Box(bare interface{}) (Value, error) {
+	return NIL, NewTypeError(bare, "can't be boxed as", t)
+}
+
+// RecordTypeType is the type of RecordTypes
+var RecordTypeType *theRecordTypeType
+
+func init() {
+	RecordTypeType = &theRecordTypeType{}
+}
+
+// RecordType is a named set of fields defined with defrecord. It's the ValueType of its records,
+// so protocols dispatch on records by the name of their type.
+type RecordType struct {
+	name   string
+	fields []Keyword
+}
+
+// NewRecordType makes a record type called name with fields, fields are looked up with keywords
+func NewRecordType(name string, fields []Keyword) *RecordType {
+	return &RecordType{name: name, fields: fields}
+}
+
+// Name implements ValueType
+func (t *RecordType) Name() string { return t.name }
+
+// Box implements ValueType, it makes a record of field values given in order
+func (t *RecordType) Box(bare interface{}) (Value, error) {
+	vals, ok := bare.([]Value)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return t.New(vals)
+}
+
+// Type implements Value
+func (t *RecordType) Type() ValueType { return RecordTypeType }
+
+// Unbox implements Value
+func (t *RecordType) Unbox() interface{} {
+	return t
+}
+
+func (t *RecordType) String() string {
+	names := make([]string, len(t.fields))
+	for i := range t.fields {
+		names[i] = string(t.fields[i])
+	}
+	return fmt.Sprintf("#<record-type %s [%s]>", t.name, strings.Join(names, " "))
+}
+
+// Fields returns keywords naming fields of the type
+func (t *RecordType) Fields() []Keyword {
+	return append([]Keyword{}, t.fields...)
+}
+
+func (t *RecordType) fieldIndex(key Value) int {
+	k, ok := key.(Keyword)
+	if !ok {
+		return -1
+	}
+	for i := range t.fields {
+		if t.fields[i] == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// New makes a record with vals of fields given in order
+func (t *RecordType) New(vals []Value) (*Record, error) {
+	if len(vals) != len(t.fields) {
+		return nil, NewExecutionError(fmt.Sprintf("wrong number of arguments (%d) passed to ->%s, expected %d", len(vals), t.name, len(t.fields)))
+	}
+	return &Record{rtype: t, vals: append([]Value{}, vals...)}, nil
+}
+
+// FromMap makes a record with fields taken from map m, fields missing from it are nil and
+// keys which aren't fields are kept in the record too
+func (t *RecordType) FromMap(m Value) (*Record, error) {
+	em, ok := m.(entryMap)
+	if !ok {
+		return nil, NewTypeError(m, "is not a map", nil)
+	}
+	r := &Record{rtype: t, vals: make([]Value, len(t.fields))}
+	for i := range r.vals {
+		r.vals[i] = NIL
+	}
+	em.eachEntry(func(k, v Value) bool {
+		if i := t.fieldIndex(k); i >= 0 {
+			r.vals[i] = v
+		} else {
+			r.ext = append(r.ext, k, v)
+		}
+		return true
+	})
+	return r, nil
+}
+
+// IsInstance tells if v is a record of the type
+func (t *RecordType) IsInstance(v Value) bool {
+	r, ok := v.(*Record)
+	return ok && r.rtype == t
+}
+
+// Record is a map with a fixed set of fields, see RecordType. Keys which aren't fields can be assoced
+// to records too, they are kept in insertion order after the fields.
+type Record struct {
+	rtype *RecordType
+	vals  []Value
+	ext   []Value
+	meta  Value
+}
+
+// Type implements Value
+func (r *Record) Type() ValueType { return r.rtype }
+
+// Unbox implements Value
+// Keys of the resulting Go map are compared with ==, so they must be comparable Go values.
+func (r *Record) Unbox() interface{} {
+	bare := make(map[Value]Value, len(r.vals)+len(r.ext)/2)
+	r.eachEntry(func(k, v Value) bool {
+		bare[k] = v
+		return true
+	})
+	return bare
+}
+
+func (r *Record) extIndex(key Value) int {
+	for i := 0; i < len(r.ext); i += 2 {
+		if Equal(r.ext[i], key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Record) lookup(key Value) (Value, bool) {
+	if i := r.rtype.fieldIndex(key); i >= 0 {
+		return r.vals[i], true
+	}
+	if i := r.extIndex(key); i >= 0 {
+		return r.ext[i+1], true
+	}
+	return nil, false
+}
+
+func (r *Record) eachEntry(f func(k, v Value) bool) bool {
+	for i := range r.vals {
+		if !f(r.rtype.fields[i], r.vals[i]) {
+			return false
+		}
+	}
+	for i := 0; i < len(r.ext); i += 2 {
+		if !f(r.ext[i], r.ext[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValueAtOr implements Lookup
+func (r *Record) ValueAtOr(key Value, notFound Value) Value {
+	if v, ok := r.lookup(key); ok {
+		return v
+	}
+	return notFound
+}
+
+// Contains tells whether key is a field of the record or has been assoced to it
+func (r *Record) Contains(key Value) bool {
+	_, ok := r.lookup(key)
+	return ok
+}
+
+// Count implements Counted
+func (r *Record) Count() Value {
+	return Int(len(r.vals) + len(r.ext)/2)
+}
+
+// Equals implements Equaler, records are only equal to records of the same type
+func (r *Record) Equals(o Value) bool {
+	return mapEquals(r, o)
+}
+
+// Meta implements Metadatable
+func (r *Record) Meta() Value { return metaOrNil(r.meta) }
+
+// WithMeta implements Metadatable
+func (r *Record) WithMeta(meta Value) Value {
+	return &Record{rtype: r.rtype, vals: r.vals, ext: r.ext, meta: meta}
+}
+
+func (r *Record) String() string {
+	return "#" + r.rtype.name + mapString(r)
+}
+
+// Assoc returns a record of the same type with key mapped to val, keys which aren't fields are kept as extra entries
+func (r *Record) Assoc(key Value, val Value) *Record {
+	out := &Record{rtype: r.rtype, vals: r.vals, ext: r.ext, meta: r.meta}
+	if i := r.rtype.fieldIndex(key); i >= 0 {
+		out.vals = append([]Value{}, r.vals...)
+		out.vals[i] = val
+		return out
+	}
+	if i := r.extIndex(key); i >= 0 {
+		out.ext = append([]Value{}, r.ext...)
+		out.ext[i+1] = val
+		return out
+	}
+	trackAllocation(2)
+	out.ext = append(append(make([]Value, 0, len(r.ext)+2), r.ext...), key, val)
+	return out
+}
+
+// Dissoc returns the record without key. Removing an extra entry keeps it a record but a record
+// missing one of its fields is no longer one, so removing a field gives a plain map of the remaining entries.
+func (r *Record) Dissoc(key Value) Value {
+	if i := r.extIndex(key); i >= 0 {
+		ext := make([]Value, 0, len(r.ext)-2)
+		ext = append(ext, r.ext[:i]...)
+		return &Record{rtype: r.rtype, vals: r.vals, ext: append(ext, r.ext[i+2:]...), meta: r.meta}
+	}
+	if r.rtype.fieldIndex(key) < 0 {
+		return r
+	}
+	var out Value = EmptyArrayMap
+	r.eachEntry(func(k, v Value) bool {
+		if !Equal(k, key) {
+			out = assocMap(out, k, v)
+		}
+		return true
+	})
+	if r.meta != nil {
+		out = out.(Metadatable).WithMeta(r.meta)
+	}
+	return out
+}
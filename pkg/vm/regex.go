@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"regexp"
+)
+
+type theRegexType struct{}
+
+func (t *theRegexType) Name() string { return "Regex" }
+
+func (t *theRegexType) Box(bare interface{}) (Value, error) {
+	re, ok := bare.(*regexp.Regexp)
+	if !ok {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	return &Regex{re: re}, nil
+}
+
+// RegexType is the type of Regexes
+var RegexType *theRegexType
+
+func init() {
+	RegexType = &theRegexType{}
+}
+
+// Regex is a compiled regular expression using Go's RE2 syntax.
+// Like in Clojure, two regexes are only equal when they are the same object.
+type Regex struct {
+	re *regexp.Regexp
+}
+
+// NewRegex compiles pattern into a Regex
+func NewRegex(pattern string) (*Regex, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Regex{re: re}, nil
+}
+
+// Type implements Value
+func (r *Regex) Type() ValueType { return RegexType }
+
+// Unbox implements Value
+func (r *Regex) Unbox() interface{} {
+	return r.re
+}
+
+// Regexp returns the underlying *regexp.Regexp
+func (r *Regex) Regexp() *regexp.Regexp {
+	return r.re
+}
+
+func (r *Regex) String() string {
+	return "#\"" + r.re.String() + "\""
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// runState is shared by a frame run with RunWithContext and the frames of let-go functions it calls,
+// including ones called back from natives and ones running in futures started by them
+type runState struct {
+	ctx    context.Context
+	done   <-chan struct{}
+	budget *InstructionBudget
+	// debug is called before each instruction while stepping
+	debug    DebugHook
+	stepping bool
+}
+
+// InstructionBudget caps the number of instructions executed by runs it's passed to.
+// One budget can be shared by many runs, also concurrent ones.
+type InstructionBudget struct {
+	remaining int64
+}
+
+// NewInstructionBudget makes a budget allowing n instructions
+func NewInstructionBudget(n int) *InstructionBudget {
+	return &InstructionBudget{remaining: int64(n)}
+}
+
+// Remaining returns how many instructions can still be executed
+func (b *InstructionBudget) Remaining() int {
+	if r := atomic.LoadInt64(&b.remaining); r > 0 {
+		return int(r)
+	}
+	return 0
+}
+
+// tick accounts for one executed instruction
+func (s *runState) tick() error {
+	if s.budget == nil {
+		return nil
+	}
+	if atomic.AddInt64(&s.budget.remaining, -1) < 0 {
+		return NewExecutionError("instruction budget exceeded")
+	}
+	return nil
+}
+
+// check returns an error if the run was cancelled
+func (s *runState) check() error {
+	select {
+	case <-s.done:
+		return NewExecutionError("execution cancelled").Wrap(s.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// RunWithContext runs the frame like Run but stops with an error once ctx is cancelled.
+// Cancellation is checked on backward jumps and calls to let-go functions, whether they're called from bytecode,
+// called back from natives like map or reduce or run in futures started meanwhile.
+func (f *Frame) RunWithContext(ctx context.Context) (Value, error) {
+	return f.runWith(&runState{ctx: ctx, done: ctx.Done()})
+}
+
+// RunWithBudget runs the frame like RunWithContext and additionally aborts with an error once the budget
+// runs out. Instructions of all let-go functions the run calls are paid from the same budget.
+func (f *Frame) RunWithBudget(ctx context.Context, budget *InstructionBudget) (Value, error) {
+	return f.runWith(&runState{ctx: ctx, done: ctx.Done(), budget: budget})
+}
+
+// runWith runs the frame as part of state, which the goroutine's state carries to functions called from natives
+func (f *Frame) runWith(state *runState) (Value, error) {
+	f.state = state
+	if err := state.check(); err != nil {
+		return NIL, err
+	}
+	g := enterState()
+	outer := g.run
+	g.run = state
+	defer func() {
+		g.run = outer
+		g.leave()
+	}()
+	return f.Run()
+}
+
+// invoke calls fn passing the run state on to let-go functions
+func (f *Frame) invoke(fn Fn, args []Value) (Value, error) {
+	if f.state == nil {
+		return fn.Invoke(args)
+	}
+	fun, ok := fn.(*Func)
+	if !ok {
+		return fn.Invoke(args)
+	}
+	if err := f.state.check(); err != nil {
+		return NIL, err
+	}
+	return fun.invoke(f.state, args)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "strings"
+
+// EmptyChecker is implemented by sequences which can't count their elements cheaply,
+// like lazy ones, but can tell whether they are empty
+type EmptyChecker interface {
+	IsEmpty() bool
+}
+
+// IsEmpty tells whether sequence s has no elements
+func IsEmpty(s Seq) bool {
+	return seqEmpty(s)
+}
+
+// nextOf implements Seq.Next in terms of Rest
+func nextOf(s Seq) Seq {
+	r := s.Rest()
+	if seqEmpty(r) {
+		return nil
+	}
+	return r
+}
+
+// seqString prints a sequence like a list
+func seqString(s Seq) string {
+	b := &strings.Builder{}
+	b.WriteRune('(')
+	for i := 0; !seqEmpty(s); i++ {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteString(s.First().String())
+		s = s.Rest()
+	}
+	b.WriteRune(')')
+	return b.String()
+}
+
+// AppendElements appends elements of collection coll to dst.
+// Strings yield their characters and maps yield MapEntries, nil has no elements.
+func AppendElements(dst []Value, coll Value) ([]Value, error) {
+	switch c := coll.(type) {
+	case *Nil:
+		return dst, nil
+	case ArrayVector:
+		return append(dst, c...), nil
+	case *PersistentVector:
+		for i := 0; i < c.count; i += vectorWidth {
+			dst = append(dst, c.leafFor(i)...)
+		}
+		return dst, nil
+	case *PrimitiveVector:
+		return appendPrimitives(dst, c), nil
+	case MapEntry:
+		return append(dst, c.key, c.val), nil
+	case *Set:
+		return append(dst, c.m.Keys()...), nil
+	case entryMap:
+		return mapEntries(dst, c), nil
+	case String:
+		for _, r := range string(c) {
+			dst = append(dst, Char(r))
+		}
+		return dst, nil
+	case Seq:
+		for s := c; ; s = s.Rest() {
+			if err := SeqError(s); err != nil {
+				return dst, err
+			}
+			if seqEmpty(s) {
+				return dst, nil
+			}
+			dst = append(dst, s.First())
+		}
+	default:
+		return dst, NewTypeError(coll, "is not a collection", nil)
+	}
+}
+
+// collectionSize is a cheap guess of how many elements coll has, used to presize slices
+func collectionSize(coll Value) int {
+	if c, ok := coll.(Collection); ok {
+		if n, ok := c.Count().(Int); ok {
+			return int(n)
+		}
+	}
+	return 0
+}
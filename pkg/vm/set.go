@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import "strings"
+
+type theSetType struct{}
+
+func (st *theSetType) Name() string { return "Set" }
+
+func (st *theSetType) Box(bare interface{}) (Value, error) {
+	arr, ok := bare.([]Value)
+	if !ok {
+		return EmptySet, NewTypeError(bare, "can't be boxed as", st)
+	}
+	ret := EmptySet
+	for i := range arr {
+		ret = ret.Conj(arr[i])
+	}
+	return ret, nil
+}
+
+// SetType is the type of Sets
+var SetType *theSetType
+
+// EmptySet is an empty Set
+var EmptySet *Set
+
+func init() {
+	SetType = &theSetType{}
+	EmptySet = &Set{m: EmptyMap}
+}
+
+// Set is a boxed collection of distinct values.
+// It's a Map from each element to itself so updates and membership tests are O(log32 n) like for Maps.
+type Set struct {
+	m    *Map
+	meta Value
+}
+
+// Type implements Value
+func (s *Set) Type() ValueType { return SetType }
+
+// Unbox implements Value
+func (s *Set) Unbox() interface{} {
+	return []Value(s.m.Keys())
+}
+
+// Conj returns a new Set with val added
+func (s *Set) Conj(val Value) *Set {
+	if s.m.Contains(val) {
+		return s
+	}
+	return &Set{m: s.m.Assoc(val, val), meta: s.meta}
+}
+
+// Disj returns a new Set without val
+func (s *Set) Disj(val Value) *Set {
+	m := s.m.Dissoc(val)
+	if m == s.m {
+		return s
+	}
+	return &Set{m: m, meta: s.meta}
+}
+
+// Meta implements Metadatable
+func (s *Set) Meta() Value { return metaOrNil(s.meta) }
+
+// WithMeta implements Metadatable
+func (s *Set) WithMeta(meta Value) Value {
+	return &Set{m: s.m, meta: meta}
+}
+
+// Contains tells whether val is a member of the Set
+func (s *Set) Contains(val Value) bool {
+	return s.m.Contains(val)
+}
+
+// Count implements Collection
+func (s *Set) Count() Value {
+	return s.m.Count()
+}
+
+// Empty implements Collection
+func (s *Set) Empty() Collection {
+	return EmptySet
+}
+
+// each calls f with every element until it returns false
+func (s *Set) each(f func(e Value) bool) bool {
+	return s.m.eachEntry(func(k, _ Value) bool { return f(k) })
+}
+
+// Equals implements Equaler
+func (s *Set) Equals(o Value) bool {
+	os, ok := o.(*Set)
+	if !ok || s.m.count != os.m.count {
+		return false
+	}
+	return s.each(os.Contains)
+}
+
+func (s *Set) String() string {
+	b := &strings.Builder{}
+	b.WriteString("#{")
+	elems := s.m.Keys()
+	if PrintSorted() {
+		sortForPrinting(elems)
+	}
+	for i := range elems {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteString(elems[i].String())
+	}
+	b.WriteRune('}')
+	return b.String()
+}
+
+func NewSet(vs []Value) Value {
+	s, err := SetType.Box(vs)
+	if err != nil {
+		return EmptySet
+	}
+	return s
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+type theSortedMapType struct{}
+
+func (t *theSortedMapType) Name() string { return "SortedMap" }
+
+func (t *theSortedMapType) Box(bare interface{}) (Value, error) {
+	arr, ok := bare.([]Value)
+	if !ok || len(arr)%2 != 0 {
+		return NIL, NewTypeError(bare, "can't be boxed as", t)
+	}
+	ret := NewSortedMap(Compare)
+	for i := 0; i < len(arr); i += 2 {
+		var err error
+		ret, err = ret.Assoc(arr[i], arr[i+1])
+		if err != nil {
+			return NIL, err
+		}
+	}
+	return ret, nil
+}
+
+// SortedMapType is the type of SortedMaps
+var SortedMapType *theSortedMapType
+
+func init() {
+	SortedMapType = &theSortedMapType{}
+}
+
+// Comparator orders two values like Compare
+type Comparator func(a Value, b Value) (int, error)
+
+// SortedMap is an associative collection keeping its entries ordered by key.
+// It's a persistent AVL tree so updates are O(log n) and copy only the path to the changed entry.
+type SortedMap struct {
+	count int
+	root  *sortedNode
+	cmp   Comparator
+	meta  Value
+}
+
+type sortedNode struct {
+	key    Value
+	val    Value
+	left   *sortedNode
+	right  *sortedNode
+	height int
+}
+
+// NewSortedMap makes an empty SortedMap ordering keys with cmp
+func NewSortedMap(cmp Comparator) *SortedMap {
+	return &SortedMap{cmp: cmp}
+}
+
+// Comparator returns the function ordering the keys
+func (m *SortedMap) Comparator() Comparator {
+	return m.cmp
+}
+
+func (n *sortedNode) h() int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func makeSortedNode(key Value, val Value, left *sortedNode, right *sortedNode) *sortedNode {
+	h := left.h()
+	if right.h() > h {
+		h = right.h()
+	}
+	return &sortedNode{key: key, val: val, left: left, right: right, height: h + 1}
+}
+
+// balanceSortedNode makes a node out of parts whose heights differ by at most 2, rotating when needed
+func balanceSortedNode(key Value, val Value, left *sortedNode, right *sortedNode) *sortedNode {
+	switch {
+	case left.h() > right.h()+1:
+		if left.left.h() >= left.right.h() {
+			return makeSortedNode(left.key, left.val, left.left, makeSortedNode(key, val, left.right, right))
+		}
+		lr := left.right
+		return makeSortedNode(lr.key, lr.val, makeSortedNode(left.key, left.val, left.left, lr.left), makeSortedNode(key, val, lr.right, right))
+	case right.h() > left.h()+1:
+		if right.right.h() >= right.left.h() {
+			return makeSortedNode(right.key, right.val, makeSortedNode(key, val, left, right.left), right.right)
+		}
+		rl := right.left
+		return makeSortedNode(rl.key, rl.val, makeSortedNode(key, val, left, rl.left), makeSortedNode(right.key, right.val, rl.right, right.right))
+	}
+	return makeSortedNode(key, val, left, right)
+}
+
+func (m *SortedMap) insert(n *sortedNode, key Value, val Value) (*sortedNode, bool, error) {
+	if n == nil {
+		return makeSortedNode(key, val, nil, nil), true, nil
+	}
+	c, err := m.cmp(key, n.key)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case c < 0:
+		left, added, err := m.insert(n.left, key, val)
+		if err != nil {
+			return nil, false, err
+		}
+		return balanceSortedNode(n.key, n.val, left, n.right), added, nil
+	case c > 0:
+		right, added, err := m.insert(n.right, key, val)
+		if err != nil {
+			return nil, false, err
+		}
+		return balanceSortedNode(n.key, n.val, n.left, right), added, nil
+	}
+	return makeSortedNode(n.key, val, n.left, n.right), false, nil
+}
+
+// removeMin returns n without its leftmost node, which is returned too
+func removeMin(n *sortedNode) (*sortedNode, *sortedNode) {
+	if n.left == nil {
+		return n.right, n
+	}
+	left, min := removeMin(n.left)
+	return balanceSortedNode(n.key, n.val, left, n.right), min
+}
+
+func (m *SortedMap) remove(n *sortedNode, key Value) (*sortedNode, bool, error) {
+	if n == nil {
+		return nil, false, nil
+	}
+	c, err := m.cmp(key, n.key)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case c < 0:
+		left, removed, err := m.remove(n.left, key)
+		if err != nil || !removed {
+			return n, false, err
+		}
+		return balanceSortedNode(n.key, n.val, left, n.right), true, nil
+	case c > 0:
+		right, removed, err := m.remove(n.right, key)
+		if err != nil || !removed {
+			return n, false, err
+		}
+		return balanceSortedNode(n.key, n.val, n.left, right), true, nil
+	}
+	if n.right == nil {
+		return n.left, true, nil
+	}
+	right, min := removeMin(n.right)
+	return balanceSortedNode(min.key, min.val, n.left, right), true, nil
+}
+
+// Assoc returns a new SortedMap with key mapped to val, it fails when key can't be compared with the other keys
+func (m *SortedMap) Assoc(key Value, val Value) (*SortedMap, error) {
+	root, added, err := m.insert(m.root, key, val)
+	if err != nil {
+		return nil, err
+	}
+	count := m.count
+	if added {
+		trackAllocation(2)
+		count++
+	}
+	return &SortedMap{count: count, root: root, cmp: m.cmp, meta: m.meta}, nil
+}
+
+// Dissoc returns a new SortedMap without key
+func (m *SortedMap) Dissoc(key Value) (*SortedMap, error) {
+	root, removed, err := m.remove(m.root, key)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return m, nil
+	}
+	return &SortedMap{count: m.count - 1, root: root, cmp: m.cmp, meta: m.meta}, nil
+}
+
+// Meta implements Metadatable
+func (m *SortedMap) Meta() Value { return metaOrNil(m.meta) }
+
+// WithMeta implements Metadatable
+func (m *SortedMap) WithMeta(meta Value) Value {
+	return &SortedMap{count: m.count, root: m.root, cmp: m.cmp, meta: meta}
+}
+
+// Lookup finds the value mapped to key
+func (m *SortedMap) Lookup(key Value) (Value, bool, error) {
+	n := m.root
+	for n != nil {
+		c, err := m.cmp(key, n.key)
+		if err != nil {
+			return NIL, false, err
+		}
+		switch {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n.val, true, nil
+		}
+	}
+	return NIL, false, nil
+}
+
+// ValueAtOr returns the value mapped to key or dflt if there is no such key or it can't be compared with the keys
+func (m *SortedMap) ValueAtOr(key Value, dflt Value) Value {
+	v, ok, err := m.Lookup(key)
+	if !ok || err != nil {
+		return dflt
+	}
+	return v
+}
+
+// Contains tells whether key is present in the SortedMap
+func (m *SortedMap) Contains(key Value) bool {
+	_, ok, _ := m.Lookup(key)
+	return ok
+}
+
+// walk calls f with entries in ascending or descending key order until it returns false
+func (n *sortedNode) walk(ascending bool, f func(n *sortedNode) bool) bool {
+	if n == nil {
+		return true
+	}
+	first, second := n.left, n.right
+	if !ascending {
+		first, second = second, first
+	}
+	return first.walk(ascending, f) && f(n) && second.walk(ascending, f)
+}
+
+// Range returns MapEntries for which keep is true, in ascending or descending key order.
+// The keys kept must be consecutive, like the ones on one side of a bound, the walk stops after the last one.
+func (m *SortedMap) Range(ascending bool, keep func(key Value) (bool, error)) ([]Value, error) {
+	var out []Value
+	var err error
+	m.root.walk(ascending, func(n *sortedNode) bool {
+		var ok bool
+		ok, err = keep(n.key)
+		if err != nil || (!ok && out != nil) {
+			return false
+		}
+		if ok {
+			out = append(out, NewMapEntry(n.key, n.val))
+		}
+		return true
+	})
+	return out, err
+}
+
+// Type implements Value
+func (m *SortedMap) Type() ValueType { return SortedMapType }
+
+// Unbox implements Value
+func (m *SortedMap) Unbox() interface{} {
+	bare := make(map[Value]Value, m.count)
+	m.root.walk(true, func(n *sortedNode) bool {
+		bare[n.key] = n.val
+		return true
+	})
+	return bare
+}
+
+// Count implements Collection
+func (m *SortedMap) Count() Value {
+	return Int(m.count)
+}
+
+// Empty implements Collection, the empty map keeps the ordering
+func (m *SortedMap) Empty() Collection {
+	return NewSortedMap(m.cmp)
+}
+
+// Equals implements Equaler, sorted maps are equal to any map with the same entries
+func (m *SortedMap) Equals(o Value) bool {
+	return mapEquals(m, o)
+}
+
+func (m *SortedMap) lookup(key Value) (Value, bool) {
+	v, ok, err := m.Lookup(key)
+	return v, ok && err == nil
+}
+
+func (m *SortedMap) eachEntry(f func(k, v Value) bool) bool {
+	return m.root.walk(true, func(n *sortedNode) bool {
+		return f(n.key, n.val)
+	})
+}
+
+func (m *SortedMap) String() string {
+	return mapString(m)
+}
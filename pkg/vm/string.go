@@ -17,7 +17,12 @@
 
 package vm
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type theStringType struct {
 	zero String
@@ -51,6 +56,38 @@ func (l String) Unbox() interface{} {
 	return string(l)
 }
 
+// Count implements Counted, strings are counted in characters
+func (l String) Count() Value {
+	return Int(utf8.RuneCountInString(string(l)))
+}
+
+// String prints the string the way the reader reads it back, control characters are written as \u escapes
 func (l String) String() string {
-	return fmt.Sprintf("%q", string(l))
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range string(l) {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&b, "\\u%04x", r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
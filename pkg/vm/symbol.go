@@ -17,7 +17,10 @@
 
 package vm
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type theSymbolType struct {
 	zero Symbol
@@ -54,3 +57,14 @@ func (l Symbol) Unbox() interface{} {
 func (l Symbol) String() string {
 	return fmt.Sprintf("%s", string(l))
 }
+
+// Namespaced splits a qualified symbol like foo/bar into its namespace and name parts.
+// The namespace part is empty for unqualified symbols.
+func (l Symbol) Namespaced() (string, string) {
+	s := string(l)
+	i := strings.IndexRune(s, '/')
+	if i <= 0 || i == len(s)-1 {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
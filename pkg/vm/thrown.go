@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/nooga/let-go/pkg/errors"
+)
+
+// Thrown is an error carrying an arbitrary LETGO value raised with throw
+type Thrown struct {
+	value Value
+	cause error
+}
+
+// NewThrown creates an error carrying value
+func NewThrown(value Value) *Thrown {
+	return &Thrown{value: value}
+}
+
+// Value returns the thrown value
+func (t *Thrown) Value() Value {
+	return t.value
+}
+
+// Error implements error
+func (t *Thrown) Error() string {
+	msg := t.value.String()
+	if s, ok := t.value.(String); ok {
+		msg = string(s)
+	}
+	return errors.AddCause(t, fmt.Sprintf("Thrown: %s", msg))
+}
+
+func (t *Thrown) Wrap(e error) errors.Error {
+	t.cause = e
+	return t
+}
+
+func (t *Thrown) GetCause() error {
+	return t.cause
+}
+
+// ErrorValue turns an error into a value which can be bound in a catch clause.
+// Values raised with throw are returned as they are, other errors are boxed.
+func ErrorValue(err error) Value {
+	for e := err; e != nil; {
+		if t, ok := e.(*Thrown); ok {
+			return t.value
+		}
+		ee, ok := e.(errors.Error)
+		if !ok {
+			break
+		}
+		e = ee.GetCause()
+	}
+	return NewBoxed(err)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package vm
+
+// Natives receive their arguments as Values and have to check them before unboxing, a bare type assertion like
+// v.Unbox().(int) panics on anything else. These helpers do the check and return a TypeError naming the value
+// which was passed instead.
+
+// AsInt returns the integer held by v
+func AsInt(v Value) (int, error) {
+	i, ok := v.(Int)
+	if !ok {
+		return 0, NewTypeError(v, "is not an integer", IntType)
+	}
+	return int(i), nil
+}
+
+// AsFloat returns v as a float64, Ints are promoted
+func AsFloat(v Value) (float64, error) {
+	switch n := v.(type) {
+	case Int:
+		return float64(n), nil
+	case Float:
+		return float64(n), nil
+	}
+	return 0, NewTypeError(v, "is not a number", nil)
+}
+
+// AsString returns the string held by v
+func AsString(v Value) (string, error) {
+	s, ok := v.(String)
+	if !ok {
+		return "", NewTypeError(v, "is not a string", StringType)
+	}
+	return string(s), nil
+}
+
+// AsFn returns v as a function it can be called as
+func AsFn(v Value) (Fn, error) {
+	f, ok := v.(Fn)
+	if !ok {
+		return nil, NewTypeError(v, "is not a function", nil)
+	}
+	return f, nil
+}
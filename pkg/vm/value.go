@@ -28,35 +28,68 @@ type ValueType interface {
 	Box(interface{}) (Value, error)
 }
 
-// Value is implemented by all LETGO values
+// Value is implemented by all LETGO values.
+// Unbox returns the bare Go value behind it, its Go type depends on the type of the Value so it should only be
+// asserted after checking Type() or with the As* helpers which report a mismatch as an error instead of panicking.
 type Value interface {
 	fmt.Stringer
 	Type() ValueType
 	Unbox() interface{}
 }
 
-// Seq is implemented by all sequence-like values
+// Seq is implemented by all sequence-like values.
+// Rest returns the elements after the first one and is empty, never nil, when there are none.
+// Next is like Rest but returns nil instead of an empty sequence, which may realize an element of a lazy one.
 type Seq interface {
 	Value
 	Cons(Value) Seq
 	First() Value
-	More() Seq
+	Rest() Seq
 	Next() Seq
 }
 
+// Counted is implemented by values which know their number of elements without walking them
+type Counted interface {
+	Count() Value
+}
+
 // Collection is implemented by all collections
 type Collection interface {
 	Value
-	Count() Value
+	Counted
 	Empty() Collection
 }
 
+// Fn is implemented by all callable values.
+// Invoke must not modify the argument slice, it belongs to the caller.
 type Fn interface {
 	Value
-	Invoke([]Value) Value
+	Invoke([]Value) (Value, error)
 	Arity() int
 }
 
+// Callable is implemented by functions which know up front how many arguments they accept,
+// max is -1 when there is no upper bound
+type Callable interface {
+	Fn
+	ArityInfo() (min int, max int, variadic bool)
+}
+
+// Metadatable is implemented by values that can carry a metadata map
+type Metadatable interface {
+	Value
+	Meta() Value
+	WithMeta(meta Value) Value
+}
+
+// metaOrNil returns the metadata stored by a collection, NIL if it has none
+func metaOrNil(meta Value) Value {
+	if meta == nil {
+		return NIL
+	}
+	return meta
+}
+
 func BoxValue(v reflect.Value) (Value, error) {
 	if v.CanInterface() {
 		rv, ok := v.Interface().(Value)
@@ -67,6 +100,8 @@ func BoxValue(v reflect.Value) (Value, error) {
 	switch v.Type().Kind() {
 	case reflect.Int:
 		return IntType.Box(v.Interface())
+	case reflect.Float64, reflect.Float32:
+		return FloatType.Box(v.Interface())
 	case reflect.String:
 		return StringType.Box(v.Interface())
 	case reflect.Bool:
@@ -104,6 +139,8 @@ func BoxValue(v reflect.Value) (Value, error) {
 	}
 }
 
+// IsTruthy is the truthiness rule of branching, only nil and false are falsy while
+// everything else including 0, "" and empty collections is truthy
 func IsTruthy(v Value) bool {
 	return !(v == NIL || v == FALSE)
 }
@@ -17,20 +17,27 @@
 
 package vm
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 type Var struct {
-	root    Value
-	nsref   *Namespace
-	ns      string
-	name    string
-	isMacro bool
+	root      Value
+	nsref     *Namespace
+	ns        string
+	name      string
+	isMacro   bool
+	isDynamic bool
+	isBound   bool
+	// bindings counts dynamic bindings of the Var on all goroutines, while there are none derefs skip looking them up
+	bindings int32
 }
 
-func (v *Var) Invoke(values []Value) Value {
+func (v *Var) Invoke(values []Value) (Value, error) {
 	f, ok := v.root.(Fn)
 	if !ok {
-		return NIL // FIXME this should be an error
+		return NIL, NewTypeError(v.root, "is not a function", nil)
 	}
 	return f.Invoke(values)
 }
@@ -43,6 +50,15 @@ func (v *Var) Arity() int {
 	return f.Arity()
 }
 
+// ArityInfo implements Callable by asking the function the var is bound to
+func (v *Var) ArityInfo() (int, int, bool) {
+	f, ok := v.root.(Fn)
+	if !ok {
+		return 0, -1, true
+	}
+	return ArityOf(f)
+}
+
 func NewVar(nsref *Namespace, ns string, name string) *Var {
 	return &Var{
 		nsref:   nsref,
@@ -53,15 +69,91 @@ func NewVar(nsref *Namespace, ns string, name string) *Var {
 	}
 }
 
+// NewLocalVar makes a dynamic Var which doesn't belong to any namespace, with-local-vars binds these
+func NewLocalVar(name string) *Var {
+	v := NewVar(nil, "", name)
+	v.isDynamic = true
+	return v
+}
+
 func (v *Var) SetRoot(val Value) *Var {
 	v.root = val
+	v.isBound = true
 	return v
 }
 
+// IsBound tells whether the Var has a root value or a dynamic binding, unbound vars deref to nil
+func (v *Var) IsBound() bool {
+	return v.isBound || len(v.goroutineBindings()) > 0
+}
+
+// Root returns the root value of the Var ignoring dynamic bindings
+func (v *Var) Root() Value {
+	return v.root
+}
+
+// goroutineBindings returns the dynamic bindings of the Var made on the calling goroutine, innermost last
+func (v *Var) goroutineBindings() []Value {
+	if atomic.LoadInt32(&v.bindings) == 0 {
+		return nil
+	}
+	if s := currentState(); s != nil {
+		return s.bindings[v]
+	}
+	return nil
+}
+
+// Deref returns the innermost dynamic binding of the Var or its root if there are no bindings
 func (v *Var) Deref() Value {
+	if b := v.goroutineBindings(); len(b) > 0 {
+		return b[len(b)-1]
+	}
 	return v.root
 }
 
+// PushBinding establishes a new dynamic binding shadowing the current value until PopBinding is called.
+// Like in Clojure bindings are local to the goroutine making them, futures and agent actions it starts get a copy.
+func (v *Var) PushBinding(val Value) error {
+	if !v.isDynamic {
+		return NewExecutionError(fmt.Sprintf("can't dynamically bind non-dynamic var %s", v))
+	}
+	s := enterState()
+	s.bindings[v] = append(s.bindings[v], val)
+	atomic.AddInt32(&v.bindings, 1)
+	return nil
+}
+
+// SetBinding replaces the innermost dynamic binding, it fails when the Var isn't dynamically bound
+func (v *Var) SetBinding(val Value) error {
+	b := v.goroutineBindings()
+	if len(b) == 0 {
+		return NewExecutionError(fmt.Sprintf("can't set %s, it's not dynamically bound", v))
+	}
+	b[len(b)-1] = val
+	return nil
+}
+
+// PopBinding removes the innermost dynamic binding
+func (v *Var) PopBinding() {
+	s := currentState()
+	if s == nil {
+		return
+	}
+	b := s.bindings[v]
+	n := len(b)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		delete(s.bindings, v)
+	} else {
+		b[n-1] = nil
+		s.bindings[v] = b[:n-1]
+	}
+	atomic.AddInt32(&v.bindings, -1)
+	s.leave()
+}
+
 func (v *Var) Type() ValueType {
 	return v.Deref().Type()
 }
@@ -71,9 +163,22 @@ func (v *Var) Unbox() interface{} {
 }
 
 func (v *Var) String() string {
+	if v.nsref == nil {
+		return fmt.Sprintf("#<local-var %s>", v.name)
+	}
 	return fmt.Sprintf("#'%s/%s", v.ns, v.name)
 }
 
+// Name returns the unqualified name of the Var
+func (v *Var) Name() string {
+	return v.name
+}
+
+// NSName returns the name of the namespace the Var belongs to
+func (v *Var) NSName() string {
+	return v.ns
+}
+
 func (v *Var) IsMacro() bool {
 	return v.isMacro
 }
@@ -81,3 +186,12 @@ func (v *Var) IsMacro() bool {
 func (v *Var) SetMacro() {
 	v.isMacro = true
 }
+
+func (v *Var) IsDynamic() bool {
+	return v.isDynamic
+}
+
+func (v *Var) SetDynamic() *Var {
+	v.isDynamic = true
+	return v
+}
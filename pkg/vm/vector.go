@@ -60,8 +60,8 @@ func (l ArrayVector) First() Value {
 	return l[0]
 }
 
-// More implements Seq
-func (l ArrayVector) More() Seq {
+// Rest implements Seq
+func (l ArrayVector) Rest() Seq {
 	if len(l) == 0 {
 		return ArrayVector{}
 	}
@@ -70,12 +70,38 @@ func (l ArrayVector) More() Seq {
 
 // Next implements Seq
 func (l ArrayVector) Next() Seq {
-	return l.More()
+	if len(l) <= 1 {
+		return nil
+	}
+	return l[1:]
 }
 
-// Cons implements Seq
+// Cons implements Seq, for vectors it appends.
+// Vectors which outgrow a single trie leaf become PersistentVectors so appending to them stays cheap.
 func (l ArrayVector) Cons(val Value) Seq {
-	return append(l, val)
+	if len(l) >= vectorWidth {
+		return NewPersistentVector(l).Conj(val)
+	}
+	trackAllocation(1)
+	out := make(ArrayVector, len(l)+1)
+	copy(out, l)
+	out[len(l)] = val
+	return out
+}
+
+// Assoc returns a copy of the vector with element i replaced by val, i equal to the length appends
+func (l ArrayVector) Assoc(i int, val Value) (Seq, error) {
+	if i == len(l) {
+		return l.Cons(val), nil
+	}
+	if i < 0 || i > len(l) {
+		return nil, NewExecutionError("index out of bounds")
+	}
+	trackAllocation(len(l))
+	out := make(ArrayVector, len(l))
+	copy(out, l)
+	out[i] = val
+	return out, nil
 }
 
 // Count implements Collection
@@ -88,8 +114,26 @@ func (l ArrayVector) Empty() Collection {
 	return make(ArrayVector, 0)
 }
 
+// Equals implements Equaler
+func (l ArrayVector) Equals(o Value) bool {
+	return seqEquals(l, o)
+}
+
+// Meta implements Metadatable, ArrayVectors never carry metadata
+func (l ArrayVector) Meta() Value { return NIL }
+
+// WithMeta implements Metadatable, a slice has nowhere to keep metadata so it returns an equal PersistentVector carrying it
+func (l ArrayVector) WithMeta(meta Value) Value {
+	return NewPersistentVector(l).WithMeta(meta)
+}
+
+// NewArrayVector makes a vector holding a copy of v so callers are free to reuse the slice,
+// this matters for natives which get their variadic arguments as a view into the VM stack.
 func NewArrayVector(v []Value) Value {
-	return ArrayVector(v)
+	trackAllocation(len(v))
+	vk := make(ArrayVector, len(v))
+	copy(vk, v)
+	return vk
 }
 
 func (l ArrayVector) String() string {
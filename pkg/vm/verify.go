@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2021 Marcin Gasperowicz <xnooga@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+ * documentation files (the "Software"), to deal in the Software without restriction, including without limitation the
+ * rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit
+ * persons to whom the Software is furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial portions of the
+ * Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE
+ * WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+ * OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package vm
+
+import "fmt"
+
+// VerifyError describes a problem found by CodeChunk.Verify at a particular instruction
+type VerifyError struct {
+	IP      int
+	message string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("VerifyError at ip %d: %s", e.IP, e.message)
+}
+
+// stackEffect returns how many values an instruction needs on the stack and how it changes the depth
+func stackEffect(op uint8, arg int) (need int, delta int, ok bool) {
+	switch op {
+	case OPNOP, OPJMP:
+		return 0, 0, true
+	case OPLDC, OPLDA, OPLDK:
+		return 0, 1, true
+	case OPINV, OPAPP, OPPON:
+		return arg + 1, -arg, true
+	case OPDPN:
+		return arg + 1, 1, true
+	case OPRET, OPLDV, OPMKC:
+		return 1, 0, true
+	case OPBRT, OPBRF, OPPOP:
+		return 1, -1, true
+	case OPSTV, OPPAK:
+		return 2, -1, true
+	case OPSTL:
+		return arg + 2, -1, true
+	case OPVEC:
+		return arg, 1 - arg, true
+	case OPADD, OPSUB, OPMUL, OPLT, OPGT, OPEQ:
+		return 3, -2, true
+	case OPINC, OPDEC:
+		return 2, -1, true
+	}
+	return 0, 0, false
+}
+
+func hasArg(op uint8) bool {
+	switch op {
+	case OPLDC, OPLDA, OPBRT, OPBRF, OPJMP, OPPON, OPDPN, OPINV, OPLDK, OPAPP, OPSTL, OPVEC:
+		return true
+	}
+	return false
+}
+
+// Verify simulates stack depth along every control flow path of the chunk. It checks that no instruction
+// underflows the stack, that paths merging at an instruction agree on the depth, that jumps stay within the
+// code, that every path ends with RET and that maxStack covers the deepest point.
+func (c *CodeChunk) Verify() error {
+	if c.length == 0 {
+		return &VerifyError{IP: 0, message: "empty code"}
+	}
+	depths := make([]int, c.length)
+	for i := range depths {
+		depths[i] = -1
+	}
+	deepest := 0
+	work := []int{0}
+	depths[0] = 0
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		for {
+			op := c.code[ip]
+			arg := 0
+			size := 1
+			if hasArg(op) {
+				if ip+5 > c.length {
+					return &VerifyError{IP: ip, message: fmt.Sprintf("truncated %s argument", OpcodeToString(op))}
+				}
+				arg, _ = c.Get32(ip + 1)
+				size = 5
+			}
+			need, delta, ok := stackEffect(op, arg)
+			if !ok {
+				return &VerifyError{IP: ip, message: fmt.Sprintf("unknown instruction %d", op)}
+			}
+			if arg < 0 && op != OPJMP && op != OPBRT && op != OPBRF {
+				return &VerifyError{IP: ip, message: fmt.Sprintf("negative %s argument %d", OpcodeToString(op), arg)}
+			}
+			depth := depths[ip]
+			if depth < need {
+				return &VerifyError{IP: ip, message: fmt.Sprintf("%s underflows the stack, needs %d values, has %d", OpcodeToString(op), need, depth)}
+			}
+			depth += delta
+			if depth > deepest {
+				deepest = depth
+			}
+			if op == OPRET {
+				break
+			}
+			var next []int
+			switch op {
+			case OPJMP:
+				next = []int{ip + arg}
+			case OPBRT, OPBRF:
+				next = []int{ip + 5, ip + arg}
+			default:
+				next = []int{ip + size}
+			}
+			fallthroughIP := -1
+			for _, n := range next {
+				if n < 0 || n >= c.length {
+					return &VerifyError{IP: ip, message: fmt.Sprintf("control flows outside of code to %d", n)}
+				}
+				switch depths[n] {
+				case -1:
+					depths[n] = depth
+					if fallthroughIP < 0 {
+						fallthroughIP = n
+					} else {
+						work = append(work, n)
+					}
+				case depth:
+				default:
+					return &VerifyError{IP: n, message: fmt.Sprintf("inconsistent stack depth, %d and %d", depths[n], depth)}
+				}
+			}
+			if fallthroughIP < 0 {
+				break
+			}
+			ip = fallthroughIP
+		}
+	}
+	if deepest > c.maxStack {
+		return &VerifyError{IP: 0, message: fmt.Sprintf("maxStack %d is lower than the required %d", c.maxStack, deepest)}
+	}
+	return nil
+}
@@ -45,10 +45,26 @@ const (
 
 	OPLDK // load closed over LDK (index int32)
 	OPPAK // push closed over value to a closure
+	OPMKC // replace the function on top of the stack with a fresh closure of it
+	OPAPP // invoke function spreading the last argument which is a collection APP (arg count int32)
+	OPSTL // pop value and store it in the nth value from the top of the stack STL (n int32)
+	OPVEC // replace the top n values on the stack with a vector of them VEC (n int32)
+
+	// arithmetic on the values on top of the stack, the function they are arguments of is below them and
+	// gets called like by INV unless it's one of the functions Inline registered for the instruction
+	// and the operands are Ints
+	OPADD // add two values
+	OPSUB // subtract two values
+	OPMUL // multiply two values
+	OPLT  // less than on two values
+	OPGT  // greater than on two values
+	OPEQ  // equality of two values
+	OPINC // increment one value
+	OPDEC // decrement one value
 )
 
 func OpcodeToString(op uint8) string {
-	ops := []string{"NOP", "LDC", "LDA", "INV", "RET", "BRT", "BRF", "JMP", "POP", "PON", "DPN", "STV", "LDV", "LDK", "PAK"}
+	ops := []string{"NOP", "LDC", "LDA", "INV", "RET", "BRT", "BRF", "JMP", "POP", "PON", "DPN", "STV", "LDV", "LDK", "PAK", "MKC", "APP", "STL", "VEC", "ADD", "SUB", "MUL", "LT", "GT", "EQ", "INC", "DEC"}
 	if int(op) < len(ops) {
 		return ops[op]
 	}
@@ -59,8 +75,10 @@ func OpcodeToString(op uint8) string {
 type CodeChunk struct {
 	maxStack int
 	consts   *[]Value
-	code     []uint8
-	length   int
+	// sealed is the pool as it was when the chunk was sealed, see Seal
+	sealed []Value
+	code   []uint8
+	length int
 }
 
 func NewCodeChunk(consts *[]Value) *CodeChunk {
@@ -71,6 +89,12 @@ func NewCodeChunk(consts *[]Value) *CodeChunk {
 	}
 }
 
+// Seal fixes the constants frames of the chunk see to the ones in its pool now. Compilers seal chunks they're done
+// with so they can keep appending to the shared pool while the chunks run, also on goroutines of futures.
+func (c *CodeChunk) Seal() {
+	c.sealed = *c.consts
+}
+
 func (c *CodeChunk) Debug() {
 	fmt.Println("consts:")
 	consts := *c.consts
@@ -81,12 +105,11 @@ func (c *CodeChunk) Debug() {
 	i := 0
 	for i < len(c.code) {
 		op, _ := c.Get(i)
-		switch op {
-		case OPLDC, OPLDA, OPBRT, OPBRF, OPJMP, OPPON, OPDPN, OPINV, OPLDK:
+		if hasArg(op) {
 			arg, _ := c.Get32(i + 1)
 			fmt.Println("  ", i, ":", OpcodeToString(op), arg)
 			i += 5
-		default:
+		} else {
 			fmt.Println("  ", i, ":", OpcodeToString(op))
 			i++
 		}
@@ -128,7 +151,8 @@ func (c *CodeChunk) Get32(idx int) (int, error) {
 	if idx >= c.length || idx+4 > c.length {
 		return 0, NewExecutionError("bytecode wide fetch out of bounds")
 	}
-	return int(binary.LittleEndian.Uint32(c.code[idx:])), nil
+	// arguments are signed so jumps can go backwards
+	return int(int32(binary.LittleEndian.Uint32(c.code[idx:]))), nil
 }
 
 func (c *CodeChunk) Update32(address int, value int) {
@@ -139,8 +163,6 @@ func (c *CodeChunk) SetMaxStack(max int) {
 	c.maxStack = max
 }
 
-const defaultStackSize = 32
-
 // Frame is a single interpreter context
 type Frame struct {
 	stack       []Value
@@ -152,23 +174,29 @@ type Frame struct {
 	code        *CodeChunk
 	ip          int
 	sp          int
+	state       *runState
 }
 
 func NewFrame(code *CodeChunk, args []Value) *Frame {
+	consts := code.sealed
+	if consts == nil {
+		consts = *code.consts
+	}
 	return &Frame{
 		stack:   make([]Value, code.maxStack),
 		args:    args,
 		argc:    len(args),
-		consts:  *code.consts,
-		constsc: len(*code.consts),
+		consts:  consts,
+		constsc: len(consts),
 		code:    code,
 		ip:      0,
 		sp:      0,
 	}
 }
 
+// Push puts v on top of the stack which holds as many values as the maxStack of the chunk
 func (f *Frame) Push(v Value) error {
-	if f.sp >= defaultStackSize-1 {
+	if f.sp >= len(f.stack) {
 		return NewExecutionError("stack overflow")
 	}
 	f.stack[f.sp] = v
@@ -191,9 +219,14 @@ func (f *Frame) Nth(n int) (Value, error) {
 	if i < 0 {
 		return NIL, NewExecutionError("Nth: stack underflow")
 	}
+	if i >= f.sp {
+		return NIL, NewExecutionError("Nth: index above the top of the stack")
+	}
 	return f.stack[i], nil
 }
 
+// Mult returns count values below the top start values of the stack.
+// The slice aliases the stack so it changes with later pushes, copy it to keep it.
 func (f *Frame) Mult(start int, count int) ([]Value, error) {
 	if count < 0 {
 		return nil, NewExecutionError("Mult: count 0 or negative")
@@ -202,26 +235,116 @@ func (f *Frame) Mult(start int, count int) ([]Value, error) {
 	if i-count < 0 {
 		return nil, NewExecutionError("Mult: stack underflow")
 	}
+	if i > f.sp {
+		return nil, NewExecutionError("Mult: start above the top of the stack")
+	}
 	return f.stack[i-count : i], nil
 }
 
 func (f *Frame) Drop(n int) error {
-	top := f.sp - 1
-	if top < 0 {
-		return NewExecutionError("Drop: stack underflow")
+	if n == 0 {
+		return nil
 	}
-	f.sp -= n
-	if f.sp < 0 {
+	if n < 0 {
+		return NewExecutionError("Drop: negative count")
+	}
+	if n > f.sp {
 		return NewExecutionError("Drop: stack underflow")
 	}
-	// for i := top; i >= f.sp; i-- {
+	f.sp -= n
+	// for i := f.sp + n - 1; i >= f.sp; i-- {
 	// 	f.stack[i] = nil
 	// }
 	return nil
 }
 
+// call invokes the function below the top arity values on the stack replacing all of them with the result
+func (f *Frame) call(arity int) error {
+	fraw, err := f.Nth(arity)
+	if err != nil {
+		return NewExecutionError("invoke instruction failed").Wrap(err)
+	}
+	fn, ok := fraw.(Fn)
+	if !ok {
+		return NewTypeError(fraw, "is not a function", nil)
+	}
+	a, err := f.Mult(0, arity)
+	if err != nil {
+		return NewExecutionError("popping arguments failed").Wrap(err)
+	}
+	// natives may keep their arguments so they get a copy which later pushes can't overwrite,
+	// Funcs only read them while the call runs and use the stack directly
+	if _, ok := fn.(*Func); !ok {
+		a = append(make([]Value, 0, arity), a...)
+	}
+	out, err := f.invoke(fn, a)
+	if err != nil {
+		return err
+	}
+	if err := allocationExceeded(); err != nil {
+		return err
+	}
+	err = f.Drop(arity + 1)
+	if err != nil {
+		return NewExecutionError("cleaning stack after call").Wrap(err)
+	}
+	err = f.Push(out)
+	if err != nil {
+		return NewExecutionError("pushing return value failed").Wrap(err)
+	}
+	return nil
+}
+
+// inlined holds the functions each arithmetic instruction computes calls of, see Inline
+var inlined [OPDEC - OPADD + 1][]Value
+
+// Inline lets the arithmetic instruction op compute calls of fn for Ints instead of calling it.
+// Instructions check the function they got so calls of anything else, like a function rebound with with-redefs,
+// still go through the function. It's meant to be used during initialization.
+func Inline(op uint8, fn Value) {
+	inlined[op-OPADD] = append(inlined[op-OPADD], fn)
+}
+
+// Inlines tells whether the arithmetic instruction op computes calls of fn itself
+func Inlines(op uint8, fn Value) bool {
+	for _, f := range inlined[op-OPADD] {
+		if f == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// arithInt computes the result of an arithmetic instruction on two Ints
+func arithInt(op uint8, a, b Int) Value {
+	switch op {
+	case OPADD:
+		return a + b
+	case OPSUB:
+		return a - b
+	case OPMUL:
+		return a * b
+	case OPLT:
+		return Boolean(a < b)
+	case OPGT:
+		return Boolean(a > b)
+	default:
+		return Boolean(a == b)
+	}
+}
+
 func (f *Frame) Run() (Value, error) {
 	for {
+		if f.state != nil {
+			if err := f.state.tick(); err != nil {
+				return NIL, err
+			}
+			if f.state.stepping {
+				if err := f.state.step(f); err != nil {
+					return NIL, err
+				}
+			}
+		}
 		inst, _ := f.code.Get(f.ip)
 		//	fmt.Println("exec", f.ip, OpcodeToString(inst))
 		switch inst {
@@ -268,9 +391,55 @@ func (f *Frame) Run() (Value, error) {
 			if err != nil {
 				return NIL, NewExecutionError("INV arg count").Wrap(err)
 			}
+			if err := f.call(arity); err != nil {
+				return NIL, err
+			}
+			f.ip += 5
+
+		case OPADD, OPSUB, OPMUL, OPLT, OPGT, OPEQ:
+			if f.sp < 3 {
+				return NIL, NewExecutionError(OpcodeToString(inst) + " stack underflow")
+			}
+			if a, ok := f.stack[f.sp-2].(Int); ok {
+				if b, ok := f.stack[f.sp-1].(Int); ok && Inlines(inst, f.stack[f.sp-3]) {
+					f.stack[f.sp-3] = arithInt(inst, a, b)
+					f.sp -= 2
+					f.ip++
+					continue
+				}
+			}
+			if err := f.call(2); err != nil {
+				return NIL, err
+			}
+			f.ip++
+
+		case OPINC, OPDEC:
+			if f.sp < 2 {
+				return NIL, NewExecutionError(OpcodeToString(inst) + " stack underflow")
+			}
+			if a, ok := f.stack[f.sp-1].(Int); ok && Inlines(inst, f.stack[f.sp-2]) {
+				if inst == OPINC {
+					f.stack[f.sp-2] = a + 1
+				} else {
+					f.stack[f.sp-2] = a - 1
+				}
+				f.sp--
+				f.ip++
+				continue
+			}
+			if err := f.call(1); err != nil {
+				return NIL, err
+			}
+			f.ip++
+
+		case OPAPP:
+			arity, err := f.code.Get32(f.ip + 1)
+			if err != nil {
+				return NIL, NewExecutionError("APP arg count").Wrap(err)
+			}
 			fraw, err := f.Nth(arity)
 			if err != nil {
-				return NIL, NewExecutionError("invoke instruction failed").Wrap(err)
+				return NIL, NewExecutionError("apply instruction failed").Wrap(err)
 			}
 			fn, ok := fraw.(Fn)
 			if !ok {
@@ -280,7 +449,23 @@ func (f *Frame) Run() (Value, error) {
 			if err != nil {
 				return NIL, NewExecutionError("popping arguments failed").Wrap(err)
 			}
-			out := fn.Invoke(a)
+			// fixed arguments and the spread collection go straight into one fresh slice
+			args := make([]Value, arity-1, arity-1+collectionSize(a[arity-1]))
+			copy(args, a[:arity-1])
+			args, err = AppendElements(args, a[arity-1])
+			if err != nil {
+				return NIL, NewExecutionError("spreading apply arguments failed").Wrap(err)
+			}
+			if err := CheckArity(fn, len(args)); err != nil {
+				return NIL, err
+			}
+			out, err := f.invoke(fn, args)
+			if err != nil {
+				return NIL, err
+			}
+			if err := allocationExceeded(); err != nil {
+				return NIL, err
+			}
 			err = f.Drop(arity + 1)
 			if err != nil {
 				return NIL, NewExecutionError("cleaning stack after call").Wrap(err)
@@ -326,6 +511,12 @@ func (f *Frame) Run() (Value, error) {
 			if err != nil {
 				return NIL, NewExecutionError("JMP offset").Wrap(err)
 			}
+			// loops jump backwards so that's where runaway code gets stopped
+			if offset <= 0 && f.state != nil {
+				if err := f.state.check(); err != nil {
+					return NIL, err
+				}
+			}
 			f.ip += offset
 
 		case OPPOP:
@@ -434,6 +625,53 @@ func (f *Frame) Run() (Value, error) {
 			fun.closedOvers = append(fun.closedOvers, val)
 			f.ip++
 
+		case OPSTL:
+			num, err := f.code.Get32(f.ip + 1)
+			if err != nil {
+				return NIL, NewExecutionError("STL get argument").Wrap(err)
+			}
+			val, err := f.Pop()
+			if err != nil {
+				return NIL, NewExecutionError("STL pop value failed").Wrap(err)
+			}
+			idx := f.sp - 1 - num
+			if idx < 0 {
+				return NIL, NewExecutionError("STL stack underflow")
+			}
+			f.stack[idx] = val
+			f.ip += 5
+
+		case OPVEC:
+			num, err := f.code.Get32(f.ip + 1)
+			if err != nil {
+				return NIL, NewExecutionError("VEC get argument").Wrap(err)
+			}
+			elems, err := f.Mult(0, num)
+			if err != nil {
+				return NIL, NewExecutionError("VEC elements").Wrap(err)
+			}
+			// NewVector copies the elements out of the stack
+			vec := NewVector(elems)
+			if err = f.Drop(num); err != nil {
+				return NIL, NewExecutionError("VEC drop").Wrap(err)
+			}
+			if err = f.Push(vec); err != nil {
+				return NIL, NewExecutionError("VEC push").Wrap(err)
+			}
+			f.ip += 5
+
+		case OPMKC:
+			idx := f.sp - 1
+			if idx < 0 {
+				return NIL, NewExecutionError("MKC stack underflow")
+			}
+			fun, ok := f.stack[idx].(*Func)
+			if !ok {
+				return NIL, NewExecutionError("MKC expected a Fn")
+			}
+			f.stack[idx] = fun.MakeClosure()
+			f.ip++
+
 		default:
 			return NIL, NewExecutionError("unknown instruction")
 		}
@@ -18,8 +18,14 @@
 package vm
 
 import (
+	"fmt"
+	"math"
 	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -108,18 +114,18 @@ func TestListType(t *testing.T) {
 	assert.Equal(t, v3, l3.Unbox())
 	assert.Equal(t, v4, l4.Unbox())
 
-	assert.Equal(t, l4.More(), l4.Next())
+	assert.Equal(t, l4.Rest(), l4.Rest())
 
 	assert.Equal(t, NIL, l.First())
-	assert.Equal(t, l, l.Next())
-	assert.Equal(t, l, l.More())
-	assert.Equal(t, EmptyList, l.Next())
-	assert.Equal(t, EmptyList, l.More())
+	assert.Equal(t, l, l.Rest())
+	assert.Equal(t, l, l.Rest())
+	assert.Equal(t, EmptyList, l.Rest())
+	assert.Equal(t, EmptyList, l.Rest())
 
-	assert.Equal(t, l2, l4.Next())
-	assert.True(t, l2 == l4.Next())
+	assert.Equal(t, l2, l4.Rest())
+	assert.True(t, l2 == l4.Rest())
 
-	assert.Equal(t, l2.First(), l4.Next().First())
+	assert.Equal(t, l2.First(), l4.Rest().First())
 
 	assert.Equal(t, l3.First(), l4.First())
 
@@ -154,6 +160,134 @@ func TestListType(t *testing.T) {
 	assert.Equal(t, EmptyList, badList)
 }
 
+func TestEqual(t *testing.T) {
+	list := NewList([]Value{Int(1), Int(2), Int(3)})
+	vec := ArrayVector{Int(1), Int(2), Int(3)}
+
+	assert.True(t, Equal(list, vec))
+	assert.True(t, Equal(vec, list))
+	assert.True(t, Equal(EmptyList, ArrayVector{}))
+	assert.False(t, Equal(list, ArrayVector{Int(1), Int(2)}))
+	assert.False(t, Equal(EmptyList, NIL))
+
+	m := NewMap([]Value{Keyword("a"), Int(1), Keyword("b"), vec})
+	m2 := NewMap([]Value{Keyword("b"), list, Keyword("a"), Int(1)})
+	assert.True(t, Equal(m, m2))
+	assert.False(t, Equal(m, m.(*Map).Dissoc(Keyword("a"))))
+	assert.False(t, Equal(NewMap([]Value{Int(1), Int(2)}), ArrayVector{Int(1), Int(2)}))
+	assert.False(t, Equal(ArrayVector{Int(1), Int(2)}, NewMap([]Value{Int(1), Int(2)})))
+	assert.False(t, Equal(EmptyMap, ArrayVector{}))
+
+	s := NewSet([]Value{Int(1), vec, Int(1)})
+	assert.Equal(t, Int(2), s.(*Set).Count())
+	assert.True(t, Equal(s, NewSet([]Value{list, Int(1)})))
+	assert.False(t, Equal(s, vec))
+}
+
+func TestNumericTower(t *testing.T) {
+	assert.True(t, Equal(Int(1), Int(1)))
+	assert.False(t, Equal(Int(1), Float(1)))
+
+	eq, err := NumEqual(Int(1), Float(1))
+	assert.NoError(t, err)
+	assert.True(t, eq)
+
+	eq, err = NumEqual(Float(0.5), Int(0))
+	assert.NoError(t, err)
+	assert.False(t, eq)
+
+	_, err = NumEqual(Int(1), String("1"))
+	assert.Error(t, err)
+
+	sum, err := Add(Int(1), Float(0.5))
+	assert.NoError(t, err)
+	assert.Equal(t, Float(1.5), sum)
+
+	sum, err = Add(Int(1), Int(2))
+	assert.NoError(t, err)
+	assert.Equal(t, Int(3), sum)
+
+	// there are no ratios, Ints dividing evenly stay Ints and others give a Float
+	q, err := Div(Int(4), Int(2))
+	assert.NoError(t, err)
+	assert.Equal(t, Int(2), q)
+	q, err = Div(Int(-9), Int(3))
+	assert.NoError(t, err)
+	assert.Equal(t, Int(-3), q)
+	q, err = Div(Int(1), Int(2))
+	assert.NoError(t, err)
+	assert.Equal(t, Float(0.5), q)
+	q, err = Div(Float(4), Int(2))
+	assert.NoError(t, err)
+	assert.Equal(t, Float(2), q)
+
+	_, err = Div(Int(1), Int(0))
+	assert.Error(t, err)
+
+	c, err := Compare(Int(2), Float(1.5))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c)
+}
+
+func TestCompare(t *testing.T) {
+	c, err := Compare(NewList([]Value{Int(1), Int(2)}), ArrayVector{Int(1), Int(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	c, err = Compare(ArrayVector{Int(5)}, ArrayVector{Int(1), Int(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	c, err = Compare(String("b"), String("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c)
+
+	c, err = Compare(NIL, Int(0))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	_, err = Compare(Int(1), String("a"))
+	assert.Error(t, err)
+}
+
+func TestNewArrayVectorCopies(t *testing.T) {
+	args := []Value{Int(1), Int(2)}
+	v := NewArrayVector(args)
+	args[0] = Int(42)
+	assert.Equal(t, Int(1), v.(ArrayVector)[0])
+}
+
+func TestIdentical(t *testing.T) {
+	a := ArrayVector{Int(1), Int(2)}
+	b := ArrayVector{Int(1), Int(2)}
+	assert.True(t, Equal(a, b))
+	assert.False(t, Identical(a, b))
+	assert.True(t, Identical(a, a))
+	assert.False(t, Identical(a, a[:1]))
+	assert.True(t, Identical(ArrayVector{}, ArrayVector{}))
+
+	l := NewList([]Value{Int(1)})
+	assert.True(t, Equal(l, NewList([]Value{Int(1)})))
+	assert.False(t, Identical(l, NewList([]Value{Int(1)})))
+	assert.True(t, Identical(l, l))
+
+	assert.True(t, Identical(Keyword("a"), Keyword("a")))
+	assert.True(t, Identical(Int(1), Int(1)))
+	assert.False(t, Identical(Int(1), Float(1)))
+	assert.False(t, Identical(a, l))
+}
+
+func TestInstant(t *testing.T) {
+	now := time.Now()
+	a, b := Instant(now), Instant(now.In(time.FixedZone("X", 3600)))
+	assert.True(t, Equal(a, b))
+	assert.False(t, Equal(a, Instant(now.Add(time.Second))))
+
+	c, err := Compare(a, Instant(now.Add(time.Second)))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+}
+
 func TestSimpleCall(t *testing.T) {
 
 	forty, err := IntType.Box(40)
@@ -187,3 +321,1090 @@ func TestSimpleCall(t *testing.T) {
 
 	assert.Equal(t, 42, out.Unbox())
 }
+
+func TestNativeTyped(t *testing.T) {
+	add := NativeTyped("add", []ValueType{IntType, NumberType}, func(vs []Value) (Value, error) {
+		return Add(vs[0], vs[1])
+	})
+	out, err := add.Invoke([]Value{Int(1), Float(0.5)})
+	assert.NoError(t, err)
+	assert.Equal(t, Float(1.5), out)
+
+	_, err = add.Invoke([]Value{Int(1)})
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (1) passed to add, expected 2")
+
+	_, err = add.Invoke([]Value{Float(1), Int(2)})
+	assert.Error(t, err)
+	assert.IsType(t, &TypeError{}, err)
+	assert.Contains(t, err.Error(), "argument 1 to add")
+
+	ns := NewNamespace("test")
+	v := ns.DefNativeTyped("id", []ValueType{AnyType}, func(vs []Value) (Value, error) {
+		return vs[0], nil
+	})
+	out, err = v.Invoke([]Value{Keyword("x")})
+	assert.NoError(t, err)
+	assert.Equal(t, Keyword("x"), out)
+	assert.Equal(t, 1, v.Arity())
+}
+
+func TestSeqFromSlice(t *testing.T) {
+	vs := []Value{Int(1), Int(2), Int(3)}
+	s := SeqFromSlice(vs)
+	assert.Equal(t, Int(3), s.(Collection).Count())
+	assert.True(t, s.(Equaler).Equals(NewList(vs)))
+	assert.Equal(t, Int(2), s.Rest().First())
+	assert.Equal(t, "(1 2 3)", s.String())
+	assert.True(t, IsEmpty(SeqFromSlice(nil)))
+}
+
+func TestSeqFromChan(t *testing.T) {
+	ch := make(chan Value)
+	go func() {
+		for i := 0; i < 3; i++ {
+			ch <- Int(i)
+		}
+		close(ch)
+	}()
+	s := SeqFromChan(ch)
+	elems, err := AppendElements(nil, s)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{Int(0), Int(1), Int(2)}, elems)
+
+	// walking the sequence again doesn't receive from the channel
+	elems, err = AppendElements(nil, s)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{Int(0), Int(1), Int(2)}, elems)
+	assert.True(t, s.Cons(Int(-1)).(Equaler).Equals(NewList([]Value{Int(-1), Int(0), Int(1), Int(2)})))
+
+	empty := make(chan Value)
+	close(empty)
+	assert.True(t, IsEmpty(SeqFromChan(empty)))
+}
+
+func TestLazySeq(t *testing.T) {
+	calls := 0
+	s := NewLazySeq(func() (Seq, error) {
+		calls++
+		return NewList([]Value{Int(1), Int(2)}).(Seq), nil
+	})
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, Int(1), s.First())
+	assert.Equal(t, []Value{Int(1), Int(2)}, s.Unbox())
+	assert.Equal(t, 1, calls)
+
+	failing := NewLazySeq(func() (Seq, error) {
+		return nil, NewExecutionError("boom")
+	})
+	assert.True(t, IsEmpty(failing))
+	_, err := AppendElements(nil, NewCons(Int(0), failing))
+	assert.EqualError(t, err, "ExecutionError: boom")
+}
+
+func TestAtomSwap(t *testing.T) {
+	a := NewAtom(Int(0))
+	inc := NativeTyped("inc", []ValueType{IntType}, func(vs []Value) (Value, error) {
+		return vs[0].(Int) + 1, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := a.Swap(inc, nil)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, Int(1000), a.Deref())
+	assert.False(t, a.CompareAndSet(Int(0), Int(1)))
+	assert.True(t, a.CompareAndSet(Int(1000), Int(1)))
+}
+
+func TestVerify(t *testing.T) {
+	consts := []Value{Int(1), TRUE}
+	chunk := func(maxStack int, build func(c *CodeChunk)) *CodeChunk {
+		c := NewCodeChunk(&consts)
+		build(c)
+		c.SetMaxStack(maxStack)
+		return c
+	}
+
+	// (if true 1 1)
+	ok := chunk(1, func(c *CodeChunk) {
+		c.Append(OPLDC)
+		c.Append32(1)
+		c.Append(OPBRF)
+		c.Append32(15)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPJMP)
+		c.Append32(10)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPRET)
+	})
+	assert.NoError(t, ok.Verify())
+	out, err := NewFrame(ok, nil).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, Int(1), out)
+
+	small := chunk(1, func(c *CodeChunk) {
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPPOP, OPRET)
+	})
+	assert.EqualError(t, small.Verify(), "VerifyError at ip 0: maxStack 1 is lower than the required 2")
+
+	underflow := chunk(2, func(c *CodeChunk) {
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPPOP, OPPOP, OPRET)
+	})
+	err = underflow.Verify()
+	assert.Error(t, err)
+	assert.Equal(t, 6, err.(*VerifyError).IP)
+
+	// the else branch leaves an extra value on the stack
+	unbalanced := chunk(3, func(c *CodeChunk) {
+		c.Append(OPLDC)
+		c.Append32(1)
+		c.Append(OPBRF)
+		c.Append32(15)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPJMP)
+		c.Append32(15)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPLDC)
+		c.Append32(0)
+		c.Append(OPRET)
+	})
+	err = unbalanced.Verify()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "inconsistent stack depth")
+
+	noret := chunk(1, func(c *CodeChunk) {
+		c.Append(OPLDC)
+		c.Append32(0)
+	})
+	assert.Error(t, noret.Verify())
+}
+
+func TestMakeClosure(t *testing.T) {
+	consts := []Value{}
+	tmpl := MakeFunc(1, false, NewCodeChunk(&consts)).SetClosedOversCount(3)
+	c := tmpl.MakeClosure()
+	assert.NotSame(t, tmpl, c)
+	assert.Equal(t, 0, len(c.closedOvers))
+	assert.Equal(t, 3, cap(c.closedOvers))
+	assert.Equal(t, 1, c.Arity())
+	assert.Nil(t, tmpl.closedOvers)
+}
+
+func TestPersistentVector(t *testing.T) {
+	const n = 2000
+	elems := make([]Value, n)
+	var v Seq = ArrayVector{}
+	for i := 0; i < n; i++ {
+		elems[i] = Int(i)
+		v = v.Cons(Int(i))
+	}
+	pv, ok := v.(*PersistentVector)
+	assert.True(t, ok)
+	assert.Equal(t, Int(n), pv.Count())
+	assert.Equal(t, elems, pv.Unbox())
+	for i := 0; i < n; i++ {
+		e, ok := pv.Nth(i)
+		assert.True(t, ok)
+		assert.Equal(t, Int(i), e)
+	}
+	_, ok = pv.Nth(n)
+	assert.False(t, ok)
+
+	// updates leave the original alone
+	for _, i := range []int{0, 31, 32, 1023, 1024, n - 1} {
+		u, err := pv.Assoc(i, Keyword("x"))
+		assert.NoError(t, err)
+		e, _ := u.Nth(i)
+		assert.Equal(t, Keyword("x"), e)
+		e, _ = pv.Nth(i)
+		assert.Equal(t, Int(i), e)
+	}
+	_, err := pv.Assoc(n+1, NIL)
+	assert.Error(t, err)
+
+	assert.True(t, pv.Equals(ArrayVector(elems)))
+	assert.True(t, ArrayVector(elems).Equals(pv))
+	walked, err := AppendElements(nil, pv.Rest())
+	assert.NoError(t, err)
+	assert.Equal(t, elems[1:], walked)
+	assert.Equal(t, Int(n-1), pv.Rest().(Collection).Count())
+}
+
+func TestArrayVectorCons(t *testing.T) {
+	a := ArrayVector{Int(1), Int(2)}
+	b := a.Cons(Int(3))
+	c := a.Cons(Int(4))
+	assert.Equal(t, ArrayVector{Int(1), Int(2), Int(3)}, b)
+	assert.Equal(t, ArrayVector{Int(1), Int(2), Int(4)}, c)
+
+	u, err := a.Assoc(0, Int(0))
+	assert.NoError(t, err)
+	assert.Equal(t, ArrayVector{Int(0), Int(2)}, u)
+	assert.Equal(t, ArrayVector{Int(1), Int(2)}, a)
+}
+
+const benchVectorSize = 100000
+
+// BenchmarkVectorConj builds a vector of 100k elements one conj at a time.
+// Appending in place to a slice is what ArrayVector used to do, it's cheap but lets vectors see each other's updates.
+func BenchmarkVectorConj(b *testing.B) {
+	b.Run("ArrayVector append", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := ArrayVector{}
+			for j := 0; j < benchVectorSize; j++ {
+				v = append(v, Int(j))
+			}
+		}
+	})
+	b.Run("PersistentVector", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := EmptyPersistentVector
+			for j := 0; j < benchVectorSize; j++ {
+				v = v.Conj(Int(j))
+			}
+		}
+	})
+}
+
+// BenchmarkVectorAssoc replaces an element of a 100k element vector
+func BenchmarkVectorAssoc(b *testing.B) {
+	elems := make([]Value, benchVectorSize)
+	for i := range elems {
+		elems[i] = Int(i)
+	}
+	av := ArrayVector(elems)
+	pv := NewPersistentVector(elems)
+	b.Run("ArrayVector", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = av.Assoc(i%benchVectorSize, NIL)
+		}
+	})
+	b.Run("PersistentVector", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = pv.Assoc(i%benchVectorSize, NIL)
+		}
+	})
+}
+
+// collidingKey hashes the same as every other collidingKey
+type collidingKey int
+
+func (k collidingKey) Type() ValueType    { return IntType }
+func (k collidingKey) Unbox() interface{} { return int(k) }
+func (k collidingKey) String() string     { return fmt.Sprint(int(k)) }
+func (k collidingKey) Hash() uint32       { return 42 }
+
+func TestMap(t *testing.T) {
+	const n = 5000
+	m := EmptyMap
+	for i := 0; i < n; i++ {
+		m = m.Assoc(Int(i), Int(i*2))
+	}
+	assert.Equal(t, Int(n), m.Count())
+	for i := 0; i < n; i++ {
+		assert.Equal(t, Int(i*2), m.ValueAt(Int(i)))
+	}
+	assert.False(t, m.Contains(Int(n)))
+	assert.Equal(t, Int(n), m.Assoc(Int(1), Int(0)).Count())
+
+	smaller := m
+	for i := 0; i < n; i += 2 {
+		smaller = smaller.Dissoc(Int(i))
+	}
+	assert.Equal(t, Int(n/2), smaller.Count())
+	assert.Equal(t, NIL, smaller.ValueAt(Int(0)))
+	assert.Equal(t, Int(2), smaller.ValueAt(Int(1)))
+	assert.Equal(t, Int(0), m.ValueAt(Int(0)))
+	assert.Same(t, smaller, smaller.Dissoc(Int(0)))
+
+	// contents decide equality, not the order of updates
+	backwards := EmptyMap
+	for i := n - 1; i >= 0; i-- {
+		backwards = backwards.Assoc(Int(i), Int(i*2))
+	}
+	assert.True(t, m.Equals(backwards))
+	assert.Equal(t, Hash(m), Hash(backwards))
+	assert.False(t, m.Equals(smaller))
+
+	c := EmptyMap.Assoc(collidingKey(1), Int(1)).Assoc(collidingKey(2), Int(2)).Assoc(collidingKey(3), Int(3))
+	assert.Equal(t, Int(3), c.Count())
+	assert.Equal(t, Int(2), c.ValueAt(collidingKey(2)))
+	c = c.Dissoc(collidingKey(2))
+	assert.Equal(t, Int(2), c.Count())
+	assert.Equal(t, NIL, c.ValueAt(collidingKey(2)))
+	assert.Equal(t, Int(3), c.ValueAt(collidingKey(3)))
+}
+
+func TestHash(t *testing.T) {
+	list := NewList([]Value{Int(1), String("a")})
+	assert.Equal(t, Hash(list), Hash(ArrayVector{Int(1), String("a")}))
+	assert.Equal(t, Hash(list), Hash(NewPersistentVector([]Value{Int(1), String("a")})))
+	assert.NotEqual(t, Hash(String("a")), Hash(Keyword("a")))
+	assert.Equal(t, Hash(NewSet([]Value{Int(1), Int(2)})), Hash(NewSet([]Value{Int(2), Int(1)})))
+}
+
+// naiveAssoc is a map update copying a flat array of keys and values, which Map used to be
+func naiveAssoc(kvs []Value, key Value, val Value) []Value {
+	for i := 0; i < len(kvs); i += 2 {
+		if Equal(kvs[i], key) {
+			out := make([]Value, len(kvs))
+			copy(out, kvs)
+			out[i+1] = val
+			return out
+		}
+	}
+	out := make([]Value, len(kvs), len(kvs)+2)
+	copy(out, kvs)
+	return append(out, key, val)
+}
+
+// BenchmarkMapAssoc builds maps one entry at a time.
+// The naive flat map is quadratic so it only goes to 10k entries, at 100k a single run takes minutes.
+func BenchmarkMapAssoc(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var kvs []Value
+				for j := 0; j < n; j++ {
+					kvs = naiveAssoc(kvs, Int(j), Int(j))
+				}
+			}
+		})
+	}
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("HAMT/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := EmptyMap
+				for j := 0; j < n; j++ {
+					m = m.Assoc(Int(j), Int(j))
+				}
+			}
+		})
+	}
+}
+
+func TestSortedMap(t *testing.T) {
+	const n = 1000
+	m := NewSortedMap(Compare)
+	for _, i := range rand.Perm(n) {
+		var err error
+		m, err = m.Assoc(Int(i), Int(i*2))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, Int(n), m.Count())
+	// an AVL tree of n nodes is at most about 1.44 log2(n) high
+	assert.LessOrEqual(t, m.root.height, 15)
+
+	entries, err := AppendElements(nil, m)
+	assert.NoError(t, err)
+	for i := range entries {
+		assert.Equal(t, NewMapEntry(Int(i), Int(i*2)), entries[i])
+	}
+
+	for i := 0; i < n; i += 2 {
+		m, err = m.Dissoc(Int(i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, Int(n/2), m.Count())
+	assert.Equal(t, NIL, m.ValueAtOr(Int(0), NIL))
+	assert.Equal(t, Int(2), m.ValueAtOr(Int(1), NIL))
+
+	above, err := m.Range(false, func(k Value) (bool, error) { return k.(Int) > n-6, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{NewMapEntry(Int(n-1), Int(2*n-2)), NewMapEntry(Int(n-3), Int(2*n-6)), NewMapEntry(Int(n-5), Int(2*n-10))}, above)
+
+	_, err = m.Assoc(Keyword("nope"), NIL)
+	assert.Error(t, err)
+}
+
+func TestArrayMap(t *testing.T) {
+	var m Value = EmptyArrayMap
+	var keys []Value
+	for i := ArrayMapThreshold; i > 0; i-- {
+		m = m.(*ArrayMap).Assoc(Int(i), Int(-i))
+		keys = append(keys, Int(i))
+	}
+	assert.IsType(t, &ArrayMap{}, m)
+	entries, err := AppendElements(nil, m)
+	assert.NoError(t, err)
+	for i := range entries {
+		assert.Equal(t, NewMapEntry(keys[i], Int(-keys[i].(Int))), entries[i])
+	}
+	assert.IsType(t, &ArrayMap{}, m.(*ArrayMap).Assoc(Int(1), NIL))
+
+	grown := m.(*ArrayMap).Assoc(Int(0), Int(0))
+	assert.IsType(t, &Map{}, grown)
+	assert.Equal(t, Int(ArrayMapThreshold+1), grown.(*Map).Count())
+	assert.Equal(t, Int(-3), grown.(*Map).ValueAt(Int(3)))
+	assert.True(t, grown.(*Map).Dissoc(Int(0)).Equals(m))
+	assert.True(t, m.(*ArrayMap).Equals(grown.(*Map).Dissoc(Int(0))))
+	assert.Equal(t, Hash(m), Hash(grown.(*Map).Dissoc(Int(0))))
+}
+
+func TestNamespaceRefer(t *testing.T) {
+	base := NewNamespace("base")
+	shared := base.Def("shared", Int(1))
+	base.Def("shadowed", Int(2))
+	ns := NewNamespace("derived").Refer(base)
+	own := ns.Def("shadowed", Int(3))
+
+	assert.Equal(t, shared, ns.Lookup("shared"))
+	assert.Equal(t, own, ns.Lookup("shadowed"))
+	assert.Equal(t, NIL, ns.Lookup("missing"))
+	assert.Equal(t, NIL, base.Lookup("missing"))
+}
+
+func TestEncodeChunkUnserializable(t *testing.T) {
+	consts := []Value{NewAtom(NIL)}
+	c := NewCodeChunk(&consts)
+	c.Append(OPLDC)
+	c.Append32(0)
+	c.Append(OPRET)
+	assert.EqualError(t, EncodeChunk(&strings.Builder{}, c), "TypeError: Atom can't be serialized as bytecode ")
+}
+
+func TestCallablePersistentVector(t *testing.T) {
+	vs := make([]Value, 100)
+	for i := range vs {
+		vs[i] = Int(i * 2)
+	}
+	var f Fn = NewPersistentVector(vs)
+	out, err := f.Invoke([]Value{Int(70)})
+	assert.NoError(t, err)
+	assert.Equal(t, Int(140), out)
+	_, err = f.Invoke([]Value{Int(100)})
+	assert.Error(t, err)
+}
+
+func TestArityInfo(t *testing.T) {
+	consts := []Value{}
+	boxed, err := NativeFnType.Box(func(s string, rest ...int) int { return len(rest) })
+	assert.NoError(t, err)
+	wrapped, err := NativeFnType.Wrap(func(vs []Value) (Value, error) { return NIL, nil })
+	assert.NoError(t, err)
+
+	tests := []struct {
+		fn                 Fn
+		min, max, variadic interface{}
+	}{
+		{MakeFunc(2, false, NewCodeChunk(&consts)), 2, 2, false},
+		{MakeFunc(2, true, NewCodeChunk(&consts)), 1, -1, true},
+		{NativeTyped("typed", []ValueType{IntType}, nil), 1, 1, false},
+		{boxed.(Fn), 1, -1, true},
+		{wrapped.(Fn), 0, -1, true},
+		{Keyword("k"), 1, 2, false},
+		{ArrayVector{Int(1)}, 1, 1, false},
+		{NewSet(nil).(Fn), 1, 2, false},
+	}
+	for _, tt := range tests {
+		min, max, variadic := ArityOf(tt.fn)
+		assert.Equal(t, []interface{}{tt.min, tt.max, tt.variadic}, []interface{}{min, max, variadic}, tt.fn.String())
+	}
+
+	assert.NoError(t, CheckArity(wrapped.(Fn), 7))
+	assert.NoError(t, CheckArity(Keyword("k"), 2))
+	err = CheckArity(Keyword("k"), 3)
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (3) passed to :k, expected 1 or 2")
+	err = CheckArity(NativeTyped("typed", []ValueType{IntType}, nil), 0)
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (0) passed to typed, expected 1")
+	err = CheckArity(MakeFunc(3, true, NewCodeChunk(&consts)).WithName("f"), 1)
+	assert.EqualError(t, err, "ExecutionError: wrong number of arguments (1) passed to f, expected at least 2")
+}
+
+func TestAsHelpers(t *testing.T) {
+	i, err := AsInt(Int(42))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, i)
+	_, err = AsInt(String("42"))
+	assert.Error(t, err)
+
+	f, err := AsFloat(Int(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, f)
+	f, err = AsFloat(Float(0.5))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, f)
+	_, err = AsFloat(NIL)
+	assert.Error(t, err)
+
+	s, err := AsString(String("hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", s)
+	_, err = AsString(Keyword("hi"))
+	assert.Error(t, err)
+
+	fn, err := AsFn(Keyword("k"))
+	assert.NoError(t, err)
+	assert.Equal(t, Keyword("k"), fn)
+	_, err = AsFn(Int(1))
+	assert.Error(t, err)
+}
+
+func TestNativePanicRecovered(t *testing.T) {
+	f, err := NativeFnType.Wrap(func(vs []Value) (Value, error) {
+		return Int(vs[0].Unbox().(int) + 1), nil
+	})
+	assert.NoError(t, err)
+	out, err := f.(Fn).Invoke([]Value{Int(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, Int(2), out)
+
+	_, err = f.(Fn).Invoke([]Value{String("1")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "panicked: interface conversion")
+	assert.NotContains(t, err.Error(), "goroutine")
+
+	DebugPanics = true
+	defer func() { DebugPanics = false }()
+	_, err = NativeTyped("boom", nil, func(vs []Value) (Value, error) { panic("boom") }).Invoke(nil)
+	assert.Contains(t, err.Error(), "boom panicked: boom")
+	assert.Contains(t, err.Error(), "goroutine")
+}
+
+func TestLookup(t *testing.T) {
+	k := Keyword("k")
+	byName := func(a Value, b Value) (int, error) {
+		x, ok := a.(Keyword)
+		y, ok2 := b.(Keyword)
+		if !ok || !ok2 {
+			return 0, NewTypeError(a, "is not comparable", nil)
+		}
+		return strings.Compare(string(x), string(y)), nil
+	}
+	sm, err := NewSortedMap(byName).Assoc(k, Int(4))
+	assert.NoError(t, err)
+	cases := []struct {
+		coll  Value
+		key   Value
+		found Value
+	}{
+		{EmptyArrayMap.Assoc(k, Int(1)), k, Int(1)},
+		{EmptyMap.Assoc(k, Int(2)), k, Int(2)},
+		{sm, k, Int(4)},
+		{NewSet([]Value{k}), k, k},
+		{ArrayVector{Int(5), Int(6)}, Int(1), Int(6)},
+		{NewPersistentVector([]Value{Int(7)}), Int(0), Int(7)},
+		{String("żab"), Int(1), Char('a')},
+	}
+	missing := []Value{Keyword("missing"), Int(-1), Int(10), String("x")}
+	for _, c := range cases {
+		l, ok := c.coll.(Lookup)
+		assert.True(t, ok, c.coll.String())
+		assert.Equal(t, c.found, l.ValueAtOr(c.key, NIL), c.coll.String())
+		assert.Equal(t, c.found, Get(c.coll, c.key, NIL), c.coll.String())
+		for _, m := range missing {
+			assert.Equal(t, Keyword("nf"), l.ValueAtOr(m, Keyword("nf")), c.coll.String())
+		}
+	}
+	assert.Equal(t, Keyword("nf"), Get(NIL, k, Keyword("nf")))
+	assert.Equal(t, Keyword("nf"), Get(Int(1), k, Keyword("nf")))
+}
+
+func TestSeqRestNext(t *testing.T) {
+	one := []Seq{
+		NewList([]Value{Int(1)}).(Seq),
+		ArrayVector{Int(1)},
+		NewPersistentVector([]Value{Int(1)}),
+		NewCons(Int(1), EmptyList),
+		SeqFromSlice([]Value{Int(1)}),
+		NewLazySeq(func() (Seq, error) { return NewList([]Value{Int(1)}).(Seq), nil }),
+	}
+	for _, s := range one {
+		assert.Nil(t, s.Next(), s.String())
+		assert.NotNil(t, s.Rest(), s.String())
+		assert.True(t, IsEmpty(s.Rest()), s.String())
+	}
+
+	two := []Seq{
+		NewList([]Value{Int(1), Int(2)}).(Seq),
+		ArrayVector{Int(1), Int(2)},
+		NewPersistentVector([]Value{Int(1), Int(2)}),
+		NewCons(Int(1), NewList([]Value{Int(2)}).(Seq)),
+		SeqFromSlice([]Value{Int(1), Int(2)}),
+	}
+	for _, s := range two {
+		assert.Equal(t, Int(2), s.Next().First(), s.String())
+		assert.Equal(t, Int(2), s.Rest().First(), s.String())
+	}
+
+	assert.True(t, IsEmpty(EmptyList.Rest()))
+	assert.Nil(t, EmptyList.Next())
+}
+
+func TestPersistentVectorPop(t *testing.T) {
+	const n = 1100
+	v := NewPersistentVector(nil)
+	for i := 0; i < n; i++ {
+		v = v.Conj(Int(i))
+	}
+	full := v
+	for i := n - 1; i >= 0; i-- {
+		last, ok := v.Nth(i)
+		assert.True(t, ok)
+		assert.Equal(t, Int(i), last)
+		var err error
+		v, err = v.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, Int(i), v.Count())
+		if i%97 == 0 {
+			// popped vectors can still be appended to
+			grown := v.Conj(Keyword("x"))
+			e, _ := grown.Nth(i)
+			assert.Equal(t, Keyword("x"), e)
+			elems, err := AppendElements([]Value{}, v)
+			assert.NoError(t, err)
+			assert.Equal(t, full.Unbox().([]Value)[:i], elems)
+		}
+	}
+	_, err := v.Pop()
+	assert.Error(t, err)
+	e, _ := full.Nth(n - 1)
+	assert.Equal(t, Int(n-1), e)
+}
+
+// ifNode is a tiny AST for emitting nested ifs the way the compiler does, leaves are constant indexes
+type ifNode struct {
+	cond, then, els interface{}
+}
+
+func emitIf(c *CodeChunk, node interface{}) {
+	n, ok := node.(ifNode)
+	if !ok {
+		c.Append(OPLDC)
+		c.Append32(node.(int))
+		return
+	}
+	emitIf(c, n.cond)
+	brf := c.Length()
+	c.Append(OPBRF)
+	c.Append32(0)
+	emitIf(c, n.then)
+	jmp := c.Length()
+	c.Append(OPJMP)
+	c.Append32(0)
+	c.Update32(brf+1, c.Length()-brf)
+	if n.els == nil {
+		// a missing else pushes nil so both paths leave one value
+		emitIf(c, 0)
+	} else {
+		emitIf(c, n.els)
+	}
+	c.Update32(jmp+1, c.Length()-jmp)
+}
+
+func TestNestedIfStackBalance(t *testing.T) {
+	const nilc, truec, falsec, a, b, sentinel = 0, 1, 2, 3, 4, 5
+	consts := []Value{NIL, TRUE, FALSE, Keyword("a"), Keyword("b"), Keyword("sentinel")}
+	cases := []struct {
+		form interface{}
+		out  Value
+	}{
+		{ifNode{falsec, a, nil}, NIL},
+		{ifNode{truec, a, nil}, Keyword("a")},
+		{ifNode{truec, ifNode{falsec, a, nil}, b}, NIL},
+		{ifNode{falsec, ifNode{truec, a, nil}, b}, Keyword("b")},
+		{ifNode{ifNode{truec, falsec, truec}, a, ifNode{truec, b, nil}}, Keyword("b")},
+		{ifNode{ifNode{falsec, falsec, nil}, a, ifNode{nilc, b, nil}}, NIL},
+		{ifNode{truec, ifNode{truec, ifNode{falsec, a, nil}, b}, nil}, NIL},
+		{ifNode{truec, ifNode{truec, ifNode{truec, a, nil}, nil}, nil}, Keyword("a")},
+	}
+	for i, tc := range cases {
+		// the if runs between a sentinel and a POP of its value, RET returning the sentinel shows it pushed exactly one value
+		for _, popped := range []bool{false, true} {
+			c := NewCodeChunk(&consts)
+			c.SetMaxStack(8)
+			if popped {
+				emitIf(c, sentinel)
+			}
+			emitIf(c, tc.form)
+			if popped {
+				c.Append(OPPOP)
+			}
+			c.Append(OPRET)
+			assert.NoError(t, c.Verify(), "case %d", i)
+			out, err := NewFrame(c, nil).Run()
+			assert.NoError(t, err, "case %d", i)
+			if popped {
+				assert.Equal(t, Keyword("sentinel"), out, "case %d", i)
+			} else {
+				assert.Equal(t, tc.out, out, "case %d", i)
+			}
+		}
+	}
+}
+
+func TestIsTruthy(t *testing.T) {
+	for _, v := range []Value{NIL, FALSE, Boolean(false)} {
+		assert.False(t, IsTruthy(v), v.String())
+	}
+	for _, v := range []Value{TRUE, Int(0), Float(0), String(""), Char(0), Keyword("false"), EmptyList, ArrayVector{}, EmptyMap} {
+		assert.True(t, IsTruthy(v), v.String())
+	}
+}
+
+func TestInvokeArgsNotAliased(t *testing.T) {
+	var kept []Value
+	keep, err := NativeFnType.Wrap(func(vs []Value) (Value, error) {
+		kept = vs
+		return NIL, nil
+	})
+	assert.NoError(t, err)
+	plus, err := NativeFnType.Box(func(a int, b int) int { return a + b })
+	assert.NoError(t, err)
+
+	// (keep 1 2) followed by (plus 3 4) reusing the same stack slots
+	consts := []Value{keep, Int(1), Int(2), plus, Int(3), Int(4)}
+	c := NewCodeChunk(&consts)
+	c.SetMaxStack(3)
+	for _, call := range [][]int{{0, 1, 2}, {3, 4, 5}} {
+		for _, k := range call {
+			c.Append(OPLDC)
+			c.Append32(k)
+		}
+		c.Append(OPINV)
+		c.Append32(2)
+		if call[0] == 0 {
+			c.Append(OPPOP)
+		}
+	}
+	c.Append(OPRET)
+	out, err := NewFrame(c, nil).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, 7, out.Unbox())
+	assert.Equal(t, []Value{Int(1), Int(2)}, kept)
+
+	// the rest list of a variadic Func doesn't overwrite the caller's arguments
+	body := NewCodeChunk(&consts)
+	body.SetMaxStack(1)
+	body.Append(OPLDA)
+	body.Append32(1)
+	body.Append(OPRET)
+	variadic := MakeFunc(2, true, body)
+	args := []Value{Int(1), Int(2), Int(3)}
+	rest, err := variadic.Invoke(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "(2 3)", rest.String())
+	assert.Equal(t, []Value{Int(1), Int(2), Int(3)}, args)
+}
+
+func TestPrimitiveVector(t *testing.T) {
+	v, err := NewPrimitiveVector(IntKind, []Value{Int(1), Int(2), Int(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, v.Unbox())
+	assert.True(t, v.Equals(ArrayVector{Int(1), Int(2), Int(3)}))
+	assert.True(t, ArrayVector{Int(1), Int(2), Int(3)}.Equals(v))
+	assert.Equal(t, Hash(ArrayVector{Int(1), Int(2), Int(3)}), Hash(v))
+	assert.Equal(t, Int(2), v.ValueAtOr(Int(1), NIL))
+	assert.Equal(t, "[1 2 3]", v.String())
+
+	w, err := v.Conj(Int(4))
+	assert.NoError(t, err)
+	assert.Equal(t, "[1 2 3 4]", w.String())
+	assert.Equal(t, "[1 2 3]", v.String())
+	_, err = v.Conj(Float(1.5))
+	assert.Error(t, err)
+	// Cons can't fail so it falls back to a boxed vector
+	assert.Equal(t, "[1 2 3 :a]", v.Cons(Keyword("a")).String())
+
+	p, err := w.Pop()
+	assert.NoError(t, err)
+	grown, err := p.Conj(Int(9))
+	assert.NoError(t, err)
+	assert.Equal(t, "[1 2 3 9]", grown.String())
+	assert.Equal(t, "[1 2 3 4]", w.String())
+
+	f, err := NewPrimitiveVector(FloatKind, []Value{Int(1), Float(2.5)})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2.5}, f.Unbox())
+	elems, err := AppendElements(nil, f)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{Float(1), Float(2.5)}, elems)
+	assert.Nil(t, f.Rest().Next())
+
+	_, err = NewPrimitiveVector(IntKind, []Value{Float(1)})
+	assert.Error(t, err)
+}
+
+const benchSumSize = 1000000
+
+// BenchmarkSumVector sums a million Ints kept boxed in a vector and unboxed in a PrimitiveVector.
+// The PrimitiveVector needs a single allocation to build, reading it back boxes elements as they are summed.
+func BenchmarkSumVector(b *testing.B) {
+	elems := make([]Value, benchSumSize)
+	for i := range elems {
+		elems[i] = Int(i)
+	}
+	boxed := NewPersistentVector(elems)
+	prim, err := NewPrimitiveVector(IntKind, elems)
+	assert.NoError(b, err)
+	sum := func(b *testing.B, v interface {
+		Nth(int) (Value, bool)
+	}) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			acc := 0
+			for j := 0; j < benchSumSize; j++ {
+				e, _ := v.Nth(j)
+				acc += int(e.(Int))
+			}
+			if acc != benchSumSize*(benchSumSize-1)/2 {
+				b.Fatal("wrong sum", acc)
+			}
+		}
+	}
+	b.Run("PersistentVector", func(b *testing.B) { sum(b, boxed) })
+	b.Run("PrimitiveVector", func(b *testing.B) { sum(b, prim) })
+	b.Run("PrimitiveVector unboxed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			acc := 0
+			for _, x := range prim.Unbox().([]int) {
+				acc += x
+			}
+			if acc != benchSumSize*(benchSumSize-1)/2 {
+				b.Fatal("wrong sum", acc)
+			}
+		}
+	})
+}
+
+func TestMapEntry(t *testing.T) {
+	e := NewMapEntry(Keyword("a"), Int(1))
+	assert.Equal(t, Keyword("a"), e.Key())
+	assert.Equal(t, Int(1), e.Val())
+	assert.Equal(t, "[:a 1]", e.String())
+	assert.Equal(t, Int(2), e.Count())
+	assert.True(t, Equal(e, ArrayVector{Keyword("a"), Int(1)}))
+	assert.True(t, Equal(ArrayVector{Keyword("a"), Int(1)}, e))
+	assert.Equal(t, Hash(ArrayVector{Keyword("a"), Int(1)}), Hash(e))
+	assert.Equal(t, Int(1), Get(e, Int(1), NIL))
+
+	elems, err := AppendElements(nil, e)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{Keyword("a"), Int(1)}, elems)
+	assert.Equal(t, ArrayVector{Keyword("a"), Int(1), Int(2)}, e.Cons(Int(2)))
+}
+
+type beanInner struct {
+	Zip string
+}
+
+type beanOuter struct {
+	Name    string
+	Age     uint8
+	URL     string
+	Home    *beanInner
+	Work    beanInner
+	Tags    []string
+	Any     interface{}
+	hidden  int
+	Missing *beanInner
+}
+
+func TestBean(t *testing.T) {
+	b, ok := NewBean(&beanOuter{Name: "Ann", Age: 40, URL: "u", Home: &beanInner{Zip: "00-001"}, Work: beanInner{Zip: "x"}, Tags: []string{"a"}, Any: 1.5, hidden: 1})
+	assert.True(t, ok)
+	assert.Equal(t, Int(8), b.Count())
+	assert.Equal(t, String("Ann"), Get(b, Keyword("name"), NIL))
+	assert.Equal(t, Int(40), Get(b, Keyword("age"), NIL))
+	assert.Equal(t, String("u"), Get(b, Keyword("URL"), NIL))
+	assert.Equal(t, ArrayVector{String("a")}, Get(b, Keyword("tags"), NIL))
+	assert.Equal(t, Float(1.5), Get(b, Keyword("any"), NIL))
+	assert.Equal(t, NIL, Get(b, Keyword("missing"), Keyword("nf")))
+	assert.Equal(t, Keyword("nf"), Get(b, Keyword("hidden"), Keyword("nf")))
+	assert.False(t, b.Contains(Keyword("hidden")))
+
+	home := Get(b, Keyword("home"), NIL)
+	assert.IsType(t, &Bean{}, home)
+	assert.Equal(t, String("00-001"), Get(home, Keyword("zip"), NIL))
+	assert.Equal(t, String("x"), Get(Get(b, Keyword("work"), NIL), Keyword("zip"), NIL))
+	assert.True(t, Equal(home, NewMap([]Value{Keyword("zip"), String("00-001")})))
+	assert.Equal(t, `{:zip "00-001"}`, home.String())
+
+	v, err := b.Invoke([]Value{Keyword("name")})
+	assert.NoError(t, err)
+	assert.Equal(t, String("Ann"), v)
+
+	_, ok = NewBean(42)
+	assert.False(t, ok)
+	_, ok = NewBean((*beanInner)(nil))
+	assert.False(t, ok)
+}
+
+func TestRecordAssocDissoc(t *testing.T) {
+	point := NewRecordType("Point", []Keyword{"x", "y"})
+	p, err := point.New([]Value{Int(1), Int(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, "#Point{:x 1, :y 2}", p.String())
+	assert.Equal(t, "Point", TypeName(p))
+
+	moved := p.Assoc(Keyword("x"), Int(5))
+	assert.True(t, point.IsInstance(moved))
+	assert.Equal(t, Int(1), Get(p, Keyword("x"), NIL))
+	assert.Equal(t, Int(5), Get(moved, Keyword("x"), NIL))
+
+	extended := p.Assoc(Keyword("z"), Int(3))
+	assert.True(t, point.IsInstance(extended))
+	assert.Equal(t, Int(3), extended.Count())
+	assert.Equal(t, "#Point{:x 1, :y 2, :z 3}", extended.String())
+	assert.True(t, Equal(p, extended.Dissoc(Keyword("z"))))
+	assert.True(t, point.IsInstance(extended.Dissoc(Keyword("z"))))
+
+	// a record missing a field degrades to a plain map
+	m := extended.WithMeta(NewMap([]Value{Keyword("m"), TRUE})).(*Record).Dissoc(Keyword("x"))
+	assert.False(t, point.IsInstance(m))
+	assert.IsType(t, &ArrayMap{}, m)
+	assert.Equal(t, "{:y 2, :z 3}", m.String())
+	assert.Equal(t, TRUE, Get(m.(*ArrayMap).Meta(), Keyword("m"), NIL))
+
+	assert.False(t, Equal(p, NewMap([]Value{Keyword("x"), Int(1), Keyword("y"), Int(2)})))
+	assert.False(t, Equal(NewMap([]Value{Keyword("x"), Int(1), Keyword("y"), Int(2)}), p))
+	other, err := NewRecordType("Point", []Keyword{"x", "y"}).New([]Value{Int(1), Int(2)})
+	assert.NoError(t, err)
+	assert.False(t, Equal(p, other))
+
+	_, err = point.New([]Value{Int(1)})
+	assert.Error(t, err)
+}
+
+type goTypeCat struct{ Name string }
+type goTypeDog struct{ Name string }
+
+func TestGoType(t *testing.T) {
+	cat := RegisterGoType("Cat", goTypeCat{})
+	dog := RegisterGoType("Dog", &goTypeDog{})
+	assert.Same(t, cat, RegisterGoType("Cat", &goTypeCat{}))
+	assert.NotEqual(t, cat, dog)
+
+	assert.True(t, cat.IsInstance(NewBoxed(goTypeCat{})))
+	assert.True(t, cat.IsInstance(NewBoxed(&goTypeCat{})))
+	assert.False(t, cat.IsInstance(NewBoxed(goTypeDog{})))
+	assert.False(t, dog.IsInstance(String("dog")))
+
+	assert.Equal(t, "Dog", TypeName(NewBoxed(&goTypeDog{})))
+	assert.Equal(t, "Boxed", TypeName(NewBoxed(struct{}{})))
+	assert.Equal(t, "Int", TypeName(Int(1)))
+}
+
+func TestJoinFutures(t *testing.T) {
+	// each future waits for its gate, so the order they complete in is up to the test
+	gated := func(gate chan struct{}, v Value, err error) *Future {
+		fn, _ := NativeFnType.Wrap(func([]Value) (Value, error) {
+			<-gate
+			return v, err
+		})
+		return NewFuture(fn.(Fn))
+	}
+	before := runtime.NumGoroutine()
+	gates := []chan struct{}{make(chan struct{}), make(chan struct{}), make(chan struct{})}
+	fs := []*Future{gated(gates[0], Int(1), nil), gated(gates[1], Int(2), nil), gated(gates[2], Int(3), nil)}
+	close(gates[2])
+	close(gates[0])
+	assert.False(t, fs[1].IsRealized())
+	close(gates[1])
+	out, err := JoinFutures(fs)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{Int(1), Int(2), Int(3)}, out)
+
+	// a failure is reported without waiting for the futures still running
+	slow := make(chan struct{})
+	failed := make(chan struct{})
+	fs = []*Future{gated(slow, Int(1), nil), gated(failed, NIL, NewExecutionError("boom"))}
+	close(failed)
+	_, err = JoinFutures(fs)
+	assert.EqualError(t, err, "ExecutionError: boom")
+	assert.False(t, fs[0].IsRealized())
+	close(slow)
+	v, err := fs[0].Force()
+	assert.NoError(t, err)
+	assert.Equal(t, Int(1), v)
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
+
+func TestFloatString(t *testing.T) {
+	cases := map[Float]string{
+		0.1:                         "0.1",
+		0.30000000000000004:         "0.30000000000000004",
+		100:                         "100.0",
+		-0.5:                        "-0.5",
+		1234567:                     "1234567.0",
+		12345678.9:                  "1.23456789E7",
+		1e21:                        "1.0E21",
+		0.001:                       "0.001",
+		-1.25e-8:                    "-1.25E-8",
+		5e-324:                      "5.0E-324",
+		1.7976931348623157e308:      "1.7976931348623157E308",
+		Float(math.Inf(1)):          "##Inf",
+		Float(math.Inf(-1)):         "##-Inf",
+		Float(math.Copysign(0, -1)): "-0.0",
+	}
+	for f, s := range cases {
+		assert.Equal(t, s, f.String())
+	}
+	assert.Equal(t, "##NaN", Float(math.NaN()).String())
+}
+
+func TestFrameStackBounds(t *testing.T) {
+	consts := []Value{Int(1)}
+	pushes := func(maxStack int, n int) *CodeChunk {
+		c := NewCodeChunk(&consts)
+		for i := 0; i < n; i++ {
+			c.Append(OPLDC)
+			c.Append32(0)
+		}
+		c.Append(OPRET)
+		c.SetMaxStack(maxStack)
+		return c
+	}
+	for _, size := range []int{4, 64} {
+		assert.NotPanics(t, func() {
+			out, err := NewFrame(pushes(size, size), nil).Run()
+			assert.NoError(t, err, "size %d", size)
+			assert.Equal(t, Int(1), out)
+
+			_, err = NewFrame(pushes(size, size+1), nil).Run()
+			assert.Error(t, err, "size %d", size)
+			assert.Contains(t, err.Error(), "stack overflow")
+		})
+	}
+
+	f := NewFrame(pushes(2, 0), nil)
+	assert.NoError(t, f.Push(Int(1)))
+	_, err := f.Nth(-1)
+	assert.Error(t, err)
+	_, err = f.Nth(1)
+	assert.Error(t, err)
+	_, err = f.Mult(-1, 1)
+	assert.Error(t, err)
+	_, err = f.Mult(0, 2)
+	assert.Error(t, err)
+	assert.Error(t, f.Drop(-1))
+	assert.Error(t, f.Drop(2))
+	assert.NoError(t, f.Drop(1))
+}